@@ -1,6 +1,8 @@
 $previous_env = $env:GOOS
 $env:GOOS = "linux"
 
-go build -o ./build/gameserver
+go build -o ./build/gameserver ./cmd/gameserver
+go build -o ./build/matchmaking ./cmd/matchmaking
+go build -o ./build/all ./cmd/all
 
-$env:GOOS = $previous_env
\ No newline at end of file
+$env:GOOS = $previous_env
@@ -0,0 +1,77 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package main implements the entry point for the combined game server and matchmaking server, for development, in
+// main().
+package main
+
+import (
+	"github.com/6a/blade-ii-game-server/internal/admin"
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/app"
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/matchmaking"
+	"github.com/6a/blade-ii-game-server/internal/routes"
+	"github.com/6a/blade-ii-game-server/internal/session"
+)
+
+func main() {
+	store := app.Init()
+
+	// Create a session registry shared by both servers, so that a user can't be connected to both at once.
+	sessions := session.NewRegistry()
+
+	// Read the addresses for each server. If they are the same, both servers share a single listener.
+	gameServerAddress := app.GameServerAddress()
+	matchmakingAddress := app.MatchmakingAddress()
+
+	// Create and initialise an instance of the game server, and post match events to the event webhook, if one is
+	// configured.
+	gameServer := game.NewServer(store, sessions, app.Maintenance())
+	gameServer.StartEventWebhook()
+
+	// Set up the game server http handler, on its own mux.
+	gameServerMux := app.NewMux()
+	routes.SetupGameServer(gameServerMux, gameServer, store)
+
+	// Create and initialise instance of the matchmaking server, sharing the game server's capacity gauge.
+	matchmakingServer := matchmaking.NewServer(store, gameServer.Capacity(), sessions, app.Maintenance())
+
+	// Periodically report the load on both servers to the API, for the server status page.
+	status := func() apiinterface.ServerStatus {
+		return apiinterface.ServerStatus{
+			Queued:  matchmakingServer.QueuedCount(),
+			InMatch: gameServer.PlayerCount(),
+			Matches: gameServer.MatchCount(),
+		}
+	}
+
+	apiinterface.StartStatusReporter("all", status)
+
+	// Serve the admin console on its own address, if an admin token is configured.
+	console := admin.NewConsole("all", status)
+	console.AddTarget("game", gameServer.SendCommand)
+	console.AddTarget("matchmaking", matchmakingServer.SendCommand)
+	if console.Enabled() {
+		adminMux := app.NewMux()
+		routes.SetupAdmin(adminMux, console)
+
+		go app.Serve("Admin console", app.AdminAddress(), adminMux)
+	}
+
+	// Set up the matchmaking server and player stats http handlers. If the servers share an address, the game server mux is reused.
+	// Otherwise, the matchmaking server gets its own mux, and is served on its own address in a separate goroutine.
+	if matchmakingAddress == gameServerAddress {
+		routes.SetupMatchMaking(gameServerMux, matchmakingServer, store)
+		routes.SetupStats(gameServerMux, store)
+	} else {
+		matchmakingMux := app.NewMux()
+		routes.SetupMatchMaking(matchmakingMux, matchmakingServer, store)
+		routes.SetupStats(matchmakingMux, store)
+
+		go app.Serve("Matchmaking server", matchmakingAddress, matchmakingMux)
+	}
+
+	app.Serve("Gameserver", gameServerAddress, gameServerMux)
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package main implements the entry point for the standalone game server, in main().
+//
+// The standalone matchmaking server can't observe this server's capacity, or its connections - so clients are
+// refused when the server is full rather than kept in the queue, and duplicate logins across the two servers are not
+// detected (see the documentation for cmd/matchmaking).
+package main
+
+import (
+	"github.com/6a/blade-ii-game-server/internal/admin"
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/app"
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/routes"
+	"github.com/6a/blade-ii-game-server/internal/session"
+)
+
+func main() {
+	store := app.Init()
+
+	// Create a session registry. The matchmaking server runs in another process, so only connections to this server
+	// are tracked.
+	sessions := session.NewRegistry()
+
+	// Create and initialise an instance of the game server, and post match events to the event webhook, if one is
+	// configured.
+	gameServer := game.NewServer(store, sessions, app.Maintenance())
+	gameServer.StartEventWebhook()
+
+	// Periodically report the load on the game server to the API, for the server status page.
+	status := func() apiinterface.ServerStatus {
+		return apiinterface.ServerStatus{
+			InMatch: gameServer.PlayerCount(),
+			Matches: gameServer.MatchCount(),
+		}
+	}
+
+	apiinterface.StartStatusReporter("gameserver", status)
+
+	// Serve the admin console on its own address, if an admin token is configured.
+	console := admin.NewConsole("gameserver", status)
+	console.AddTarget("game", gameServer.SendCommand)
+	if console.Enabled() {
+		adminMux := app.NewMux()
+		routes.SetupAdmin(adminMux, console)
+
+		go app.Serve("Admin console", app.AdminAddress(), adminMux)
+	}
+
+	// Set up the game server http handler, and start serving.
+	mux := app.NewMux()
+	routes.SetupGameServer(mux, gameServer, store)
+
+	app.Serve("Gameserver", app.GameServerAddress(), mux)
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package main implements a load testing tool for the matchmaking and game servers, in main().
+//
+// The tool spins up a number of simulated players, each of which joins matchmaking, accepts the match that it is
+// paired into, joins the match on the game server, and plays random legal moves until the match ends. The latency of
+// each stage, and any errors, are reported once every player has finished.
+//
+// The servers must be built with the "insecure" build tag (go build -tags insecure), and be running with test auth
+// enabled (the "b2_test_auth_bypass" and "b2_insecure_test_mode" environment variables) or in offline mode (the
+// "b2_offline_mode" and "b2_insecure_test_mode" environment variables), so that the generated credentials are
+// accepted. As every simulated player connects from the same IP address, the limit on connections per IP address (the
+// "max_connections_per_ip" environment variable) must also be raised or disabled for anything more than a handful of
+// players.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// config is the configuration for a load test.
+type config struct {
+
+	// The number of players to simulate, and the number of the first player (so that several instances of the tool can
+	// be run against the same servers without their players colliding).
+	players     int
+	firstPlayer int
+
+	// The websocket URLs for the matchmaking and game servers.
+	matchmakingURL string
+	gameURL        string
+
+	// The delay between starting each player.
+	rampInterval time.Duration
+
+	// The maximum time that each player waits before making a move (the actual wait is random, up to this value).
+	thinkTime time.Duration
+
+	// The maximum time that each player has to finish their match.
+	timeout time.Duration
+
+	// Whether to print each player's error as it occurs.
+	verbose bool
+}
+
+func main() {
+	var cfg config
+	flag.IntVar(&cfg.players, "players", 100, "number of players to simulate (should be even, as players are paired)")
+	flag.IntVar(&cfg.firstPlayer, "first", 0, "number of the first simulated player")
+	flag.StringVar(&cfg.matchmakingURL, "matchmaking", "ws://localhost:20000/matchmaking", "matchmaking server websocket URL")
+	flag.StringVar(&cfg.gameURL, "game", "ws://localhost:20000/game", "game server websocket URL")
+	flag.DurationVar(&cfg.rampInterval, "ramp", 10*time.Millisecond, "delay between starting each player")
+	flag.DurationVar(&cfg.thinkTime, "think", 500*time.Millisecond, "maximum random delay before each move")
+	flag.DurationVar(&cfg.timeout, "timeout", 10*time.Minute, "maximum time for each player to finish their match")
+	flag.BoolVar(&cfg.verbose, "v", false, "print each player's error as it occurs")
+	flag.Parse()
+
+	if cfg.players%2 != 0 {
+		fmt.Fprintln(os.Stderr, "Warning: an odd number of players was specified, so one of them will not be paired")
+	}
+
+	rand.Seed(time.Now().UnixNano())
+
+	results := newReport()
+	sentMoves := &sync.Map{}
+	start := time.Now()
+
+	// Start each player, and wait for them all to finish.
+	var wg sync.WaitGroup
+	for index := 0; index < cfg.players; index++ {
+		wg.Add(1)
+
+		p := &player{
+			publicID:  teststore.PublicIDPrefix + strconv.Itoa(cfg.firstPlayer+index),
+			config:    &cfg,
+			report:    results,
+			sentMoves: sentMoves,
+		}
+
+		go func() {
+			defer wg.Done()
+			p.run()
+		}()
+
+		time.Sleep(cfg.rampInterval)
+	}
+
+	wg.Wait()
+
+	results.write(os.Stdout, cfg.players, time.Since(start))
+}
@@ -0,0 +1,386 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package main implements a load testing tool for the matchmaking and game servers, in main().
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/gorilla/websocket"
+)
+
+const (
+
+	// authToken is the auth token sent by every simulated player - the test store accepts any non-empty token.
+	authToken = "loadtest"
+
+	// moveSequenceDelimiter separates the sequence number from the rest of a serialised move.
+	moveSequenceDelimiter = "|"
+
+	// payloadDelimiter separates the instruction from the data in match data messages and moves.
+	payloadDelimiter = ":"
+
+	// dataDelimiter separates the sections of the data in match data messages.
+	dataDelimiter = "."
+)
+
+// Kinds of error recorded by the simulated players.
+const (
+	errorDial      = "dial"
+	errorConnRead  = "connection read"
+	errorConnWrite = "connection write"
+	errorRejected  = "rejected by server"
+	errorProtocol  = "unexpected message"
+	errorDesync    = "state desync"
+)
+
+// failure is an error that occurred while simulating a player, along with the kind of error, for the report.
+type failure struct {
+	kind string
+	err  error
+}
+
+// Error returns the string representation of the failure.
+func (f *failure) Error() string {
+	return f.kind + ": " + f.err.Error()
+}
+
+// fail creates and returns a new failure of the specified kind.
+func fail(kind string, format string, args ...interface{}) error {
+	return &failure{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// player is a single simulated player, that joins matchmaking, and then plays the match that it is paired into.
+type player struct {
+
+	// The public ID of the player, which determines their test account.
+	publicID string
+
+	// The configuration for the load test.
+	config *config
+
+	// The report to record results to.
+	report *report
+
+	// The time at which each move was sent by each player, keyed by public ID and move sequence number, so that the
+	// opponent can record how long it took to be relayed.
+	sentMoves *sync.Map
+
+	// The deadline for the player to finish their match.
+	deadline time.Time
+
+	// The time at which the most recent auth request was sent.
+	authSentTime time.Time
+}
+
+// run simulates the player from joining matchmaking to the end of their match, recording any error to the report.
+func (p *player) run() {
+	p.deadline = time.Now().Add(p.config.timeout)
+
+	matchID, err := p.matchmake()
+	if err == nil {
+		err = p.play(matchID)
+	}
+
+	if err != nil {
+		var f *failure
+		if errors.As(err, &f) {
+			p.report.recordError(f.kind)
+		} else {
+			p.report.recordError(err.Error())
+		}
+
+		if p.config.verbose {
+			fmt.Printf("Player [%s] failed: %v\n", p.publicID, err)
+		}
+	}
+}
+
+// matchmake connects to the matchmaking server, accepts the first match that is found, and returns its ID once it is
+// confirmed.
+func (p *player) matchmake() (matchID uint64, err error) {
+	conn, err := p.connect(p.config.matchmakingURL)
+	if err != nil {
+		return matchID, err
+	}
+
+	defer conn.Close()
+
+	for {
+		payload, err := p.receive(conn)
+		if err != nil {
+			return matchID, err
+		}
+
+		switch payload.Code {
+		case protocol.WSCAuthSuccess:
+			p.recordAuth()
+		case protocol.WSCJoinedQueue, protocol.WSCOpponentAccepted, protocol.WSCOpponentDidNotAccept, protocol.WSCMatchCreationFailed, protocol.WSCServerAnnouncement:
+
+			// Informational - keep waiting for a match.
+		case protocol.WSCMatchMakingMatchFound:
+			if err := p.send(conn, protocol.WSCMatchMakingAccept, ""); err != nil {
+				return matchID, err
+			}
+		case protocol.WSCMatchConfirmed:
+
+			// The match ID may be followed by the opponent's region.
+			matchID, err = strconv.ParseUint(strings.SplitN(payload.Message, payloadDelimiter, 2)[0], 10, 64)
+			if err != nil {
+				return matchID, fail(errorProtocol, "malformed match confirmation [%s]", payload.Message)
+			}
+
+			return matchID, nil
+		default:
+			return matchID, fail(errorRejected, "matchmaking code [%d]: %s", payload.Code, payload.Message)
+		}
+	}
+}
+
+// play connects to the game server, joins the specified match, and plays random legal moves until it ends.
+func (p *player) play(matchID uint64) error {
+	conn, err := p.connect(p.config.gameURL)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	var rules *game.Rules
+	var self, opponent game.Player
+	var opponentPublicID string
+	var sequence uint64
+	var matchIDSent time.Time
+
+	for {
+		payload, err := p.receive(conn)
+		if err != nil {
+			return err
+		}
+
+		switch payload.Code {
+		case protocol.WSCAuthSuccess:
+			p.recordAuth()
+
+			matchIDSent = time.Now()
+			if err := p.send(conn, protocol.WSCMatchID, strconv.FormatUint(matchID, 10)); err != nil {
+				return err
+			}
+		case protocol.WSCMatchIDConfirmed:
+			p.report.recordLatency(latencyMatchID, time.Since(matchIDSent))
+		case protocol.WSCAuthReceived, protocol.WSCMatchIDReceived, protocol.WSCMatchJoined, protocol.WSCMatchRelayMessage, protocol.WSCServerAnnouncement:
+
+			// Informational.
+		case protocol.WSCMatchData:
+			instruction, data := splitPayload(payload.Message)
+
+			switch instruction {
+			case game.InstructionCards:
+
+				// Format: <player>.<player 1 deck>.<player 2 deck>
+				sections := strings.SplitN(data, dataDelimiter, 2)
+				cards, err := game.DeserializeDecks(sections[len(sections)-1])
+				if len(sections) != 2 || err != nil {
+					return fail(errorProtocol, "malformed card data [%s]", data)
+				}
+
+				self, opponent = game.Player1, game.Player2
+				if sections[0] == "1" {
+					self, opponent = game.Player2, game.Player1
+				}
+
+				rules = game.NewRules(cards)
+				if err := p.send(conn, protocol.WSCMatchClientReady, ""); err != nil {
+					return err
+				}
+			case game.InstructionOpponentData:
+
+				// Format: <display name>.<public ID>.<avatar> - the display name may contain the delimiter.
+				sections := strings.Split(data, dataDelimiter)
+				if len(sections) >= 3 {
+					opponentPublicID = sections[len(sections)-2]
+				}
+			case game.InstructionAutoPlayed:
+
+				// Format: <player>.<strikes>.<move>
+				sections := strings.SplitN(data, dataDelimiter, 3)
+				if len(sections) != 3 || rules == nil {
+					return fail(errorProtocol, "malformed auto-played move [%s]", data)
+				}
+
+				autoPlayed := game.Player1
+				if sections[0] == "1" {
+					autoPlayed = game.Player2
+				}
+
+				if err := applyMove(rules, autoPlayed, sections[2]); err != nil {
+					return err
+				}
+			}
+		case protocol.WSCMatchMove:
+			if rules == nil {
+				return fail(errorProtocol, "move received before card data")
+			}
+
+			// Forwarded moves are prefixed with a sequence number, which is acknowledged.
+			sections := strings.SplitN(payload.Message, moveSequenceDelimiter, 2)
+			if len(sections) != 2 {
+				return fail(errorProtocol, "move without a sequence number [%s]", payload.Message)
+			}
+
+			if err := p.send(conn, protocol.WSCMatchMoveAck, sections[0]); err != nil {
+				return err
+			}
+
+			if sent, ok := p.sentMoves.Load(opponentPublicID + moveSequenceDelimiter + sections[0]); ok {
+				p.report.recordLatency(latencyMoveRelay, time.Since(sent.(time.Time)))
+				p.sentMoves.Delete(opponentPublicID + moveSequenceDelimiter + sections[0])
+			}
+
+			if err := applyMove(rules, opponent, sections[1]); err != nil {
+				return err
+			}
+		case protocol.WSCMatchWin:
+			p.report.recordResult("win")
+			return nil
+		case protocol.WSCMatchLoss:
+			p.report.recordResult("loss")
+			return nil
+		case protocol.WSCMatchDraw:
+			p.report.recordResult("draw")
+			return nil
+		case protocol.WSCMatchTimeOut:
+			p.report.recordResult("timed out")
+			return nil
+		case protocol.WSCMatchMutualTimeout:
+			p.report.recordResult("mutual timeout")
+			return nil
+		case protocol.WSCMatchForfeit:
+			p.report.recordResult("opponent forfeited")
+			return nil
+		case protocol.WSCMatchNoContest:
+			p.report.recordResult("no contest")
+			return nil
+		default:
+			return fail(errorRejected, "game code [%d]: %s", payload.Code, payload.Message)
+		}
+
+		// Make moves for as long as the match is waiting for one from this player (a blast keeps the turn). If there
+		// are no legal moves, the player waits for the server to end the match (by timing them out).
+		for rules != nil && rules.ExpectsMove(self) {
+			moves := rules.LegalMoves(self)
+			if len(moves) == 0 {
+				break
+			}
+
+			if p.config.thinkTime > 0 {
+				time.Sleep(time.Duration(rand.Int63n(int64(p.config.thinkTime))))
+			}
+
+			move := moves[rand.Intn(len(moves))]
+			rules.Apply(self, move)
+			sequence++
+
+			sequenceString := strconv.FormatUint(sequence, 10)
+			p.sentMoves.Store(p.publicID+moveSequenceDelimiter+sequenceString, time.Now())
+
+			if err := p.send(conn, protocol.WSCMatchMove, sequenceString+moveSequenceDelimiter+moveString(move)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// connect opens a websocket connection to the specified URL, and sends an auth request for the player. The result of
+// the auth request is left for the caller to read.
+func (p *player) connect(url string) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, fail(errorDial, "%v", err)
+	}
+
+	conn.SetReadDeadline(p.deadline)
+
+	auth := protocol.Payload{
+		Code:    protocol.WSCAuthRequest,
+		Message: p.publicID + payloadDelimiter + authToken,
+		Version: protocol.CurrentVersion,
+	}
+
+	p.authSentTime = time.Now()
+	if err := conn.WriteMessage(websocket.TextMessage, protocol.NewMessageFromPayload(protocol.WSMTText, auth).GetPayloadBytes()); err != nil {
+		conn.Close()
+		return nil, fail(errorConnWrite, "%v", err)
+	}
+
+	return conn, nil
+}
+
+// recordAuth records the latency of the most recent auth request.
+func (p *player) recordAuth() {
+	p.report.recordLatency(latencyAuth, time.Since(p.authSentTime))
+}
+
+// send sends a message with the specified code and message to the server.
+func (p *player) send(conn *websocket.Conn, code protocol.B2Code, message string) error {
+	if err := conn.WriteMessage(websocket.TextMessage, protocol.NewMessage(protocol.WSMTText, code, message).GetPayloadBytes()); err != nil {
+		return fail(errorConnWrite, "%v", err)
+	}
+
+	return nil
+}
+
+// receive waits for the next message from the server, and returns its payload.
+func (p *player) receive(conn *websocket.Conn) (protocol.Payload, error) {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return protocol.Payload{}, fail(errorConnRead, "%v", err)
+	}
+
+	return protocol.NewPayloadFromBytes(data), nil
+}
+
+// splitPayload splits a match data message into the instruction, and the data.
+//
+// Format: <instruction><delim><data>
+func splitPayload(message string) (instruction game.B2MatchInstruction, data string) {
+	sections := strings.SplitN(message, payloadDelimiter, 2)
+	value, _ := strconv.Atoi(sections[0])
+	if len(sections) == 2 {
+		data = sections[1]
+	}
+
+	return game.B2MatchInstruction(value), data
+}
+
+// moveString returns the serialised form of the specified move.
+//
+// Format: <instruction><delim><payload>
+func moveString(move game.Move) string {
+	return strconv.Itoa(int(move.Instruction)) + payloadDelimiter + move.Payload
+}
+
+// applyMove parses the specified serialised move, and applies it for the specified player. Returns an error if the move
+// can't be parsed, or is not valid - which means that the player's view of the match no longer matches the server's.
+func applyMove(rules *game.Rules, player game.Player, serialised string) error {
+	move, err := game.MoveFromString(serialised)
+	if err != nil {
+		return fail(errorProtocol, "malformed move [%s]: %v", serialised, err)
+	}
+
+	if !rules.Apply(player, move) {
+		return fail(errorDesync, "move [%s] is not valid for player [%d]", serialised, player)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package main implements a load testing tool for the matchmaking and game servers, in main().
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency series recorded by the simulated players.
+const (
+	latencyAuth      = "auth"
+	latencyMatchID   = "match id"
+	latencyMoveRelay = "move relay"
+)
+
+// latencySeries is the order in which the latency series are reported.
+var latencySeries = []string{latencyAuth, latencyMatchID, latencyMoveRelay}
+
+// report collects the results from all of the simulated players. Safe for concurrent use.
+type report struct {
+
+	// The latencies recorded for each series.
+	latencies map[string][]time.Duration
+
+	// The number of errors of each kind.
+	errors map[string]int
+
+	// The number of match results received, by result, and the number of players that finished a match.
+	results  map[string]int
+	finished int
+
+	// Mutex lock to protect the above.
+	lock sync.Mutex
+}
+
+// newReport creates and returns a pointer to a new, empty report.
+func newReport() *report {
+	return &report{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		results:   make(map[string]int),
+	}
+}
+
+// recordLatency records a latency sample for the specified series.
+func (r *report) recordLatency(series string, latency time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.latencies[series] = append(r.latencies[series], latency)
+}
+
+// recordError records an error of the specified kind.
+func (r *report) recordError(kind string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.errors[kind]++
+}
+
+// recordResult records a player finishing a match with the specified result.
+func (r *report) recordResult(result string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.results[result]++
+	r.finished++
+}
+
+// percentile returns the specified percentile (0 to 1) of the specified samples, which must be sorted.
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	index := int(math.Ceil(p*float64(len(samples)))) - 1
+	if index < 0 {
+		index = 0
+	}
+
+	return samples[index]
+}
+
+// milliseconds formats the specified duration as a number of milliseconds, to one decimal place.
+func milliseconds(duration time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(duration)/float64(time.Millisecond))
+}
+
+// write writes the report to the specified writer, in the following format:
+//
+//	Blade II Online load test report
+//	Players:   <players>
+//	Duration:  <duration>
+//	Finished:  <players that finished a match> (<result>: <count>, ...)
+//	Errors:    <total>
+//	  <kind>: <count>
+//	Latency (ms)    count     p50     p90     p99     max
+//	  <series>      ...
+func (r *report) write(w io.Writer, players int, duration time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fmt.Fprintln(w, "Blade II Online load test report")
+	fmt.Fprintf(w, "Players:   %d\n", players)
+	fmt.Fprintf(w, "Duration:  %s\n", duration.Round(time.Millisecond))
+
+	fmt.Fprintf(w, "Finished:  %d", r.finished)
+	for index, result := range sortedKeys(r.results) {
+		separator := ", "
+		if index == 0 {
+			separator = " ("
+		}
+
+		fmt.Fprintf(w, "%s%s: %d", separator, result, r.results[result])
+	}
+
+	if len(r.results) > 0 {
+		fmt.Fprint(w, ")")
+	}
+
+	fmt.Fprintln(w)
+
+	total := 0
+	for _, count := range r.errors {
+		total += count
+	}
+
+	fmt.Fprintf(w, "Errors:    %d\n", total)
+	for _, kind := range sortedKeys(r.errors) {
+		fmt.Fprintf(w, "  %s: %d\n", kind, r.errors[kind])
+	}
+
+	fmt.Fprintf(w, "%-14s %7s %7s %7s %7s %7s\n", "Latency (ms)", "count", "p50", "p90", "p99", "max")
+	for _, series := range latencySeries {
+		samples := append([]time.Duration(nil), r.latencies[series]...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+		fmt.Fprintf(w, "  %-12s %7d %7s %7s %7s %7s\n", series, len(samples), milliseconds(percentile(samples, 0.5)), milliseconds(percentile(samples, 0.9)), milliseconds(percentile(samples, 0.99)), milliseconds(percentile(samples, 1)))
+	}
+}
+
+// sortedKeys returns the keys of the specified map, in ascending order.
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package main implements the entry point for the standalone matchmaking server, in main().
+//
+// When the servers run in separate processes, they share nothing but the database, which has two consequences that
+// the combined server (cmd/all) doesn't have:
+//
+// - Matchmaking never pauses while the game server is full, as the game server's capacity can't be observed from
+// this process. Pairs are still made, and the game server refuses the clients of any match that it has no room for
+// (with WSCServerAtCapacity).
+//
+// - Duplicate logins are only detected within each server. A user can be in the matchmaking queue and in a match at
+// the same time, and neither connection is evicted or refused (see session.Registry).
+package main
+
+import (
+	"github.com/6a/blade-ii-game-server/internal/admin"
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/app"
+	"github.com/6a/blade-ii-game-server/internal/matchmaking"
+	"github.com/6a/blade-ii-game-server/internal/routes"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/pkg/capacity"
+)
+
+func main() {
+	store := app.Init()
+
+	// Create a session registry. The game server runs in another process, so only connections to this server are
+	// tracked - duplicate logins across the two servers are not detected (see the package documentation).
+	sessions := session.NewRegistry()
+
+	// Create and initialise an instance of the matchmaking server. The game server runs in another process, so its
+	// capacity can't be observed from here - an unlimited gauge is used instead, so matchmaking never pauses, and the
+	// game server refuses any matches that it doesn't have room for (see the package documentation).
+	matchmakingServer := matchmaking.NewServer(store, capacity.NewGauge(0), sessions, app.Maintenance())
+
+	// Periodically report the size of the queue to the API, for the server status page.
+	status := func() apiinterface.ServerStatus {
+		return apiinterface.ServerStatus{
+			Queued: matchmakingServer.QueuedCount(),
+		}
+	}
+
+	apiinterface.StartStatusReporter("matchmaking", status)
+
+	// Serve the admin console on its own address, if an admin token is configured.
+	console := admin.NewConsole("matchmaking", status)
+	console.AddTarget("matchmaking", matchmakingServer.SendCommand)
+	if console.Enabled() {
+		adminMux := app.NewMux()
+		routes.SetupAdmin(adminMux, console)
+
+		go app.Serve("Admin console", app.AdminAddress(), adminMux)
+	}
+
+	// Set up the matchmaking server and player stats http handlers, and start serving.
+	mux := app.NewMux()
+	routes.SetupMatchMaking(mux, matchmakingServer, store)
+	routes.SetupStats(mux, store)
+
+	app.Serve("Matchmaking server", app.MatchmakingAddress(), mux)
+}
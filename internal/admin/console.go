@@ -0,0 +1,258 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package admin implements the admin console - a websocket endpoint through which an operator can send commands to the
+// servers, and watch their status. It is kept separate from the player-facing endpoints, with its own credentials.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/connection"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/gorilla/websocket"
+)
+
+const (
+
+	// authTimeOut is the maximum amount of time to wait for the auth message after a websocket connection is made.
+	authTimeOut = time.Second * 10
+
+	// maximumMessageSize is the maximum size (in bytes) of a message from an operator.
+	maximumMessageSize = 4096
+
+	// resultBufferSize is the size of the buffer for command results. Results that don't fit are dropped.
+	resultBufferSize = 64
+
+	// defaultStatusPeriod is the default period between status messages.
+	defaultStatusPeriod = time.Second * 5
+
+	// commandDelimiter separates the sections of command and result messages.
+	commandDelimiter = ":"
+)
+
+// statusPeriod is the period between status messages sent to each operator. Configured via the "admin_status_period"
+// environment variable.
+var statusPeriod = envvar.Duration("admin_status_period", defaultStatusPeriod)
+
+// Target accepts commands for a server, returning false if the command could not be queued.
+type Target func(command protocol.Command) bool
+
+// Console handles connections from operators, forwarding their commands to the servers, and streaming back the
+// results along with the status of the servers.
+type Console struct {
+
+	// The token that operators must present to connect. Empty if the console is disabled.
+	token string
+
+	// The servers that commands can be sent to, keyed by name.
+	targets map[string]Target
+
+	// The name of the server binary, and a function that returns the current status of the servers.
+	server string
+	status func() apiinterface.ServerStatus
+}
+
+// NewConsole creates and returns a pointer to a new admin console, that reports the status returned by the specified
+// function, under the specified server name. The admin token is configured via the "admin_token" environment
+// variable - if it is not set, the console is disabled.
+func NewConsole(server string, status func() apiinterface.ServerStatus) *Console {
+	return &Console{
+		token:   envvar.String("admin_token", ""),
+		targets: make(map[string]Target),
+		server:  server,
+		status:  status,
+	}
+}
+
+// AddTarget registers a server that commands can be sent to, under the specified name.
+func (console *Console) AddTarget(name string, target Target) {
+	console.targets[name] = target
+}
+
+// Enabled returns true if an admin token is configured.
+func (console *Console) Enabled() bool {
+	return console.token != ""
+}
+
+// HandleConnection waits for the new connection to authenticate with the admin token, and then forwards commands from
+// it to the servers until it disconnects, sending back command results and periodic status messages.
+//
+// Auth format: <admin token>
+//
+// Command format: <target><delim><command type><delim><data>
+//
+// Result format: <command type><delim><ok|error><delim><message>
+func (console *Console) HandleConnection(wsconn *websocket.Conn) {
+	wsconn.SetReadLimit(maximumMessageSize)
+
+	// Wait for the auth message, and reject the connection unless it contains the admin token.
+	wsconn.SetReadDeadline(time.Now().Add(authTimeOut))
+	payload, err := readPayload(wsconn)
+	if err != nil || payload.Code != protocol.WSCAuthRequest || !console.checkToken(payload.Message) {
+		log.Printf("Rejected admin connection from [%s]", wsconn.RemoteAddr())
+		discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthBadCredentials, "Admin auth failed"))
+		return
+	}
+
+	wsconn.SetReadDeadline(time.Time{})
+	log.Printf("Admin connected from [%s]", wsconn.RemoteAddr())
+
+	// Inform the operator that auth was successful, along with the names of the servers that they can send commands to.
+	connection.WriteText(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthSuccess, strings.Join(console.targetNames(), commandDelimiter)))
+
+	// Start writing results and status messages, and stop when the operator disconnects.
+	results := make(chan protocol.CommandResult, resultBufferSize)
+	done := make(chan struct{})
+	go console.writePump(wsconn, results, done)
+	defer close(done)
+
+	// Read commands until the operator disconnects.
+	for {
+		payload, err := readPayload(wsconn)
+		if err != nil {
+			log.Printf("Admin from [%s] disconnected: %s", wsconn.RemoteAddr(), err.Error())
+			return
+		}
+
+		command, target, err := console.parseCommand(payload)
+		if err != nil {
+			reply(results, command.Type, false, err.Error())
+			continue
+		}
+
+		command.Result = results
+		if !target(command) {
+			reply(results, command.Type, false, "Command queue is full")
+			continue
+		}
+
+		log.Printf("Admin from [%s] sent command [%d] with data [%s]", wsconn.RemoteAddr(), command.Type, command.Data)
+	}
+}
+
+// checkToken returns true if the specified token matches the admin token, comparing in constant time.
+func (console *Console) checkToken(token string) bool {
+	return console.Enabled() && subtle.ConstantTimeCompare([]byte(token), []byte(console.token)) == 1
+}
+
+// parseCommand parses a command message, returning the command, and the target it should be sent to.
+func (console *Console) parseCommand(payload protocol.Payload) (command protocol.Command, target Target, err error) {
+	if payload.Code != protocol.WSCAdminCommand {
+		return command, target, fmt.Errorf("Unexpected message code [%d]", payload.Code)
+	}
+
+	sections := strings.SplitN(payload.Message, commandDelimiter, 3)
+	if len(sections) != 3 {
+		return command, target, errors.New("Command bad format")
+	}
+
+	commandType, err := strconv.ParseUint(sections[1], 10, 16)
+	if err != nil {
+		return command, target, errors.New("Command type bad format")
+	}
+
+	command.Type, command.Data = uint16(commandType), sections[2]
+
+	target, ok := console.targets[sections[0]]
+	if !ok {
+		return command, target, fmt.Errorf("Unknown target [%s]", sections[0])
+	}
+
+	return command, target, nil
+}
+
+// targetNames returns the names of the targets, in alphabetical order.
+func (console *Console) targetNames() []string {
+	names := make([]string, 0, len(console.targets))
+	for name := range console.targets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// writePump writes command results and periodic status messages to the websocket, until the done channel is closed,
+// or a write fails. As gorilla websockets only support one concurrent writer, all writes after auth happen here.
+func (console *Console) writePump(wsconn *websocket.Conn, results <-chan protocol.CommandResult, done <-chan struct{}) {
+	ticker := time.NewTicker(statusPeriod)
+	defer ticker.Stop()
+
+	// Close the websocket on exit, so that the read loop exits too if this was due to a write error.
+	defer wsconn.Close()
+
+	// Send the status immediately, rather than waiting for the first tick.
+	if console.writeStatus(wsconn) != nil {
+		return
+	}
+
+	for {
+		var err error
+
+		select {
+		case result := <-results:
+			outcome := "error"
+			if result.Success {
+				outcome = "ok"
+			}
+
+			message := strings.Join([]string{strconv.Itoa(int(result.Type)), outcome, result.Message}, commandDelimiter)
+			err = connection.WriteText(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAdminCommandResult, message))
+		case <-ticker.C:
+			err = console.writeStatus(wsconn)
+		case <-done:
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeStatus writes the current status of the servers to the websocket, as JSON.
+func (console *Console) writeStatus(wsconn *websocket.Conn) error {
+	status := console.status()
+	status.Server = console.server
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	return connection.WriteText(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAdminStatus, string(data)))
+}
+
+// readPayload blocks until a message is received from the websocket, and returns its payload.
+func readPayload(wsconn *websocket.Conn) (protocol.Payload, error) {
+	_, data, err := wsconn.ReadMessage()
+	if err != nil {
+		return protocol.Payload{}, err
+	}
+
+	return protocol.NewPayloadFromBytes(data), nil
+}
+
+// reply adds a result for a command that could not be sent to a server to the result channel, unless it is full.
+func reply(results chan<- protocol.CommandResult, commandType uint16, success bool, message string) {
+	protocol.Command{Type: commandType, Result: results}.Reply(success, message)
+}
+
+// discard sends the specified message down the websocket, and then closes it with a close handshake.
+func discard(wsconn *websocket.Conn, message protocol.Message) {
+	connection.WriteText(wsconn, message)
+	connection.CloseWebsocket(wsconn, message, nil)
+}
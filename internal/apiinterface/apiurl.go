@@ -16,6 +16,9 @@ const (
 
 	// endpointProfiles is the path of the profiles endpoint of the Blade II Online REST API.
 	endpointProfiles = "profiles"
+
+	// endpointStatus is the path of the server status endpoint of the Blade II Online REST API.
+	endpointStatus = "status"
 )
 
 // GetURL constructs and returns the URL for the specified endpoint of the Blade II Online REST API.
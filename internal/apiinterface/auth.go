@@ -7,17 +7,33 @@ package apiinterface
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
 )
 
 // Read the auth details for the API from the environment variables.
 var (
-	apiUsername = os.Getenv("api_username")
-	apiPassword = os.Getenv("api_password")
+	apiUsername = envvar.String("api_username", "")
+	apiPassword = envvar.String("api_password", "")
 )
 
+// ValidateCredentials returns an error if the auth details for the API were not set, as every request to the API would
+// otherwise fail - which would only be noticed once a match ends.
+func ValidateCredentials() error {
+	if apiUsername == "" {
+		return errors.New("Environment variable [api_username] was not set, or is empty")
+	}
+
+	if apiPassword == "" {
+		return errors.New("Environment variable [api_password] was not set, or is empty")
+	}
+
+	return nil
+}
+
 // addAuthHeader adds a 'Basic' HTTP Authentication Scheme header (RFC7617) to the specified request.
 func addAuthHeader(req *http.Request) {
 
@@ -0,0 +1,54 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package apiinterface provides utilities for interacting with the Blade II Online REST API.
+package apiinterface
+
+import "log"
+
+// Backend is the interface through which the requests to the Blade II Online REST API (and the event webhook) are
+// made. Requests are made over HTTP by default, but can be replaced with an offline stub (see SetBackend).
+type Backend interface {
+	UpdateMatchStats(updateRequest MMRUpdateRequest) error
+	PostEvent(url string, event interface{})
+	PutStatus(url string, status ServerStatus) error
+}
+
+// httpBackend is the default backend, which makes real HTTP requests.
+type httpBackend struct{}
+
+// OfflineBackend is a backend that makes no requests, for running the servers without the REST API - match results and
+// events are logged instead, and status reports are discarded.
+type OfflineBackend struct{}
+
+// Ensure that httpBackend and OfflineBackend implement Backend.
+var (
+	_ Backend = httpBackend{}
+	_ Backend = OfflineBackend{}
+)
+
+// backend is the backend through which requests are made.
+var backend Backend = httpBackend{}
+
+// SetBackend replaces the backend through which requests are made. Must be called before any of the servers are started,
+// as the backend is read without synchronization.
+func SetBackend(newBackend Backend) {
+	backend = newBackend
+}
+
+// UpdateMatchStats logs the specified match update request.
+func (OfflineBackend) UpdateMatchStats(updateRequest MMRUpdateRequest) error {
+	log.Printf("Offline mode - not sending MMR update: %+v", updateRequest)
+	return nil
+}
+
+// PostEvent logs the specified event.
+func (OfflineBackend) PostEvent(url string, event interface{}) {
+	log.Printf("Offline mode - not posting event to [%s]: %+v", url, event)
+}
+
+// PutStatus discards the specified status, as status reports are too frequent to be worth logging.
+func (OfflineBackend) PutStatus(url string, status ServerStatus) error {
+	return nil
+}
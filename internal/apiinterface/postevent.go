@@ -0,0 +1,73 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package apiinterface provides utilities for interacting with the Blade II Online REST API.
+package apiinterface
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// postEventTimeout is the maximum time to wait for a webhook to respond to an event, so that a webhook that never
+// responds can't hold up the events that are posted after it.
+const postEventTimeout = time.Second * 10
+
+// PostEvent synchronously posts the specified event, as JSON, to the specified URL (via the current backend - see
+// SetBackend). The same auth header that is used for the Blade II Online REST API is added to the request.
+//
+// Fails silently but logs to console.
+func PostEvent(url string, event interface{}) {
+	backend.PostEvent(url, event)
+}
+
+// PostEvent posts the specified event, as JSON, to the specified URL.
+func (httpBackend) PostEvent(url string, event interface{}) {
+
+	// Create a JSON formatting string based on the event.
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error packaging event data: %v", err.Error())
+		return
+	}
+
+	// Create a temporary instance of a http client.
+	client := http.Client{Timeout: postEventTimeout}
+
+	// Set up the request that will be sent to the webhook.
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(eventBytes))
+	if err != nil {
+		log.Printf("Error packaging event data: %v", err.Error())
+		return
+	}
+
+	// Add the content type and the required auth header to the request.
+	req.Header.Add("Content-Type", "application/json")
+	addAuthHeader(req)
+
+	// Attempt to make the request that was set up above.
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Error posting event: %s", err.Error())
+		return
+	}
+
+	// Defer the closing of the response body stream so that it will be cleaned up properly when this function is exited.
+	defer resp.Body.Close()
+
+	// Any non 2xx response is considered to be an error - attempt to read the contents of the response body, and try
+	// to determine what the error was.
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Printf("Error posting event: %v", err.Error())
+		} else {
+			log.Printf("Error posting event: %v", string(body))
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package apiinterface provides utilities for interacting with the Blade II Online REST API.
+package apiinterface
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultStatusReportPeriod is the default duration between each status report.
+	defaultStatusReportPeriod = time.Second * 30
+
+	// maximumStatusBackoff is the maximum duration between status reports, while reports are failing.
+	maximumStatusBackoff = time.Minute * 5
+
+	// statusReportTimeout is the maximum time to wait for the API to respond to a status report.
+	statusReportTimeout = time.Second * 10
+)
+
+// statusReportPeriod is the duration between each status report. Configured via the "status_report_period"
+// environment variable - zero disables status reporting.
+var statusReportPeriod = envvar.Duration("status_report_period", defaultStatusReportPeriod)
+
+// ServerStatus describes the current load on a server, for the server status page.
+type ServerStatus struct {
+
+	// The name of the server that sent the report - when the servers are deployed separately, each one only reports
+	// the counts that it knows about.
+	Server string `json:"server"`
+
+	// The number of clients in the matchmaking queue.
+	Queued int `json:"queued"`
+
+	// The number of clients that are in a match.
+	InMatch int `json:"inMatch"`
+
+	// The number of matches.
+	Matches int `json:"matches"`
+
+	// The number of seconds since status reporting started.
+	Uptime int64 `json:"uptime"`
+}
+
+// StartStatusReporter starts a goroutine that periodically reports the status returned by getStatus to the status
+// endpoint of the Blade II Online REST API. The server name and uptime are filled in by the reporter. While reports
+// are failing, the period between reports is doubled (up to a maximum), and only the first failure is logged.
+func StartStatusReporter(server string, getStatus func() ServerStatus) {
+
+	// Noop if status reporting is disabled.
+	if statusReportPeriod <= 0 {
+		return
+	}
+
+	go func() {
+		startTime := time.Now()
+		wait := statusReportPeriod
+		failures := 0
+
+		for {
+			time.Sleep(wait)
+
+			// Get the latest status, and fill in the server name and uptime.
+			status := getStatus()
+			status.Server = server
+			status.Uptime = int64(time.Since(startTime).Seconds())
+
+			// Report the status. On failure, back off - on success, return to the normal period.
+			err := backend.PutStatus(GetURL(endpointStatus), status)
+			if err != nil {
+				if failures == 0 {
+					log.Printf("Error reporting server status (further failures will not be logged): %v", err.Error())
+				}
+
+				failures++
+			} else {
+				if failures > 0 {
+					log.Printf("Server status reporting recovered after %v failed attempts", failures)
+				}
+
+				failures = 0
+			}
+
+			wait = nextStatusWait(wait, err != nil)
+		}
+	}()
+}
+
+// nextStatusWait returns the duration to wait before the next status report, given the duration that was waited before
+// the last one, and whether it failed. Failures double the wait, up to a maximum, and a success returns it to the
+// normal period.
+func nextStatusWait(wait time.Duration, failed bool) time.Duration {
+	if !failed {
+		return statusReportPeriod
+	}
+
+	wait *= 2
+	if wait > maximumStatusBackoff {
+		wait = maximumStatusBackoff
+	}
+
+	return wait
+}
+
+// PutStatus synchronously puts the specified status, as JSON, to the specified URL, and returns any errors.
+func (httpBackend) PutStatus(url string, status ServerStatus) error {
+
+	// Create a JSON formatting string based on the status.
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	// Create a temporary instance of a http client.
+	client := http.Client{Timeout: statusReportTimeout}
+
+	// Set up the request that will be sent to the API.
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(statusBytes))
+	if err != nil {
+		return err
+	}
+
+	// Add the content type and the required auth header to the request.
+	req.Header.Add("Content-Type", "application/json")
+	addAuthHeader(req)
+
+	// Attempt to make the request that was set up above.
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// Defer the closing of the response body stream so that it will be cleaned up properly when this function is exited.
+	defer resp.Body.Close()
+
+	// Any non 2xx response is considered to be an error - attempt to read the contents of the response body, and try
+	// to determine what the error was.
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("status %v: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
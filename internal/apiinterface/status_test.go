@@ -0,0 +1,95 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package apiinterface
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPutStatus checks that a status report is sent to the API as an authenticated PUT request, with the status as
+// JSON, and that any response other than a 2xx is returned as an error that includes the status code and body.
+func TestPutStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		response int
+		failed   bool
+	}{
+		{"Accepted", http.StatusNoContent, false},
+		{"Rejected", http.StatusForbidden, true},
+		{"Server error", http.StatusInternalServerError, true},
+	}
+
+	status := ServerStatus{Server: "matchmaking", Queued: 3, InMatch: 4, Matches: 2, Uptime: 60}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received ServerStatus
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut {
+					t.Errorf("Status was sent with method [%s], expected [%s]", r.Method, http.MethodPut)
+				}
+
+				if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+					t.Errorf("Status was sent with content type [%s], expected [application/json]", contentType)
+				}
+
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+					t.Errorf("Status was sent without basic auth")
+				}
+
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("Status was not valid JSON: %v", err)
+				}
+
+				w.WriteHeader(test.response)
+				w.Write([]byte("response body"))
+			}))
+			defer server.Close()
+
+			err := httpBackend{}.PutStatus(server.URL, status)
+			if (err != nil) != test.failed {
+				t.Fatalf("PutStatus returned [%v], expected failure: %v", err, test.failed)
+			}
+
+			if err != nil && (!strings.Contains(err.Error(), strconv.Itoa(test.response)) || !strings.Contains(err.Error(), "response body")) {
+				t.Fatalf("Error [%v] doesn't include the status code and response body", err)
+			}
+
+			if received != status {
+				t.Fatalf("API received %+v, expected %+v", received, status)
+			}
+		})
+	}
+}
+
+// TestNextStatusWait checks that each failed status report doubles the wait before the next one, up to the maximum,
+// and that a successful report returns to the normal period.
+func TestNextStatusWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		wait     time.Duration
+		failed   bool
+		expected time.Duration
+	}{
+		{"First failure", statusReportPeriod, true, statusReportPeriod * 2},
+		{"Repeated failure", statusReportPeriod * 2, true, statusReportPeriod * 4},
+		{"Failure near the maximum", maximumStatusBackoff - time.Second, true, maximumStatusBackoff},
+		{"Failure at the maximum", maximumStatusBackoff, true, maximumStatusBackoff},
+		{"Success", statusReportPeriod, false, statusReportPeriod},
+		{"Recovery", maximumStatusBackoff, false, statusReportPeriod},
+	}
+
+	for _, test := range tests {
+		if wait := nextStatusWait(test.wait, test.failed); wait != test.expected {
+			t.Errorf("%s: waited [%v], expected [%v]", test.name, wait, test.expected)
+		}
+	}
+}
@@ -15,9 +15,23 @@ const (
 	Player2        = 2
 )
 
-// MMRUpdateRequest describes the data needed to update the MMR for a pair of users.
+// Outcome represents how a match was concluded. Matches that end without a result (no contest) are never sent to the
+// API, so every outcome affects the stats of both players.
+type Outcome string
+
+// Enum values that represent the potential outcomes for a match.
+const (
+	OutcomeWin  Outcome = "win"
+	OutcomeDraw Outcome = "draw"
+)
+
+// MMRUpdateRequest describes the data needed to update the MMR for a pair of users. The outcome is explicit, so that a
+// draw can't be mistaken for a match with a missing winner.
 type MMRUpdateRequest struct {
-	Player1ID uint64 `json:"player1id"`
-	Player2ID uint64 `json:"player2id"`
-	Winner    Winner `json:"winner"`
+	Player1ID  uint64  `json:"player1id"`
+	Player2ID  uint64  `json:"player2id"`
+	Player1MMR int     `json:"player1mmr"`
+	Player2MMR int     `json:"player2mmr"`
+	Winner     Winner  `json:"winner"`
+	Outcome    Outcome `json:"outcome"`
 }
@@ -8,29 +8,61 @@ package apiinterface
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 )
 
-// UpdateMatchStats synchronously sends a request to the API server to update the MMR, as well as
-// the w/d/l for the specified players, based on the winner.
+// StatsUpdater is the interface through which the match stats (including the MMR) for each player are updated, once a
+// match has a result.
+type StatsUpdater interface {
+	UpdateMatchStats(client1ID uint64, client2ID uint64, client1MMR int, client2MMR int, winner Winner) error
+}
+
+// APIStatsUpdater is the default stats updater, which updates the match stats via the Blade II Online REST API (see
+// UpdateMatchStats).
+type APIStatsUpdater struct{}
+
+// Ensure that APIStatsUpdater implements StatsUpdater.
+var _ StatsUpdater = APIStatsUpdater{}
+
+// UpdateMatchStats updates the match stats via the Blade II Online REST API (see the package function of the same name).
+func (APIStatsUpdater) UpdateMatchStats(client1ID uint64, client2ID uint64, client1MMR int, client2MMR int, winner Winner) error {
+	return UpdateMatchStats(client1ID, client2ID, client1MMR, client2MMR, winner)
+}
+
+// UpdateMatchStats synchronously sends a request to the API server (via the current backend - see SetBackend) to update
+// the MMR, as well as the w/d/l for the specified players, based on the winner and the MMR of each player at the start of
+// the match. The outcome is derived from the winner - Draw means that the match was drawn.
 //
-// Fails silently (for the client) but logs to console.
-func UpdateMatchStats(client1ID uint64, client2ID uint64, winner Winner) {
+// Returns an error if the update failed.
+func UpdateMatchStats(client1ID uint64, client2ID uint64, client1MMR int, client2MMR int, winner Winner) error {
+
+	// Determine the outcome of the match.
+	outcome := OutcomeWin
+	if winner == Draw {
+		outcome = OutcomeDraw
+	}
 
-	// Create an instance of the match update request struct, with the parameters that were passed in.
-	updateRequest := MMRUpdateRequest{
+	// Create an instance of the match update request struct, with the parameters that were passed in, and send it.
+	return backend.UpdateMatchStats(MMRUpdateRequest{
 		client1ID,
 		client2ID,
+		client1MMR,
+		client2MMR,
 		winner,
-	}
+		outcome,
+	})
+}
+
+// UpdateMatchStats sends the specified match update request to the profiles endpoint of the API.
+func (httpBackend) UpdateMatchStats(updateRequest MMRUpdateRequest) error {
 
 	// Create a JSON formatting string based on the match update request.
 	updateRequestBytes, err := json.Marshal(updateRequest)
 	if err != nil {
-		log.Printf("Error packaging MMR update data: %v", err.Error())
-		return
+		return err
 	}
 
 	// Create a temporary instance of a http client.
@@ -39,8 +71,7 @@ func UpdateMatchStats(client1ID uint64, client2ID uint64, winner Winner) {
 	// Set up the request that will be sent to the API.
 	req, err := http.NewRequest(http.MethodPatch, GetURL(endpointProfiles), bytes.NewBuffer(updateRequestBytes))
 	if err != nil {
-		log.Printf("Error packaging MMR update data: %v", err.Error())
-		return
+		return err
 	}
 
 	// Add required auth header to the request.
@@ -49,20 +80,24 @@ func UpdateMatchStats(client1ID uint64, client2ID uint64, winner Winner) {
 	// Attempt to make the request that was set up above.
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Error Sending MMR update: %s", err.Error())
-	} else if resp.StatusCode != http.StatusNoContent {
+		return err
+	}
 
-		// Defer the closing of the response body stream so that it will be cleaned up properly when this closure is exited.
-		defer resp.Body.Close()
+	// Defer the closing of the response body stream so that it will be cleaned up properly when this function is exited.
+	defer resp.Body.Close()
 
-		// Attempt to read the contents of the response body, and try to determine what the error was.
+	// Any response other than no content is considered to be an error - attempt to read the contents of the response
+	// body, and try to determine what the error was.
+	if resp.StatusCode != http.StatusNoContent {
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf("Error sending MMR update: %v", err.Error())
-		} else {
-			log.Printf("Error Sending MMR update: %v", string(body))
+			return err
 		}
-	} else {
-		log.Println("Successfully updated Match stats")
+
+		return fmt.Errorf("status %v: %s", resp.StatusCode, string(body))
 	}
+
+	log.Println("Successfully updated Match stats")
+
+	return nil
 }
@@ -0,0 +1,170 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import (
+	"flag"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// DefaultAddress is the default local address:port that the servers will be available on. Unless configured
+// otherwise, the game server and the matchmaking server share this address.
+const DefaultAddress = "localhost:20000"
+
+// DefaultAdminAddress is the default local address:port that the admin console will be available on, if it is enabled.
+const DefaultAdminAddress = "localhost:20001"
+
+// Init performs the setup that is common to all of the server binaries - parsing flags, seeding the random package,
+// and handling termination and maintenance signals - and then opens and returns the database store, wrapped in a
+// profile caching store (see database.NewProfileCachingStore).
+//
+// If test auth is enabled (via the "b2_test_auth_bypass" environment variable), or offline mode (via the
+// "b2_offline_mode" environment variable), an in-memory test store is used instead of the database (see
+// insecureStore). Both are only available in binaries built with the "insecure" build tag. Otherwise, the process exits
+// if the auth details for the API are missing (see apiinterface.ValidateCredentials).
+func Init() database.Store {
+
+	// Parse the command line flags.
+	flag.Parse()
+
+	// Seed the random package.
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	// Log and exit cleanly when the process is asked to terminate, and toggle maintenance mode when asked to.
+	go handleSignals()
+
+	// If requested, exit once the servers have drained during maintenance.
+	if *drainThenExit {
+		go exitWhenDrained()
+	}
+
+	// In offline mode, or with test auth enabled, use the test store instead of the database.
+	if store, ok := insecureStore(); ok {
+		return store
+	}
+
+	// Check that the auth details for the API are present - the server can not report match results without them.
+	if err := apiinterface.ValidateCredentials(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Open the database.
+	return database.NewProfileCachingStore(database.NewMySQLStore())
+}
+
+// GameServerAddress returns the address setting for the game server - a comma-separated list of listeners (see
+// Listen). Configured via the "game_server_address" environment variable.
+func GameServerAddress() string {
+	return envvar.String("game_server_address", DefaultAddress)
+}
+
+// MatchmakingAddress returns the address setting for the matchmaking server - a comma-separated list of listeners
+// (see Listen). Configured via the "matchmaking_server_address" environment variable.
+func MatchmakingAddress() string {
+	return envvar.String("matchmaking_server_address", DefaultAddress)
+}
+
+// AdminAddress returns the address setting for the admin console - a comma-separated list of listeners (see Listen),
+// which must not overlap with any of the player-facing listeners. Configured via the "admin_address" environment
+// variable.
+func AdminAddress() string {
+	return envvar.String("admin_address", DefaultAdminAddress)
+}
+
+// NewMux creates and returns a pointer to a new http mux, with the endpoints that every server exposes (such as the
+// health check endpoint) already set up.
+func NewMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// The health check endpoint simply reports that the process is up, and able to serve requests - or that it is
+	// draining, if maintenance mode is enabled. The status is OK either way, as the process is still healthy.
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if maintenanceMode.Enabled() {
+			w.Write([]byte("draining"))
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+
+	return mux
+}
+
+// Serve starts serving the specified mux on every listener in the specified address setting (see Listen), and blocks
+// until one of them fails, or they are shut down. Pass in the name of the server, for logging. The log.Fatal wrapper
+// ensures that any errors (including failing to create any of the listeners) will cause a clean exit with a proper
+// exit code.
+//
+// If a TLS certificate and key are configured (via the "tls_cert_file" and "tls_key_file" environment variables),
+// the mux is served over HTTPS, so that clients can connect with wss://. Otherwise, it is served over plain HTTP.
+func Serve(name string, address string, mux *http.ServeMux) {
+	certFile := envvar.String("tls_cert_file", "")
+	keyFile := envvar.String("tls_key_file", "")
+
+	// A certificate without a key (or vice versa) is a configuration error, rather than a reason to fall back to
+	// plain HTTP.
+	if (certFile == "") != (keyFile == "") {
+		log.Fatal("Environment variables [tls_cert_file] and [tls_key_file] must either both be set, or both be empty")
+	}
+
+	transport := "plain HTTP - TLS not configured"
+	if certFile != "" {
+		transport = "TLS"
+	}
+
+	// Create all of the listeners before serving on any of them, so that a bad entry fails startup.
+	listeners, err := Listen(address)
+	if err != nil {
+		log.Fatalf("Blade II Online %s %s", name, err.Error())
+	}
+
+	// Serve on every listener, and wait for any of them to stop.
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		log.Printf("Blade II Online %s listening on: %v (%s)", name, listener.Addr(), transport)
+
+		go func(listener net.Listener) {
+			errs <- serveListener(listener, mux, certFile, keyFile)
+		}(listener)
+	}
+
+	// If the servers were shut down, the process is about to exit, so block until it does.
+	if err := <-errs; err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	select {}
+}
+
+// handleSignals toggles maintenance mode for each maintenance signal, and exits on an interrupt or termination signal.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, maintenanceSignals...)...)
+
+	for received := range signals {
+		if isMaintenanceSignal(received) {
+			toggleMaintenance()
+			continue
+		}
+
+		log.Printf("Received signal [%v] - shutting down", received)
+
+		// Stop all of the listeners together, before exiting.
+		shutdownServers()
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+//go:build insecure
+// +build insecure
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// insecureStore returns an in-memory test store, which accepts generated credentials (see teststore.Store), and true,
+// if offline mode or test auth is enabled - for load testing, and for running the servers locally. As this lets anyone
+// connect as anyone, either one is refused unless the "b2_insecure_test_mode" environment variable is also set.
+// Offline mode also stubs out the API (see apiinterface.OfflineBackend), so that the servers can be run without any
+// backend.
+func insecureStore() (store database.Store, ok bool) {
+
+	// In offline mode, use the test store, and stub out the API, if allowed.
+	if envvar.Bool("b2_offline_mode", false) {
+		if !envvar.Bool("b2_insecure_test_mode", false) {
+			log.Fatal("Refusing to enable [b2_offline_mode] - [b2_insecure_test_mode] must also be set")
+		}
+
+		log.Printf("WARNING: offline mode is enabled - any public ID starting with [%s] is accepted, and nothing is written to the database or sent to the API", teststore.PublicIDPrefix)
+		apiinterface.SetBackend(apiinterface.OfflineBackend{})
+		return database.NewProfileCachingStore(newTestStore()), true
+	}
+
+	// Use the test store if test auth is enabled, and allowed.
+	if envvar.Bool("b2_test_auth_bypass", false) {
+		if !envvar.Bool("b2_insecure_test_mode", false) {
+			log.Fatal("Refusing to enable [b2_test_auth_bypass] - [b2_insecure_test_mode] must also be set")
+		}
+
+		log.Printf("WARNING: test auth is enabled - any public ID starting with [%s] is accepted, and nothing is written to the database", teststore.PublicIDPrefix)
+		return database.NewProfileCachingStore(newTestStore()), true
+	}
+
+	return nil, false
+}
+
+// newTestStore returns a new test store. If the "b2_test_store_path" environment variable is set, the store's state is
+// kept in the file at that path (see teststore.NewSharedStore), so that the standalone matchmaking and game servers can
+// share their matches.
+func newTestStore() *teststore.Store {
+	if path := envvar.String("b2_test_store_path", ""); path != "" {
+		log.Printf("Test store state is shared through [%s]", path)
+		return teststore.NewSharedStore(path)
+	}
+
+	return teststore.NewStore()
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+
+	// listenerDelimiter separates the listeners in an address setting.
+	listenerDelimiter = ","
+
+	// unixListenerPrefix is the prefix for listeners that are unix sockets, followed by the path to the socket.
+	unixListenerPrefix = "unix:"
+
+	// shutdownTimeout is the maximum amount of time to wait for the http servers to shut down.
+	shutdownTimeout = time.Second * 5
+)
+
+var (
+
+	// The http servers that have been started, so that they can all be shut down together.
+	servers []*http.Server
+
+	// Mutex lock to protect the servers.
+	serversLock sync.Mutex
+)
+
+// Listen creates a listener for each entry in the specified address setting - a comma-separated list of listeners, each
+// of which is either a host:port (such as "localhost:20000", or "[::]:20000" for IPv6), or a unix socket (such as
+// "unix:/run/blade2.sock"). TCP listeners only use IPv4 or IPv6 if the host is an address of that type - hostnames,
+// and empty hosts, listen on both where possible. If any of the listeners fail, those that were already created are
+// closed, and an error naming the offending entry is returned.
+func Listen(addresses string) (listeners []net.Listener, err error) {
+	for _, entry := range strings.Split(addresses, listenerDelimiter) {
+		entry = strings.TrimSpace(entry)
+
+		listener, err := listen(entry)
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+
+			return nil, fmt.Errorf("failed to listen on [%s]: %v", entry, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// listen creates a listener for a single entry in an address setting.
+func listen(entry string) (net.Listener, error) {
+	if entry == "" {
+		return nil, fmt.Errorf("empty address")
+	}
+
+	// Unix sockets are created at the specified path. A socket file left behind by a previous process (that did not
+	// exit cleanly) would prevent the socket from being created, so it is removed first. Anything else at the path is
+	// left alone, so that listening fails rather than deleting it.
+	if strings.HasPrefix(entry, unixListenerPrefix) {
+		path := strings.TrimPrefix(entry, unixListenerPrefix)
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+
+		return net.Listen("unix", path)
+	}
+
+	// Choose the network for tcp addresses, based on the type of the host (if it is an address).
+	host, _, err := net.SplitHostPort(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	network := "tcp"
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			network = "tcp4"
+		} else {
+			network = "tcp6"
+		}
+	}
+
+	return net.Listen(network, entry)
+}
+
+// serveListener serves the specified mux with the specified listener until the server fails, or is shut down. The
+// server is registered so that it can be shut down with the others.
+func serveListener(listener net.Listener, mux *http.ServeMux, certFile string, keyFile string) error {
+	server := &http.Server{Handler: mux}
+
+	serversLock.Lock()
+	servers = append(servers, server)
+	serversLock.Unlock()
+
+	if certFile != "" {
+		return server.ServeTLS(listener, certFile, keyFile)
+	}
+
+	return server.Serve(listener)
+}
+
+// shutdownServers shuts down all of the http servers together, waiting (up to the shutdown timeout) for them to stop.
+// Unix sockets are removed as their listeners are closed.
+func shutdownServers() {
+	serversLock.Lock()
+	defer serversLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var wait sync.WaitGroup
+	for _, server := range servers {
+		wait.Add(1)
+		go func(server *http.Server) {
+			defer wait.Done()
+
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("Error shutting down http server: %s", err.Error())
+			}
+		}(server)
+	}
+
+	wait.Wait()
+}
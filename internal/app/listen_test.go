@@ -0,0 +1,108 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestListen binds an ephemeral tcp port and a unix socket from a single address setting, serves the same mux on both,
+// and checks that each of them accepts websocket upgrades.
+func TestListen(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "blade2.sock")
+
+	listeners, err := Listen("127.0.0.1:0, " + unixListenerPrefix + socket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	if len(listeners) != 2 {
+		t.Fatalf("Created %d listeners, expected 2", len(listeners))
+	}
+
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte("upgraded"))
+		conn.Close()
+	})
+
+	for _, listener := range listeners {
+		go serveListener(listener, mux, "", "")
+	}
+	t.Cleanup(shutdownServers)
+
+	tests := []struct {
+		name   string
+		url    string
+		dialer *websocket.Dialer
+	}{
+		{"tcp", "ws://" + listeners[0].Addr().String(), websocket.DefaultDialer},
+		{"unix", "ws://blade2", &websocket.Dialer{NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, _, err := test.dialer.Dial(test.url, nil)
+			if err != nil {
+				t.Fatalf("Failed to upgrade: %v", err)
+			}
+			defer conn.Close()
+
+			if _, message, err := conn.ReadMessage(); err != nil || string(message) != "upgraded" {
+				t.Fatalf("Read [%s] (error: %v), expected [upgraded]", message, err)
+			}
+		})
+	}
+}
+
+// TestListenFailure checks that an address setting with an entry that can't be listened on fails with an error naming
+// the entry, and that the listeners created for the entries before it are closed.
+func TestListenFailure(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "blade2.sock")
+
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{"Missing port", "localhost"},
+		{"Empty entry", ""},
+		{"Missing socket directory", unixListenerPrefix + filepath.Join(t.TempDir(), "missing", "blade2.sock")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listeners, err := Listen(unixListenerPrefix + socket + "," + test.entry)
+			if err == nil {
+				t.Fatalf("Listened on %d listeners, expected an error", len(listeners))
+			}
+
+			if !strings.Contains(err.Error(), "["+test.entry+"]") {
+				t.Fatalf("Error [%v] doesn't name the entry [%s]", err, test.entry)
+			}
+
+			// The socket for the first entry was closed, so can be listened on again.
+			listener, err := net.Listen("unix", socket)
+			if err != nil {
+				t.Fatalf("Socket for the first entry is still in use: %v", err)
+			}
+			listener.Close()
+		})
+	}
+}
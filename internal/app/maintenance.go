@@ -0,0 +1,70 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import (
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+// defaultMaintenanceShutdownDelay is the default delay until the planned shutdown, when maintenance mode is enabled.
+const defaultMaintenanceShutdownDelay = time.Minute * 15
+
+// drainThenExit is set via the "--drain-then-exit" flag. If set, the process shuts down by itself once maintenance
+// mode is enabled, and every server has drained.
+var drainThenExit = flag.Bool("drain-then-exit", false, "shut down once maintenance mode is enabled, and every match has finished")
+
+// maintenanceMode is the maintenance mode switch shared by every server in the process. The delay until the planned
+// shutdown (when maintenance mode is enabled by a signal, or without specifying one) is configured via the
+// "maintenance_shutdown_delay" environment variable.
+var maintenanceMode = maintenance.NewMode(envvar.Duration("maintenance_shutdown_delay", defaultMaintenanceShutdownDelay))
+
+// Maintenance returns the maintenance mode switch shared by every server in the process. It is toggled by the
+// maintenance signal (SIGUSR1, where supported), and by the maintenance admin command.
+func Maintenance() *maintenance.Mode {
+	return maintenanceMode
+}
+
+// isMaintenanceSignal returns true if the specified signal toggles maintenance mode.
+func isMaintenanceSignal(received os.Signal) bool {
+	for _, maintenanceSignal := range maintenanceSignals {
+		if received == maintenanceSignal {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toggleMaintenance enables maintenance mode if it is disabled, or disables it if it is enabled.
+func toggleMaintenance() {
+	if maintenanceMode.Toggle(time.Now()) {
+		_, shutdownTime := maintenanceMode.State()
+		log.Printf("Maintenance mode enabled - planned shutdown at %s", shutdownTime.UTC().Format(time.RFC3339))
+	} else {
+		log.Printf("Maintenance mode disabled")
+	}
+}
+
+// exitWhenDrained blocks until every server has drained while maintenance mode is enabled, and then shuts down and
+// exits. Notifications for a maintenance period that has since been cancelled are ignored.
+func exitWhenDrained() {
+	for range maintenanceMode.Drained() {
+		if !maintenanceMode.Enabled() {
+			continue
+		}
+
+		log.Printf("All servers have drained - shutting down")
+
+		shutdownServers()
+		os.Exit(0)
+	}
+}
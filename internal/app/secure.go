@@ -0,0 +1,28 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+//go:build !insecure
+// +build !insecure
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// insecureStore always returns false, as the test store is not linked into binaries built without the "insecure" build
+// tag. If offline mode or test auth is requested anyway, the process exits, rather than silently using the database.
+func insecureStore() (store database.Store, ok bool) {
+	for _, name := range []string{"b2_offline_mode", "b2_test_auth_bypass"} {
+		if envvar.Bool(name, false) {
+			log.Fatalf("Refusing to enable [%s] - this binary was built without the [insecure] build tag", name)
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,17 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+//go:build !windows
+// +build !windows
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// maintenanceSignals are the signals that toggle maintenance mode.
+var maintenanceSignals = []os.Signal{syscall.SIGUSR1}
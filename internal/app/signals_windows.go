@@ -0,0 +1,15 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+//go:build windows
+// +build windows
+
+// Package app implements the bootstrap that is shared by each of the server binaries.
+package app
+
+import "os"
+
+// maintenanceSignals are the signals that toggle maintenance mode. Windows has no user-defined signals, so maintenance
+// mode can only be toggled with the admin command.
+var maintenanceSignals = []os.Signal{}
@@ -0,0 +1,108 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package connection implements a websocket connection wrapper with various helper functions.
+package connection
+
+import (
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/gorilla/websocket"
+)
+
+const (
+
+	// closeHandshakeWait is the maximum duration to wait for the peer to echo a close frame, before the underlying
+	// connection is closed regardless.
+	closeHandshakeWait = time.Second * 1
+
+	// maximumCloseReasonLength is the maximum length (in bytes) of the reason in a close frame. Control frames are
+	// limited to 125 bytes, 2 of which are used by the close code.
+	maximumCloseReasonLength = 123
+
+	// defaultCloseWaitPeriod is the default duration to wait between queueing a final message for a connection, and
+	// starting the close handshake.
+	defaultCloseWaitPeriod = time.Second * 1
+)
+
+// closeWaitPeriod is the duration to wait between queueing a final message for a connection, and starting the close
+// handshake - giving the write pump time to send the message. Configured via the "close_wait_period" environment
+// variable.
+var closeWaitPeriod = envvar.Duration("close_wait_period", defaultCloseWaitPeriod)
+
+// closeHooks are the functions to call once each websocket has been closed by CloseWebsocket, keyed by websocket (see
+// OnClose).
+var closeHooks sync.Map
+
+// OnClose registers a function to be called once the specified websocket has been closed by CloseWebsocket - which
+// every connection is closed through, however it ends. The function is called at most once, even if the websocket is
+// closed more than once.
+func OnClose(wsconn *websocket.Conn, hook func()) {
+	closeHooks.Store(wsconn, hook)
+}
+
+// closeCode returns the websocket close code that best describes the specified B2Code.
+func closeCode(code protocol.B2Code) int {
+	switch code {
+	case protocol.WSCNone, protocol.WSCMatchWin, protocol.WSCMatchDraw, protocol.WSCMatchLoss:
+		return websocket.CloseNormalClosure
+	case protocol.WSCUnsupportedMessageType:
+		return websocket.CloseUnsupportedData
+	case protocol.WSCClientFlooding, protocol.WSCAlreadyInMatch, protocol.WSCTooManyConnections:
+		return websocket.ClosePolicyViolation
+	case protocol.WSCServerAtCapacity, protocol.WSCMatchmakingCooldown, protocol.WSCServerMaintenance:
+		return websocket.CloseTryAgainLater
+	case protocol.WSCUnknownConnectionError, protocol.WSCServerError, protocol.WSCMatchStateCorrupted:
+		return websocket.CloseInternalServerErr
+	}
+
+	// Auth and match validation failures are policy violations, as the client was not allowed to connect.
+	if (code >= protocol.WSCAuthRequest && code < protocol.WSCMatchMakingMatchFound) ||
+		(code >= protocol.WSCMatchIDExpected && code <= protocol.WSCMatchFull) {
+		return websocket.ClosePolicyViolation
+	}
+
+	// Anything else means that the server is ending the connection for some other reason.
+	return websocket.CloseGoingAway
+}
+
+// WriteText writes the specified message to the websocket as a JSON text message, with a write deadline.
+func WriteText(wsconn *websocket.Conn, message protocol.Message) error {
+	wsconn.SetWriteDeadline(time.Now().Add(maximumWriteWait))
+	return wsconn.WriteMessage(websocket.TextMessage, message.GetPayloadBytes())
+}
+
+// CloseWebsocket sends a close frame down the websocket, with a close code and reason based on the specified
+// message, and then closes the underlying connection once the peer has echoed the close frame (signalled by the
+// echoed channel being closed), or once the close handshake wait period has elapsed. A nil echoed channel means
+// that the echo cannot be observed, so the full wait period is used.
+func CloseWebsocket(wsconn *websocket.Conn, message protocol.Message, echoed <-chan struct{}) error {
+
+	// Truncate the reason so that it fits into the close frame.
+	reason := message.Payload.Message
+	if len(reason) > maximumCloseReasonLength {
+		reason = reason[:maximumCloseReasonLength]
+	}
+
+	// Send the close frame. Errors are ignored, as the connection is closed regardless.
+	closeFrame := websocket.FormatCloseMessage(closeCode(message.Payload.Code), reason)
+	wsconn.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(maximumWriteWait))
+
+	// Wait for the peer to echo the close frame, or for the wait period to elapse.
+	select {
+	case <-echoed:
+	case <-time.After(closeHandshakeWait):
+	}
+
+	// Close the underlying connection, and call the close hook for the websocket (if any).
+	err := wsconn.Close()
+	if hook, ok := closeHooks.LoadAndDelete(wsconn); ok {
+		hook.(func())()
+	}
+
+	return err
+}
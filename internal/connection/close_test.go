@@ -0,0 +1,167 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package connection
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// newTestWebsocket returns both ends of a real websocket - the server side, and the peer (client) side. Both are closed
+// when the test finishes.
+func newTestWebsocket(t *testing.T) (conn *websocket.Conn, peer *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade the connection: %v", err)
+			return
+		}
+
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial the test server: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	conn = <-conns
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, peer
+}
+
+// expectCloseFrame reads from the specified peer until the close frame arrives, and fails the test unless it has the
+// specified close code and reason.
+func expectCloseFrame(t *testing.T, peer *websocket.Conn, code int, reason string) {
+	t.Helper()
+
+	peer.SetReadDeadline(time.Now().Add(closeHandshakeWait * 2))
+	for {
+		_, _, err := peer.ReadMessage()
+		if err == nil {
+			continue
+		}
+
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok {
+			t.Fatalf("Connection failed without a close frame: %v", err)
+		}
+
+		if closeErr.Code != code || closeErr.Text != reason {
+			t.Fatalf("Close frame has code [%d] and reason [%s], expected [%d] and [%s]", closeErr.Code, closeErr.Text, code, reason)
+		}
+
+		return
+	}
+}
+
+func TestCloseCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     protocol.B2Code
+		expected int
+	}{
+		{"No code", protocol.WSCNone, websocket.CloseNormalClosure},
+		{"Match result", protocol.WSCMatchWin, websocket.CloseNormalClosure},
+		{"Flooding", protocol.WSCClientFlooding, websocket.ClosePolicyViolation},
+		{"At capacity", protocol.WSCServerAtCapacity, websocket.CloseTryAgainLater},
+		{"Server error", protocol.WSCServerError, websocket.CloseInternalServerErr},
+		{"Auth failure", protocol.WSCAuthBadCredentials, websocket.ClosePolicyViolation},
+		{"Match validation failure", protocol.WSCMatchFull, websocket.ClosePolicyViolation},
+		{"Anything else", protocol.WSCMatchForfeit, websocket.CloseGoingAway},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := closeCode(test.code); code != test.expected {
+				t.Fatalf("B2Code [%d] is mapped to close code [%d], expected [%d]", test.code, code, test.expected)
+			}
+		})
+	}
+}
+
+// TestCloseWebsocket checks that the peer is sent a close frame with the code mapped from the message, and the message
+// text (truncated to fit) as the reason - and that the close hook is called exactly once.
+func TestCloseWebsocket(t *testing.T) {
+	long := strings.Repeat("a", maximumCloseReasonLength+10)
+
+	tests := []struct {
+		name     string
+		message  protocol.Message
+		code     int
+		expected string
+	}{
+		{"Policy violation", protocol.NewMessage(protocol.WSMTText, protocol.WSCClientFlooding, "Flooding"), websocket.ClosePolicyViolation, "Flooding"},
+		{"Try again later", protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAtCapacity, "Server is at capacity"), websocket.CloseTryAgainLater, "Server is at capacity"},
+		{"Long reason", protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchWin, long), websocket.CloseNormalClosure, long[:maximumCloseReasonLength]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, peer := newTestWebsocket(t)
+
+			hooks := 0
+			OnClose(conn, func() { hooks++ })
+
+			// The close frame is written before waiting for the (unobservable) echo, so the peer can read it while the
+			// server is still waiting.
+			closed := make(chan struct{})
+			go func() {
+				CloseWebsocket(conn, test.message, nil)
+				CloseWebsocket(conn, test.message, nil)
+				close(closed)
+			}()
+
+			expectCloseFrame(t, peer, test.code, test.expected)
+			<-closed
+
+			if hooks != 1 {
+				t.Fatalf("Close hook was called %d times, expected once", hooks)
+			}
+		})
+	}
+}
+
+// TestCloseHandshake checks that closing a connection that is being read completes as soon as the peer echoes the close
+// frame, rather than waiting for the full close handshake wait period.
+func TestCloseHandshake(t *testing.T) {
+	conn, peer := newTestWebsocket(t)
+	connection := NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON)
+
+	// Read from the connection, as its read pump would, so that the echo is seen.
+	go func() {
+		for connection.ReadMessage() == nil {
+		}
+	}()
+
+	start := time.Now()
+	elapsed := make(chan time.Duration, 1)
+	go func() {
+		connection.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCServerMaintenance, "Server is in maintenance"))
+		elapsed <- time.Since(start)
+	}()
+
+	// Reading the close frame makes the peer echo it.
+	expectCloseFrame(t, peer, websocket.CloseTryAgainLater, "Server is in maintenance")
+
+	if elapsed := <-elapsed; elapsed >= closeHandshakeWait {
+		t.Fatalf("Close took [%v], expected it to finish on the echo, well before [%v]", elapsed, closeHandshakeWait)
+	}
+}
@@ -6,6 +6,9 @@
 package connection
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/xid"
@@ -22,23 +25,75 @@ const (
 	// maximumWriteWait is the maximum duration to wait before a write is considered to have failed.
 	maximumWriteWait = time.Second * 8
 
-	// pongWait is the maximum duration to wait before a connection is considered to be dead due to no inbound traffic (pong or client message).
+	// pongWait is the base duration to wait before a connection is considered to be dead due to no pong being
+	// received. The wait is extended for connections with a high latency (see pongWaitForLatency).
 	pongWait = maximumWriteWait * 2
 
+	// pongWaitLatencyMultiple is the multiple of the measured latency that is added to the pong wait, so that clients
+	// on slow networks are not disconnected while their pong is still in flight.
+	pongWaitLatencyMultiple = 4
+
+	// maximumPongWait is the longest that the pong wait can be extended to, so that dead connections are still
+	// detected promptly, however high the last measured latency was.
+	maximumPongWait = time.Second * 30
+
 	// pingPeriod is the duration to wait after a ping is received, before sending another one.
 	pingPeriod = (pongWait * 8) / 10
+
+	// maximumMessageSize is the maximum size (in bytes) of an inbound message. Larger messages cause the connection
+	// to error, as they may otherwise be relayed to the other client verbatim.
+	maximumMessageSize = 4096
+
+	// maximumDroppedMessages is the maximum number of inbound messages that can be dropped due to the inbound message
+	// queue being full, within a single dropped message window, before the client is considered to be flooding the
+	// server.
+	maximumDroppedMessages = 32
+
+	// droppedMessageWindow is the duration over which dropped inbound messages are counted. The count starts again
+	// with the first message dropped after the window has passed, so that occasional bursts over a long connection
+	// don't add up to a flood.
+	droppedMessageWindow = time.Second * 10
 )
 
+// ErrFlooding is returned when reading from a connection whose client has sent too many messages to be processed.
+var ErrFlooding = errors.New("Client is sending messages faster than they can be processed")
+
 // Connection is a wrapper for a websocket connection.
 type Connection struct {
 	WS                   *websocket.Conn       // The websocket connection itself.
 	Joined               time.Time             // The time at which the connection was created.
 	Latency              time.Duration         // The current latency of the connection.
 	InboundMessageQueue  chan protocol.Message // Inbound message queue - received messages are parked here until removed by a read pump.
-	OutboundMessageQueue chan protocol.Message // Outbound message queue - messages to be sent are parked here until removed by a write pump.
+	OutboundMessageQueue chan outboundMessage  // Outbound message queue - messages to be sent are parked here until removed by a write pump.
 	UUID                 xid.ID                // A unique ID for this connection.
+	ProtocolVersion      uint16                // The protocol version negotiated with the client when the connection was authenticated.
+	Encoding             protocol.Encoding     // The encoding used for messages after the connection was authenticated.
 	pingTimer            *time.Timer           // A timer use to handle the ping pong keep-alive.
+	closeReceived        chan struct{}         // Closed when a close frame is received from the peer.
+	closeReceivedOnce    sync.Once             // Ensures that closeReceived is only closed once.
+	closeScheduledOnce   sync.Once             // Ensures that a delayed close is only scheduled once.
 	lastPingTime         time.Time             // The time at which the most recent ping was sent.
+	queuedCount          uint64                // The number of messages added to the outbound queue. Accessed atomically.
+	writtenCount         uint64                // The number of messages written to the websocket (or superseded). Accessed atomically.
+	droppedCount         uint64                // The number of inbound messages dropped in the current dropped message window. Only accessed from the read pump.
+	droppedWindowStart   time.Time             // The time at which the current dropped message window started. Only accessed from the read pump.
+
+	// The time at which the client last sent a message (other than a control frame), and the read deadline that was last
+	// set to keep the connection alive, before the idle timeout is applied (see setReadDeadline). Only accessed from the
+	// read pump.
+	lastActivityTime  time.Time
+	keepAliveDeadline time.Time
+
+	// The sequence number of the latest coalescable message queued for each code, and a mutex lock to protect it.
+	latestCoalescable map[protocol.B2Code]uint64
+	coalescableLock   sync.Mutex
+}
+
+// outboundMessage is a message in the outbound message queue, along with its sequence number - the value of the queued
+// message count once it was added.
+type outboundMessage struct {
+	message  protocol.Message
+	sequence uint64
 }
 
 // init initialises a connection object, setting up the internal ping/pong handler, message queues, and assigning a UUID.
@@ -46,11 +101,22 @@ func (connection *Connection) init() {
 
 	// Initialise the send and receive queues.
 	connection.InboundMessageQueue = make(chan protocol.Message, MessageBufferSize)
-	connection.OutboundMessageQueue = make(chan protocol.Message, MessageBufferSize)
+	connection.OutboundMessageQueue = make(chan outboundMessage, MessageBufferSize)
+	connection.latestCoalescable = make(map[protocol.B2Code]uint64)
 
-	// Set up pong handler.
-	connection.WS.SetReadDeadline(time.Now().Add(pongWait))
+	// Limit the size of inbound messages.
+	connection.WS.SetReadLimit(maximumMessageSize)
+
+	// Set up the pong handler, and the ping handler for pings sent by the client. The connection starts out active, so
+	// that the idle timeout runs from when it was created.
+	connection.lastActivityTime = time.Now()
+	connection.setReadDeadline(time.Now().Add(pongWait))
 	connection.WS.SetPongHandler(connection.pongHandler)
+	connection.WS.SetPingHandler(connection.pingHandler)
+
+	// Set up the close handler, so that the close handshake can be completed.
+	connection.closeReceived = make(chan struct{})
+	connection.WS.SetCloseHandler(connection.closeHandler)
 
 	// Set up the ticker that dictates when pings should be sent.
 	connection.pingTimer = time.NewTimer(pingPeriod)
@@ -62,12 +128,13 @@ func (connection *Connection) init() {
 // pongHandler handles pong messages from the client.
 func (connection *Connection) pongHandler(pong string) error {
 
-	// Reset the read deadline based on the current time.
-	connection.WS.SetReadDeadline(time.Now().Add(pongWait))
-
 	// Calculate the latency of the connection (round trip).
 	connection.Latency = time.Now().Sub(connection.lastPingTime)
 
+	// Reset the read deadline based on the current time, allowing extra time for the next pong if the connection
+	// has a high latency. The deadline is never extended beyond the idle timeout.
+	connection.setReadDeadline(time.Now().Add(pongWaitForLatency(connection.Latency)))
+
 	// Reset the ping timer, so that it will fire again later.
 	connection.pingTimer.Reset(pingPeriod)
 
@@ -75,22 +142,96 @@ func (connection *Connection) pongHandler(pong string) error {
 	return nil
 }
 
+// pongWaitForLatency returns the duration to wait for the next pong, for a connection with the specified (round trip)
+// latency - the base pong wait, plus a multiple of the latency, clamped to the maximum pong wait.
+func pongWaitForLatency(latency time.Duration) time.Duration {
+
+	// Negative latencies can only come from a clock adjustment, so they are ignored.
+	if latency < 0 {
+		latency = 0
+	}
+
+	// Clamp the latency before multiplying it, so that the result can't overflow.
+	if latency > maximumPongWait {
+		latency = maximumPongWait
+	}
+
+	wait := pongWait + latency*pongWaitLatencyMultiple
+	if wait > maximumPongWait {
+		return maximumPongWait
+	}
+
+	return wait
+}
+
+// closeHandler handles close frames from the client.
+func (connection *Connection) closeHandler(code int, text string) error {
+
+	// Signal that the close frame was received, in case the server initiated the close handshake and is waiting
+	// for the echo.
+	connection.closeReceivedOnce.Do(func() {
+		close(connection.closeReceived)
+	})
+
+	// Echo the close frame, as the default close handler would. Errors are ignored, as the connection is closing
+	// regardless.
+	connection.WS.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(maximumWriteWait))
+
+	return nil
+}
+
 // ReadMessage synchronously retreives messages from the websocket.
 func (connection *Connection) ReadMessage() error {
 
 	// Wait until the websocket read function returns, and inspect the return values.
 	mt, payload, err := connection.WS.ReadMessage()
 	if err != nil {
-		return err
+		return connection.idleError(err)
 	}
 
+	// Record the activity, which pushes back the idle timeout.
+	connection.recordActivity()
+
 	// If the message was read successfully, convert it into the internal message container for use.
-	// within the application.
-	messagePayload := protocol.NewPayloadFromBytes(payload)
-	packagedMessage := protocol.NewMessageFromPayload(protocol.Type(mt), messagePayload)
+	// within the application. Binary messages on a connection that uses the binary encoding are decoded - malformed
+	// messages are treated as a connection error.
+	var packagedMessage protocol.Message
+	if connection.Encoding == protocol.EncodingBinary && mt == websocket.BinaryMessage {
+		packagedMessage, err = protocol.DecodeBinary(payload)
+		if err != nil {
+			return err
+		}
+	} else {
+		messagePayload := protocol.NewPayloadFromBytes(payload)
+		packagedMessage = protocol.NewMessageFromPayload(protocol.Type(mt), messagePayload)
+	}
+
+	// Add the packaged message data to the receive queue, ready to be read by the application. If the queue is full,
+	// the message is dropped rather than blocking (which would stop pongs from being processed) - and once too many
+	// messages have been dropped, the client is considered to be flooding.
+	select {
+	case connection.InboundMessageQueue <- packagedMessage:
+	default:
+		return connection.recordDroppedMessage(time.Now())
+	}
 
-	// Add the packaged message data to the receive queue, ready to be read by the application.
-	connection.InboundMessageQueue <- packagedMessage
+	return nil
+}
+
+// recordDroppedMessage counts an inbound message that was dropped at the specified time, and returns ErrFlooding if
+// too many have been dropped within the current dropped message window. Only called from the read pump.
+func (connection *Connection) recordDroppedMessage(now time.Time) error {
+
+	// Start a new window, if the current one has passed.
+	if now.Sub(connection.droppedWindowStart) > droppedMessageWindow {
+		connection.droppedWindowStart = now
+		connection.droppedCount = 0
+	}
+
+	connection.droppedCount++
+	if connection.droppedCount > maximumDroppedMessages {
+		return ErrFlooding
+	}
 
 	return nil
 }
@@ -98,15 +239,91 @@ func (connection *Connection) ReadMessage() error {
 // WriteMessage synchronously sends messages down the websocket.
 func (connection *Connection) WriteMessage(message protocol.Message) error {
 
-	// Write a message to the websocket based on the passed in message.
-	return connection.WS.WriteMessage(int(message.Type), message.GetPayloadBytes())
+	// Stamp the message with the protocol version for the connection - unless the client is using the legacy
+	// version, in which case the payload is left unchanged.
+	if connection.ProtocolVersion > protocol.LegacyVersion {
+		message.Payload.Version = connection.ProtocolVersion
+	}
+
+	// Set the write deadline, so that a wedged connection cannot block the write indefinitely.
+	connection.WS.SetWriteDeadline(time.Now().Add(maximumWriteWait))
+
+	// Write a message to the websocket based on the passed in message - as a binary message if the connection
+	// uses the binary encoding.
+	var err error
+	if connection.Encoding == protocol.EncodingBinary {
+		var data []byte
+		data, err = protocol.EncodeBinary(message)
+		if err != nil {
+			return err
+		}
+
+		err = connection.WS.WriteMessage(websocket.BinaryMessage, data)
+	} else {
+		err = connection.WS.WriteMessage(int(message.Type), message.GetPayloadBytes())
+	}
+
+	// If the write was successful, increment the written message count, so that other goroutines can determine
+	// whether a particular message has been written yet.
+	if err == nil {
+		atomic.AddUint64(&connection.writtenCount, 1)
+	}
+
+	return err
 }
 
-// SendMessage asynchronously sends a message down the websocket.
+// SendMessage asynchronously sends a message down the websocket. A coalescable message supersedes any coalescable
+// message with the same code that is still in the outbound queue (see isSuperseded).
 func (connection *Connection) SendMessage(message protocol.Message) {
 
+	// Increment the queued message count, which doubles as the sequence number for the message. For coalescable
+	// messages, this is done while holding the lock, so that the latest sequence number recorded for each code is always
+	// the highest.
+	var sequence uint64
+	if message.Coalescable {
+		connection.coalescableLock.Lock()
+		sequence = atomic.AddUint64(&connection.queuedCount, 1)
+		connection.latestCoalescable[message.Payload.Code] = sequence
+		connection.coalescableLock.Unlock()
+	} else {
+		sequence = atomic.AddUint64(&connection.queuedCount, 1)
+	}
+
 	// Add the message to the outbound queue.
-	connection.OutboundMessageQueue <- message
+	connection.OutboundMessageQueue <- outboundMessage{message: message, sequence: sequence}
+}
+
+// isSuperseded returns true if the specified message from the outbound queue is coalescable, and a newer coalescable
+// message with the same code has since been queued - in which case it should be dropped rather than sent. Messages that
+// are not coalescable are never superseded, so their order (relative to each other) is always preserved.
+func (connection *Connection) isSuperseded(outbound outboundMessage) bool {
+	if !outbound.message.Coalescable {
+		return false
+	}
+
+	connection.coalescableLock.Lock()
+	defer connection.coalescableLock.Unlock()
+
+	return connection.latestCoalescable[outbound.message.Payload.Code] != outbound.sequence
+}
+
+// QueuedCount returns the number of messages that have been added to the outbound queue. Once WrittenCount is
+// greater than or equal to this value, all the messages that were queued up until this point have been written.
+func (connection *Connection) QueuedCount() uint64 {
+	return atomic.LoadUint64(&connection.queuedCount)
+}
+
+// WrittenCount returns the number of messages that have been successfully written to the websocket, including those that
+// were dropped because they were superseded.
+func (connection *Connection) WrittenCount() uint64 {
+	return atomic.LoadUint64(&connection.writtenCount)
+}
+
+// DiscardInboundMessages removes and discards all the messages that are currently in the inbound message queue.
+func (connection *Connection) DiscardInboundMessages() {
+	for len(connection.InboundMessageQueue) > 0 {
+		<-connection.InboundMessageQueue
+	}
 }
 
 // GetNextInboundMessage gets the next message from the inbound message queue.
@@ -129,9 +346,15 @@ func (connection *Connection) GetNextOutboundMessage() protocol.Message {
 	for {
 		select {
 
-		// Blocks until read.
-		case message := <-connection.OutboundMessageQueue:
-			return message
+		// Blocks until read. Superseded messages are dropped, and counted as written, as there is nothing left to wait
+		// for - the newer message that superseded them is sent instead.
+		case outbound := <-connection.OutboundMessageQueue:
+			if connection.isSuperseded(outbound) {
+				atomic.AddUint64(&connection.writtenCount, 1)
+				continue
+			}
+
+			return outbound.message
 
 		// The ping timer is able to bypass the blocked queue read, enabling the ping message to be sent.
 		case <-connection.pingTimer.C:
@@ -146,25 +369,42 @@ func (connection *Connection) GetNextOutboundMessage() protocol.Message {
 	}
 }
 
-// Close closes the connection.
-func (connection *Connection) Close() error {
+// Close performs the close handshake with a close code and reason based on the specified message, and then closes
+// the connection.
+func (connection *Connection) Close(message protocol.Message) error {
 
 	// Stop the ping timer to avoid it triggering while the websocket is in an invalid state due to being closed,
 	// or being in the process of closing etc..
 	connection.pingTimer.Stop()
 
 	// Close the websocket connection, and return any errors.
-	return connection.WS.Close()
+	return CloseWebsocket(connection.WS, message, connection.closeReceived)
+}
+
+// CloseAfterWait schedules the connection to be closed (as per Close) after the close wait period, so that any
+// messages that were queued just before can be sent first. Does not block.
+//
+// A timer is used rather than a sleeping goroutine, so that no goroutine exists for the connection until the wait
+// period has elapsed - and once it has, the goroutine lives only as long as the close handshake. Only the first call
+// has any effect, so a connection that is closed more than once will not schedule multiple closes.
+func (connection *Connection) CloseAfterWait(message protocol.Message) {
+	connection.closeScheduledOnce.Do(func() {
+		time.AfterFunc(closeWaitPeriod, func() {
+			connection.Close(message)
+		})
+	})
 }
 
-// NewConnection creates a new connection.
-func NewConnection(wsconn *websocket.Conn) *Connection {
+// NewConnection creates a new connection, that uses the specified protocol version and message encoding.
+func NewConnection(wsconn *websocket.Conn, protocolVersion uint16, encoding protocol.Encoding) *Connection {
 
 	// Create a new connection, with the provided websocket connection.
 	connection := Connection{
-		WS:      wsconn,
-		Joined:  time.Now(),
-		Latency: time.Second * 0,
+		WS:              wsconn,
+		Joined:          time.Now(),
+		Latency:         time.Second * 0,
+		ProtocolVersion: protocolVersion,
+		Encoding:        encoding,
 	}
 
 	// Initialise, and then return the connection.
@@ -0,0 +1,212 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package connection
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// TestPongWaitForLatency checks that the pong wait is extended by a multiple of the measured latency, that it is never
+// shorter than the base wait (even for a negative latency), and that it is clamped to the maximum without overflowing.
+func TestPongWaitForLatency(t *testing.T) {
+
+	// The latency at which the extended wait reaches the maximum.
+	limit := (maximumPongWait - pongWait) / pongWaitLatencyMultiple
+
+	tests := []struct {
+		name     string
+		latency  time.Duration
+		expected time.Duration
+	}{
+		{"No latency", 0, pongWait},
+		{"Negative latency", -time.Second, pongWait},
+		{"Low latency", time.Millisecond * 100, pongWait + time.Millisecond*100*pongWaitLatencyMultiple},
+		{"Latency at the limit", limit, maximumPongWait},
+		{"Latency past the limit", limit + time.Millisecond, maximumPongWait},
+		{"Latency that would overflow", time.Duration(math.MaxInt64), maximumPongWait},
+	}
+
+	for _, test := range tests {
+		if wait := pongWaitForLatency(test.latency); wait != test.expected {
+			t.Errorf("%s: waited [%v], expected [%v]", test.name, wait, test.expected)
+		}
+	}
+}
+
+// TestRecordDroppedMessage checks that a client is only considered to be flooding once more than the maximum number
+// of messages have been dropped within a single window.
+func TestRecordDroppedMessage(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name     string
+		drops    int
+		interval time.Duration
+		flooding bool
+	}{
+		{"Burst within the limit", maximumDroppedMessages, 0, false},
+		{"Burst over the limit", maximumDroppedMessages + 1, 0, true},
+		{"Spread over the limit, within one window", maximumDroppedMessages + 1, droppedMessageWindow / (maximumDroppedMessages * 2), true},
+		{"Spread over the limit, across windows", maximumDroppedMessages * 4, droppedMessageWindow / (maximumDroppedMessages / 2), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			connection := &Connection{}
+
+			var err error
+			for i := 0; i < test.drops && err == nil; i++ {
+				err = connection.recordDroppedMessage(start.Add(test.interval * time.Duration(i)))
+			}
+
+			if flooding := err == ErrFlooding; flooding != test.flooding {
+				t.Fatalf("Flooding is %v after %d drops, %v apart - expected %v", flooding, test.drops, test.interval, test.flooding)
+			}
+		})
+	}
+}
+
+// TestReadMessageFlooding checks that a client that fills the inbound queue, which nothing is draining, has their
+// extra messages dropped rather than blocking the read pump - and that the read fails with ErrFlooding, rather than a
+// read deadline, once too many have been dropped.
+func TestReadMessageFlooding(t *testing.T) {
+	conn, peer := newTestWebsocket(t)
+	connection := NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON)
+
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|2:")
+	for i := 0; i < MessageBufferSize+maximumDroppedMessages+1; i++ {
+		if err := peer.WriteMessage(websocket.TextMessage, message.GetPayloadBytes()); err != nil {
+			t.Fatalf("Failed to write message %d: %v", i, err)
+		}
+	}
+
+	// Every message up until the last one is either queued or dropped.
+	for i := 0; i < MessageBufferSize+maximumDroppedMessages; i++ {
+		if err := connection.ReadMessage(); err != nil {
+			t.Fatalf("Reading message %d failed: %v", i, err)
+		}
+	}
+
+	if err := connection.ReadMessage(); err != ErrFlooding {
+		t.Fatalf("Reading the last message returned [%v], expected [%v]", err, ErrFlooding)
+	}
+
+	if queued := len(connection.InboundMessageQueue); queued != MessageBufferSize {
+		t.Fatalf("%d messages were queued, expected %d", queued, MessageBufferSize)
+	}
+}
+
+// closeAfterWaitConnections is the number of connections that are closed at once when checking for leaked goroutines.
+const closeAfterWaitConnections = 200
+
+// TestCloseAfterWaitGoroutines closes many connections at once (each more than once), as when every client disconnects
+// during a restart, and checks that no goroutine is held for each connection during the close wait period - and that
+// once the close handshakes are done, every connection has been closed and no goroutines are left behind.
+func TestCloseAfterWaitGoroutines(t *testing.T) {
+	period := closeWaitPeriod
+	closeWaitPeriod = time.Millisecond * 200
+	t.Cleanup(func() { closeWaitPeriod = period })
+
+	connections := make([]*Connection, 0, closeAfterWaitConnections)
+	peers := make([]*websocket.Conn, 0, closeAfterWaitConnections)
+	for i := 0; i < closeAfterWaitConnections; i++ {
+		conn, peer := newTestWebsocket(t)
+		connections = append(connections, NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON))
+		peers = append(peers, peer)
+	}
+
+	baseline := runtime.NumGoroutine()
+
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCServerMaintenance, "Server is in maintenance")
+	for _, connection := range connections {
+		connection.CloseAfterWait(message)
+		connection.CloseAfterWait(message)
+	}
+
+	// A handful of goroutines may come and go, but not one per connection.
+	if extra := runtime.NumGoroutine() - baseline; extra >= closeAfterWaitConnections/10 {
+		t.Fatalf("%d goroutines were started while waiting to close %d connections", extra, closeAfterWaitConnections)
+	}
+
+	// Nothing reads from the connections, so each close handshake waits for the full handshake wait.
+	deadline := time.Now().Add(closeWaitPeriod + closeHandshakeWait*3)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are left [%v] after closing %d connections", runtime.NumGoroutine()-baseline, closeWaitPeriod+closeHandshakeWait*3, closeAfterWaitConnections)
+		}
+
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	for _, peer := range peers {
+		expectCloseFrame(t, peer, websocket.CloseTryAgainLater, "Server is in maintenance")
+	}
+}
+
+// TestCoalescableMessages queues stale and fresh copies of coalescable messages between moves, writes everything in the
+// outbound queue, and checks that only the freshest copy of each coalescable message is written (in its own place in
+// the queue), that the moves are written in the order in which they were queued, and that the superseded copies are
+// still counted as written.
+func TestCoalescableMessages(t *testing.T) {
+	conn, peer := newTestWebsocket(t)
+	connection := NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON)
+
+	queued := []protocol.Message{
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMakingMatchFound, "stale").AsCoalescable(),
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|7:"),
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAnnouncement, "announcement").AsCoalescable(),
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMakingMatchFound, "stale").AsCoalescable(),
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "2|6:"),
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMakingMatchFound, "fresh").AsCoalescable(),
+		protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "3|10:5"),
+	}
+
+	expected := []protocol.Payload{
+		{Code: protocol.WSCMatchMove, Message: "1|7:"},
+		{Code: protocol.WSCServerAnnouncement, Message: "announcement"},
+		{Code: protocol.WSCMatchMove, Message: "2|6:"},
+		{Code: protocol.WSCMatchMakingMatchFound, Message: "fresh"},
+		{Code: protocol.WSCMatchMove, Message: "3|10:5"},
+	}
+
+	for _, message := range queued {
+		connection.SendMessage(message)
+	}
+
+	for len(connection.OutboundMessageQueue) > 0 {
+		if err := connection.WriteMessage(connection.GetNextOutboundMessage()); err != nil {
+			t.Fatalf("Failed to write a message: %v", err)
+		}
+	}
+
+	if written, queued := connection.WrittenCount(), connection.QueuedCount(); written != queued {
+		t.Fatalf("%d of %d queued messages were counted as written", written, queued)
+	}
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	for _, payload := range expected {
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read [%d: %s]: %v", payload.Code, payload.Message, err)
+		}
+
+		if received := protocol.NewPayloadFromBytes(data); received.Code != payload.Code || received.Message != payload.Message {
+			t.Fatalf("Received [%d: %s], expected [%d: %s]", received.Code, received.Message, payload.Code, payload.Message)
+		}
+	}
+
+	// Nothing else was written.
+	peer.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
+	if _, data, err := peer.ReadMessage(); err == nil {
+		t.Fatalf("Received [%s], expected nothing else", data)
+	}
+}
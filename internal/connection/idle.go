@@ -0,0 +1,76 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package connection implements a websocket connection wrapper with various helper functions.
+package connection
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/gorilla/websocket"
+)
+
+// defaultIdleTimeout is the default maximum time that a connection can stay open without the client sending any
+// messages (other than control frames, such as pings and pongs).
+const defaultIdleTimeout = time.Minute * 15
+
+// idleTimeout is the maximum time that a connection can stay open without the client sending any messages - control
+// frames don't count, so a client can't keep a connection open with pings and pongs alone. Configured via the
+// "connection_idle_timeout" environment variable - zero disables the idle timeout.
+var idleTimeout = envvar.Duration("connection_idle_timeout", defaultIdleTimeout)
+
+// ErrIdleTimeout is returned when reading from a connection whose client has not sent any messages for longer than the
+// idle timeout.
+var ErrIdleTimeout = errors.New("Client has not sent any messages for too long")
+
+// pingHandler handles ping frames from the client, by responding with a pong frame, as the default ping handler would.
+// Unlike pongs (see pongHandler), pings never extend the read deadline, as they are sent at the client's discretion.
+func (connection *Connection) pingHandler(appData string) error {
+	err := connection.WS.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(maximumWriteWait))
+
+	// Errors caused by the connection closing, or temporary network errors, are ignored - as with the default handler.
+	if err == websocket.ErrCloseSent {
+		return nil
+	} else if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+		return nil
+	}
+
+	return err
+}
+
+// setReadDeadline sets the read deadline for the websocket to the specified time, unless the idle timeout would elapse
+// before then, in which case the deadline is set to when the idle timeout will elapse. The specified time is stored,
+// so that the deadline can be updated when the client next sends a message (see recordActivity). Only called from the
+// read pump (including the control frame handlers).
+func (connection *Connection) setReadDeadline(deadline time.Time) {
+	connection.keepAliveDeadline = deadline
+
+	if idleTimeout > 0 {
+		if idleDeadline := connection.lastActivityTime.Add(idleTimeout); idleDeadline.Before(deadline) {
+			deadline = idleDeadline
+		}
+	}
+
+	connection.WS.SetReadDeadline(deadline)
+}
+
+// recordActivity records that the client sent a message, and updates the read deadline accordingly. Only called from
+// the read pump.
+func (connection *Connection) recordActivity() {
+	connection.lastActivityTime = time.Now()
+	connection.setReadDeadline(connection.keepAliveDeadline)
+}
+
+// idleError returns ErrIdleTimeout in place of the specified read error, if it was caused by the read deadline being
+// reached after the idle timeout elapsed. Otherwise, the error is returned unchanged. Only called from the read pump.
+func (connection *Connection) idleError(err error) error {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && idleTimeout > 0 && time.Since(connection.lastActivityTime) >= idleTimeout {
+		return ErrIdleTimeout
+	}
+
+	return err
+}
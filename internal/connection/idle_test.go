@@ -0,0 +1,77 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package connection
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// testIdleTimeout is the idle timeout used when checking that idle connections are closed - long enough for several
+// pings to be sent before it elapses.
+const testIdleTimeout = time.Millisecond * 300
+
+// TestPingsDontPreventIdleTimeout sends nothing but pings from a raw websocket client, and checks that each one is
+// answered with a pong, but that the connection is still closed with ErrIdleTimeout once the idle timeout has elapsed.
+func TestPingsDontPreventIdleTimeout(t *testing.T) {
+	timeout := idleTimeout
+	idleTimeout = testIdleTimeout
+	t.Cleanup(func() { idleTimeout = timeout })
+
+	conn, peer := newTestWebsocket(t)
+	connection := NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON)
+	start := time.Now()
+
+	// The client's reads are only needed to handle the pongs.
+	var pongs int32
+	peer.SetPongHandler(func(string) error {
+		atomic.AddInt32(&pongs, 1)
+		return nil
+	})
+
+	go func() {
+		for {
+			if _, _, err := peer.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(testIdleTimeout / 10)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := peer.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	if err := connection.ReadMessage(); err != ErrIdleTimeout {
+		t.Fatalf("Reading returned [%v], expected [%v]", err, ErrIdleTimeout)
+	}
+
+	if elapsed := time.Since(start); elapsed < testIdleTimeout || elapsed > testIdleTimeout*3 {
+		t.Fatalf("Connection was closed after [%v], expected [%v]", elapsed, testIdleTimeout)
+	}
+
+	if atomic.LoadInt32(&pongs) == 0 {
+		t.Fatalf("No pings were answered")
+	}
+}
@@ -10,76 +10,95 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql" // mysql driver - Isn't explicitly used, so imported with no label.
 )
 
-// authExpiryGracePeriod defines the minimum duration of validity remaining for a auth token before it's considered invalid.
-// This exists so that we can avoid race conditions that could occur if a token is changed in the database during an auth
-// check.
-const authExpiryGracePeriod = time.Minute * 10
+// defaultAuthExpiryGracePeriod defines the default minimum duration of validity remaining for a auth token before it's
+// considered invalid. This exists so that we can avoid race conditions that could occur if a token is changed in the
+// database during an auth check.
+const defaultAuthExpiryGracePeriod = time.Minute * 10
+
+// Values for the "phase" column of the matches table, for matches that have concluded. Finished matches have a
+// winner, while draws, no contest and aborted matches have a null winner - the phase is what tells them apart.
+const (
+	matchPhaseFinished  = 2
+	matchPhaseNoContest = 3
+	matchPhaseDraw      = 4
+	matchPhaseAborted   = 5
+)
+
+// MySQLStore is a Store that is backed by a MySQL database.
+type MySQLStore struct {
 
-var (
-	// db is a pointer to this packages single instance of a database connection.
+	// The database connection.
 	db *sql.DB
 
-	// envvars is a container for all of the environment variables used by the database package.
+	// A container for all of the environment variables used by the store.
 	envvars EnvironmentVariables
 
-	// pstatements is a container for all of the prepared staments used by the database package.
+	// A container for all of the prepared staments used by the store.
 	pstatements PreparedStatements
-)
+}
 
-// Init should be called at the start of the function. It opens a connection to the database
+// NewMySQLStore creates and returns a pointer to a new MySQL store. It opens a connection to the database
 // based on the parameters defined by environment variables, as specified by the EnvironmentVariables struct.
-func Init() {
+func NewMySQLStore() *MySQLStore {
+
+	// Create a new store.
+	store := MySQLStore{}
 
 	// Attempt to load and store the environment variables. Failure here will
 	// cause a panic - the server can not function if the database's environment variables are not
 	// present, or could not be loaded properly.
-	err := envvars.Load()
+	err := store.envvars.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Based on the environment variables that were loaded above, construct all of the prepared statements that
 	// the database will use.
-	pstatements.Construct(&envvars)
+	store.pstatements.Construct(&store.envvars)
 
 	// Construct the connection string for the database connection.
-	var connString = fmt.Sprintf("%v:%v@(%v:%v)/%v?tls=skip-verify&parseTime=true", envvars.DBUsername, envvars.DBPass, envvars.DBURL, envvars.DBPort, envvars.DBName)
+	var connString = fmt.Sprintf("%v:%v@(%v:%v)/%v?tls=skip-verify&parseTime=true", store.envvars.DBUsername, store.envvars.DBPass, store.envvars.DBURL, store.envvars.DBPort, store.envvars.DBName)
 
 	// Attempt to open the connection based on the connection string above. Failure here will
 	// cause a panic, as the server cannot function is the database instance is not valid.
-	// The resultant database object when successful is stored in the instance variable for this package.
-	db, err = sql.Open("mysql", connString)
+	// The resultant database object when successful is stored in the store.
+	store.db, err = sql.Open("mysql", connString)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	log.Println("Database connection initiated successfully")
+
+	// Return a pointer to the newly created store.
+	return &store
 }
 
-// ValidateAuth checks the specified database ID and token to see if they match and are valid.
-func ValidateAuth(publicID string, authToken string) (databaseID uint64, err error) {
+// ValidateAuth checks the specified database ID and token to see if they match and are valid. Returns one of
+// ErrUserNotFound, ErrUserBanned, ErrTokenInvalid, ErrTokenExpired or ErrDatabase if they are not.
+func (store *MySQLStore) ValidateAuth(publicID string, authToken string) (databaseID uint64, err error) {
 
 	// Attempt to get the user's Database ID, and ban status.
-	databaseID, banned, err := getUser(publicID)
+	databaseID, banned, err := store.getUser(publicID)
 	if err != nil {
 		return databaseID, err
 	}
 
 	// Exit earlier with an error if the user is banned.
 	if banned {
-		return databaseID, errors.New("User is banned")
+		return databaseID, ErrUserBanned
 	}
 
 	// Prepare a statement that will fetch the expiry datetime for the specified user's auth token.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.GetAuthExpiry)
+	statement, err := store.db.Prepare(store.pstatements.GetAuthExpiry)
 	if err != nil {
-		return databaseID, errors.New("Internal server error: Failed to prepare statement")
+		return databaseID, databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
@@ -90,27 +109,77 @@ func ValidateAuth(publicID string, authToken string) (databaseID uint64, err err
 	// An error means that either a row was not found, or there was a database error.
 	var expiry time.Time
 	err = statement.QueryRow(databaseID, authToken).Scan(&expiry)
-	if err != nil {
-		return databaseID, errors.New("Token is invalid")
+	if err == sql.ErrNoRows {
+		return databaseID, ErrTokenInvalid
+	} else if err != nil {
+		return databaseID, databaseError(err)
 	}
 
-	// If the token is expired (less than [authExpiryGracePeriod] time remains until the expiry datetime), return
+	// If the token is expired (less than [AuthExpiryGracePeriod] time remains until the expiry datetime), return
 	// an appropriate error.
-	if expiry.Sub(time.Now()) <= authExpiryGracePeriod {
-		return databaseID, errors.New("Token is expired")
+	if expiry.Sub(time.Now()) <= store.envvars.AuthExpiryGracePeriod {
+		return databaseID, ErrTokenExpired
 	}
 
 	return databaseID, err
 }
 
+// GetBannedAmong returns the database IDs of the users that are banned, out of the specified database IDs - so that
+// players who were banned after they connected can be removed.
+func (store *MySQLStore) GetBannedAmong(databaseIDs []uint64) (banned []uint64, err error) {
+
+	// Early exit if there is nothing to check, as an empty IN() list is not valid.
+	if len(databaseIDs) == 0 {
+		return banned, nil
+	}
+
+	// Prepare a statement that will fetch the banned users out of the specified database IDs.
+	// Exit on error.
+	placeholders, args := inList(databaseIDs)
+	statement, err := store.db.Prepare(fmt.Sprintf(store.pstatements.GetBannedAmong, placeholders))
+	if err != nil {
+		return banned, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the users table with the specified database IDs.
+	// The returned rows should have a single column - the database ID of a banned user.
+	// An error means that there was a database error.
+	rows, err := statement.Query(args...)
+	if err != nil {
+		return banned, databaseError(err)
+	}
+
+	// Defer closing of the rows so that they are cleaned up properly when this function exits.
+	defer rows.Close()
+
+	// Read each row into the output slice.
+	for rows.Next() {
+		var databaseID uint64
+		if err = rows.Scan(&databaseID); err != nil {
+			return banned, databaseError(err)
+		}
+
+		banned = append(banned, databaseID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return banned, databaseError(err)
+	}
+
+	return banned, nil
+}
+
 // GetMMR returns the current MMR for the specified user.
-func GetMMR(databaseID uint64) (MMR int, err error) {
+func (store *MySQLStore) GetMMR(databaseID uint64) (MMR int, err error) {
 
 	// Prepare a statement that will fetch the MMR for the specified user.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.GetMMR)
+	statement, err := store.db.Prepare(store.pstatements.GetMMR)
 	if err != nil {
-		return MMR, errors.New("Internal server error: Failed to prepare statement")
+		return MMR, databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
@@ -120,78 +189,101 @@ func GetMMR(databaseID uint64) (MMR int, err error) {
 	// The returned row should have a single column - the MMR for the user.
 	// An error means that either a row was not found, or there was a database error.
 	err = statement.QueryRow(databaseID).Scan(&MMR)
-	if err != nil {
-		return MMR, errors.New("User does not exist")
+	if err == sql.ErrNoRows {
+		return MMR, ErrUserNotFound
+	} else if err != nil {
+		return MMR, databaseError(err)
 	}
 
 	return MMR, nil
 }
 
-// CreateMatch creates a match with the two clients specified, and returns the match id.
-func CreateMatch(client1DatabaseID uint64, client2DatabaseID uint64) (matchID uint64, err error) {
+// MatchPlayer is a player in a match, along with their display name, avatar and MMR when the match was created. They
+// are stored with the match, so that the game server doesn't need to fetch them again when the player connects.
+type MatchPlayer struct {
+	DatabaseID  uint64
+	DisplayName string
+	Avatar      uint8
+	MMR         int
+}
+
+// CreateMatch creates a match with the two players specified, and returns the match id. The turn time is stored
+// with a resolution of one second - zero means that the game server's default turn time is used.
+func (store *MySQLStore) CreateMatch(player1 MatchPlayer, player2 MatchPlayer, turnTime time.Duration) (matchID uint64, err error) {
 
 	// Prepare a statement that will add an entry to the matches table with the specified match details.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.CreateMatch)
+	statement, err := store.db.Prepare(store.pstatements.CreateMatch)
 	if err != nil {
-		return matchID, errors.New("Internal server error: Failed to prepare statement")
+		return matchID, databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
 	defer statement.Close()
 
-	// Query the matches table with the specified database ID's.
+	// Query the matches table with the specified players.
 	// The returned value contains information about the outcome of executing the command.
 	// An error means that either the specified values were invalid, or there was a database error.
-	res, err := statement.Exec(client1DatabaseID, client2DatabaseID)
+	res, err := statement.Exec(
+		player1.DatabaseID, player1.DisplayName, player1.Avatar, player1.MMR,
+		player2.DatabaseID, player2.DisplayName, player2.Avatar, player2.MMR,
+		int(turnTime.Seconds()),
+	)
 	if err != nil {
-		return matchID, err
+		return matchID, databaseError(err)
 	}
 
 	// Read the last insert ID from the result from the previous query - this is the match ID,
 	// which is used as the return value for this function.
 	matchIDInt, err := res.LastInsertId()
 	if err != nil {
-		return matchID, err
+		return matchID, databaseError(err)
 	}
 
 	matchID = uint64(matchIDInt)
 
-	return matchID, err
+	return matchID, nil
 }
 
-// ValidateMatch returns true if the specified match exists, and the specified client is part of it.
-func ValidateMatch(databaseID uint64, matchID uint64) (valid bool, err error) {
+// ValidateMatch returns true if the specified match exists, and the specified client is part of it, along with
+// the turn time for the match (zero if the match uses the default turn time), and the display name, avatar and MMR
+// that the client had when the match was created.
+func (store *MySQLStore) ValidateMatch(databaseID uint64, matchID uint64) (valid bool, turnTime time.Duration, player MatchPlayer, err error) {
 
 	// Prepare a statement that will check if a match exists in the matches table with the specified match
 	// ID, and the specified user is present. Exit on error.
-	statement, err := db.Prepare(pstatements.CheckMatchValid)
+	statement, err := store.db.Prepare(store.pstatements.CheckMatchValid)
+	if err != nil {
+		return false, turnTime, player, databaseError(err)
+	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
 	defer statement.Close()
 
-	// Query the matches table with the specified user and match ID.
-	// The returned row should have a single column - the outcome (true or false) of the query.
+	// Query the matches table (joined with the users and profiles tables) with the specified user and match ID.
+	// The returned row should have four columns - the turn time for the match in seconds, and the display name, avatar
+	// and MMR of the user.
 	// An error means that either the row was not found, or there was a database error.
-	var found bool
-	err = statement.QueryRow(matchID, databaseID).Scan(&found)
+	var turnTimeSeconds int
+	player.DatabaseID = databaseID
+	err = statement.QueryRow(databaseID, databaseID, databaseID, databaseID, matchID).Scan(&turnTimeSeconds, &player.DisplayName, &player.Avatar, &player.MMR)
 	if err == sql.ErrNoRows {
-		return false, errors.New("Invalid - either the match does not exist, or the specified client is not part of it")
+		return false, turnTime, player, errors.New("Invalid - either the match does not exist, or the specified client is not part of it")
 	} else if err != nil {
-		return false, err
+		return false, turnTime, player, databaseError(err)
 	}
 
-	return found, nil
+	return true, time.Duration(turnTimeSeconds) * time.Second, player, nil
 }
 
 // GetClientNameAndAvatar returns the displayname and avatar id for the specified user.
-func GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8, err error) {
+func (store *MySQLStore) GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8, err error) {
 
 	// Prepare a statement that will fetch the display name for the specified user.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.GetDisplayName)
+	statement, err := store.db.Prepare(store.pstatements.GetDisplayName)
 	if err != nil {
-		return displayname, 0, errors.New("Internal server error: Failed to prepare statement")
+		return displayname, 0, databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
@@ -201,20 +293,22 @@ func GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8
 	// The returned row should have a single column - the display name for the user.
 	// An error means that either a row was not found, or there was a database error.
 	err = statement.QueryRow(databaseID).Scan(&displayname)
-	if err != nil {
-		return displayname, 0, errors.New("User does not exist")
+	if err == sql.ErrNoRows {
+		return displayname, 0, ErrUserNotFound
+	} else if err != nil {
+		return displayname, 0, databaseError(err)
 	}
 
 	// Close the previous statement, so that its resources are cleared (locally and/or on the database).
 	err = statement.Close()
 	if err != nil {
-		return displayname, 0, errors.New("Failed to close statement")
+		return displayname, 0, databaseError(err)
 	}
 
 	// Prepare a statement that will fetch the avatar id for the specified user.
-	statement, err = db.Prepare(pstatements.GetAvatar)
+	statement, err = store.db.Prepare(store.pstatements.GetAvatar)
 	if err != nil {
-		return displayname, 0, errors.New("Internal server error: Failed to prepare statement")
+		return displayname, 0, databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
@@ -224,21 +318,79 @@ func GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8
 	// The returned row should have a single column - the avatar id for the user.
 	// An error means that either a row was not found, or there was a database error.
 	err = statement.QueryRow(databaseID).Scan(&avatar)
-	if err != nil {
-		return displayname, 0, errors.New("User does not exist")
+	if err == sql.ErrNoRows {
+		return displayname, 0, ErrUserNotFound
+	} else if err != nil {
+		return displayname, 0, databaseError(err)
 	}
 
 	return displayname, avatar, nil
 }
 
+// ClientProfile is the display name and avatar id for a single user.
+type ClientProfile struct {
+	DisplayName string
+	Avatar      uint8
+}
+
+// GetClientsNameAndAvatar returns the displayname and avatar id for each of the specified users, in a single query,
+// keyed by database ID. Users that do not exist are left out.
+func (store *MySQLStore) GetClientsNameAndAvatar(databaseIDs []uint64) (profiles map[uint64]ClientProfile, err error) {
+	profiles = make(map[uint64]ClientProfile, len(databaseIDs))
+
+	// Early exit if there is nothing to fetch, as an empty IN() list is not valid.
+	if len(databaseIDs) == 0 {
+		return profiles, nil
+	}
+
+	// Prepare a statement that will fetch the display name and avatar id for the specified users.
+	// Exit on error.
+	placeholders, args := inList(databaseIDs)
+	statement, err := store.db.Prepare(fmt.Sprintf(store.pstatements.GetProfiles, placeholders))
+	if err != nil {
+		return profiles, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the users table (joined with the profiles table) with the specified database IDs.
+	// The returned rows should have three columns - the database ID, the display name and the avatar id.
+	// An error means that there was a database error.
+	rows, err := statement.Query(args...)
+	if err != nil {
+		return profiles, databaseError(err)
+	}
+
+	// Defer closing of the rows so that they are cleaned up properly when this function exits.
+	defer rows.Close()
+
+	// Read each row into the output map.
+	for rows.Next() {
+		var databaseID uint64
+		var profile ClientProfile
+		if err = rows.Scan(&databaseID, &profile.DisplayName, &profile.Avatar); err != nil {
+			return profiles, databaseError(err)
+		}
+
+		profiles[databaseID] = profile
+	}
+
+	if err = rows.Err(); err != nil {
+		return profiles, databaseError(err)
+	}
+
+	return profiles, nil
+}
+
 // SetMatchStart updates the phase + start time column for the specified match.
-func SetMatchStart(matchID uint64) (err error) {
+func (store *MySQLStore) SetMatchStart(matchID uint64) (err error) {
 
 	// Prepare a statement that will update the row in the matches table with the specified match ID.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.SetMatchStart)
+	statement, err := store.db.Prepare(store.pstatements.SetMatchStart)
 	if err != nil {
-		return errors.New("Internal server error: Failed to prepare statement")
+		return databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
@@ -249,44 +401,337 @@ func SetMatchStart(matchID uint64) (err error) {
 	// An error means that either the specified values were invalid, or there was a database error.
 	_, err = statement.Exec(matchID)
 	if err != nil {
-		return err
+		return databaseError(err)
 	}
 
-	return err
+	return nil
 }
 
 // SetMatchResult updates the specified match with the winner, end time, and sets phase to 2 (finished).
-func SetMatchResult(matchID uint64, winnerDatabaseID uint64) (err error) {
+func (store *MySQLStore) SetMatchResult(matchID uint64, winnerDatabaseID uint64) (err error) {
+
+	// Prepare a statement that will update the row in the matches table with the specified match ID.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.SetMatchResult)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the matches table with the new match phase (2 - finished), specified match ID, and the databaseID of the winning player.
+	// The returned value is ignored, as it will not contain any data that we need.
+	// An error means that either the specified values were invalid, or there was a database error.
+	_, err = statement.Exec(matchPhaseFinished, winnerDatabaseID, matchID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// SetMatchNoContest updates the specified match with the end time, and sets phase to 3 (no contest). No winner is
+// recorded, so the match does not count as a win, loss or draw for either player.
+func (store *MySQLStore) SetMatchNoContest(matchID uint64) (err error) {
+
+	// Prepare a statement that will update the row in the matches table with the specified match ID.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.SetMatchResult)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the matches table with the new match phase (3 - no contest), a null winner, and the specified match ID.
+	// The returned value is ignored, as it will not contain any data that we need.
+	// An error means that either the specified values were invalid, or there was a database error.
+	_, err = statement.Exec(matchPhaseNoContest, nil, matchID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// SetMatchDraw updates the specified match with the end time, and sets phase to 4 (draw). No winner is recorded, but
+// unlike a no contest match, the match counts as a draw for both players.
+func (store *MySQLStore) SetMatchDraw(matchID uint64) (err error) {
+
+	// Prepare a statement that will update the row in the matches table with the specified match ID.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.SetMatchResult)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the matches table with the new match phase (4 - draw), a null winner, and the specified match ID.
+	// The returned value is ignored, as it will not contain any data that we need.
+	// An error means that either the specified values were invalid, or there was a database error.
+	_, err = statement.Exec(matchPhaseDraw, nil, matchID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// SetMatchAborted updates the specified match with the end time, and sets phase to 5 (aborted). Used for matches that
+// never started, as one of the players did not connect. No winner is recorded, so the match does not count as a win,
+// loss or draw for either player.
+func (store *MySQLStore) SetMatchAborted(matchID uint64) (err error) {
 
 	// Prepare a statement that will update the row in the matches table with the specified match ID.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.SetMatchResult)
+	statement, err := store.db.Prepare(store.pstatements.SetMatchResult)
 	if err != nil {
-		return errors.New("Internal server error: Failed to prepare statement")
+		return databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
 	defer statement.Close()
 
-	// Query the matches table with the new match phase (2 - ended), specified match ID, and the databaseID of the winning player.
+	// Query the matches table with the new match phase (5 - aborted), a null winner, and the specified match ID.
 	// The returned value is ignored, as it will not contain any data that we need.
 	// An error means that either the specified values were invalid, or there was a database error.
-	_, err = statement.Exec(2, winnerDatabaseID, matchID)
+	_, err = statement.Exec(matchPhaseAborted, nil, matchID)
 	if err != nil {
-		return err
+		return databaseError(err)
 	}
 
-	return err
+	return nil
+}
+
+// RecordMatchAudit adds an audit record for the conclusion of the specified match, including how it ended (reason),
+// how long it lasted, and how many moves were made. Audit records are never updated once written.
+func (store *MySQLStore) RecordMatchAudit(matchID uint64, player1DatabaseID uint64, player2DatabaseID uint64, winnerDatabaseID uint64, reason uint16, duration time.Duration, moves int) (err error) {
+
+	// Prepare a statement that will add an entry to the audit table with the specified details.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.RecordMatchAudit)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the audit table with the specified details. The duration is stored in milliseconds.
+	// The returned value is ignored, as it will not contain any data that we need.
+	// An error means that either the specified values were invalid, or there was a database error.
+	_, err = statement.Exec(matchID, player1DatabaseID, player2DatabaseID, winnerDatabaseID, reason, duration.Milliseconds(), moves)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// RecentMatch describes a finished match, from the perspective of one of the players.
+type RecentMatch struct {
+
+	// The display name of the opponent.
+	OpponentDisplayName string
+
+	// The database ID of the winner - zero for a draw.
+	Winner uint64
+
+	// The time at which the match ended.
+	End time.Time
+}
+
+// GetRecentMatches returns up to (limit) of the most recently finished matches for the specified user, most recent first.
+func (store *MySQLStore) GetRecentMatches(databaseID uint64, limit int) (matches []RecentMatch, err error) {
+
+	// Prepare a statement that will fetch the recent matches for the specified user.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.GetRecentMatches)
+	if err != nil {
+		return matches, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the matches table (joined with the users table) with the specified database ID and limit.
+	// The returned rows should have three columns - the opponent's display name, the winner, and the end time.
+	// An error means that there was a database error.
+	rows, err := statement.Query(databaseID, databaseID, limit)
+	if err != nil {
+		return matches, databaseError(err)
+	}
+
+	// Defer closing of the rows so that they are cleaned up properly when this function exits.
+	defer rows.Close()
+
+	// Read each row into a recent match, and add it to the output slice.
+	for rows.Next() {
+		var match RecentMatch
+		var winner sql.NullInt64
+		err = rows.Scan(&match.OpponentDisplayName, &winner, &match.End)
+		if err != nil {
+			return matches, databaseError(err)
+		}
+
+		// A null winner is treated as a draw.
+		match.Winner = uint64(winner.Int64)
+
+		matches = append(matches, match)
+	}
+
+	if err = rows.Err(); err != nil {
+		return matches, databaseError(err)
+	}
+
+	return matches, nil
+}
+
+// RecentOpponent describes an opponent from a finished match, from the perspective of one of the players.
+type RecentOpponent struct {
+
+	// The database ID of the opponent.
+	DatabaseID uint64
+
+	// The time at which the match ended.
+	End time.Time
+}
+
+// GetRecentOpponents returns the opponents from up to (limit) of the most recently finished matches for the specified user,
+// most recent first. An opponent appears once for each match against them.
+func (store *MySQLStore) GetRecentOpponents(databaseID uint64, limit int) (opponents []RecentOpponent, err error) {
+
+	// Prepare a statement that will fetch the recent opponents for the specified user.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.GetRecentOpponents)
+	if err != nil {
+		return opponents, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the matches table with the specified database ID and limit.
+	// The returned rows should have two columns - the opponent's database ID, and the end time.
+	// An error means that there was a database error.
+	rows, err := statement.Query(databaseID, databaseID, limit)
+	if err != nil {
+		return opponents, databaseError(err)
+	}
+
+	// Defer closing of the rows so that they are cleaned up properly when this function exits.
+	defer rows.Close()
+
+	// Read each row into a recent opponent, and add it to the output slice.
+	for rows.Next() {
+		var opponent RecentOpponent
+		err = rows.Scan(&opponent.DatabaseID, &opponent.End)
+		if err != nil {
+			return opponents, databaseError(err)
+		}
+
+		opponents = append(opponents, opponent)
+	}
+
+	if err = rows.Err(); err != nil {
+		return opponents, databaseError(err)
+	}
+
+	return opponents, nil
+}
+
+// PlayerStats is a summary of the match record and MMR for a single player.
+type PlayerStats struct {
+	Wins    int `json:"wins"`
+	Losses  int `json:"losses"`
+	Draws   int `json:"draws"`
+	MMR     int `json:"mmr"`
+	PeakMMR int `json:"peakMMR"`
+}
+
+// GetPlayerStats returns the number of wins, losses and draws for the specified user, along with their current and
+// peak MMR. Matches that ended without a result (no contest) are not counted.
+func (store *MySQLStore) GetPlayerStats(databaseID uint64) (stats PlayerStats, err error) {
+
+	// Prepare a statement that will count the results of the matches for the specified user.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.GetMatchRecord)
+	if err != nil {
+		return stats, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the matches table with the specified database ID.
+	// The returned row should have three columns - the number of wins, losses and draws.
+	// An error means that there was a database error.
+	err = statement.QueryRow(databaseID, databaseID, databaseID).Scan(&stats.Wins, &stats.Losses, &stats.Draws)
+	if err != nil {
+		return stats, databaseError(err)
+	}
+
+	// Prepare a statement that will fetch the current and peak MMR for the specified user.
+	// Exit on error.
+	mmrStatement, err := store.db.Prepare(store.pstatements.GetMMRAndPeak)
+	if err != nil {
+		return stats, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer mmrStatement.Close()
+
+	// Query the profiles table with the specified database ID.
+	// The returned row should have two columns - the current and peak MMR for the user.
+	// An error means that either a row was not found, or there was a database error.
+	err = mmrStatement.QueryRow(databaseID).Scan(&stats.MMR, &stats.PeakMMR)
+	if err == sql.ErrNoRows {
+		return stats, ErrUserNotFound
+	} else if err != nil {
+		return stats, databaseError(err)
+	}
+
+	return stats, nil
+}
+
+// GetMMRHidden returns true if the specified user has chosen to hide their MMR from their opponents.
+func (store *MySQLStore) GetMMRHidden(databaseID uint64) (hidden bool, err error) {
+
+	// Prepare a statement that will fetch the MMR privacy setting for the specified user.
+	// Exit on error.
+	statement, err := store.db.Prepare(store.pstatements.GetMMRHidden)
+	if err != nil {
+		return hidden, databaseError(err)
+	}
+
+	// Defer closing of the statement so that it is cleaned up properly when this function exits.
+	defer statement.Close()
+
+	// Query the profiles table with the specified database ID.
+	// The returned row should have a single column - whether the user's MMR is hidden.
+	// An error means that either a row was not found, or there was a database error.
+	err = statement.QueryRow(databaseID).Scan(&hidden)
+	if err == sql.ErrNoRows {
+		return hidden, ErrUserNotFound
+	} else if err != nil {
+		return hidden, databaseError(err)
+	}
+
+	return hidden, nil
 }
 
 // getUser is a helper function that returns the database ID and ban state for the specified user
-func getUser(publicID string) (databaseID uint64, banned bool, err error) {
+func (store *MySQLStore) getUser(publicID string) (databaseID uint64, banned bool, err error) {
 
 	// Prepare a statement that will query the users table with the specified public ID.
 	// Exit on error.
-	statement, err := db.Prepare(pstatements.GetUser)
+	statement, err := store.db.Prepare(store.pstatements.GetUser)
 	if err != nil {
-		return databaseID, banned, errors.New("Internal server error: Failed to prepare statement")
+		return databaseID, banned, databaseError(err)
 	}
 
 	// Defer closing of the statement so that it is cleaned up properly when this function exits.
@@ -296,9 +741,24 @@ func getUser(publicID string) (databaseID uint64, banned bool, err error) {
 	// The returned row should have a two columns - the database ID, and the ban state (true or false) for the user.
 	// An error means that either a row was not found, or there was a database error.
 	err = statement.QueryRow(publicID).Scan(&databaseID, &banned)
-	if err != nil {
-		return databaseID, banned, errors.New("User does not exist")
+	if err == sql.ErrNoRows {
+		return databaseID, banned, ErrUserNotFound
+	} else if err != nil {
+		return databaseID, banned, databaseError(err)
 	}
 
 	return databaseID, banned, nil
 }
+
+// inList is a helper function that returns the placeholders for a variable length IN() list of the specified database
+// IDs, along with the database IDs as the arguments for them.
+func inList(databaseIDs []uint64) (placeholders string, args []interface{}) {
+	marks := make([]string, len(databaseIDs))
+	args = make([]interface{}, len(databaseIDs))
+	for index, databaseID := range databaseIDs {
+		marks[index] = "?"
+		args[index] = databaseID
+	}
+
+	return strings.Join(marks, ", "), args
+}
@@ -7,8 +7,11 @@ package database
 
 import (
 	"errors"
+	"fmt"
 	"log"
-	"os"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
 )
 
 // EnvironmentVariables is a light wrapper for the environment variables required by the database package.
@@ -22,19 +25,24 @@ type EnvironmentVariables struct {
 	TableProfiles string
 	TableMatches  string
 	TableTokens   string
+	TableAudit    string
+
+	// The minimum duration of validity remaining for an auth token before it's considered invalid.
+	AuthExpiryGracePeriod time.Duration
 }
 
 // Load attempts to read in all the required environment variables.
 func (ev *EnvironmentVariables) Load() error {
-	ev.DBUsername = os.Getenv("db_user")
-	ev.DBPass = os.Getenv("db_pass")
-	ev.DBURL = os.Getenv("db_url")
-	ev.DBPort = os.Getenv("db_port")
-	ev.DBName = os.Getenv("db_name")
-	ev.TableUsers = os.Getenv("db_table_users")
-	ev.TableProfiles = os.Getenv("db_table_profiles")
-	ev.TableMatches = os.Getenv("db_table_matches")
-	ev.TableTokens = os.Getenv("db_table_tokens")
+	ev.DBUsername = envvar.String("db_user", "")
+	ev.DBPass = envvar.String("db_pass", "")
+	ev.DBURL = envvar.String("db_url", "")
+	ev.DBPort = envvar.String("db_port", "")
+	ev.DBName = envvar.String("db_name", "")
+	ev.TableUsers = envvar.String("db_table_users", "")
+	ev.TableProfiles = envvar.String("db_table_profiles", "")
+	ev.TableMatches = envvar.String("db_table_matches", "")
+	ev.TableTokens = envvar.String("db_table_tokens", "")
+	ev.TableAudit = envvar.String("db_table_audit", "")
 
 	// Check all the loaded values - empty strings suggest that either the environment variable
 	// did not exist, or exists but has no value (or was an empty string etc.). If any variable
@@ -76,6 +84,25 @@ func (ev *EnvironmentVariables) Load() error {
 		return errors.New("Environment variable [db_table_tokens] was not set, or is empty")
 	}
 
+	if ev.TableAudit == "" {
+		return errors.New("Environment variable [db_table_audit] was not set, or is empty")
+	}
+
+	// The auth expiry grace period is optional, but must be a positive duration if it is set.
+	ev.AuthExpiryGracePeriod = defaultAuthExpiryGracePeriod
+	if raw := envvar.String("auth_expiry_grace_period", ""); raw != "" {
+		gracePeriod, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("Environment variable [auth_expiry_grace_period] is not a valid duration: %v", raw)
+		}
+
+		if gracePeriod <= 0 {
+			return fmt.Errorf("Environment variable [auth_expiry_grace_period] must be a positive duration: %v", raw)
+		}
+
+		ev.AuthExpiryGracePeriod = gracePeriod
+	}
+
 	log.Println("Environment variables loaded successfully")
 
 	return nil
@@ -0,0 +1,30 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package database provides an interface through which the application can interact with a database.
+package database
+
+import (
+	"errors"
+	"log"
+)
+
+// Errors returned when validating the credentials for a user, so that the cause of the failure can be reported
+// accurately to the client.
+var (
+	ErrUserNotFound = errors.New("User does not exist")
+	ErrUserBanned   = errors.New("User is banned")
+	ErrTokenInvalid = errors.New("Token is invalid")
+	ErrTokenExpired = errors.New("Token is expired")
+
+	// ErrDatabase means that the database could not be accessed - the details are logged rather than returned, as
+	// they are not meaningful to the client.
+	ErrDatabase = errors.New("Internal server error")
+)
+
+// databaseError is a helper function that logs the specified database error, and returns ErrDatabase in its place.
+func databaseError(err error) error {
+	log.Printf("Database error: %s", err.Error())
+	return ErrDatabase
+}
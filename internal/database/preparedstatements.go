@@ -12,15 +12,23 @@ import (
 
 // PreparedStatements is a light wrapper for all the prepared statements used in this package.
 type PreparedStatements struct {
-	GetUser         string
-	GetAuthExpiry   string
-	GetMMR          string
-	CreateMatch     string
-	CheckMatchValid string
-	GetDisplayName  string
-	GetAvatar       string
-	SetMatchStart   string
-	SetMatchResult  string
+	GetUser            string
+	GetBannedAmong     string
+	GetAuthExpiry      string
+	GetMMR             string
+	CreateMatch        string
+	CheckMatchValid    string
+	GetDisplayName     string
+	GetAvatar          string
+	GetProfiles        string
+	SetMatchStart      string
+	SetMatchResult     string
+	GetRecentMatches   string
+	GetRecentOpponents string
+	RecordMatchAudit   string
+	GetMatchRecord     string
+	GetMMRAndPeak      string
+	GetMMRHidden       string
 }
 
 // Construct constructs all the prepared statements for this PreparedStatements object.
@@ -29,18 +37,31 @@ func (p *PreparedStatements) Construct(envvars *EnvironmentVariables) {
 	// Get the "id" and "banned" columns from the row in the users table with the specified public ID.
 	p.GetUser = fmt.Sprintf("SELECT `id`, `banned` FROM `%v`.`%v` WHERE `public_id` = ?;", envvars.DBName, envvars.TableUsers)
 
+	// Get the "id" column from the rows in the users table that are banned, out of a list of database IDs. The list is
+	// variable length, so the placeholders for it are filled in when the statement is used (see GetBannedAmong).
+	p.GetBannedAmong = fmt.Sprintf("SELECT `id` FROM `%v`.`%v` WHERE `banned` = 1 AND `id` IN(%%s);", envvars.DBName, envvars.TableUsers)
+
 	// Get the "auth_expiry" column from the row in the tokens table with the specified database ID.
 	p.GetAuthExpiry = fmt.Sprintf("SELECT `auth_expiry` FROM `%v`.`%v` WHERE `id` = ? AND `auth` = ?;", envvars.DBName, envvars.TableTokens)
 
 	// Get the "mmr" column from the row in the profiles table with the specified database ID.
 	p.GetMMR = fmt.Sprintf("SELECT `mmr` FROM `%v`.`%v` WHERE `id` = ?;", envvars.DBName, envvars.TableProfiles)
 
-	// Insert a new row into the matches table and set the "player1" and "player2" columns with the specified values.
-	p.CreateMatch = fmt.Sprintf("INSERT INTO `%v`.`%v` (`player1`, `player2`) VALUES (?, ?);", envvars.DBName, envvars.TableMatches)
+	// Insert a new row into the matches table and set the "player1", "player2" and "turn_time" columns with the specified values, along
+	// with the display name ("handle"), avatar and MMR of each player when the match was created. Empty display names are stored as null.
+	p.CreateMatch = fmt.Sprintf("INSERT INTO `%v`.`%v` (`player1`, `player1_handle`, `player1_avatar`, `player1_mmr`, `player2`, `player2_handle`, `player2_avatar`, `player2_mmr`, `turn_time`) VALUES (?, NULLIF(?, ''), ?, ?, ?, NULLIF(?, ''), ?, ?, ?);", envvars.DBName, envvars.TableMatches)
 
-	// Return a row with a value of either true of false, based on whether a row exists in the matches table with the specified match ID, and where "player1"
-	// or "player2" matches the specified database ID.
-	p.CheckMatchValid = fmt.Sprintf("SELECT EXISTS (SELECT * FROM `%v`.`%v` WHERE `id` = ? AND `phase` = 0 AND ? IN(`player1`, `player2`));", envvars.DBName, envvars.TableMatches)
+	// Get the "turn_time" column from the row in the matches table with the specified match ID, if "player1" or "player2" matches the specified
+	// database ID, along with the display name, avatar and MMR that were stored for that player when the match was created. Matches that were
+	// created without them fall back to the "handle" column in the users table, and the "avatar" and "mmr" columns in the profiles table. No
+	// rows are returned if the match does not exist or the user is not part of it.
+	p.CheckMatchValid = fmt.Sprintf("SELECT COALESCE(`m`.`turn_time`, 0), "+
+		"COALESCE(IF(`m`.`player1` = ?, `m`.`player1_handle`, `m`.`player2_handle`), `u`.`handle`), "+
+		"COALESCE(IF(`m`.`player1` = ?, `m`.`player1_avatar`, `m`.`player2_avatar`), `p`.`avatar`), "+
+		"COALESCE(IF(`m`.`player1` = ?, `m`.`player1_mmr`, `m`.`player2_mmr`), `p`.`mmr`) "+
+		"FROM `%v`.`%v` AS `m` INNER JOIN `%v`.`%v` AS `u` ON `u`.`id` = ? INNER JOIN `%v`.`%v` AS `p` ON `p`.`id` = `u`.`id` "+
+		"WHERE `m`.`id` = ? AND `m`.`phase` = 0 AND `u`.`id` IN(`m`.`player1`, `m`.`player2`);",
+		envvars.DBName, envvars.TableMatches, envvars.DBName, envvars.TableUsers, envvars.DBName, envvars.TableProfiles)
 
 	// Get the "handle" column from the row in the users table with the specified database ID.
 	p.GetDisplayName = fmt.Sprintf("SELECT `handle` FROM `%v`.`%v` WHERE `id` = ?;", envvars.DBName, envvars.TableUsers)
@@ -48,11 +69,42 @@ func (p *PreparedStatements) Construct(envvars *EnvironmentVariables) {
 	// Get the "avatar" column from the row in the profiles table with the specified database ID.
 	p.GetAvatar = fmt.Sprintf("SELECT `avatar` FROM `%v`.`%v` WHERE `id` = ?;", envvars.DBName, envvars.TableProfiles)
 
+	// Get the "id" and "handle" columns from the rows in the users table, and the "avatar" column from the matching rows in
+	// the profiles table, out of a list of database IDs. The list is variable length, so the placeholders for it are
+	// filled in when the statement is used (see GetClientsNameAndAvatar).
+	p.GetProfiles = fmt.Sprintf("SELECT `u`.`id`, `u`.`handle`, `p`.`avatar` FROM `%v`.`%v` AS `u` INNER JOIN `%v`.`%v` AS `p` ON `p`.`id` = `u`.`id` WHERE `u`.`id` IN(%%s);", envvars.DBName, envvars.TableUsers, envvars.DBName, envvars.TableProfiles)
+
 	// Update the "phase" and "start" column for the row in the matches table with the specified match ID.
 	p.SetMatchStart = fmt.Sprintf("UPDATE `%v`.`%v` SET `phase` = 1, `start` = NOW() WHERE `id` = ?;", envvars.DBName, envvars.TableMatches)
 
-	// Update the "phase", "winner", and "end" column for the row in the matches table with the specified match ID.
-	p.SetMatchResult = fmt.Sprintf("UPDATE `%v`.`%v` SET `phase` = ?, `winner` = ?, `end` = NOW() WHERE `id` = ?;", envvars.DBName, envvars.TableMatches)
+	// Update the "phase", "winner", and "end" column for the row in the matches table with the specified match ID, if the match
+	// has not already concluded (phase 0 - waiting, or 1 - in play), so that the result can only be written once.
+	p.SetMatchResult = fmt.Sprintf("UPDATE `%v`.`%v` SET `phase` = ?, `winner` = ?, `end` = NOW() WHERE `id` = ? AND `phase` < 2;", envvars.DBName, envvars.TableMatches)
+
+	// Get the opponent's "handle", and the "winner" and "end" columns for the most recent finished (or drawn) matches in the matches table that
+	// include the specified database ID, up to the specified limit. The opponent is whichever of "player1" or "player2" is not the
+	// specified database ID.
+	p.GetRecentMatches = fmt.Sprintf("SELECT `u`.`handle`, `m`.`winner`, `m`.`end` FROM `%v`.`%v` AS `m` INNER JOIN `%v`.`%v` AS `u` ON `u`.`id` = IF(`m`.`player1` = ?, `m`.`player2`, `m`.`player1`) WHERE ? IN(`m`.`player1`, `m`.`player2`) AND `m`.`phase` IN(2, 4) ORDER BY `m`.`end` DESC LIMIT ?;", envvars.DBName, envvars.TableMatches, envvars.DBName, envvars.TableUsers)
+
+	// Get the opponent and "end" columns from the rows in the matches table that have finished (or were drawn), and include the
+	// specified database ID, up to the specified limit. The opponent is whichever of "player1" or "player2" is not the specified
+	// database ID.
+	p.GetRecentOpponents = fmt.Sprintf("SELECT IF(`player1` = ?, `player2`, `player1`), `end` FROM `%v`.`%v` WHERE ? IN(`player1`, `player2`) AND `phase` IN(2, 4) ORDER BY `end` DESC LIMIT ?;", envvars.DBName, envvars.TableMatches)
+
+	// Insert a new row into the audit table with the specified match ID, players, winner, reason, duration (in milliseconds) and move count.
+	p.RecordMatchAudit = fmt.Sprintf("INSERT INTO `%v`.`%v` (`match`, `player1`, `player2`, `winner`, `reason`, `duration`, `moves`, `time`) VALUES (?, ?, ?, ?, ?, ?, ?, NOW());", envvars.DBName, envvars.TableAudit)
+
+	// Count the wins, losses and draws for the specified database ID, from the finished (or drawn) matches in the matches table
+	// that include it. Legacy draws were recorded as finished matches without a winner, so they are counted as draws too.
+	p.GetMatchRecord = fmt.Sprintf("SELECT COALESCE(SUM(`phase` = 2 AND `winner` = ?), 0), COALESCE(SUM(`phase` = 2 AND COALESCE(`winner`, 0) NOT IN(0, ?)), 0), COALESCE(SUM(`phase` = 4 OR COALESCE(`winner`, 0) = 0), 0) FROM `%v`.`%v` WHERE ? IN(`player1`, `player2`) AND `phase` IN(2, 4);", envvars.DBName, envvars.TableMatches)
+
+	// Get the "mmr" and "peak_mmr" columns from the row in the profiles table with the specified database ID. Profiles without
+	// a peak MMR use their current MMR.
+	p.GetMMRAndPeak = fmt.Sprintf("SELECT `mmr`, GREATEST(COALESCE(`peak_mmr`, `mmr`), `mmr`) FROM `%v`.`%v` WHERE `id` = ?;", envvars.DBName, envvars.TableProfiles)
+
+	// Get the "hide_mmr" column from the row in the profiles table with the specified database ID. Profiles without the
+	// setting show their MMR.
+	p.GetMMRHidden = fmt.Sprintf("SELECT COALESCE(`hide_mmr`, 0) FROM `%v`.`%v` WHERE `id` = ?;", envvars.DBName, envvars.TableProfiles)
 
 	log.Println("Prepared statements constructed successfully")
 }
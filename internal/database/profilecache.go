@@ -0,0 +1,110 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package database provides an interface through which the application can interact with a database.
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// defaultProfileCacheTTL is the default duration for which a cached display name and avatar are used, before they are
+// fetched from the database again.
+const defaultProfileCacheTTL = time.Minute * 10
+
+// profileCacheTTL is the duration for which a cached display name and avatar are used, before they are fetched from
+// the database again. Configured via the "profile_cache_ttl" environment variable.
+var profileCacheTTL = envvar.Duration("profile_cache_ttl", defaultProfileCacheTTL)
+
+// cachedProfile is a display name and avatar for a user, along with the time at which they expire from the cache.
+type cachedProfile struct {
+	displayname string
+	avatar      uint8
+	expiry      time.Time
+}
+
+// ProfileCachingStore is a Store that caches the display name and avatar for each user, so that they are only fetched
+// from the underlying store once when a user rejoins matchmaking. All other operations are passed straight through to
+// the underlying store.
+type ProfileCachingStore struct {
+	Store
+
+	// The cached profiles, keyed by database ID.
+	profiles map[uint64]cachedProfile
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to the cached profiles.
+	lock sync.Mutex
+}
+
+// NewProfileCachingStore creates and returns a pointer to a new profile caching store, that wraps the specified store.
+// Display names and avatars are cached, so that they are only fetched once when a client joins matchmaking and then
+// connects to the game server.
+func NewProfileCachingStore(store Store) *ProfileCachingStore {
+	return &ProfileCachingStore{
+		Store:    store,
+		profiles: make(map[uint64]cachedProfile),
+	}
+}
+
+// GetClientNameAndAvatar returns the displayname and avatar id for the specified user, from the cache if possible.
+// Otherwise, they are fetched from the underlying store, and cached if successful.
+func (store *ProfileCachingStore) GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8, err error) {
+	now := time.Now()
+
+	// Return the cached profile, if there is one that has not expired.
+	store.lock.Lock()
+	profile, ok := store.profiles[databaseID]
+	store.lock.Unlock()
+
+	if ok && now.Before(profile.expiry) {
+		return profile.displayname, profile.avatar, nil
+	}
+
+	// Fetch the profile from the underlying store - errors are not cached.
+	displayname, avatar, err = store.Store.GetClientNameAndAvatar(databaseID)
+	if err != nil {
+		return displayname, avatar, err
+	}
+
+	store.cache(now, map[uint64]ClientProfile{databaseID: {DisplayName: displayname, Avatar: avatar}})
+
+	return displayname, avatar, nil
+}
+
+// GetClientsNameAndAvatar always fetches the displayname and avatar id for each of the specified users from the
+// underlying store, as it's used when the most recent values are needed. The fetched profiles replace any cached ones.
+func (store *ProfileCachingStore) GetClientsNameAndAvatar(databaseIDs []uint64) (profiles map[uint64]ClientProfile, err error) {
+	profiles, err = store.Store.GetClientsNameAndAvatar(databaseIDs)
+	if err != nil {
+		return profiles, err
+	}
+
+	store.cache(time.Now(), profiles)
+
+	return profiles, nil
+}
+
+// cache removes any expired profiles, so that the cache doesn't grow without bound, and then caches the specified
+// profiles.
+func (store *ProfileCachingStore) cache(now time.Time, profiles map[uint64]ClientProfile) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for id, profile := range store.profiles {
+		if now.After(profile.expiry) {
+			delete(store.profiles, id)
+		}
+	}
+
+	for id, profile := range profiles {
+		store.profiles[id] = cachedProfile{
+			displayname: profile.DisplayName,
+			avatar:      profile.Avatar,
+			expiry:      now.Add(profileCacheTTL),
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package database provides an interface through which the application can interact with a database.
+package database
+
+import "time"
+
+// Store is the set of database operations used by the rest of the application. MySQLStore is the implementation
+// used by the server - other implementations can be injected in its place.
+type Store interface {
+	ValidateAuth(publicID string, authToken string) (databaseID uint64, err error)
+	GetBannedAmong(databaseIDs []uint64) (banned []uint64, err error)
+	GetMMR(databaseID uint64) (MMR int, err error)
+	CreateMatch(player1 MatchPlayer, player2 MatchPlayer, turnTime time.Duration) (matchID uint64, err error)
+	ValidateMatch(databaseID uint64, matchID uint64) (valid bool, turnTime time.Duration, player MatchPlayer, err error)
+	GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8, err error)
+	GetClientsNameAndAvatar(databaseIDs []uint64) (profiles map[uint64]ClientProfile, err error)
+	SetMatchStart(matchID uint64) (err error)
+	SetMatchResult(matchID uint64, winnerDatabaseID uint64) (err error)
+	SetMatchDraw(matchID uint64) (err error)
+	SetMatchNoContest(matchID uint64) (err error)
+	SetMatchAborted(matchID uint64) (err error)
+	RecordMatchAudit(matchID uint64, player1DatabaseID uint64, player2DatabaseID uint64, winnerDatabaseID uint64, reason uint16, duration time.Duration, moves int) (err error)
+	GetRecentMatches(databaseID uint64, limit int) (matches []RecentMatch, err error)
+	GetRecentOpponents(databaseID uint64, limit int) (opponents []RecentOpponent, err error)
+	GetPlayerStats(databaseID uint64) (stats PlayerStats, err error)
+	GetMMRHidden(databaseID uint64) (hidden bool, err error)
+}
+
+// Ensure that MySQLStore and ProfileCachingStore implement Store.
+var (
+	_ Store = (*MySQLStore)(nil)
+	_ Store = (*ProfileCachingStore)(nil)
+)
@@ -0,0 +1,145 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// defaultCasualTimeoutStrikes is the default number of turn timeouts that each player can have auto-played for them
+// in a casual match, before a timeout is a loss.
+const defaultCasualTimeoutStrikes = 2
+
+// casualTimeoutStrikes is the number of turn timeouts that each player can have auto-played for them in a casual
+// match (one created with a turn time), before a timeout is a loss. Ranked matches always use zero. Configured via the
+// "match_casual_timeout_strikes" environment variable.
+var casualTimeoutStrikes = envvar.Int("match_casual_timeout_strikes", defaultCasualTimeoutStrikes)
+
+// autoPlay plays a move on behalf of the specified client, who has timed out, if they have timeout strikes remaining
+// and there is a move that can be played without losing the match. The move is sent to both clients, along with the
+// player it was played for and their new strike count, in the following format:
+//
+//	<player>.<strikes>.<move>
+//
+// Where the player is in the same format as the card data (0 for player 1, 1 for player 2). Returns true if a move was
+// auto-played.
+func (match *Match) autoPlay(client *GClient, other *GClient, player Player) bool {
+
+	// Noop if the client has used all of their strikes.
+	if client.timeoutStrikes >= match.timeoutStrikeLimit {
+		return false
+	}
+
+	// Select the move to play - noop if there is none.
+	move, ok := match.selectAutoPlayMove(player)
+	if !ok {
+		return false
+	}
+
+	// Apply the move. It was simulated while being selected, so this should not fail.
+	previousTurn, previousDeckCount := match.State.Turn, match.deckCount()
+	valid, matchEnded, winner, nextToAct := match.updateMatchState(player, move)
+	if !valid {
+		log.Printf("Match [ %v ] failed to auto-play move [%d:%s] for client [%s]", match.ID, move.Instruction, move.Payload, client.PublicID)
+		return false
+	}
+
+	// Wait for a move from whoever should act next - or if the move ended the match, stop the turn timer straight away
+	// (as with moves made by the players).
+	if !matchEnded {
+		match.setWaitingForMove(nextToAct)
+	} else {
+		match.stopTurnTimer()
+	}
+
+	// Record the strike, the move, and the activity.
+	client.timeoutStrikes++
+	match.moveCount++
+	match.recordMove(player, move, true)
+	match.lastActivityTime = time.Now()
+
+	log.Printf("Match [ %v ] auto-played move [%d:%s] for client [%s] after a timeout - strike [%d] of [%d]", match.ID, move.Instruction, move.Payload, client.PublicID, client.timeoutStrikes, match.timeoutStrikeLimit)
+
+	// Convert the player to the card data player format.
+	var playerString = "0"
+	if player == Player2 {
+		playerString = "1"
+	}
+
+	// Send the move to both clients, and wait until it has been written to the other client before starting the turn
+	// timer.
+	data := playerString + clientDataDelimiter + strconv.Itoa(client.timeoutStrikes) + clientDataDelimiter + strconv.Itoa(int(move.Instruction)) + payloadDelimiter + move.Payload
+	match.BroadCast(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionAutoPlayed, data)))
+	match.awaitForwardedMove(other)
+
+	// Inform both clients of the new deck sizes, if the move was a draw from a deck.
+	match.sendDeckCounts(previousDeckCount)
+
+	// End the match if the move ended it, otherwise inform both clients of any change to the turn flow.
+	if matchEnded {
+		match.endMatch(winner)
+	} else {
+		match.sendTurnFlowUpdate(previousTurn)
+	}
+
+	return true
+}
+
+// selectAutoPlayMove returns the move to auto-play for the specified player. While the turn is undecided, this is the
+// draw from their deck. Otherwise (or if their deck is empty), it is the lowest value card (other than a blast) from
+// their hand that can be played without losing the match. Returns false if there is no such move.
+func (match *Match) selectAutoPlayMove(player Player) (move Move, ok bool) {
+
+	// Get the player's deck and hand.
+	deck, hand := match.State.Cards.Player1Deck, match.State.Cards.Player1Hand
+	if player == Player2 {
+		deck, hand = match.State.Cards.Player2Deck, match.State.Cards.Player2Hand
+	}
+
+	// While the turn is undecided, the player draws the top card of their deck onto the field, if they can.
+	if match.State.Turn == PlayerUndecided && len(deck) > 0 {
+		move = Move{Instruction: last(deck).ToInstruction()}
+		valid, _, _ := match.simulateMove(player, move)
+		return move, valid
+	}
+
+	// Otherwise, try each distinct card in their hand, from the lowest value upwards. Blast cards are skipped, as they
+	// don't end the turn (so the player would just time out again), and require a target to be chosen.
+	candidates := append([]Card(nil), hand...)
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Value() < candidates[j].Value() })
+
+	tried := make(map[Card]bool)
+	for _, card := range candidates {
+		if card == Blast || tried[card] {
+			continue
+		}
+
+		tried[card] = true
+		move = Move{Instruction: card.ToInstruction()}
+
+		// The move is playable if it is valid, and it doesn't end the match with the player losing (or drawing).
+		valid, matchEnded, winner := match.simulateMove(player, move)
+		if valid && (!matchEnded || winner == player) {
+			return move, true
+		}
+	}
+
+	return Move{}, false
+}
+
+// simulateMove applies the specified move for the specified player to a copy of the match state, using the same logic
+// as real moves, and returns the result without modifying the match.
+func (match *Match) simulateMove(player Player, move Move) (validMove bool, matchEnded bool, winner Player) {
+	_, result := match.engine.ApplyMove(match.State, player, move)
+
+	return result.Accepted, result.Ended, result.Winner
+}
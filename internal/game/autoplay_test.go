@@ -0,0 +1,183 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// autoPlayedMessages returns the auto-played instructions in the specified client's outbound queue, emptying it.
+func autoPlayedMessages(client *GClient) []string {
+	messages := make([]string, 0)
+	for len(client.connection.OutboundMessageQueue) > 0 {
+		message := client.connection.GetNextOutboundMessage()
+		if message.Payload.Code == protocol.WSCMatchData && strings.HasPrefix(message.Payload.Message, makeMessageString(InstructionAutoPlayed, "")) {
+			messages = append(messages, message.Payload.Message)
+		}
+	}
+
+	return messages
+}
+
+// newAutoPlayTestMatch returns a match in play with the specified state, in which each player can have the specified
+// number of timeouts auto-played for them.
+func newAutoPlayTestMatch(t *testing.T, state MatchState, strikeLimit int) *Match {
+	t.Helper()
+
+	match := &Match{
+		ID:                 1,
+		Client1:            newTestClient(t),
+		Client2:            newTestClient(t),
+		State:              state,
+		Server:             &Server{disconnect: make(chan DisconnectRequest, 2)},
+		turnTimer:          time.NewTimer(time.Hour),
+		timeoutStrikeLimit: strikeLimit,
+	}
+
+	match.Client1.DBID = 1
+	match.Client2.DBID = 2
+	match.SetPhase(Play)
+
+	return match
+}
+
+// TestAutoPlay checks the move that is auto-played for a player that timed out - the draw from their deck while the
+// turn is undecided, and otherwise the lowest value card in their hand that doesn't lose the match (never a blast) -
+// and that it is sent to both clients with the player's new strike count. Nothing is played for a player that has no
+// strikes left, or no move that doesn't lose.
+func TestAutoPlay(t *testing.T) {
+
+	// It is player 2's turn, and only a card with a value of at least 2 avoids losing.
+	beaten := MatchState{
+		Turn: Player2,
+		Cards: Cards{
+			Player1Hand:  []Card{LaurasGreatsword},
+			Player1Field: []Card{JusisSword},
+			Player2Hand:  []Card{Blast, LaurasGreatsword, ElliotsOrbalStaff, FiesTwinGunswords},
+			Player2Field: []Card{FiesTwinGunswords},
+		},
+		Player1Score: 4,
+		Player2Score: 2,
+	}
+
+	undecided := MatchState{
+		Turn: PlayerUndecided,
+		Cards: Cards{
+			Player1Deck: []Card{ElliotsOrbalStaff, GaiusSpear},
+			Player1Hand: []Card{FiesTwinGunswords},
+			Player2Deck: []Card{JusisSword},
+			Player2Hand: []Card{FiesTwinGunswords},
+		},
+	}
+
+	losing := beaten
+	losing.Cards.Player2Hand = []Card{ElliotsOrbalStaff}
+
+	tests := []struct {
+		name    string
+		state   MatchState
+		player  Player
+		strikes int
+		played  bool
+		move    B2MatchInstruction
+	}{
+		{"Lowest card that doesn't lose", beaten, Player2, 0, true, CardFiesTwinGunswords},
+		{"Draw while the turn is undecided", undecided, Player1, 0, true, CardGaiusSpear},
+		{"Last strike", beaten, Player2, 1, true, CardFiesTwinGunswords},
+		{"Strikes exhausted", beaten, Player2, 2, false, 0},
+		{"Only losing cards", losing, Player2, 0, false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			state.Cards = test.state.Cards.Copy()
+			match := newAutoPlayTestMatch(t, state, 2)
+
+			client, other := match.Client1, match.Client2
+			if test.player == Player2 {
+				client, other = match.Client2, match.Client1
+			}
+
+			client.timeoutStrikes = test.strikes
+
+			played := match.autoPlay(client, other, test.player)
+			if played != test.played {
+				t.Fatalf("Auto-played is %v, expected %v", played, test.played)
+			}
+
+			if !played {
+				if client.timeoutStrikes != test.strikes || !reflect.DeepEqual(match.State.Cards, test.state.Cards.Copy()) {
+					t.Fatalf("Match changed without a move being auto-played - strikes [%d], cards %+v", client.timeoutStrikes, match.State.Cards)
+				}
+
+				return
+			}
+
+			if client.timeoutStrikes != test.strikes+1 {
+				t.Fatalf("Player has [%d] strikes, expected [%d]", client.timeoutStrikes, test.strikes+1)
+			}
+
+			// The player is sent in the same format as the card data.
+			player := "0"
+			if test.player == Player2 {
+				player = "1"
+			}
+
+			expected := makeMessageString(InstructionAutoPlayed, player+"."+strconv.Itoa(test.strikes+1)+"."+strconv.Itoa(int(test.move))+":")
+			for _, recipient := range []*GClient{match.Client1, match.Client2} {
+				if messages := autoPlayedMessages(recipient); !reflect.DeepEqual(messages, []string{expected}) {
+					t.Fatalf("Client %d was sent %v, expected [%s]", recipient.DBID, messages, expected)
+				}
+			}
+
+			if last := match.moveHistory[len(match.moveHistory)-1]; last.Player != test.player || last.Instruction != int(test.move) || !last.AutoPlayed {
+				t.Fatalf("Move history ends with %+v, expected move [%d] auto-played for player %v", last, test.move, test.player)
+			}
+		})
+	}
+}
+
+// TestTimeoutStrikeExhaustion times a player out until they have no strikes left, and checks that each timeout before
+// then auto-plays a move, and that the next one is a loss.
+func TestTimeoutStrikeExhaustion(t *testing.T) {
+	match := newAutoPlayTestMatch(t, MatchState{}, 2)
+
+	// Each timeout is on the same turn - the auto-played move passes the turn to their opponent, so it's reset.
+	timeout := func() {
+		state := midMatchState(LaurasGreatsword, GaiusSpear, JusisSword)
+		match.State.Turn, match.State.Cards = state.Turn, state.Cards
+		match.State.Player1Score, match.State.Player2Score = state.Player1Score, state.Player2Score
+		match.setWaitingForMove(Player2)
+
+		match.turnTimer = time.NewTimer(0)
+		time.Sleep(time.Millisecond * 10)
+		match.Tick()
+	}
+
+	for strike := 1; strike <= 2; strike++ {
+		timeout()
+
+		if match.Client2.timeoutStrikes != strike || match.GetPhase() != Play {
+			t.Fatalf("After timeout %d, player has [%d] strikes in phase %v - expected a move to be auto-played", strike, match.Client2.timeoutStrikes, match.GetPhase())
+		}
+	}
+
+	timeout()
+
+	if phase := match.GetPhase(); phase != Finished {
+		t.Fatalf("Match is in phase %v after the strikes ran out, expected %v", phase, Finished)
+	}
+
+	if request := <-match.Server.disconnect; request.Client != match.Client2 || request.Reason != protocol.WSCMatchTimeOut {
+		t.Fatalf("Client %d was removed with reason [%d], expected client 2 with reason [%d]", request.Client.DBID, request.Reason, protocol.WSCMatchTimeOut)
+	}
+}
@@ -60,6 +60,16 @@ const (
 	InstructionMatchIllegalMove   B2MatchInstruction = 23
 	InstructionMatchMutualTimeOut B2MatchInstruction = 24
 	InstructionMatchTimeOut       B2MatchInstruction = 25
+
+	// Turn flow messages that can only be received from the server. These are numbered after the error group so
+	// that the values of the existing instructions remain unchanged.
+	InstructionFieldCleared B2MatchInstruction = 26
+	InstructionTurnDecided  B2MatchInstruction = 27
+	InstructionTurnTime     B2MatchInstruction = 28
+	InstructionCardCounts   B2MatchInstruction = 29
+	InstructionAutoPlayed   B2MatchInstruction = 30
+	InstructionMatchResult  B2MatchInstruction = 31
+	InstructionDeckCounts   B2MatchInstruction = 32
 )
 
 // ToCard returns this instruction as a card. Invalid cards are returned with the default value of 0 (ElliotsOrbalStaff).
@@ -78,3 +88,8 @@ func (i B2MatchInstruction) ToCard() (card Card) {
 
 	return card
 }
+
+// ToInstruction returns the instruction that represents this card being selected.
+func (c Card) ToInstruction() B2MatchInstruction {
+	return B2MatchInstruction(uint8(c) + serverMoveUpdateToCardOffset)
+}
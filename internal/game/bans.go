@@ -0,0 +1,88 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// defaultBanSweepPeriod is the default period between checks for players that were banned after they connected.
+const defaultBanSweepPeriod = time.Minute * 3
+
+// banSweepPeriod is the period between checks for players that were banned after they connected. Configured via the
+// "ban_sweep_period" environment variable.
+var banSweepPeriod = envvar.Duration("ban_sweep_period", defaultBanSweepPeriod)
+
+// sweepBans removes any players that the most recent ban sweep found to be banned, and starts the next ban sweep if
+// it's due. The sweep queries the store in its own goroutine, so that the main loop isn't held up by the database.
+// Only called from the main loop.
+func (gs *Server) sweepBans(now time.Time) {
+
+	// Remove the players that were found to be banned, if the sweep in progress has finished. In a match, this is a
+	// forfeit for the banned player (see handleDisconnectRequests).
+	select {
+	case banned := <-gs.bannedUsers:
+		for _, databaseID := range banned {
+			if gs.removeUser(databaseID, protocol.WSCAuthBanned, "Account banned") > 0 {
+				log.Printf("User [%d] was removed from the game server after being banned", databaseID)
+			}
+		}
+
+		gs.banSweepRunning = false
+	default:
+	}
+
+	// Early exit if a sweep is still in progress, or the next sweep isn't due yet.
+	if gs.banSweepRunning || now.Before(gs.nextBanSweep) {
+		return
+	}
+
+	gs.nextBanSweep = now.Add(banSweepPeriod)
+
+	// Collect the database IDs of every client on the server.
+	databaseIDs := make([]uint64, 0, len(gs.matches)*2)
+	for _, match := range gs.matches {
+		for _, client := range []*GClient{match.Client1, match.Client2} {
+			if client != nil {
+				databaseIDs = append(databaseIDs, client.DBID)
+			}
+		}
+	}
+
+	if len(databaseIDs) == 0 {
+		return
+	}
+
+	// Check which of them are banned. The result is always sent, so that the next sweep can start.
+	gs.banSweepRunning = true
+	go func() {
+		banned, err := gs.store.GetBannedAmong(databaseIDs)
+		if err != nil {
+			log.Printf("Ban sweep failed: %s", err.Error())
+		}
+
+		gs.bannedUsers <- banned
+	}()
+}
+
+// removeUser removes every connection for the specified user from the server, with the specified reason and message,
+// and returns the number of connections that were removed. Only called from the main loop.
+func (gs *Server) removeUser(databaseID uint64, reason protocol.B2Code, message string) (count int) {
+	for _, match := range gs.matches {
+		for _, client := range []*GClient{match.Client1, match.Client2} {
+			if client != nil && client.DBID == databaseID && !client.isPendingKill() {
+				gs.Remove(client, reason, message)
+				count++
+			}
+		}
+	}
+
+	return count
+}
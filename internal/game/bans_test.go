@@ -0,0 +1,62 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// TestBanSweep bans a player in the middle of a match, and checks that the next ban sweep removes them as banned, and
+// that this is a forfeit - their opponent is told so, and is awarded the win through the normal result path.
+func TestBanSweep(t *testing.T) {
+	store := &resultRecordingStore{Store: teststore.NewStore()}
+	stats := &statsRecorder{}
+
+	match := newRemovalTestMatch(t, store, stats)
+
+	gs := match.Server
+	gs.bannedUsers = make(chan []uint64, 1)
+
+	store.SetBanned(match.Client2.DBID, true)
+
+	// The sweep queries the store in the background, and the banned players are removed on the next call once it has
+	// finished.
+	gs.sweepBans(time.Now())
+	for end := time.Now().Add(testDeadline); len(gs.bannedUsers) == 0; time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(end) {
+			t.Fatalf("Ban sweep did not finish within [%v]", testDeadline)
+		}
+	}
+
+	gs.sweepBans(time.Now())
+
+	if len(gs.disconnect) != 1 {
+		t.Fatalf("Ban sweep made %d disconnect requests, expected 1", len(gs.disconnect))
+	}
+
+	// Hand the request over for processing, as the main loop would.
+	gs.immediateDisconnect <- <-gs.disconnect
+	gs.handleDisconnectRequests()
+
+	if codes := outboundCodes(match.Client2); !reflect.DeepEqual(codes, []protocol.B2Code{protocol.WSCMatchData, protocol.WSCAuthBanned}) {
+		t.Fatalf("Banned client was sent %v, expected the result and [%d]", codes, protocol.WSCAuthBanned)
+	}
+
+	if codes := outboundCodes(match.Client1); !reflect.DeepEqual(codes, []protocol.B2Code{protocol.WSCMatchData, protocol.WSCMatchForfeit}) {
+		t.Fatalf("Other client was sent %v, expected the result and [%d]", codes, protocol.WSCMatchForfeit)
+	}
+
+	if _, ok := gs.matches[match.ID]; ok {
+		t.Fatalf("Match was not removed")
+	}
+
+	waitForResults(t, store, []string{"SetMatchResult"}, stats, []apiinterface.Winner{apiinterface.Player1})
+}
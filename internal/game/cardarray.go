@@ -218,32 +218,57 @@ func unBolt(targetField *[]Card) {
 	}
 }
 
-// calculateScore aggregates the values of all the cards in the specified card array, taking
-// into consideration the edge case where a force card doubles the score of all the previous
-// cards in the array.
+// calculateScore aggregates the values of all the cards in the specified card array, which must be in the order in
+// which they were played.
+//
+// The score is a left fold over the field: each card adds its value to the running total, except for bolted cards,
+// which add nothing, and force cards, which double the running total at the moment they are played. Cards played after
+// a force add their face value, and are only doubled if another force follows them. A force that is the first card on
+// the field could only have come from the deck, so it is worth its face value instead.
+//
+// For example, [2, Force, 3, Force] is ((3 * 2) + 4) * 2 = 20.
 func calculateScore(targetCards []Card) uint16 {
 
 	// Start with a default value of zero of type uint16. I'm pretty sure that the total score
 	// Can never exceed the max uint8, but just incase, a uint16 is used.
 	var total uint16 = 0
 
-	// For each of the cards in the card array...
-	for i := 0; i < len(targetCards); i++ {
-
-		// Check if the card is bolted, as bolted cards do not add any points to the score.
-		if !isBolted(targetCards[i]) {
-
-			// If the current card is a Force card, and it is NOT the first card in the array, double
-			// the current total. If the card WAS the first card in the array, it is handled as a normal
-			// card as it could only have come from the deck straight onto the field. Otherwise, the card
-			// is handled like a normal card, and its value is added to the total.
-			if targetCards[i] == Force && i > 0 {
-				total *= 2
-			} else {
-				total += uint16(targetCards[i].Value())
-			}
+	// Fold over the cards in play order.
+	for i, card := range targetCards {
+
+		// Bolted cards do not add any points to the score.
+		if isBolted(card) {
+			continue
+		}
+
+		// A force card that is NOT the first card doubles the current total. Anything else (including a force card
+		// that came straight from the deck) adds its value to the total.
+		if card == Force && i > 0 {
+			total *= 2
+		} else {
+			total += uint16(card.Value())
 		}
 	}
 
 	return total
 }
+
+// scoreAfterForce returns the score that the specified field would have if a force card were played onto it from the
+// hand - which, as with any card played from the hand, first removes a bolted card from the top of the field.
+func scoreAfterForce(field []Card) uint16 {
+	forced := append([]Card(nil), field...)
+	if len(forced) > 0 && isBolted(last(forced)) {
+		forced = forced[:len(forced)-1]
+	}
+
+	return calculateScore(append(forced, Force))
+}
+
+// scoreAfterUnbolt returns the score that the specified field would have if the bolted card on top of it was unbolted
+// by a rod card. The field is returned unchanged if its top card isn't bolted.
+func scoreAfterUnbolt(field []Card) uint16 {
+	unbolted := append([]Card(nil), field...)
+	unBolt(&unbolted)
+
+	return calculateScore(unbolted)
+}
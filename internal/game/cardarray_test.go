@@ -0,0 +1,106 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCalculateScore checks that each force card doubles the total at the moment it is played, and that cards played
+// after it add their face value - for fields with zero, one, two and three force cards, interleaved with basic and
+// bolted cards.
+func TestCalculateScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    []Card
+		expected uint16
+	}{
+		// Zero forces.
+		{"Empty field", []Card{}, 0},
+		{"Basic cards", []Card{FiesTwinGunswords, AlisasOrbalBow}, 5},
+		{"Bolted card", []Card{FiesTwinGunswords, InactiveAlisasOrbalBow}, 2},
+		{"Effect cards from the deck", []Card{Bolt, Mirror, Blast}, 3},
+
+		// One force.
+		{"Force from the deck", []Card{Force}, 1},
+		{"Force from the deck, then a basic card", []Card{Force, AlisasOrbalBow}, 4},
+		{"Basic card, then a force", []Card{AlisasOrbalBow, Force}, 6},
+		{"Card after a force is not doubled", []Card{AlisasOrbalBow, Force, JusisSword}, 10},
+		{"Force after a bolted card doubles nothing", []Card{InactiveFiesTwinGunswords, Force}, 0},
+		{"Bolted force adds nothing", []Card{AlisasOrbalBow, InactiveForce, JusisSword}, 7},
+
+		// Two forces.
+		{"Consecutive forces", []Card{AlisasOrbalBow, Force, Force}, 12},
+		{"Interleaved forces", []Card{AlisasOrbalBow, Force, JusisSword, Force}, 20},
+		{"Force from the deck, then a force", []Card{Force, Force}, 2},
+		{"Bolted card between forces", []Card{FiesTwinGunswords, Force, InactiveLaurasGreatsword, Force}, 8},
+
+		// Three forces.
+		{"Three consecutive forces", []Card{FiesTwinGunswords, Force, Force, Force}, 16},
+		{"Three interleaved forces", []Card{FiesTwinGunswords, Force, ElliotsOrbalStaff, Force, InactiveJusisSword, Force}, 20},
+		{"Force from the deck, then two forces", []Card{Force, JusisSword, Force, Force}, 20},
+		{"Card after the third force is not doubled", []Card{ElliotsOrbalStaff, Force, Force, Force, LaurasGreatsword}, 15},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if score := calculateScore(test.field); score != test.expected {
+				t.Fatalf("Score for %v is %d, expected %d", test.field, score, test.expected)
+			}
+		})
+	}
+}
+
+// TestScoreAfterForce checks that playing a force from the hand first removes a bolted card from the top of the field.
+func TestScoreAfterForce(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    []Card
+		expected uint16
+	}{
+		{"Empty field", []Card{}, 1},
+		{"Basic cards", []Card{AlisasOrbalBow, JusisSword}, 14},
+		{"Bolted card on top", []Card{AlisasOrbalBow, InactiveJusisSword}, 6},
+		{"Bolted card underneath", []Card{InactiveAlisasOrbalBow, JusisSword}, 8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			field := append([]Card(nil), test.field...)
+			original := append([]Card(nil), test.field...)
+
+			if score := scoreAfterForce(field); score != test.expected {
+				t.Fatalf("Score after a force on %v is %d, expected %d", test.field, score, test.expected)
+			}
+
+			if !reflect.DeepEqual(field, original) {
+				t.Fatalf("Field %v was modified to %v", test.field, field)
+			}
+		})
+	}
+}
+
+// TestScoreAfterUnbolt checks the score once the bolted card on top of a field is unbolted.
+func TestScoreAfterUnbolt(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    []Card
+		expected uint16
+	}{
+		{"Bolted card on top", []Card{AlisasOrbalBow, InactiveJusisSword}, 7},
+		{"Bolted force on top", []Card{AlisasOrbalBow, InactiveForce}, 6},
+		{"Nothing bolted", []Card{AlisasOrbalBow, JusisSword}, 7},
+		{"Bolted card underneath", []Card{InactiveAlisasOrbalBow, JusisSword}, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if score := scoreAfterUnbolt(test.field); score != test.expected {
+				t.Fatalf("Score after unbolting %v is %d, expected %d", test.field, score, test.expected)
+			}
+		})
+	}
+}
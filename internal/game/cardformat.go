@@ -0,0 +1,116 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+
+	// FullCardsFormatV1 is the first version of the full cards serialization format.
+	FullCardsFormatV1 int = 1
+
+	// LatestFullCardsFormat is the most recent version of the full cards serialization format.
+	LatestFullCardsFormat = FullCardsFormatV1
+
+	// fullCardsZoneCount is the number of zones (decks, hands, fields and discards for each player) in the full cards
+	// serialization format.
+	fullCardsZoneCount = 8
+
+	// fullCardsCardWidth is the number of hexadecimal characters used to represent each card in the full cards
+	// serialization format.
+	fullCardsCardWidth = 2
+)
+
+// zones returns pointers to each of the zones, in the order in which they are serialized in the full format.
+func (c *Cards) zones() [fullCardsZoneCount]*[]Card {
+	return [fullCardsZoneCount]*[]Card{
+		&c.Player1Deck, &c.Player1Hand, &c.Player1Field, &c.Player1Discard,
+		&c.Player2Deck, &c.Player2Hand, &c.Player2Field, &c.Player2Discard,
+	}
+}
+
+// SerializeFull returns the string representation of ALL the zones, in the specified version of the full format.
+// Unlike Serialized, which only contains the decks, this is intended for restoring a match that is already in
+// progress.
+//
+// Version 1 of the format is as follows:
+//
+//	V.D1.H1.F1.X1.D2.H2.F2.X2
+//
+// Where "V" is the version number, and each of the other sections is a zone - the deck (D), hand (H), field (F) and
+// discard pile (X) of player 1 and then player 2. Each zone is a (possibly empty) sequence of cards, each of which is
+// represented by a fixed width, two character hexadecimal number, so that cards with a value of 16 or more are not
+// ambiguous.
+func (c *Cards) SerializeFull(version int) (string, error) {
+
+	// Reject unknown versions.
+	if version != FullCardsFormatV1 {
+		return "", fmt.Errorf("Unsupported cards format version [ %v ]", version)
+	}
+
+	// Create an empty buffer to save on string operation costs, and write the version tag.
+	var buffer bytes.Buffer
+	buffer.WriteString(strconv.Itoa(version))
+
+	// For each zone, write the delimiter, and then a fixed width hex string representation of each card.
+	for _, zone := range c.zones() {
+		buffer.WriteString(SerializedCardsDelimiter)
+
+		for _, card := range *zone {
+			buffer.WriteString(fmt.Sprintf("%0*x", fullCardsCardWidth, uint8(card)))
+		}
+	}
+
+	// Return the contents of the buffer as a string.
+	return buffer.String(), nil
+}
+
+// DeserializeFull parses a string produced by SerializeFull, and returns the cards that it represents. Returns an
+// error if the version is not supported, or if the string is malformed or contains an invalid card.
+func DeserializeFull(serialized string) (Cards, error) {
+	var cards Cards
+
+	// Split the string into the version tag and the zones.
+	sections := strings.Split(serialized, SerializedCardsDelimiter)
+
+	version, err := strconv.Atoi(sections[0])
+	if err != nil {
+		return cards, fmt.Errorf("Invalid cards format version [ %v ]", sections[0])
+	}
+
+	if version != FullCardsFormatV1 {
+		return cards, fmt.Errorf("Unsupported cards format version [ %v ]", version)
+	}
+
+	if len(sections) != fullCardsZoneCount+1 {
+		return cards, fmt.Errorf("Expected [ %v ] zones in serialized cards, found [ %v ]", fullCardsZoneCount, len(sections)-1)
+	}
+
+	// Parse each zone, a fixed width card at a time.
+	for index, zone := range cards.zones() {
+		section := sections[index+1]
+		if len(section)%fullCardsCardWidth != 0 {
+			return cards, fmt.Errorf("Malformed zone [ %v ] in serialized cards", index)
+		}
+
+		*zone = make([]Card, 0, len(section)/fullCardsCardWidth)
+		for offset := 0; offset < len(section); offset += fullCardsCardWidth {
+			value, err := strconv.ParseUint(section[offset:offset+fullCardsCardWidth], 16, 8)
+			if err != nil || Card(value) > InactiveForce {
+				return cards, fmt.Errorf("Invalid card [ %v ] in zone [ %v ] of serialized cards", section[offset:offset+fullCardsCardWidth], index)
+			}
+
+			*zone = append(*zone, Card(value))
+		}
+	}
+
+	return cards, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestFullCardsRoundTrip checks that every card value survives serialization in the full format, in every zone,
+// including the inactive cards that need more than one hexadecimal character.
+func TestFullCardsRoundTrip(t *testing.T) {
+	for card := ElliotsOrbalStaff; card <= InactiveForce; card++ {
+		for zone := 0; zone < fullCardsZoneCount; zone++ {
+
+			// Put the card in the zone on its own, and next to a card from each end of the range, so that any
+			// ambiguity between neighbouring cards shows up.
+			var cards Cards
+			*cards.zones()[zone] = []Card{card, ElliotsOrbalStaff, card, InactiveForce}
+
+			serialized, err := cards.SerializeFull(LatestFullCardsFormat)
+			if err != nil {
+				t.Fatalf("Failed to serialize card %v in zone %d: %v", card, zone, err)
+			}
+
+			deserialized, err := DeserializeFull(serialized)
+			if err != nil {
+				t.Fatalf("Failed to deserialize card %v in zone %d [%s]: %v", card, zone, serialized, err)
+			}
+
+			for index, expected := range cards.zones() {
+				if actual := *deserialized.zones()[index]; len(*expected) != len(actual) || (len(actual) > 0 && !reflect.DeepEqual(*expected, actual)) {
+					t.Fatalf("Zone %d is %v after a round trip through [%s], expected %v", index, actual, serialized, *expected)
+				}
+			}
+		}
+	}
+}
+
+// TestSerializeFullFormat checks the exact output of the full format, so that it stays compatible with clients.
+func TestSerializeFullFormat(t *testing.T) {
+	cards := Cards{
+		Player1Deck:    []Card{ElliotsOrbalStaff, Force},
+		Player1Hand:    []Card{InactiveGaiusSpear},
+		Player2Field:   []Card{InactiveForce},
+		Player2Discard: []Card{Bolt, Mirror},
+	}
+
+	serialized, err := cards.SerializeFull(FullCardsFormatV1)
+	if err != nil {
+		t.Fatalf("Failed to serialize: %v", err)
+	}
+
+	if expected := "1.000a.10.....15.0708"; serialized != expected {
+		t.Fatalf("Serialized as [%s], expected [%s]", serialized, expected)
+	}
+
+	if _, err := cards.SerializeFull(FullCardsFormatV1 + 1); err == nil {
+		t.Fatalf("Serialized with an unsupported version")
+	}
+}
+
+// TestDeserializeFullErrors checks that malformed strings are rejected.
+func TestDeserializeFullErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		serialized string
+	}{
+		{"Empty", ""},
+		{"Missing version", ".00.00.00.00.00.00.00.00"},
+		{"Unsupported version", "2........"},
+		{"Too few zones", "1......."},
+		{"Too many zones", "1........."},
+		{"Partial card", "1.000..0......"},
+		{"Invalid hex", "1.zz......."},
+		{"Card out of range", "1.16......."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cards, err := DeserializeFull(test.serialized); err == nil {
+				t.Fatalf("Deserialized [%s] as %+v, expected an error", test.serialized, cards)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// standardCardPoolName is the name of the standard card pool (see StandardCardPool).
+const standardCardPoolName = "standard"
+
+// cardNames maps the name of each card that can be in a card pool, as used in card pool specs, to the card itself.
+var cardNames = map[string]Card{
+	"ElliotsOrbalStaff":   ElliotsOrbalStaff,
+	"FiesTwinGunswords":   FiesTwinGunswords,
+	"AlisasOrbalBow":      AlisasOrbalBow,
+	"JusisSword":          JusisSword,
+	"MachiasOrbalShotgun": MachiasOrbalShotgun,
+	"GaiusSpear":          GaiusSpear,
+	"LaurasGreatsword":    LaurasGreatsword,
+	"Bolt":                Bolt,
+	"Mirror":              Mirror,
+	"Blast":               Blast,
+	"Force":               Force,
+}
+
+// CardPool is a named set of cards that the decks for each match are drawn from - the standard card pool, or a custom
+// one for an event mode.
+type CardPool struct {
+	Name  string
+	Cards []Card
+}
+
+// cardPoolSpec is the JSON representation of a custom card pool - its name, and the number of each card (by name - see
+// cardNames) that it contains. Cards that are not listed are not in the pool.
+//
+// Format: {"name": "effect-heavy", "cards": {"FiesTwinGunswords": 4, "Bolt": 6, ...}}
+type cardPoolSpec struct {
+	Name  string         `json:"name"`
+	Cards map[string]int `json:"cards"`
+}
+
+// loadCardPool returns the card pool that is used for every match. This is the standard card pool, unless a custom card
+// pool is specified via either the "card_pool" environment variable (containing the card pool spec itself), or the
+// "card_pool_file" environment variable (containing the path to a file that contains the card pool spec) - see
+// cardPoolSpec. Returns an error if both are set, or if the custom card pool is invalid (see validateCardPool).
+func loadCardPool() (pool CardPool, err error) {
+	spec := envvar.String("card_pool", "")
+	path := envvar.String("card_pool_file", "")
+
+	if spec != "" && path != "" {
+		return pool, errors.New("Environment variables [card_pool] and [card_pool_file] must not both be set")
+	}
+
+	// Read the spec from the file, if one was specified.
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return pool, fmt.Errorf("Failed to read card pool file [%s]: %s", path, err.Error())
+		}
+
+		spec = string(data)
+	}
+
+	if spec == "" {
+		return StandardCardPool(), nil
+	}
+
+	pool, err = parseCardPool([]byte(spec))
+	if err != nil {
+		return pool, err
+	}
+
+	return pool, validateCardPool(pool)
+}
+
+// parseCardPool parses the specified card pool spec (see cardPoolSpec), and returns the card pool that it describes.
+// Returns an error if the spec is malformed, or contains an unknown card or a negative count.
+func parseCardPool(data []byte) (pool CardPool, err error) {
+	var spec cardPoolSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return pool, fmt.Errorf("Malformed card pool spec: %s", err.Error())
+	}
+
+	if spec.Name == "" {
+		return pool, errors.New("Card pool spec has no name")
+	}
+
+	pool.Name = spec.Name
+
+	// Add the cards in enum order, rather than map order, so that the same spec always produces the same pool.
+	names := make([]string, 0, len(spec.Cards))
+	for name := range spec.Cards {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool { return cardNames[names[i]] < cardNames[names[j]] })
+
+	for _, name := range names {
+		card, ok := cardNames[name]
+		if !ok {
+			return pool, fmt.Errorf("Unknown card [%s] in card pool [%s]", name, spec.Name)
+		}
+
+		count := spec.Cards[name]
+		if count < 0 {
+			return pool, fmt.Errorf("Negative count [%d] for card [%s] in card pool [%s]", count, name, spec.Name)
+		}
+
+		for i := 0; i < count; i++ {
+			pool.Cards = append(pool.Cards, card)
+		}
+	}
+
+	return pool, nil
+}
+
+// validateCardPool returns an error if the specified card pool can't be used for matches - if it doesn't contain
+// enough cards for two decks, or enough non-effect cards for each deck to have one, or if no valid set of cards (see
+// validateCards) could be generated from it.
+func validateCardPool(pool CardPool) error {
+	if len(pool.Cards) < int(startingDeckSize)*2 {
+		return fmt.Errorf("Card pool [%s] has [%d] cards - at least [%d] are required", pool.Name, len(pool.Cards), int(startingDeckSize)*2)
+	}
+
+	basicCards := 0
+	for _, card := range pool.Cards {
+		if card < Bolt {
+			basicCards++
+		}
+	}
+
+	if basicCards < 2 {
+		return fmt.Errorf("Card pool [%s] has [%d] non-effect cards - at least [2] are required, one for each deck", pool.Name, basicCards)
+	}
+
+	// Make sure that the pool can actually produce a playable opening.
+	if _, err := GenerateCardsFromPool(pool.Cards, int(startingDeckSize)); err != nil {
+		return fmt.Errorf("Card pool [%s] is unusable: %s", pool.Name, err.Error())
+	}
+
+	return nil
+}
+
+// mustLoadCardPool returns the card pool that is used for every match (see loadCardPool), and exits if it is invalid,
+// so that a misconfigured event mode is caught at startup.
+func mustLoadCardPool() CardPool {
+	pool, err := loadCardPool()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Using card pool [%s] with [%d] cards", pool.Name, len(pool.Cards))
+
+	return pool
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGenerateCardsAcrossPools generates cards from several card pools, and checks that each pool is valid, and that
+// every set of cards generated from it has full decks drawn from the pool, with a non-effect card in each deck and a
+// legal first move (see checkLegalFirstMove).
+func TestGenerateCardsAcrossPools(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"Effect heavy", `{"name": "effect-heavy", "cards": {"FiesTwinGunswords": 3, "AlisasOrbalBow": 3, "JusisSword": 3, "MachiasOrbalShotgun": 3, "GaiusSpear": 2, "LaurasGreatsword": 2, "Bolt": 6, "Mirror": 6, "Blast": 6, "Force": 4}}`},
+		{"No effect cards", `{"name": "basics", "cards": {"ElliotsOrbalStaff": 2, "FiesTwinGunswords": 6, "AlisasOrbalBow": 6, "JusisSword": 6, "MachiasOrbalShotgun": 6, "GaiusSpear": 4, "LaurasGreatsword": 4}}`},
+		{"Scarce non-effect cards", `{"name": "scarce", "cards": {"FiesTwinGunswords": 2, "JusisSword": 2, "Bolt": 7, "Mirror": 7, "Blast": 7, "Force": 5}}`},
+		{"Exactly two decks", `{"name": "minimal", "cards": {"FiesTwinGunswords": 5, "AlisasOrbalBow": 5, "JusisSword": 5, "MachiasOrbalShotgun": 5, "GaiusSpear": 4, "Bolt": 2, "Mirror": 2, "Blast": 2}}`},
+	}
+
+	pools := []CardPool{StandardCardPool()}
+	for _, test := range tests {
+		pool, err := parseCardPool([]byte(test.spec))
+		if err != nil {
+			t.Fatalf("%s: failed to parse the card pool: %v", test.name, err)
+		}
+
+		pools = append(pools, pool)
+	}
+
+	for _, pool := range pools {
+		t.Run(pool.Name, func(t *testing.T) {
+			if err := validateCardPool(pool); err != nil {
+				t.Fatalf("Card pool is invalid: %v", err)
+			}
+
+			available := make(map[Card]int)
+			for _, card := range pool.Cards {
+				available[card]++
+			}
+
+			for i := 0; i < generatedDeals; i++ {
+				cards := GenerateCards(pool)
+
+				used := make(map[Card]int)
+				for _, deck := range [][]Card{cards.Player1Deck, cards.Player2Deck} {
+					if len(deck) != int(startingDeckSize) || containsOnlyEffectCards(deck) {
+						t.Fatalf("Generated deck %v, expected [%d] cards including a non-effect card", deck, startingDeckSize)
+					}
+
+					for _, card := range deck {
+						if used[card]++; used[card] > available[card] {
+							t.Fatalf("Generated decks %v and %v contain more of card [%v] than the pool", cards.Player1Deck, cards.Player2Deck, card)
+						}
+					}
+				}
+
+				checkLegalFirstMove(t, cards)
+			}
+		})
+	}
+}
+
+// TestValidateCardPool checks that card pools that can't be used for matches are rejected when they are loaded, with
+// an error that names the pool.
+func TestValidateCardPool(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"Too few cards", `{"name": "small", "cards": {"FiesTwinGunswords": 10, "AlisasOrbalBow": 10, "JusisSword": 9}}`},
+		{"One non-effect card", `{"name": "effects", "cards": {"GaiusSpear": 1, "Bolt": 8, "Mirror": 8, "Blast": 8, "Force": 5}}`},
+		{"No playable opening", `{"name": "ties", "cards": {"JusisSword": 30}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, err := parseCardPool([]byte(test.spec))
+			if err != nil {
+				t.Fatalf("Failed to parse the card pool: %v", err)
+			}
+
+			if err := validateCardPool(pool); err == nil || !strings.Contains(err.Error(), "["+pool.Name+"]") {
+				t.Fatalf("Card pool was validated with [%v], expected an error naming [%s]", err, pool.Name)
+			}
+		})
+	}
+}
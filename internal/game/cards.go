@@ -7,9 +7,12 @@ package game
 
 import (
 	"bytes"
+	"fmt"
+	"log"
 	"math"
 	"math/rand"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -21,17 +24,47 @@ const (
 	// before the set of cards is considered to be invalid.
 	maxDrawsOnStart uint8 = 3
 
-	// postInitialisationDeckSize is the size of the deck after the intitial state of the match is initialised -
-	// i.e. after all the cards are placed onto the field, and each player draws from their deck into their hands.
-	postInitialisationDeckSize uint8 = 5
-
-	// startingHandSize is the initial size of a players hand when the match starts.
+	// startingHandSize is the initial size of a players hand when the match starts. This is the same for every card
+	// pool - the rest of the deck is left to draw from when the field is cleared.
 	startingHandSize uint8 = 10
 
-	// startingDeckSize is the intitial size of a players deck when the match starts, before the cards are dealt.
+	// startingDeckSize is the intitial size of a players deck when the match starts, before the cards are dealt, for
+	// the standard card pool.
 	startingDeckSize uint8 = 15
+
+	// maxGenerationAttempts is the number of sets of cards that are generated from a custom card pool before giving
+	// up, in case the pool can never produce a valid set.
+	maxGenerationAttempts = 10000
 )
 
+// StandardCardPool returns the card pool that decks are drawn from in a standard match (ref:
+// https://www.reddit.com/r/Falcom/comments/fxt5nq/can_i_buy_the_card_game_blade_anywhere/fmxo8qo/). A new slice of
+// cards is returned each time, so that it can be modified to build custom card pools.
+func StandardCardPool() CardPool {
+	return CardPool{
+		Name: standardCardPoolName,
+		Cards: []Card{
+			ElliotsOrbalStaff, ElliotsOrbalStaff,
+			FiesTwinGunswords, FiesTwinGunswords, FiesTwinGunswords, FiesTwinGunswords, FiesTwinGunswords,
+			AlisasOrbalBow, AlisasOrbalBow, AlisasOrbalBow, AlisasOrbalBow, AlisasOrbalBow,
+			JusisSword, JusisSword, JusisSword, JusisSword, JusisSword,
+			MachiasOrbalShotgun, MachiasOrbalShotgun, MachiasOrbalShotgun, MachiasOrbalShotgun,
+			GaiusSpear, GaiusSpear, GaiusSpear,
+			LaurasGreatsword, LaurasGreatsword,
+			Bolt, Bolt, Bolt, Bolt,
+			Mirror, Mirror, Mirror, Mirror,
+			Blast, Blast, Blast, Blast,
+			Force, Force,
+		},
+	}
+}
+
+// dealtDeckSize returns the number of cards left in a deck of the specified size, once the hand has been dealt from
+// it.
+func dealtDeckSize(deckSize int) int {
+	return deckSize - int(startingHandSize)
+}
+
 // Cards is a container for all the cards on the field.
 type Cards struct {
 	Player1Deck    []Card
@@ -76,31 +109,99 @@ func (c *Cards) Serialized() string {
 	return buffer.String()
 }
 
-// GenerateCards generates a new set of cards for a match - has additional checks to ensure that the match is not
-// unwinnable from the first move etc.
-func GenerateCards() (cards Cards) {
-
-	// Generate all the cards (ref: https://www.reddit.com/r/Falcom/comments/fxt5nq/can_i_buy_the_card_game_blade_anywhere/fmxo8qo/)
-	// that will be used to create the deck for a match. This is not stored as a const as a. its pretty large and unsightly, and b.
-	// it would need to get copied each time anyway as we will be modifying arrays that point to sections within this pool.
-	pool := []Card{
-		ElliotsOrbalStaff, ElliotsOrbalStaff,
-		FiesTwinGunswords, FiesTwinGunswords, FiesTwinGunswords, FiesTwinGunswords, FiesTwinGunswords,
-		AlisasOrbalBow, AlisasOrbalBow, AlisasOrbalBow, AlisasOrbalBow, AlisasOrbalBow,
-		JusisSword, JusisSword, JusisSword, JusisSword, JusisSword,
-		MachiasOrbalShotgun, MachiasOrbalShotgun, MachiasOrbalShotgun, MachiasOrbalShotgun,
-		GaiusSpear, GaiusSpear, GaiusSpear,
-		LaurasGreatsword, LaurasGreatsword,
-		Bolt, Bolt, Bolt, Bolt,
-		Mirror, Mirror, Mirror, Mirror,
-		Blast, Blast, Blast, Blast,
-		Force, Force,
+// DeserializeDecks parses a string produced by Serialized, and returns cards containing the decks that it represents.
+// Returns an error if the string is malformed, or contains an invalid card.
+func DeserializeDecks(serialized string) (cards Cards, err error) {
+
+	// Split the string into the two decks.
+	decks := strings.Split(serialized, SerializedCardsDelimiter)
+	if len(decks) != 2 {
+		return cards, fmt.Errorf("Expected [ 2 ] decks in serialized cards, found [ %v ]", len(decks))
+	}
+
+	// Parse each deck, a single hexadecimal character at a time.
+	for index, target := range []*[]Card{&cards.Player1Deck, &cards.Player2Deck} {
+		*target = make([]Card, 0, len(decks[index]))
+		for _, char := range decks[index] {
+			value, err := strconv.ParseUint(string(char), 16, 8)
+			if err != nil || Card(value) > Force {
+				return cards, fmt.Errorf("Invalid card [ %c ] in deck [ %v ] of serialized cards", char, index)
+			}
+
+			*target = append(*target, Card(value))
+		}
+	}
+
+	return cards, nil
+}
+
+// clone returns a deep copy of the cards, so that the copy can be modified without affecting the original.
+func (c *Cards) clone() Cards {
+	return Cards{
+		Player1Deck:    append([]Card(nil), c.Player1Deck...),
+		Player1Hand:    append([]Card(nil), c.Player1Hand...),
+		Player1Field:   append([]Card(nil), c.Player1Field...),
+		Player1Discard: append([]Card(nil), c.Player1Discard...),
+
+		Player2Deck:    append([]Card(nil), c.Player2Deck...),
+		Player2Hand:    append([]Card(nil), c.Player2Hand...),
+		Player2Field:   append([]Card(nil), c.Player2Field...),
+		Player2Discard: append([]Card(nil), c.Player2Discard...),
+	}
+}
+
+// GenerateCards generates a new set of cards for a match, from the specified card pool (normally the game server's
+// active card pool - see loadCardPool) - has additional checks to ensure that the match is not unwinnable from the
+// first move etc.
+func GenerateCards(pool CardPool) (cards Cards) {
+
+	// The active card pool was checked when it was loaded, so it is all but certain to produce a valid set of cards.
+	// If it somehow doesn't, fall back to the standard card pool, which always produces a valid set of cards
+	// eventually, so there's no limit on the attempts.
+	cards, err := generateCards(pool.Cards, int(startingDeckSize), maxGenerationAttempts)
+	if err != nil {
+		log.Printf("Failed to generate cards from card pool [%s]: %s - falling back to the standard card pool", pool.Name, err.Error())
+		cards, _ = generateCards(StandardCardPool().Cards, int(startingDeckSize), 0)
 	}
 
-	// Iterate until a valid set of cards is generated. While there is always a danger of infinite looping here,
-	// the chances of the algorithm failing to find a deck more than a few times is infinitesimally small.
-	var success = false
-	for !success {
+	return cards
+}
+
+// GenerateCardsFromPool generates a new set of cards for a match, with decks of the specified size drawn from the
+// specified card pool (such as for an event mode), with the same checks as GenerateCards. Returns an error if the pool
+// is too small for two decks, the decks are too small to deal a hand from and still draw from, or no valid set of
+// cards could be generated from the pool.
+func GenerateCardsFromPool(pool []Card, deckSize int) (cards Cards, err error) {
+
+	// Each deck needs a full hand, and at least one card left over for the first draw.
+	if dealtDeckSize(deckSize) < 1 {
+		return cards, fmt.Errorf("Deck size [ %v ] must be greater than the hand size [ %v ]", deckSize, startingHandSize)
+	}
+
+	// The pool must contain enough cards for both decks.
+	if len(pool) < deckSize*2 {
+		return cards, fmt.Errorf("Card pool of [ %v ] cards is too small for two decks of [ %v ]", len(pool), deckSize)
+	}
+
+	// Only cards that can be serialized (as a single hexadecimal character) and played are allowed.
+	for _, card := range pool {
+		if card > Force {
+			return cards, fmt.Errorf("Invalid card [ %v ] in card pool", card)
+		}
+	}
+
+	return generateCards(pool, deckSize, maxGenerationAttempts)
+}
+
+// generateCards generates a new set of cards for a match, with decks of the specified size drawn from the specified
+// card pool, which must be large enough for both decks. Up to (maxAttempts) sets of cards are generated, until a valid
+// one is found - zero means that there is no limit. Returns an error if no valid set was found.
+func generateCards(pool []Card, deckSize int, maxAttempts int) (cards Cards, err error) {
+
+	// Iterate until a valid set of cards is generated. Without an attempt limit there is a danger of infinite looping
+	// here, but with the standard pool, the chances of the algorithm failing to find a deck more than a few times is
+	// infinitesimally small.
+	for attempt := 0; maxAttempts == 0 || attempt < maxAttempts; attempt++ {
 
 		// Generate a permutation based on the size of the card pool. This gives us an array with a set of
 		// integers representing each index of the pool array, in random order.
@@ -109,25 +210,28 @@ func GenerateCards() (cards Cards) {
 		// Create an empty Card object to fill later.
 		cards = Cards{}
 
-		// Fill player 1's deck using the first 15 members (0 ->14) of the permutation array.
-		for i := uint8(0); i < startingDeckSize; i++ {
+		// Fill player 1's deck using the first (deckSize) members of the permutation array.
+		for i := 0; i < deckSize; i++ {
 			cards.Player1Deck = append(cards.Player1Deck, pool[permutation[i]])
 		}
 
-		// Fill player 2's deck using the next 15 members (15 -> 29) of the permutation array.
-		for i := uint8(15); i < startingDeckSize*2; i++ {
+		// Fill player 2's deck using the next (deckSize) members of the permutation array.
+		for i := deckSize; i < deckSize*2; i++ {
 			cards.Player2Deck = append(cards.Player2Deck, pool[permutation[i]])
 		}
 
-		// Check the validity of the cards that were selected. A result of true will cause the loop to exit.
-		success = validateCards(&cards)
+		// Check the validity of the cards that were selected. If they are valid, return them.
+		if validateCards(&cards, deckSize) {
+			return cards, nil
+		}
 	}
 
-	// Reaching this point means a valid set of cards has been found - so return the set.
-	return cards
+	// Reaching this point means that the attempt limit was reached without finding a valid set of cards.
+	return Cards{}, fmt.Errorf("No valid set of cards found after [ %v ] attempts", maxAttempts)
 }
 
-// InitializeCards simulates the first moves of the game until a playable state is reached.
+// InitializeCards simulates the first moves of the game until a playable state is reached. The decks can be of any
+// size larger than the hand size (see GenerateCardsFromPool).
 //
 // Returns a COPY of the input cards.
 func InitializeCards(inCards Cards) (outCards Cards) {
@@ -136,23 +240,27 @@ func InitializeCards(inCards Cards) (outCards Cards) {
 	// While the parameter is passed as a copy, it contains arrays which must be deep copied.
 	outCards = inCards.Copy()
 
-	// Copy the all the cards after the first 5, from player 1's deck to player 1's hand.
-	outCards.Player1Hand = outCards.Player1Deck[postInitialisationDeckSize:]
+	// Determine how many cards are left in each deck once the hands have been dealt (5, for the standard decks).
+	player1DeckSize := dealtDeckSize(len(outCards.Player1Deck))
+	player2DeckSize := dealtDeckSize(len(outCards.Player2Deck))
+
+	// Copy the all the cards after the ones that are left in the deck, from player 1's deck to player 1's hand.
+	outCards.Player1Hand = outCards.Player1Deck[player1DeckSize:]
 
 	// Reverse the cards in player 1's hand.
 	reverseCardArray(outCards.Player1Hand)
 
-	// Trim player 1's deck so that it contains only the first 5 cards.
-	outCards.Player1Deck = outCards.Player1Deck[:postInitialisationDeckSize]
+	// Trim player 1's deck so that it contains only the cards that are left in it.
+	outCards.Player1Deck = outCards.Player1Deck[:player1DeckSize]
 
-	// Copy the all the cards after the first 5, from player 2's deck to player 2's hand.
-	outCards.Player2Hand = outCards.Player2Deck[postInitialisationDeckSize:]
+	// Copy the all the cards after the ones that are left in the deck, from player 2's deck to player 2's hand.
+	outCards.Player2Hand = outCards.Player2Deck[player2DeckSize:]
 
 	// Reverse the cards in player 2's hand.
 	reverseCardArray(outCards.Player2Hand)
 
-	// Trim player 2's deck so that it contains only the first 5 cards.
-	outCards.Player2Deck = outCards.Player2Deck[:postInitialisationDeckSize]
+	// Trim player 2's deck so that it contains only the cards that are left in it.
+	outCards.Player2Deck = outCards.Player2Deck[:player2DeckSize]
 
 	// Return the initialised cards
 	return outCards
@@ -189,17 +297,27 @@ func (c Cards) Copy() (outCards Cards) {
 	return outCards
 }
 
-// validateCards returns true if the current cards will NOT result in a bad game state, such as an insta-loss, or more
-// requires more than "maxDrawsOnStart" draws in order to reach a playable state.
-func validateCards(cards *Cards) (valid bool) {
+// validateCards returns true if the current cards (with decks of the specified size, before the hands are dealt) will
+// NOT result in a bad game state, such as an insta-loss, or more requires more than "maxDrawsOnStart" draws in order to
+// reach a playable state. This holds for decks drawn from any card pool.
+func validateCards(cards *Cards, deckSize int) (valid bool) {
+
+	// Each deck must contain at least one non-effect card, whatever card pool the decks were drawn from.
+	if containsOnlyEffectCards(cards.Player1Deck) || containsOnlyEffectCards(cards.Player2Deck) {
+		return false
+	}
+
+	// Determine how many cards are left in each deck once the hands have been dealt.
+	postInitialisationDeckSize := dealtDeckSize(deckSize)
 
 	// Iterate until (maxDrawsOnStart) is reached.
-	for i := uint8(0); i < maxDrawsOnStart; i++ {
+	for i := 0; i < int(maxDrawsOnStart); i++ {
 
-		// Get the index of the card that will be checked from each deck. This starts at i = 4.
+		// Get the index of the card that will be checked from each deck. This starts at the top of the deck (index 4,
+		// for the standard decks).
 		cardIndex := postInitialisationDeckSize - 1 - i
 
-		// This should never be hit, but it's here incase somebody changes (postInitialisationDeckSize) to a bad value.
+		// Stop if the decks run out before (maxDrawsOnStart) is reached, as the match could not start.
 		if cardIndex < 0 {
 			break
 		}
@@ -261,8 +379,11 @@ func validFirstMoveAvailable(hand []Card, cardToBeatOrMatch Card, currentScore u
 	for i := 0; i < len(hand); i++ {
 
 		// Store the hand with the target card (the card being checked to see if playing it puts the
-		// game in a playable state) removed.
-		cardSetWithoutCurrent = append(hand[:i], hand[i+1:]...)
+		// game in a playable state) removed. A fresh slice is built each time, as appending to a subslice of
+		// the hand would overwrite the hand itself (and the deck that backs it).
+		cardSetWithoutCurrent = make([]Card, 0, len(hand)-1)
+		cardSetWithoutCurrent = append(cardSetWithoutCurrent, hand[:i]...)
+		cardSetWithoutCurrent = append(cardSetWithoutCurrent, hand[i+1:]...)
 
 		// If there will be at least one non-effect card available if this one is played...
 		if !containsOnlyEffectCards(cardSetWithoutCurrent) {
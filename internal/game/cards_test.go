@@ -0,0 +1,152 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// generatedDeals is the number of sets of cards that are generated by the property tests.
+const generatedDeals = 2000
+
+// TestValidFirstMoveAvailableKeepsHand is a regression test for first move validation building the hand without each
+// card by appending to a subslice of the hand, which overwrote the hand as it went. Here, removing the gunswords
+// overwrote them with the bolt, so the bolt was then checked against a hand of nothing but effect cards, and rejected.
+func TestValidFirstMoveAvailableKeepsHand(t *testing.T) {
+	hand := []Card{FiesTwinGunswords, Bolt, Mirror}
+	original := append([]Card{}, hand...)
+
+	if !validFirstMoveAvailable(hand, JusisSword, 3) {
+		t.Fatalf("Hand %v has no valid first move, but the bolt is valid", original)
+	}
+
+	if !reflect.DeepEqual(hand, original) {
+		t.Fatalf("Hand was modified from %v to %v", original, hand)
+	}
+}
+
+// TestValidFirstMoveAvailable checks first move validation for hands with and without a valid first move.
+func TestValidFirstMoveAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		hand     []Card
+		toBeat   Card
+		score    uint8
+		expected bool
+	}{
+		{"Card that beats the opponent", []Card{LaurasGreatsword, ElliotsOrbalStaff}, GaiusSpear, 1, true},
+		{"Card that matches the opponent", []Card{AlisasOrbalBow, ElliotsOrbalStaff}, JusisSword, 1, true},
+		{"Only cards that are too low", []Card{ElliotsOrbalStaff, ElliotsOrbalStaff}, LaurasGreatsword, 1, false},
+		{"Force that doubles the score enough", []Card{Force, ElliotsOrbalStaff}, JusisSword, 2, true},
+		{"Force that doesn't double the score enough", []Card{Force, ElliotsOrbalStaff}, LaurasGreatsword, 2, false},
+		{"Bolt", []Card{Bolt, ElliotsOrbalStaff}, LaurasGreatsword, 1, true},
+		{"Mirror", []Card{Mirror, ElliotsOrbalStaff}, LaurasGreatsword, 1, true},
+		{"Blast", []Card{Blast, ElliotsOrbalStaff}, LaurasGreatsword, 1, false},
+		{"Effect card that would leave only effect cards", []Card{Bolt, Mirror}, LaurasGreatsword, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := validFirstMoveAvailable(test.hand, test.toBeat, test.score); valid != test.expected {
+				t.Fatalf("Hand %v against %v with a score of %d is %v, expected %v", test.hand, test.toBeat, test.score, valid, test.expected)
+			}
+		})
+	}
+}
+
+// TestGenerateCardsProperties checks that generating cards never modifies the card pool, and that every set of cards
+// that is generated serializes to the same decks, and deals hands from the end of each deck.
+func TestGenerateCardsProperties(t *testing.T) {
+	pool := StandardCardPool()
+	original := StandardCardPool()
+
+	for i := 0; i < generatedDeals; i++ {
+		cards := GenerateCards(pool)
+
+		if !reflect.DeepEqual(pool, original) {
+			t.Fatalf("Card pool was modified after %d deals", i+1)
+		}
+
+		deserialized, err := DeserializeDecks(cards.Serialized())
+		if err != nil {
+			t.Fatalf("Failed to deserialize generated cards [%s]: %v", cards.Serialized(), err)
+		}
+
+		if !reflect.DeepEqual(deserialized.Player1Deck, cards.Player1Deck) || !reflect.DeepEqual(deserialized.Player2Deck, cards.Player2Deck) {
+			t.Fatalf("Serialized cards [%s] do not match the generated decks %v and %v", cards.Serialized(), cards.Player1Deck, cards.Player2Deck)
+		}
+
+		initialized := InitializeCards(cards)
+		for _, decks := range [][3][]Card{
+			{cards.Player1Deck, initialized.Player1Deck, initialized.Player1Hand},
+			{cards.Player2Deck, initialized.Player2Deck, initialized.Player2Hand},
+		} {
+			generated, deck, hand := decks[0], decks[1], decks[2]
+
+			if len(hand) != int(startingHandSize) || !reflect.DeepEqual(deck, generated[:len(generated)-len(hand)]) {
+				t.Fatalf("Deck %v was dealt into deck %v and hand %v", generated, deck, hand)
+			}
+
+			for j, card := range hand {
+				if card != generated[len(generated)-1-j] {
+					t.Fatalf("Hand %v is not the end of deck %v, reversed", hand, generated)
+				}
+			}
+		}
+	}
+}
+
+// checkLegalFirstMove checks that for the specified cards, the initial draws decide the turn, and the player that
+// goes first has a move that doesn't lose the match straight away.
+func checkLegalFirstMove(t *testing.T, cards Cards) {
+	t.Helper()
+
+	rules := NewRules(cards)
+
+	// Both players draw until the turn is decided.
+	for draws := 0; rules.Turn() == PlayerUndecided; draws++ {
+		if draws > int(maxDrawsOnStart)*2 {
+			t.Fatalf("Turn was not decided after %d draws, for cards [%s]", draws, cards.Serialized())
+		}
+
+		for _, player := range []Player{Player1, Player2} {
+			if rules.ExpectsMove(player) {
+				if moves := rules.LegalMoves(player); len(moves) == 0 || !rules.Apply(player, moves[0]) {
+					t.Fatalf("Player %v could not draw, for cards [%s]", player, cards.Serialized())
+				}
+			}
+		}
+
+		if ended, _ := rules.Ended(); ended {
+			t.Fatalf("Match ended while drawing, for cards [%s]", cards.Serialized())
+		}
+	}
+
+	// At least one of the first player's moves must keep the match going.
+	first := rules.Turn()
+	playable := false
+	for _, move := range rules.LegalMoves(first) {
+		next := *rules
+		if next.Apply(first, move) {
+			if ended, _ := next.Ended(); !ended {
+				playable = true
+				break
+			}
+		}
+	}
+
+	if !playable {
+		t.Fatalf("Player %v has no playable first move, for cards [%s]", first, cards.Serialized())
+	}
+}
+
+// TestGeneratedCardsHaveLegalFirstMove checks that every set of cards that is generated from the standard card pool has
+// a legal first move (see checkLegalFirstMove).
+func TestGeneratedCardsHaveLegalFirstMove(t *testing.T) {
+	for i := 0; i < generatedDeals; i++ {
+		checkLegalFirstMove(t, GenerateCards(StandardCardPool()))
+	}
+}
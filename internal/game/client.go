@@ -12,11 +12,9 @@ import (
 	"github.com/6a/blade-ii-game-server/internal/connection"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
 )
 
-// closeWaitPeriod is the time to wait between sending a close message, and closing a websocket.
-const closeWaitPeriod = time.Second * 1
-
 // GClient is a container for a websocket connection and its associated user data.
 type GClient struct {
 
@@ -26,10 +24,27 @@ type GClient struct {
 	PublicID    string
 	DisplayName string
 	Avatar      uint8
+	MMR         int
+
+	// The turn time for the client's match, as stored when the match was created. Zero means that the default
+	// turn time is used.
+	MatchTurnTime time.Duration
 
 	// Whether the server is currently expecting a move update from this client.
 	WaitingForMove bool
 
+	// The number of times that this client has timed out, and had a move auto-played on their behalf.
+	timeoutStrikes int
+
+	// The sequence number of the last move that was accepted from this client, for clients that use move sequence
+	// numbers. Sequence numbers start at 1, so zero means that no moves have been accepted yet.
+	lastMoveSequence uint64
+
+	// The sequence number of the last move forwarded to this client from their opponent, and the forwarded moves that
+	// this client has not yet acknowledged - for clients that acknowledge moves.
+	forwardedMoveSequence uint64
+	pendingMoves          []pendingMove
+
 	// A pointer to the websocket connection for this client.
 	connection *connection.Connection
 
@@ -65,6 +80,20 @@ func (client *GClient) pollReceive() {
 			break
 		}
 
+		// If the client sent messages faster than they could be processed, remove this client from the server
+		// and break out of the loop.
+		if err == connection.ErrFlooding {
+			client.server.Remove(client, protocol.WSCClientFlooding, err.Error())
+			break
+		}
+
+		// If the client hasn't sent any messages for too long, remove this client from the server and break out of the
+		// loop.
+		if err == connection.ErrIdleTimeout {
+			client.server.Remove(client, protocol.WSCConnectionTimeOut, err.Error())
+			break
+		}
+
 		// If the read function returned an error, remove this client from the server and
 		// break out of the loop.
 		if err != nil {
@@ -86,8 +115,13 @@ func (client *GClient) pollSend() {
 		err := client.connection.WriteMessage(message)
 
 		// If the client is pending kill (most likely due to being terminated by another thread)
-		// break out of the loop without doing anything.
+		// break out of the loop without doing anything - unless there are more messages queued, such
+		// as a match result followed by the final message, in which case keep writing until they are sent.
 		if client.isPendingKill() {
+			if err == nil && len(client.connection.OutboundMessageQueue) > 0 {
+				continue
+			}
+
 			break
 		}
 
@@ -100,6 +134,11 @@ func (client *GClient) pollSend() {
 	}
 }
 
+// discardInboundMessages discards any messages that this client has sent that have not yet been processed.
+func (client *GClient) discardInboundMessages() {
+	client.connection.DiscardInboundMessages()
+}
+
 // IsSameConnection returns true if the specified client is the same as this one.
 func (client *GClient) IsSameConnection(other *GClient) bool {
 
@@ -112,6 +151,11 @@ func (client *GClient) IsSameConnection(other *GClient) bool {
 	return client.connection.UUID.Compare(other.connection.UUID) == 0
 }
 
+// ConnectionID returns the unique ID of the client's underlying connection.
+func (client *GClient) ConnectionID() xid.ID {
+	return client.connection.UUID
+}
+
 // SendMessage adds a message to the outbound queue.
 func (client *GClient) SendMessage(message protocol.Message) {
 
@@ -119,25 +163,24 @@ func (client *GClient) SendMessage(message protocol.Message) {
 	client.connection.SendMessage(message)
 }
 
-// Close sends a message to the client, and closes the connection after a delay.
-// The delay is asynchronous, as it is wrapped in a goroutine.
+// Close sends a message to the client, and closes the connection with a close handshake after a delay.
+// The delay is asynchronous, so this does not block.
 func (client *GClient) Close(message protocol.Message) {
 
 	// Send the specified message to the client.
 	client.SendMessage(message)
 
+	// The connection is no longer active, so remove it from the session registry.
+	client.server.sessions.Unregister(client.DBID, client.ConnectionID())
+
 	// Using the client kill lock mutex to avoid race conditions, set pendingKill
 	// to true, so that the next read/writes cause their respective pumps to exit.
 	client.killLock.Lock()
 	client.pendingKill = true
 	client.killLock.Unlock()
 
-	// Spin up a goroutine, which sleeps for a set amount for a set amount of time before closing
-	// the websocket connection.
-	go func() {
-		time.Sleep(closeWaitPeriod)
-		client.connection.WS.Close()
-	}()
+	// Close the websocket connection once the close wait period has elapsed, without blocking.
+	client.connection.CloseAfterWait(message)
 }
 
 // isPendingKill is a helper function that returns true if this client is due to be killed.
@@ -156,14 +199,16 @@ func (client *GClient) isPendingKill() bool {
 
 // NewClient creates a and retruns a pointer to a new Client, and starts its
 // message pumps in two seperate go routines.
-func NewClient(wsconn *websocket.Conn, databaseID uint64, publicID string, displayname string, matchID uint64, avatar uint8, gameServer *Server) *GClient {
-	connection := connection.NewConnection(wsconn)
+func NewClient(wsconn *websocket.Conn, databaseID uint64, publicID string, displayname string, matchID uint64, matchTurnTime time.Duration, avatar uint8, mmr int, protocolVersion uint16, encoding protocol.Encoding, gameServer *Server) *GClient {
+	connection := connection.NewConnection(wsconn, protocolVersion, encoding)
 	client := &GClient{
 		DBID:           databaseID,
 		PublicID:       publicID,
 		DisplayName:    displayname,
 		MatchID:        matchID,
+		MatchTurnTime:  matchTurnTime,
 		Avatar:         avatar,
+		MMR:            mmr,
 		connection:     connection,
 		server:         gameServer,
 		WaitingForMove: false,
@@ -0,0 +1,147 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+// SendCommand adds a command to the command queue, to be processed by the main loop. Returns false if the queue is
+// full, in which case the command is dropped. Safe to call from any goroutine.
+func (gs *Server) SendCommand(command protocol.Command) bool {
+	select {
+	case gs.commands <- command:
+		return true
+	default:
+		return false
+	}
+}
+
+// processCommand handles server commands, and reports the outcome to the sender of the command.
+func (gs *Server) processCommand(command protocol.Command) {
+	log.Printf("Processing command of type [ %v ] with data [ %v ]", command.Type, command.Data)
+
+	switch command.Type {
+	case protocol.QCTBroadcastMessage:
+
+		// Send the message to every client in every match - including matches that are still waiting for players.
+		message := protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAnnouncement, command.Data)
+		count := 0
+		for _, match := range gs.matches {
+			for _, client := range []*GClient{match.Client1, match.Client2} {
+				if client != nil {
+					client.SendMessage(message)
+					count++
+				}
+			}
+		}
+
+		command.Reply(true, fmt.Sprintf("Broadcast to %d clients", count))
+	case protocol.QCTDropAll:
+
+		// End every match without a result, and disconnect all of the clients.
+		count := len(gs.matches)
+		for _, match := range gs.matches {
+			gs.dropMatch(match, command.Data)
+		}
+
+		command.Reply(true, fmt.Sprintf("Dropped %d matches", count))
+	case protocol.QCTChangePollTime:
+
+		// The poll time is specified as a duration string, such as "100ms".
+		pollTime, err := time.ParseDuration(command.Data)
+		if err != nil || pollTime <= 0 || pollTime > maximumPollTime {
+			command.Reply(false, fmt.Sprintf("Poll time must be a duration greater than zero, and no longer than %v", maximumPollTime))
+			return
+		}
+
+		gs.pollTime = pollTime
+		command.Reply(true, fmt.Sprintf("Poll time set to %v", pollTime))
+	case protocol.QCTForceDisconnectUser:
+
+		// The user is specified by their database ID. In a match, this is a forfeit for the user.
+		databaseID, err := strconv.ParseUint(command.Data, 10, 64)
+		if err != nil {
+			command.Reply(false, "Database ID bad format")
+			return
+		}
+
+		count := gs.removeUser(databaseID, protocol.WSCDroppedByServer, "Disconnected by the server")
+		if count == 0 {
+			command.Reply(false, fmt.Sprintf("User [%d] is not on the server", databaseID))
+			return
+		}
+
+		command.Reply(true, fmt.Sprintf("Disconnected user [%d] (%d connections)", databaseID, count))
+	case protocol.QCTBanSweep:
+
+		// Run the ban sweep on this tick, rather than waiting for the next one to be due.
+		gs.nextBanSweep = time.Time{}
+		command.Reply(true, "Ban sweep scheduled")
+	case protocol.QCTMaintenance:
+
+		// The data is either "off", or the delay until the planned shutdown (such as "15m" - the default delay is used
+		// if it's empty). The switch is shared with any other servers in the process, and each one announces the change
+		// on its next tick.
+		if err := gs.maintenance.Set(command.Data, time.Now()); err != nil {
+			command.Reply(false, err.Error())
+			return
+		}
+
+		command.Reply(true, maintenance.Announcement(gs.maintenance.State()))
+	case protocol.QCTMoveValidation:
+
+		// The data is the name of the validation mode - "enforce", "shadow" or "off". Takes effect from the next move.
+		mode, ok := validationModeFromString(command.Data)
+		if !ok {
+			command.Reply(false, "Validation mode must be one of [enforce], [shadow] or [off]")
+			return
+		}
+
+		gs.validationMode = mode
+		command.Reply(true, fmt.Sprintf("Move validation mode set to [%s]", mode))
+	default:
+		command.Reply(false, fmt.Sprintf("Unknown command type [%d]", command.Type))
+	}
+}
+
+// dropMatch disconnects the clients in the specified match with the specified message, and removes the match. Matches
+// that were in play end without a result, and matches that were still waiting for players are aborted.
+func (gs *Server) dropMatch(match *Match, reason string) {
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCDroppedByServer, reason)
+
+	if match.Client1 != nil {
+		match.Client1.Close(message)
+	}
+
+	if match.Client2 != nil {
+		match.Client2.Close(message)
+	}
+
+	// Record the match as no contest if it started (this is a noop if the result was already written, such as for a
+	// match that ended gracefully), or as aborted if it did not.
+	if match.GetPhase() > WaitingForPlayers {
+		match.SetMatchNoContest()
+		match.RecordAudit(protocol.WSCDroppedByServer)
+		match.publishMatchEvent(EventMatchEnded, protocol.WSCDroppedByServer)
+	} else {
+		match.SetMatchAborted()
+	}
+
+	match.SetPhase(Finished)
+
+	// Remove the match from the match map, and update the capacity gauge.
+	delete(gs.matches, match.ID)
+	gs.capacity.Set(len(gs.matches))
+
+	log.Printf("Match [%d] was dropped by the server. Total matches: %v", match.ID, len(gs.matches))
+}
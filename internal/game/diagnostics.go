@@ -0,0 +1,303 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// moveHistoryLength is the number of recent moves that are kept for each match, for diagnostic dumps.
+	moveHistoryLength = 20
+
+	// defaultDiagnosticsRetention is the default maximum number of diagnostic dump files that are kept.
+	defaultDiagnosticsRetention = 100
+
+	// diagnosticsFilePrefix and diagnosticsFileSuffix surround the match ID and timestamp in the name of each dump
+	// file. Only files with both are counted (and removed) by the retention cap.
+	diagnosticsFilePrefix = "match-"
+	diagnosticsFileSuffix = ".json"
+
+	// redactedDisplayName replaces the display names in diagnostic dumps, if they are redacted.
+	redactedDisplayName = "<redacted>"
+)
+
+var (
+
+	// diagnosticsDirectory is the directory to which diagnostic dumps are written - empty to not write them to files.
+	// Configured via the "match_diagnostics_dir" environment variable.
+	diagnosticsDirectory = envvar.String("match_diagnostics_dir", "")
+
+	// diagnosticsWebhookURL is the URL to which diagnostic dumps are posted - empty to not post them. Configured via the
+	// "match_diagnostics_webhook_url" environment variable.
+	diagnosticsWebhookURL = envvar.String("match_diagnostics_webhook_url", "")
+
+	// diagnosticsRetention is the maximum number of diagnostic dump files that are kept - the oldest are removed once
+	// there are more. Zero or less keeps them all. Configured via the "match_diagnostics_retention" environment
+	// variable.
+	diagnosticsRetention = envvar.Int("match_diagnostics_retention", defaultDiagnosticsRetention)
+
+	// diagnosticsRedactNames is whether the display names of the players are redacted from diagnostic dumps.
+	// Configured via the "match_diagnostics_redact_names" environment variable.
+	diagnosticsRedactNames = envvar.Bool("match_diagnostics_redact_names", false)
+
+	// diagnosticsLock serializes the writing of dump files, so that the retention cap is applied consistently.
+	diagnosticsLock sync.Mutex
+)
+
+// diagnosticCodes are the codes with which a match can be removed that indicate that it ended abnormally, and should
+// have a diagnostic dump written. Recovered panics are dumped too (see recoverMatchPanic).
+var diagnosticCodes = map[protocol.B2Code]bool{
+	protocol.WSCMatchIllegalMove:    true,
+	protocol.WSCMatchStateCorrupted: true,
+}
+
+// historyMove is a move in the recent move history for a match.
+type historyMove struct {
+	Player      Player `json:"player"`
+	Instruction int    `json:"instruction"`
+	Payload     string `json:"payload"`
+	AutoPlayed  bool   `json:"autoPlayed,omitempty"`
+	Time        int64  `json:"time"`
+}
+
+// diagnosticMessage is the most recent message received from either client in a diagnostic dump - usually the one that
+// triggered the abnormal termination.
+type diagnosticMessage struct {
+	Player  Player          `json:"player"`
+	Code    protocol.B2Code `json:"code"`
+	Message string          `json:"message"`
+}
+
+// diagnosticClient describes one of the clients in a diagnostic dump.
+type diagnosticClient struct {
+	DBID        uint64 `json:"dbid"`
+	DisplayName string `json:"displayName"`
+	LatencyMS   int64  `json:"latencyMS"`
+}
+
+// diagnosticState is the state of the match in a diagnostic dump.
+type diagnosticState struct {
+	Phase        Phase       `json:"phase"`
+	Turn         Player      `json:"turn"`
+	Winner       uint64      `json:"winner"`
+	Player1Score uint16      `json:"p1score"`
+	Player2Score uint16      `json:"p2score"`
+	Player1MMR   int         `json:"p1mmr"`
+	Player2MMR   int         `json:"p2mmr"`
+	Cards        loggedCards `json:"cards"`
+}
+
+// matchDiagnostics is a diagnostic dump for a match that ended abnormally.
+type matchDiagnostics struct {
+	MatchID uint64              `json:"matchid"`
+	Time    int64               `json:"time"`
+	Code    protocol.B2Code     `json:"code"`
+	Panic   string              `json:"panic,omitempty"`
+	Stack   string              `json:"stack,omitempty"`
+	State   diagnosticState     `json:"state"`
+	Moves   []historyMove       `json:"moves"`
+	Clients [2]diagnosticClient `json:"clients"`
+	Trigger *diagnosticMessage  `json:"trigger,omitempty"`
+}
+
+// diagnosticsEnabled returns true if diagnostic dumps are written to files, posted to a webhook, or both.
+func diagnosticsEnabled() bool {
+	return diagnosticsDirectory != "" || diagnosticsWebhookURL != ""
+}
+
+// recordMove adds the specified move, made by the specified player, to the recent move history, discarding the oldest
+// move if the history is full.
+func (match *Match) recordMove(player Player, move Move, autoPlayed bool) {
+	if len(match.moveHistory) == moveHistoryLength {
+		match.moveHistory = append(match.moveHistory[:0], match.moveHistory[1:]...)
+	}
+
+	match.moveHistory = append(match.moveHistory, historyMove{
+		Player:      player,
+		Instruction: int(move.Instruction),
+		Payload:     move.Payload,
+		AutoPlayed:  autoPlayed,
+		Time:        time.Now().UnixMilli(),
+	})
+}
+
+// recordMessage stores the specified message, received from the specified player, as the most recent message for the
+// match.
+func (match *Match) recordMessage(player Player, message protocol.Message) {
+	match.lastMessage = &diagnosticMessage{
+		Player:  player,
+		Code:    message.Payload.Code,
+		Message: message.Payload.Message,
+	}
+}
+
+// removeWithDiagnostics removes the specified client (which also ends the match) with the specified code and message,
+// as Server.Remove does - first writing a diagnostic dump, if the code indicates that the match ended abnormally.
+func (match *Match) removeWithDiagnostics(client *GClient, code protocol.B2Code, message string) {
+	if diagnosticCodes[code] {
+		match.writeDiagnostics(code, "", "")
+	}
+
+	match.Server.Remove(client, code, message)
+}
+
+// recoverMatchPanic recovers from a panic while ticking the specified match, logging it along with the stack trace,
+// writing a diagnostic dump, and ending the match as if its state was corrupted - so that a bug in the match logic
+// affects only the match in which it occurred. Must be called directly by a deferred statement, as recover has no
+// effect otherwise.
+func (gs *Server) recoverMatchPanic(match *Match) {
+	if r := recover(); r != nil {
+		stack := string(debug.Stack())
+		log.Printf("Match [ %v ] recovered from a panic: %v\n%s", match.ID, r, stack)
+
+		match.writeDiagnostics(protocol.WSCMatchStateCorrupted, fmt.Sprint(r), stack)
+
+		// End the match as a draw, as neither player can be held responsible.
+		match.State.Winner = 0
+		gs.Remove(match.Client1, protocol.WSCMatchStateCorrupted, "Match state corrupted")
+		match.SetPhase(Finished)
+	}
+}
+
+// writeDiagnostics writes a diagnostic dump for this match, which ended abnormally with the specified code - along with
+// the value and stack trace of the panic that ended it, if any. Only one dump is written per match. The dump is built
+// here, but written (and posted) in a goroutine, so that the main loop is not blocked.
+func (match *Match) writeDiagnostics(code protocol.B2Code, panicValue string, stack string) {
+	if !diagnosticsEnabled() || match.diagnosticsWritten {
+		return
+	}
+
+	match.diagnosticsWritten = true
+
+	now := time.Now()
+	dump := matchDiagnostics{
+		MatchID: match.ID,
+		Time:    now.UnixMilli(),
+		Code:    code,
+		Panic:   panicValue,
+		Stack:   stack,
+		State: diagnosticState{
+			Phase:        match.GetPhase(),
+			Turn:         match.State.Turn,
+			Winner:       match.State.Winner,
+			Player1Score: match.State.Player1Score,
+			Player2Score: match.State.Player2Score,
+			Player1MMR:   match.State.Player1MMR,
+			Player2MMR:   match.State.Player2MMR,
+			Cards:        newLoggedCards(&match.State.Cards),
+		},
+		Moves:   append([]historyMove{}, match.moveHistory...),
+		Clients: [2]diagnosticClient{newDiagnosticClient(match.Client1), newDiagnosticClient(match.Client2)},
+		Trigger: match.lastMessage,
+	}
+
+	data, err := json.Marshal(dump)
+	if err != nil {
+		log.Printf("Match [ %v ] failed to encode a diagnostic dump: %s", match.ID, err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("%s%d-%s%s", diagnosticsFilePrefix, match.ID, now.UTC().Format("20060102T150405.000Z"), diagnosticsFileSuffix)
+
+	go func() {
+		if diagnosticsDirectory != "" {
+			if err := saveDiagnostics(diagnosticsDirectory, name, data); err != nil {
+				log.Printf("Match [ %v ] failed to write a diagnostic dump: %s", dump.MatchID, err.Error())
+			} else {
+				log.Printf("Match [ %v ] wrote a diagnostic dump to [%s]", dump.MatchID, filepath.Join(diagnosticsDirectory, name))
+			}
+		}
+
+		if diagnosticsWebhookURL != "" {
+			apiinterface.PostEvent(diagnosticsWebhookURL, json.RawMessage(data))
+		}
+	}()
+}
+
+// newDiagnosticClient returns the description of the specified client for a diagnostic dump, redacting their display
+// name if required. A nil client is described with zero values.
+func newDiagnosticClient(client *GClient) diagnosticClient {
+	if client == nil {
+		return diagnosticClient{}
+	}
+
+	displayName := client.DisplayName
+	if diagnosticsRedactNames {
+		displayName = redactedDisplayName
+	}
+
+	return diagnosticClient{
+		DBID:        client.DBID,
+		DisplayName: displayName,
+		LatencyMS:   client.connection.Latency.Milliseconds(),
+	}
+}
+
+// saveDiagnostics writes the specified dump to a file with the specified name, in the specified directory (creating it
+// if needed), and then removes the oldest dump files beyond the retention cap.
+func saveDiagnostics(directory string, name string, data []byte) error {
+	diagnosticsLock.Lock()
+	defer diagnosticsLock.Unlock()
+
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(directory, name), data, 0644); err != nil {
+		return err
+	}
+
+	if diagnosticsRetention <= 0 {
+		return nil
+	}
+
+	// Find the existing dump files, oldest first. The names start with the match ID rather than the time at which they
+	// were written, so they are sorted by modification time.
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+
+	dumps := make([]os.FileInfo, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), diagnosticsFilePrefix) && strings.HasSuffix(file.Name(), diagnosticsFileSuffix) {
+			dumps = append(dumps, file)
+		}
+	}
+
+	sort.Slice(dumps, func(i, j int) bool {
+		if !dumps[i].ModTime().Equal(dumps[j].ModTime()) {
+			return dumps[i].ModTime().Before(dumps[j].ModTime())
+		}
+
+		return dumps[i].Name() < dumps[j].Name()
+	})
+
+	// Remove the oldest dumps beyond the retention cap.
+	for index := 0; index < len(dumps)-diagnosticsRetention; index++ {
+		if err := os.Remove(filepath.Join(directory, dumps[index].Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
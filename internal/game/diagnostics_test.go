@@ -0,0 +1,96 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// TestIllegalMoveDiagnostics plays a few moves and then an illegal one, and checks that a well formed diagnostic dump
+// is written for the match, ending with the moves that were made and the message that ended it.
+func TestIllegalMoveDiagnostics(t *testing.T) {
+	directory, retention := diagnosticsDirectory, diagnosticsRetention
+	t.Cleanup(func() {
+		diagnosticsDirectory, diagnosticsRetention = directory, retention
+	})
+
+	diagnosticsDirectory, diagnosticsRetention = t.TempDir(), defaultDiagnosticsRetention
+
+	match := newAutoPlayTestMatch(t, midMatchState(GaiusSpear, FiesTwinGunswords), 0)
+
+	// Player 2 plays Gaius' spear, player 1 beats it with Laura's greatsword, and then player 2 plays Gaius' spear again,
+	// which they no longer have.
+	moves := []struct {
+		client  *GClient
+		message string
+	}{
+		{match.Client2, "1|6:"},
+		{match.Client1, "1|7:"},
+		{match.Client2, "2|6:"},
+	}
+
+	for _, move := range moves {
+		move.client.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, move.message)
+		match.Tick()
+	}
+
+	if request := <-match.Server.disconnect; request.Client != match.Client2 || request.Reason != protocol.WSCMatchIllegalMove {
+		t.Fatalf("Client %d was removed with reason [%d], expected client 2 with reason [%d]", request.Client.DBID, request.Reason, protocol.WSCMatchIllegalMove)
+	}
+
+	// The dump is written in the background.
+	var files []string
+	for end := time.Now().Add(testDeadline); len(files) == 0; time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(end) {
+			t.Fatalf("No diagnostic dump was written within [%v]", testDeadline)
+		}
+
+		files, _ = filepath.Glob(filepath.Join(diagnosticsDirectory, diagnosticsFilePrefix+"*"+diagnosticsFileSuffix))
+	}
+
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read the diagnostic dump: %v", err)
+	}
+
+	var dump matchDiagnostics
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("Diagnostic dump is not valid JSON: %v", err)
+	}
+
+	if dump.MatchID != match.ID || dump.Code != protocol.WSCMatchIllegalMove {
+		t.Fatalf("Diagnostic dump is for match [%d] with code [%d], expected match [%d] with code [%d]", dump.MatchID, dump.Code, match.ID, protocol.WSCMatchIllegalMove)
+	}
+
+	expected := []historyMove{
+		{Player: Player2, Instruction: int(CardGaiusSpear)},
+		{Player: Player1, Instruction: int(CardLaurasGreatsword)},
+		{Player: Player2, Instruction: int(CardGaiusSpear)},
+	}
+
+	if len(dump.Moves) != len(expected) {
+		t.Fatalf("Diagnostic dump has moves %+v, expected %+v", dump.Moves, expected)
+	}
+
+	for index, move := range dump.Moves {
+		if move.Player != expected[index].Player || move.Instruction != expected[index].Instruction || move.Payload != "" || move.AutoPlayed || move.Time == 0 {
+			t.Fatalf("Diagnostic dump has moves %+v, expected %+v", dump.Moves, expected)
+		}
+	}
+
+	if dump.Trigger == nil || *dump.Trigger != (diagnosticMessage{Player: Player2, Code: protocol.WSCMatchMove, Message: "2|6:"}) {
+		t.Fatalf("Diagnostic dump was triggered by %+v, expected player 2's move [2|6:]", dump.Trigger)
+	}
+
+	if dump.Clients[0].DBID != match.Client1.DBID || dump.Clients[1].DBID != match.Client2.DBID {
+		t.Fatalf("Diagnostic dump has clients %+v, expected clients %d and %d", dump.Clients, match.Client1.DBID, match.Client2.DBID)
+	}
+}
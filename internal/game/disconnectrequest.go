@@ -6,7 +6,10 @@
 package game
 
 import (
+	"log"
+
 	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/rs/xid"
 )
 
 // DisconnectRequest is a wrapper for the information required to remove a client from the game server.
@@ -15,6 +18,9 @@ type DisconnectRequest struct {
 	// A pointer to the client to remove.
 	Client *GClient
 
+	// The unique ID of the client's connection, for identifying stale connections and duplicate requests.
+	ConnectionID xid.ID
+
 	// The reason for removal.
 	Reason protocol.B2Code
 
@@ -22,3 +28,90 @@ type DisconnectRequest struct {
 	// in a match, and the state of the match etc..
 	Message string
 }
+
+// mutualDisconnect tracks the disconnect requests that are pending for a single started match, to determine whether
+// both players have gone.
+type mutualDisconnect struct {
+
+	// Whether the current connection of each player has a connection error pending.
+	client1Disconnected bool
+	client2Disconnected bool
+
+	// Whether a mutual timeout is pending, and its message.
+	mutualTimeout bool
+	message       string
+}
+
+// ended returns true if both players have gone - either because both connections errored, or they timed out together.
+func (pending *mutualDisconnect) ended() bool {
+	return pending.mutualTimeout || (pending.client1Disconnected && pending.client2Disconnected)
+}
+
+// coalesceMutualDisconnects replaces the pending disconnect requests for the current connections in each started match
+// where both players have gone, with a single mutual timeout request - so that a mutual timeout, and the connection
+// errors from both players' pumps, converge on one no contest result, regardless of the order in which they arrived.
+// Otherwise, whichever request happened to be handled first would decide the result, awarding a win to a player who
+// had also disconnected. Requests for other matches, and for stale connections, are left as they are.
+//
+// Only called from the main loop, before the pending requests are handled.
+func (gs *Server) coalesceMutualDisconnects() {
+
+	// Take all the pending requests out of the queue, so that they can be considered together.
+	requests := make([]DisconnectRequest, 0, len(gs.immediateDisconnect))
+	for len(gs.immediateDisconnect) > 0 {
+		requests = append(requests, <-gs.immediateDisconnect)
+	}
+
+	// Determine which started matches both players have gone from. Matches that already ended gracefully are skipped,
+	// as their result is already decided.
+	pending := make(map[uint64]*mutualDisconnect)
+	for _, req := range requests {
+		match, ok := gs.matches[req.Client.MatchID]
+		if !ok || match.GetPhase() <= WaitingForPlayers || match.isMatchGracefullyFinished() {
+			continue
+		}
+
+		if pending[match.ID] == nil {
+			pending[match.ID] = &mutualDisconnect{}
+		}
+
+		if req.Reason == protocol.WSCMatchMutualTimeout {
+			pending[match.ID].mutualTimeout = true
+			pending[match.ID].message = req.Message
+		} else if req.Reason == protocol.WSCUnknownConnectionError && req.Client.IsSameConnection(match.Client1) {
+			pending[match.ID].client1Disconnected = true
+		} else if req.Reason == protocol.WSCUnknownConnectionError && req.Client.IsSameConnection(match.Client2) {
+			pending[match.ID].client2Disconnected = true
+		}
+	}
+
+	// Put the requests back into the queue, in their original order, with the requests for the current connections in
+	// each match that both players have gone from replaced by a single mutual timeout.
+	replaced := make(map[uint64]bool)
+	for _, req := range requests {
+		match, ok := gs.matches[req.Client.MatchID]
+		if !ok || pending[match.ID] == nil || !pending[match.ID].ended() || (!req.Client.IsSameConnection(match.Client1) && !req.Client.IsSameConnection(match.Client2)) {
+			gs.immediateDisconnect <- req
+			continue
+		}
+
+		if replaced[match.ID] {
+			continue
+		}
+
+		replaced[match.ID] = true
+
+		message := pending[match.ID].message
+		if !pending[match.ID].mutualTimeout {
+			message = "Both players disconnected"
+			log.Printf("Match [ %v ] - both players disconnected at the same time - ending the match as no contest", match.ID)
+		}
+
+		gs.immediateDisconnect <- DisconnectRequest{
+			Client:       match.Client1,
+			ConnectionID: match.Client1.ConnectionID(),
+			Reason:       protocol.WSCMatchMutualTimeout,
+			Message:      message,
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// EndReason is an enum type that represents the mechanism by which a match ended.
+type EndReason uint8
+
+// Definitions of end reasons. Explicitly numbered, as they are sent to the clients.
+const (
+
+	// EndReasonUnknown is used when the mechanism is not known - such as for a match that has not ended.
+	EndReasonUnknown EndReason = 0
+
+	// Reasons for a match that was played out - determined by Engine.checkForMatchEnd.
+	EndReasonDraw            EndReason = 1
+	EndReasonTieUnbreakable  EndReason = 2
+	EndReasonBlastEmptyHand  EndReason = 3
+	EndReasonOnlyEffectCards EndReason = 4
+	EndReasonScoreNotBeaten  EndReason = 5
+	EndReasonEmptyHand       EndReason = 6
+	EndReasonCannotBeatScore EndReason = 7
+
+	// Reasons for a match that was cut short.
+	EndReasonTimeout        EndReason = 8
+	EndReasonForfeit        EndReason = 9
+	EndReasonIllegalMove    EndReason = 10
+	EndReasonNoContest      EndReason = 11
+	EndReasonStateCorrupted EndReason = 12
+)
+
+// endReasonFromCode returns the end reason for a match that was removed from the server with the specified code,
+// falling back to the specified reason (the one determined by Engine.checkForMatchEnd) for wins and draws.
+func endReasonFromCode(code protocol.B2Code, played EndReason) EndReason {
+	switch code {
+	case protocol.WSCMatchWin, protocol.WSCMatchDraw:
+		return played
+	case protocol.WSCMatchTimeOut:
+		return EndReasonTimeout
+	case protocol.WSCMatchIllegalMove:
+		return EndReasonIllegalMove
+	case protocol.WSCMatchMutualTimeout:
+		return EndReasonNoContest
+	case protocol.WSCMatchStateCorrupted:
+		return EndReasonStateCorrupted
+	default:
+
+		// Disconnections, flooding, unsupported messages and explicit forfeits all count as forfeits.
+		return EndReasonForfeit
+	}
+}
+
+// sendMatchResult sends a summary of how the match ended to both clients, so that they can show an end screen. Must
+// be sent before the clients are closed, as the close message is the last message that a client receives.
+//
+// Format: <winner><delim><end reason><delim><player 1 score><delim><player 2 score><delim><turns>
+//
+// The winner is in the card data player format (0 for player 1, 1 for player 2), or empty if there was no winner. The
+// number of turns is the number of valid moves made during the match, including auto-played moves.
+func (match *Match) sendMatchResult(reason EndReason) {
+
+	// Convert the winner to the card data player format.
+	winner := ""
+	if match.State.Winner != 0 && match.State.Winner == match.Client1.DBID {
+		winner = "0"
+	} else if match.State.Winner != 0 && match.State.Winner == match.Client2.DBID {
+		winner = "1"
+	}
+
+	data := strings.Join([]string{
+		winner,
+		strconv.Itoa(int(reason)),
+		strconv.Itoa(int(match.State.Player1Score)),
+		strconv.Itoa(int(match.State.Player2Score)),
+		strconv.Itoa(match.moveCount),
+	}, clientDataDelimiter)
+
+	match.BroadCast(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionMatchResult, data)))
+}
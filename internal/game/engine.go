@@ -0,0 +1,603 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import "strconv"
+
+// Engine implements the rules of the game, separately from the networking - it applies moves to a match state, and
+// determines whether (and how) they end the match, without any clients, timers, or side effects. Matches wrap it to
+// apply the moves that their clients make, and it can also be used on its own, such as to simulate or verify a match.
+// The zero value is ready to use, and as it holds no state, it is safe for concurrent use.
+type Engine struct{}
+
+// MoveResult describes the outcome of a move that was applied by the engine (see Engine.ApplyMove).
+type MoveResult struct {
+
+	// Whether the move was accepted. If not, the state is left unchanged, and the other fields are meaningless.
+	Accepted bool
+
+	// Whether the move ended the match, and if so, the winner (PlayerUndecided for a draw), and the reason.
+	Ended  bool
+	Winner Player
+	Reason EndReason
+
+	// The player that the match is now waiting for a move from - PlayerUndecided means both players, while the turn is
+	// undecided and neither has drawn. Only meaningful for moves that did not end the match. It is derived from the
+	// move itself rather than from the turn, as a player that has already drawn is not waiting to move.
+	NextToAct Player
+
+	// Whether a blast card had its effect activated, which the clients show with a long animation.
+	UsedBlastEffect bool
+}
+
+// ActivePlayer is a uint8 typedef for the active player during a game end check
+type ActivePlayer uint8
+
+const activePlayerUndecided ActivePlayer = 0
+const activePlayerTarget ActivePlayer = 1
+const activePlayerOpposite ActivePlayer = 2
+
+// ApplyMove applies the specified move, made by the specified player, to a copy of the specified state, and returns
+// the new state along with the result of the move. The specified state is never modified. If the move is rejected, the
+// returned state is the specified state. Moves only change the cards, the turn, and the scores.
+//
+// Whether it is the player's turn is not checked here (see ExpectsMove), so that callers can decide how to handle moves
+// that are made out of turn.
+func (engine Engine) ApplyMove(state MatchState, player Player, move Move) (next MatchState, result MoveResult) {
+
+	// Copy the state, including the cards, so that the move can be applied without affecting the original.
+	next = state
+	next.Cards = state.Cards.clone()
+
+	result = engine.applyMove(&next, player, move)
+	if !result.Accepted {
+		return state, result
+	}
+
+	return next, result
+}
+
+// ExpectsMove returns true if the specified state is waiting for a move from the specified player - either because it
+// is their turn, or because the turn is undecided and they have not yet drawn. Does not account for the match having
+// ended, which is up to the caller.
+func (engine Engine) ExpectsMove(state MatchState, player Player) bool {
+	return engine.isTurn(&state, player) && !engine.hasDrawn(&state, player)
+}
+
+// isTurn returns true if the specified player is allowed to move in the specified state - because it is their turn,
+// or because the turn is undecided.
+func (engine Engine) isTurn(state *MatchState, player Player) bool {
+	return state.Turn == player || state.Turn == PlayerUndecided
+}
+
+// hasDrawn returns true if the turn is currently undecided, and the specified player has already drawn a card onto
+// their field - meaning that they are no longer expected to make a move until the turn is decided.
+func (engine Engine) hasDrawn(state *MatchState, player Player) bool {
+
+	// Draws only occur while the turn is undecided.
+	if state.Turn != PlayerUndecided {
+		return false
+	}
+
+	// The player has already drawn if there is a card on their field.
+	if player == Player1 {
+		return len(state.Cards.Player1Field) > 0
+	}
+
+	return len(state.Cards.Player2Field) > 0
+}
+
+// applyMove takes a move that the specified player made, and updates the specified state accordingly, returning the
+// result of the move. The state may be partially modified if the move is rejected, so it should be a copy (see
+// ApplyMove).
+func (engine Engine) applyMove(state *MatchState, player Player, move Move) MoveResult {
+
+	// Declare variables that will store pointers to the target player's (the one that made the move) cards.
+	var targetHand *[]Card
+	var targetField *[]Card
+	var targetDeck *[]Card
+	var targetDiscard *[]Card
+
+	// Declare variables that will store pointers to the other player's (the one that DID NOT make the move) cards.
+	var oppositeHand *[]Card
+	var oppositeField *[]Card
+	var oppositeDiscard *[]Card
+
+	// Note: using pointers allows us to use the same function for both players, and still be able to modify the
+	// modify - Using non-pointers will change the local array, but the original array will remain unchanged for
+	// operations that don't involve reordering the members by shifting array members.
+
+	// A variable to store the score of the player that made the move.
+	var targetScore uint16
+
+	// Whether or not to update the turn. E.g. when a blast is played, the turn does not change.
+	var updateTurn = false
+
+	// The player that the match is waiting for a move from once the move has been applied.
+	var nextToAct Player
+
+	// Depending on which player made the move, set values for each card array pointer.
+
+	if player == Player1 {
+		targetHand = &state.Cards.Player1Hand
+		targetField = &state.Cards.Player1Field
+		targetDeck = &state.Cards.Player1Deck
+		targetDiscard = &state.Cards.Player1Discard
+		targetScore = state.Player1Score
+
+		oppositeHand = &state.Cards.Player2Hand
+		oppositeField = &state.Cards.Player2Field
+		oppositeDiscard = &state.Cards.Player2Discard
+	} else {
+		targetHand = &state.Cards.Player2Hand
+		targetField = &state.Cards.Player2Field
+		targetDeck = &state.Cards.Player2Deck
+		targetDiscard = &state.Cards.Player2Discard
+		targetScore = state.Player2Score
+
+		oppositeHand = &state.Cards.Player1Hand
+		oppositeField = &state.Cards.Player1Field
+		oppositeDiscard = &state.Cards.Player1Discard
+	}
+
+	// Get the type of card that was played.
+	inCard := move.Instruction.ToCard()
+
+	// Hack - need to know if the move was a blast so that we can add some additional time to the turn timer, to
+	// account for the long blast animation.
+	var usedBlastEffect bool = false
+
+	// If the turn is currently undecided, this means that the board was cleared and we are waiting for both, or
+	// just one players draw from the deck.
+	if state.Turn == PlayerUndecided {
+
+		// If the target7s deck has some cards in it, try to remove one. If it fails (it shouldnt), return false.
+		// Otherwise, try to draw from the player hand. Again, it shouldnt fail, but it if does, return false.
+		if len(*targetDeck) > 0 {
+			if !removeLast(targetDeck) {
+				return MoveResult{}
+			}
+		} else {
+			if !removeFirstOfType(targetHand, inCard) {
+				return MoveResult{}
+			}
+		}
+
+		// Now that a card has been selected, add it to the target player's field.
+		*targetField = append(*targetField, inCard)
+
+		// Determine if both players have made their draw from the deck/hand to the field,
+		// by checking that both fields have one card on them. If this is the case, set the update
+		// flag to true, so that further processing occurs below.
+		// Otherwise exit early, indicating that the match has not ended, and that only the other player (who has
+		// yet to draw) is expected to make a move.
+		if len(*targetField) == 1 && len(*oppositeField) == 1 {
+			updateTurn = true
+		} else {
+			return MoveResult{Accepted: true, NextToAct: player.Opponent()}
+		}
+	} else {
+
+		// Reaching this point means that the turn is NOT undecided - i.e. it is someones turn. Once the turn has been
+		// decided, both fields always have at least one card on them, so a mirror card always swaps the fields. A mirror
+		// card played while either field is empty could only come from a state that the client would never show, so
+		// rather than guessing at what the client expects, the move is rejected as illegal.
+		if inCard == Mirror && (len(*targetField) == 0 || len(*oppositeField) == 0) {
+			return MoveResult{}
+		}
+
+		// If a blast card is about to have its effect activated, validate the whole move before any state is
+		// modified, so that a rejected blast leaves the match untouched. The move payload should contain the type (as a
+		// string) of the card that the target player selected to blast from the other player's hand, and both the
+		// blast card and the selected card must actually be in the respective hands. If either check fails, the player
+		// sent some bad data, or the game state on their client was wrong / messed with, and we return false.
+		var blastedCard Card
+		if inCard == Blast && len(*targetField) > 0 && len(*oppositeHand) > 0 {
+			blastedCardInt, err := strconv.Atoi(move.Payload)
+			if err != nil {
+				return MoveResult{}
+			}
+
+			blastedCard = Card(blastedCardInt)
+			if !contains(*targetHand, Blast) || !contains(*oppositeHand, blastedCard) {
+				return MoveResult{}
+			}
+		}
+
+		// Try to remove the first instance of the played card from the target players hand. If this fails, the player sent some bad
+		// data, or the game state on their client was wrong / messed with, and we return false.
+		if !removeFirstOfType(targetHand, inCard) {
+			return MoveResult{}
+		}
+
+		// Initialise boolean values that, based on the state of the game, are set to true if a particular effect
+		// card has been played AND THE EFFECT ACTUALLY ACTIVATED. Note that (usedBlastEffect) is declared earlier,
+		// as a hack to ensure that the value can be reused later for the blast edge case.
+		usedRodEffect := inCard == ElliotsOrbalStaff && len(*targetField) > 0 && isBolted(last(*targetField))
+		usedBoltEffect := inCard == Bolt && len(*oppositeField) > 0 && !isBolted(last(*oppositeField))
+		usedMirrorEffect := inCard == Mirror && len(*targetField) > 0 && len(*oppositeField) > 0
+		usedBlastEffect = inCard == Blast && len(*oppositeHand) > 0 // Note: Variable declared above -> See above comment.
+		usedForceEffect := inCard == Force && targetScore > 0
+
+		// Set a separate bool that is used to quickly check if a force, or a normal card was played.
+		usedNormalOrForceCard := (!usedRodEffect && !usedBoltEffect && !usedMirrorEffect && !usedBlastEffect) || usedForceEffect
+
+		// If the selected card was a normal or force card, and the target players latest field card is flipped (bolted),
+		// remove it.
+		if usedNormalOrForceCard && len(*targetField) > 0 && isBolted(last(*targetField)) {
+
+			// Get a copy of the last card on the target player's field (the one about to be removed).
+			removedCard := last(*targetField)
+
+			// Attempt to remove the last card from the target player's field. A failure indicates that a bad instruction was
+			// received, so return false.
+			if !removeFirstOfType(targetField, removedCard) {
+				return MoveResult{}
+			}
+
+			// Add the removed card to the target player's discard pile.
+			*targetDiscard = append(*targetDiscard, removedCard)
+		}
+
+		// Determine if the card was an effect card that had its effect activated. Otherwise
+		// just treat it like a normal card, placing it on the target player's field.
+		if len(*targetField) > 0 && !usedNormalOrForceCard {
+
+			// As mentioned earlier - the blast flag is checked here to handle the blast edge case.
+			if usedBlastEffect {
+
+				// Remove the first instance of the card that was selected to be blasted from the other
+				// player's hand. The move was validated before any state was modified, so the card is
+				// guaranteed to be there.
+				removeFirstOfType(oppositeHand, blastedCard)
+
+				// If the above removal call was a success, append the card that was blasted to the other
+				// player's discard pile.
+				*oppositeDiscard = append(*oppositeDiscard, blastedCard)
+
+			} else if usedRodEffect {
+
+				// If a rod effect was detected, unbolt the bolted card on the target player's field.
+				unBolt(targetField)
+			} else if usedBoltEffect {
+
+				// If a bolt effect was detected, bolt the bolted card on the other player's field.
+				bolt(oppositeField)
+			} else if usedMirrorEffect {
+
+				// If a mirror effect was detected, switch the fields for each player. To do so, the
+				// target player's field is first stored in a temporary variable. Then, the target player's
+				// field is overwritten with the other player's field. Finally, the other player's field
+				// is overwritten with the cards stored in the temporary variable.
+				tempTargetField := *targetField
+				*targetField = *oppositeField
+				*oppositeField = tempTargetField
+			}
+
+			// Finally, add the card that the target player played to the target player's discard pile.
+			*targetDiscard = append(*targetDiscard, inCard)
+		} else {
+
+			// Reaching this point means we handle the incoming move as a standard play, and add it directly
+			// to the target player's field.
+			*targetField = append(*targetField, inCard)
+		}
+
+		// If a blast effect was used, the turn does not change, and the player that made the move is expected to move
+		// again. Otherwise, it was NOT a blast card, and the update turn flag is set to true.
+		if usedBlastEffect {
+			nextToAct = player
+		} else {
+			updateTurn = true
+		}
+	}
+
+	// Update the score for both players.
+	state.Player1Score = calculateScore(state.Cards.Player1Field)
+	state.Player2Score = calculateScore(state.Cards.Player2Field)
+
+	// If the match state is NOT undecided, see if one of the players won. This is done here, and not in the previous
+	// if else statement because we need to update the score first. If both players have just drawn, the turn is about
+	// to be decided, so the match is checked in the same way - otherwise a player that can't respond to the draw would
+	// be left to time out.
+	if state.Turn != PlayerUndecided {
+		if matchEnded, winner, reason := engine.checkForMatchEnd(state, usedBlastEffect); matchEnded {
+			return MoveResult{Accepted: true, Ended: true, Winner: winner, Reason: reason, UsedBlastEffect: usedBlastEffect}
+		}
+	} else if updateTurn {
+		if matchEnded, winner, reason := engine.checkForMatchEndAfterDraw(state, player); matchEnded {
+			return MoveResult{Accepted: true, Ended: true, Winner: winner, Reason: reason}
+		}
+	}
+
+	// If the update turn flag was set to true, we need to determine which player's turn it now is.
+	if updateTurn {
+
+		// If the scores are tied, clear the board and enter the undecided state. Otherwise determine
+		// who's turn it now is based on the scores.
+		if state.Player1Score == state.Player2Score {
+
+			// Set the turn to undecided, so that both players are expected to draw.
+			state.Turn = PlayerUndecided
+
+			// Dump the target player's field into the target player's discard pile.
+			*targetDiscard = append(*targetDiscard, (*targetField)...)
+			*targetField = nil
+
+			// And do the same for the other player.
+			*oppositeDiscard = append(*oppositeDiscard, (*oppositeField)...)
+			*oppositeField = nil
+
+		} else if state.Player1Score < state.Player2Score {
+
+			// Set the turn to player 1.
+			state.Turn = Player1
+		} else {
+
+			// Set the turn to player 2.
+			state.Turn = Player2
+		}
+
+		// Whoever's turn it now is (or both players, if the turn is undecided) is expected to move next.
+		nextToAct = state.Turn
+	}
+
+	// The move was accepted, and the match continues.
+	return MoveResult{Accepted: true, NextToAct: nextToAct, UsedBlastEffect: usedBlastEffect}
+}
+
+// checkForMatchEnd returns true, the player who won, and the reason, if the match is no longer in a
+// playable state (though not due to error - rather, due to someone winning, or a draw). Pass in a bool
+// that indicates whether or not a blast effect was used on this turn (as it doesnt cause the
+// turn to change, it has to be handled as an edge case).
+func (engine Engine) checkForMatchEnd(state *MatchState, usedBlastEffect bool) (matchEnded bool, player Player, reason EndReason) {
+
+	// Return true and undecided if the match is drawn.
+	if engine.isDrawn(state) {
+		return true, PlayerUndecided, EndReasonDraw
+	}
+
+	// Return true, and player 1 if player 1 won.
+	if won, reason := engine.playerHasWon(state, Player1, usedBlastEffect); won {
+		return true, Player1, reason
+	}
+
+	// Return true, and player 2 if player 2 won.
+	if won, reason := engine.playerHasWon(state, Player2, usedBlastEffect); won {
+		return true, Player2, reason
+	}
+
+	// If none of the win conditions were met, the match is still in progress - return false.
+	return false, PlayerUndecided, EndReasonUnknown
+}
+
+// checkForMatchEndAfterDraw is the equivalent of checkForMatchEnd, for when both players have drawn, and the turn is
+// about to be decided. The player with the higher score is treated as having made the last move, as the other player
+// must now beat their score - such as a player that is left with an empty hand, who has lost. If the scores are tied,
+// the board is about to be cleared for another draw, so the match ends if either player has nothing left to draw. Pass
+// in the player that drew last, which is used for ties.
+func (engine Engine) checkForMatchEndAfterDraw(state *MatchState, lastToDraw Player) (matchEnded bool, player Player, reason EndReason) {
+
+	// Determine which player is treated as having made the last move.
+	leader := lastToDraw
+	if state.Player1Score > state.Player2Score {
+		leader = Player1
+	} else if state.Player2Score > state.Player1Score {
+		leader = Player2
+	}
+
+	// The win conditions are based on whose turn it is, so the turn is set to the leader while checking, and then
+	// restored, as the turn is decided by the caller.
+	previousTurn := state.Turn
+	state.Turn = leader
+	matchEnded, player, reason = engine.checkForMatchEnd(state, false)
+	state.Turn = previousTurn
+
+	return matchEnded, player, reason
+}
+
+// Based on the state of the game (and whether or not a blast cased was played on this
+// turn) determine if the specified player won the game, and if so, by which mechanism.
+func (engine Engine) playerHasWon(state *MatchState, player Player, usedBlastEffect bool) (won bool, reason EndReason) {
+
+	// Similar to the updateMatchState function, this function takes in a player
+	// as an argument, so we first declare some variables to set once we have
+	// determined which player is the target, and which is the "opposite" player.
+
+	// Unlike the updateMatchState function, however, the arrays are not pointers, as
+	// the arrays will not be modified.
+
+	var targetPlayerScore uint16
+	var targetField []Card
+
+	var oppositePlayerScore uint16
+	var oppositePlayerHand []Card
+	var oppositePlayerField []Card
+
+	var oppositePlayerDeckCount int
+	var activePlayer ActivePlayer = activePlayerUndecided
+
+	// Determine which player's turn it is, and store it in a local variable.
+	if state.Turn == player {
+		activePlayer = activePlayerTarget
+	} else {
+		activePlayer = activePlayerOpposite
+	}
+
+	// Depending on which player is currently beind checked to see if they won, set values
+	// for the previously declared variables.
+	if player == Player1 {
+		targetPlayerScore = state.Player1Score
+		targetField = state.Cards.Player1Field
+
+		oppositePlayerScore = state.Player2Score
+		oppositePlayerHand = state.Cards.Player2Hand
+		oppositePlayerField = state.Cards.Player2Field
+		oppositePlayerDeckCount = len(state.Cards.Player2Deck)
+
+	} else if player == Player2 {
+		targetPlayerScore = state.Player2Score
+		targetField = state.Cards.Player2Field
+
+		oppositePlayerScore = state.Player1Score
+		oppositePlayerHand = state.Cards.Player1Hand
+		oppositePlayerField = state.Cards.Player1Field
+		oppositePlayerDeckCount = len(state.Cards.Player1Deck)
+	} else {
+
+		// Edge case - if a non player (undecided) was passed in, exit early.
+		return false, EndReasonUnknown
+	}
+
+	// Early exit if the scores are equal, and the opposite player has no more cards left to
+	// try and break a tie. Ensure that the game is checked for a draw state BEFORE this function, as
+	// this check does not check the target player's side of the field.
+	if targetPlayerScore == oppositePlayerScore {
+		if oppositePlayerDeckCount+len(oppositePlayerHand) == 0 {
+			return true, EndReasonTieUnbreakable
+		}
+	}
+
+	// There are some edge cases to handle for blast effects, so we handle them here.
+	if usedBlastEffect {
+
+		// If the player being checked is the player that just made a move (in this instance, used a blast card).
+		if activePlayer == activePlayerTarget {
+
+			// If the opposite player's hand is empty and the target player's score is greater than the opposite player's
+			// score, thene the target player wins.
+			if len(oppositePlayerHand) == 0 && targetPlayerScore > oppositePlayerScore {
+				return true, EndReasonBlastEmptyHand
+			} else if len(oppositePlayerHand) == 1 && containsOnlyEffectCards(oppositePlayerHand) {
+
+				// Or, if the opposite player has only 1 card in their hand, and it is an effect card, again, the target player wins.
+				return true, EndReasonOnlyEffectCards
+			}
+		} else {
+
+			// Otherwise, if the other player used a blast card, but put themselves in a state where they only have 1 card left,
+			// and that card is an effect card, the target player wins.
+			if len(oppositePlayerHand) == 1 && containsOnlyEffectCards(oppositePlayerHand) {
+				return true, EndReasonOnlyEffectCards
+			}
+		}
+	} else {
+
+		// Extra check for non-blast turns where the opposite player only has effect cards remaining after the target player
+		// makes a move.
+		if activePlayer == activePlayerTarget && len(oppositePlayerHand) == 1 {
+			if targetPlayerScore > oppositePlayerScore && containsOnlyEffectCards(oppositePlayerHand) {
+				return true, EndReasonOnlyEffectCards
+			}
+		}
+	}
+
+	// If the target player's score is greater than the opposite player's score...
+	if targetPlayerScore > oppositePlayerScore {
+
+		// Determine the score gap that must be overcome, or equalled, in order for the opposite player
+		// to be able to continue. No need to abs or cast to signed values, as we can only enter
+		// this clause if (targetPlayerScore) is greater than (oppositePlayerScore).
+		scoreGap := targetPlayerScore - oppositePlayerScore
+
+		// If the opposite players score is lower than the target player's score, and the opposite player
+		// did NOT player a blast card, they have lost as they failed to beat the score for the their turn.
+		// Blast effects are an edge case, as it does not change the turn.
+		if activePlayer == activePlayerOpposite && !usedBlastEffect {
+			return true, EndReasonScoreNotBeaten
+		}
+
+		// If the opposite player's hand is empty, they will not be able to counter the most recent move, and
+		// therefore have lost.
+		if len(oppositePlayerHand) == 0 {
+			return true, EndReasonEmptyHand
+		}
+
+		// From here we check various conditions to see if the opposite player is able to make a valid move.
+
+		// If the opposite player has a card in their hand that will overcome or match the target player's
+		// score, they are ok to continue.
+		if canOvercomeDifference(oppositePlayerHand, scoreGap) {
+			return false, EndReasonUnknown
+		}
+
+		// If opposite player has an rod card in their hand, and are able to play it, and playing it would cause their new score to
+		// be equal to or greater than the target score, they are ok to continue.
+		if contains(oppositePlayerHand, ElliotsOrbalStaff) {
+
+			// If the opposite player's field has at least one card, and the last card is bolted...
+			if len(oppositePlayerField) > 0 && isBolted(last(oppositePlayerField)) {
+
+				// If the bolted card is a force card, and applying the force effect would overcome the
+				// difference, they are ok. The force is scored in the same way as the field, so a force that
+				// is the only card on the field is worth one, rather than doubling nothing. Or, if the bolted
+				// card has a high enough value to overcome the difference, that's also ok.
+				if last(oppositePlayerField) == InactiveForce {
+					if scoreAfterUnbolt(oppositePlayerField) >= targetPlayerScore {
+						return false, EndReasonUnknown
+					}
+				} else if uint16(getBoltedCardrealValue(last(oppositePlayerField))) >= scoreGap {
+					return false, EndReasonUnknown
+				}
+			}
+		}
+
+		// If the opposite player has a bolt card in their hand, and the target player's last field card
+		// can be bolted, they are ok to continue.
+		if contains(oppositePlayerHand, Bolt) {
+			if len(targetField) > 0 && !isBolted(last(targetField)) {
+				return false, EndReasonUnknown
+			}
+		}
+
+		// If the opposite player has a mirror card in their hand, they are ok.
+		if contains(oppositePlayerHand, Mirror) {
+			return false, EndReasonUnknown
+		}
+
+		// If the opposite player has a blast card in their hand, they are ok.
+		if contains(oppositePlayerHand, Blast) {
+			return false, EndReasonUnknown
+		}
+
+		// If the opposite player has a force card in their hand, and playing it would increase their
+		// score so that it matches or beats the target player's score, they are ok. The resulting score is
+		// calculated in the same way as the field, so that it accounts for a bolted card being removed when
+		// the force is played.
+		if contains(oppositePlayerHand, Force) {
+			if scoreAfterForce(oppositePlayerField) >= targetPlayerScore {
+				return false, EndReasonUnknown
+			}
+		}
+
+		return true, EndReasonCannotBeatScore
+	}
+
+	// Reaching this point indicates that none of the conditions were event explored, and the target player
+	// has not won in any fashion.
+	return false, EndReasonUnknown
+}
+
+// isDrawn returns true if the scores are drawn, and both players are unable to make more moves.
+func (engine Engine) isDrawn(state *MatchState) bool {
+
+	// If both decks are empty...
+	if len(state.Cards.Player1Deck)+len(state.Cards.Player2Deck) == 0 {
+
+		// If both hands are empty...
+		if len(state.Cards.Player1Hand)+len(state.Cards.Player2Hand) == 0 {
+
+			// If both scores are equal...
+			if state.Player1Score == state.Player2Score {
+
+				// The match is drawn.
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,384 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+// midMatchState returns a state in which player 1 has a score of 4, player 2 has a score of 3, it is player 2's turn,
+// and player 2 has the specified hand.
+func midMatchState(player2Hand ...Card) MatchState {
+	return MatchState{
+		Turn: Player2,
+		Cards: Cards{
+			Player1Deck:  []Card{ElliotsOrbalStaff},
+			Player1Hand:  []Card{LaurasGreatsword, GaiusSpear},
+			Player1Field: []Card{JusisSword},
+			Player2Deck:  []Card{ElliotsOrbalStaff},
+			Player2Hand:  player2Hand,
+			Player2Field: []Card{AlisasOrbalBow},
+		},
+		Player1Score: 4,
+		Player2Score: 3,
+	}
+}
+
+// TestApplyMove checks the result of applying a move to a state, the scores afterwards, and that the state passed in
+// is never modified - and is returned as is when the move is rejected.
+func TestApplyMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    MatchState
+		player   Player
+		move     Move
+		expected MoveResult
+		scores   [2]uint16
+	}{
+		{
+			name:     "Card that beats the score",
+			state:    midMatchState(FiesTwinGunswords, LaurasGreatsword),
+			player:   Player2,
+			move:     Move{Instruction: CardFiesTwinGunswords},
+			expected: MoveResult{Accepted: true, NextToAct: Player1},
+			scores:   [2]uint16{4, 5},
+		},
+		{
+			name:     "Card that isn't in the hand",
+			state:    midMatchState(FiesTwinGunswords, LaurasGreatsword),
+			player:   Player2,
+			move:     Move{Instruction: CardGaiusSpear},
+			expected: MoveResult{},
+			scores:   [2]uint16{4, 3},
+		},
+		{
+			name:     "Card that ties the score",
+			state:    midMatchState(ElliotsOrbalStaff, FiesTwinGunswords),
+			player:   Player2,
+			move:     Move{Instruction: CardElliotsOrbalStaff},
+			expected: MoveResult{Accepted: true, NextToAct: PlayerUndecided},
+			scores:   [2]uint16{4, 4},
+		},
+		{
+			name: "Card that leaves the score beaten",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{JusisSword},
+					Player2Hand:  []Card{ElliotsOrbalStaff, FiesTwinGunswords},
+					Player2Field: []Card{FiesTwinGunswords},
+				},
+				Player1Score: 4,
+				Player2Score: 2,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardElliotsOrbalStaff},
+			expected: MoveResult{Accepted: true, Ended: true, Winner: Player1, Reason: EndReasonScoreNotBeaten},
+			scores:   [2]uint16{4, 3},
+		},
+		{
+			name:     "Bolt",
+			state:    midMatchState(Bolt, FiesTwinGunswords),
+			player:   Player2,
+			move:     Move{Instruction: CardBolt},
+			expected: MoveResult{Accepted: true, NextToAct: Player1},
+			scores:   [2]uint16{0, 3},
+		},
+		{
+			name: "Rod that unbolts",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword, GaiusSpear},
+					Player1Field: []Card{JusisSword},
+					Player2Hand:  []Card{ElliotsOrbalStaff, GaiusSpear},
+					Player2Field: []Card{FiesTwinGunswords, InactiveJusisSword},
+				},
+				Player1Score: 4,
+				Player2Score: 2,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardElliotsOrbalStaff},
+			expected: MoveResult{Accepted: true, NextToAct: Player1},
+			scores:   [2]uint16{4, 6},
+		},
+		{
+			name:     "Mirror",
+			state:    midMatchState(Mirror, FiesTwinGunswords),
+			player:   Player2,
+			move:     Move{Instruction: CardMirror},
+			expected: MoveResult{Accepted: true, NextToAct: Player1},
+			scores:   [2]uint16{3, 4},
+		},
+		{
+			name: "Mirror with the opponent's field empty",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player2Hand:  []Card{Mirror, FiesTwinGunswords},
+					Player2Field: []Card{AlisasOrbalBow},
+				},
+				Player2Score: 3,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardMirror},
+			expected: MoveResult{},
+			scores:   [2]uint16{0, 3},
+		},
+		{
+			name: "Mirror with the player's field empty",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{JusisSword},
+					Player2Hand:  []Card{Mirror, FiesTwinGunswords},
+				},
+				Player1Score: 4,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardMirror},
+			expected: MoveResult{},
+			scores:   [2]uint16{4, 0},
+		},
+		{
+			name: "Mirror drawn while the turn is undecided",
+			state: MatchState{
+				Turn: PlayerUndecided,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{FiesTwinGunswords},
+					Player2Deck:  []Card{Mirror},
+					Player2Hand:  []Card{LaurasGreatsword},
+				},
+				Player1Score: 2,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardMirror},
+			expected: MoveResult{Accepted: true, NextToAct: Player2},
+			scores:   [2]uint16{2, 1},
+		},
+		{
+			name:     "Blast",
+			state:    midMatchState(Blast, FiesTwinGunswords),
+			player:   Player2,
+			move:     Move{Instruction: CardBlast, Payload: "6"},
+			expected: MoveResult{Accepted: true, NextToAct: Player2, UsedBlastEffect: true},
+			scores:   [2]uint16{4, 3},
+		},
+		{
+			name:     "Blast of a card that the opponent doesn't have",
+			state:    midMatchState(Blast, FiesTwinGunswords),
+			player:   Player2,
+			move:     Move{Instruction: CardBlast, Payload: "2"},
+			expected: MoveResult{},
+			scores:   [2]uint16{4, 3},
+		},
+		{
+			name:     "Blast with a malformed payload",
+			state:    midMatchState(Blast, FiesTwinGunswords),
+			player:   Player2,
+			move:     Move{Instruction: CardBlast, Payload: "laura"},
+			expected: MoveResult{},
+			scores:   [2]uint16{4, 3},
+		},
+		{
+			name: "First draw while the turn is undecided",
+			state: MatchState{
+				Turn: PlayerUndecided,
+				Cards: Cards{
+					Player1Deck: []Card{FiesTwinGunswords},
+					Player1Hand: []Card{LaurasGreatsword},
+					Player2Deck: []Card{JusisSword},
+					Player2Hand: []Card{LaurasGreatsword},
+				},
+			},
+			player:   Player1,
+			move:     Move{Instruction: CardFiesTwinGunswords},
+			expected: MoveResult{Accepted: true, NextToAct: Player2},
+			scores:   [2]uint16{0, 0},
+		},
+		{
+			name: "Second draw decides the turn",
+			state: MatchState{
+				Turn: PlayerUndecided,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{FiesTwinGunswords},
+					Player2Deck:  []Card{JusisSword},
+					Player2Hand:  []Card{LaurasGreatsword},
+				},
+				Player1Score: 2,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardJusisSword},
+			expected: MoveResult{Accepted: true, NextToAct: Player1},
+			scores:   [2]uint16{2, 4},
+		},
+		{
+			name:     "Draw from the hand when the deck is empty",
+			state:    MatchState{Turn: PlayerUndecided, Cards: Cards{Player1Hand: []Card{FiesTwinGunswords, LaurasGreatsword}}},
+			player:   Player1,
+			move:     Move{Instruction: CardLaurasGreatsword},
+			expected: MoveResult{Accepted: true, NextToAct: Player2},
+			scores:   [2]uint16{0, 0},
+		},
+		{
+			name:     "Draw of a card that isn't in the hand",
+			state:    MatchState{Turn: PlayerUndecided, Cards: Cards{Player1Hand: []Card{FiesTwinGunswords, LaurasGreatsword}}},
+			player:   Player1,
+			move:     Move{Instruction: CardGaiusSpear},
+			expected: MoveResult{},
+			scores:   [2]uint16{0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := test.state
+			original.Cards = test.state.Cards.clone()
+
+			next, result := Engine{}.ApplyMove(test.state, test.player, test.move)
+			if result != test.expected {
+				t.Fatalf("Move resulted in %+v, expected %+v", result, test.expected)
+			}
+
+			if scores := [2]uint16{next.Player1Score, next.Player2Score}; scores != test.scores {
+				t.Fatalf("Scores are %v, expected %v", scores, test.scores)
+			}
+
+			if !reflect.DeepEqual(test.state, original) {
+				t.Fatalf("State was modified from %+v to %+v", original, test.state)
+			}
+
+			if !result.Accepted && !reflect.DeepEqual(next, original) {
+				t.Fatalf("Rejected move returned %+v, expected the original state %+v", next, original)
+			}
+		})
+	}
+}
+
+// TestExhaustedPlayersBeforeTieClear checks that a tie that leaves one or both players with nothing left to draw ends
+// the match, both after a normal move and after both players have drawn - rather than clearing the board and waiting
+// for a draw that can never be made.
+func TestExhaustedPlayersBeforeTieClear(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    MatchState
+		player   Player
+		move     Move
+		expected MoveResult
+	}{
+		{
+			name: "Tying move exhausts the mover",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{JusisSword},
+					Player2Hand:  []Card{ElliotsOrbalStaff},
+					Player2Field: []Card{AlisasOrbalBow},
+				},
+				Player1Score: 4,
+				Player2Score: 3,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardElliotsOrbalStaff},
+			expected: MoveResult{Accepted: true, Ended: true, Winner: Player1, Reason: EndReasonTieUnbreakable},
+		},
+		{
+			name: "Tying move exhausts both players",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Field: []Card{JusisSword},
+					Player2Hand:  []Card{ElliotsOrbalStaff},
+					Player2Field: []Card{AlisasOrbalBow},
+				},
+				Player1Score: 4,
+				Player2Score: 3,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardElliotsOrbalStaff},
+			expected: MoveResult{Accepted: true, Ended: true, Winner: PlayerUndecided, Reason: EndReasonDraw},
+		},
+		{
+			name: "Tying draw exhausts the drawer",
+			state: MatchState{
+				Turn: PlayerUndecided,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{JusisSword},
+					Player2Deck:  []Card{JusisSword},
+				},
+				Player1Score: 4,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardJusisSword},
+			expected: MoveResult{Accepted: true, Ended: true, Winner: Player1, Reason: EndReasonTieUnbreakable},
+		},
+		{
+			name: "Tying draw exhausts both players",
+			state: MatchState{
+				Turn: PlayerUndecided,
+				Cards: Cards{
+					Player1Field: []Card{JusisSword},
+					Player2Deck:  []Card{JusisSword},
+				},
+				Player1Score: 4,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardJusisSword},
+			expected: MoveResult{Accepted: true, Ended: true, Winner: PlayerUndecided, Reason: EndReasonDraw},
+		},
+		{
+			name: "Tying move with cards left clears the board",
+			state: MatchState{
+				Turn: Player2,
+				Cards: Cards{
+					Player1Hand:  []Card{LaurasGreatsword},
+					Player1Field: []Card{JusisSword},
+					Player2Hand:  []Card{ElliotsOrbalStaff, FiesTwinGunswords},
+					Player2Field: []Card{AlisasOrbalBow},
+				},
+				Player1Score: 4,
+				Player2Score: 3,
+			},
+			player:   Player2,
+			move:     Move{Instruction: CardElliotsOrbalStaff},
+			expected: MoveResult{Accepted: true, NextToAct: PlayerUndecided},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, result := Engine{}.ApplyMove(test.state, test.player, test.move)
+			if result != test.expected {
+				t.Fatalf("Move resulted in %+v, expected %+v", result, test.expected)
+			}
+
+			// A match that continues after a tie is waiting for both players to draw, and each of them must be able to.
+			if !result.Ended {
+				if next.Turn != PlayerUndecided || len(next.Cards.Player1Field)+len(next.Cards.Player2Field) != 0 {
+					t.Fatalf("Board was not cleared for a tie: %+v", next)
+				}
+
+				for _, player := range []Player{Player1, Player2} {
+					cards := len(next.Cards.Player1Deck) + len(next.Cards.Player1Hand)
+					if player == Player2 {
+						cards = len(next.Cards.Player2Deck) + len(next.Cards.Player2Hand)
+					}
+
+					if cards == 0 {
+						t.Fatalf("Player %v is expected to draw, but has no cards left", player)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// EventType is a typedef for the different types of match event.
+type EventType uint8
+
+// Event type enums - explicitly numbered so that their numerical value can be
+// seen when hovering them in vscode.
+const (
+	EventMatchStarted   EventType = 0
+	EventMatchEnded     EventType = 1
+	EventPlayerTimedOut EventType = 2
+	EventIllegalMove    EventType = 3
+)
+
+// Event describes something that happened to a match, for consumption by subscribers outside of the game server.
+// Fields that are not relevant to the event type are left empty.
+type Event struct {
+
+	// The type of event.
+	Type EventType `json:"type"`
+
+	// The ID of the match that the event relates to.
+	MatchID uint64 `json:"matchid"`
+
+	// The public IDs of both players (match started and match ended events).
+	Players []string `json:"players,omitempty"`
+
+	// The public ID of the player that the event relates to (timeout and illegal move events).
+	Player string `json:"player,omitempty"`
+
+	// The public ID of the winner (match ended events). Empty for draws.
+	Winner string `json:"winner,omitempty"`
+
+	// The reason that the match ended (match ended events).
+	Reason protocol.B2Code `json:"reason,omitempty"`
+
+	// The name of the card pool that the match was played with (match started and match ended events).
+	CardPool string `json:"cardpool,omitempty"`
+
+	// The time at which the event occurred.
+	Time time.Time `json:"time"`
+}
+
+// Subscribe registers the specified channel to receive all future match events. Events are sent without blocking, so
+// events will be dropped for any subscriber whose channel is full - use a buffered channel, and read from it promptly.
+func (gs *Server) Subscribe(subscriber chan<- Event) {
+
+	// Lock the mutex lock, and then defer unlocking.
+	gs.subscriberLock.Lock()
+	defer gs.subscriberLock.Unlock()
+
+	// Add the channel to the subscribers slice.
+	gs.subscribers = append(gs.subscribers, subscriber)
+}
+
+// publish sends the specified event to all subscribers, setting the time of the event to the current time.
+func (gs *Server) publish(event Event) {
+
+	// Stamp the event with the current time.
+	event.Time = time.Now()
+
+	// Lock the mutex lock, and then defer unlocking.
+	gs.subscriberLock.Lock()
+	defer gs.subscriberLock.Unlock()
+
+	// Send the event to each subscriber. A select with a default case is used so that a slow subscriber cannot stall
+	// the main loop - if the subscriber's channel is full, the event is dropped for that subscriber.
+	for _, subscriber := range gs.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// publishMatchEvent is a helper function that publishes an event of the specified type for the specified match,
+// with the public ID of both players, and the card pool that the match was played with.
+func (match *Match) publishMatchEvent(eventType EventType, reason protocol.B2Code) {
+
+	// Create the event with both players' public IDs.
+	event := Event{
+		Type:     eventType,
+		MatchID:  match.ID,
+		Players:  []string{match.Client1.PublicID, match.Client2.PublicID},
+		Reason:   reason,
+		CardPool: match.cardPool,
+	}
+
+	// Determine the winner of the match (if any).
+	if match.State.Winner != 0 {
+		if match.State.Winner == match.Client1.DBID {
+			event.Winner = match.Client1.PublicID
+		} else if match.State.Winner == match.Client2.DBID {
+			event.Winner = match.Client2.PublicID
+		}
+	}
+
+	match.Server.publish(event)
+}
+
+// publishPlayerEvent is a helper function that publishes an event of the specified type for the specified match,
+// relating to the specified client.
+func (match *Match) publishPlayerEvent(eventType EventType, client *GClient) {
+	match.Server.publish(Event{
+		Type:    eventType,
+		MatchID: match.ID,
+		Player:  client.PublicID,
+	})
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"testing"
+)
+
+// TestPublishDropsForFullSubscribers checks that an event is sent to every subscriber, and that a subscriber whose
+// channel is full misses the event, rather than blocking the others.
+func TestPublishDropsForFullSubscribers(t *testing.T) {
+	gs := &Server{}
+
+	full := make(chan Event, 1)
+	ready := make(chan Event, 1)
+
+	gs.Subscribe(full)
+	gs.Subscribe(ready)
+
+	gs.publish(Event{Type: EventMatchStarted, MatchID: 1})
+
+	// Read the first event from only one of the subscribers, so that the other is full for the second.
+	<-ready
+	gs.publish(Event{Type: EventMatchEnded, MatchID: 1})
+
+	if event := <-full; event.Type != EventMatchStarted {
+		t.Fatalf("Full subscriber received event type [%v] first, expected [%v]", event.Type, EventMatchStarted)
+	}
+
+	if len(full) != 0 {
+		t.Fatalf("Full subscriber received an event that should have been dropped")
+	}
+
+	event := <-ready
+	if event.Type != EventMatchEnded {
+		t.Fatalf("Subscriber received event type [%v], expected [%v]", event.Type, EventMatchEnded)
+	}
+
+	if event.Time.IsZero() {
+		t.Fatalf("Event was published without a time")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// eventWebhookURLVariable is the name of the environment variable that contains the URL to which match events
+// should be posted. If it is not set, or is empty, events are not posted.
+const eventWebhookURLVariable = "event_webhook_url"
+
+// StartEventWebhook subscribes to the match events for this game server, and posts each event as JSON to the URL
+// specified by the event webhook environment variable. Does nothing if the environment variable is not set.
+func (gs *Server) StartEventWebhook() {
+
+	// Read the webhook URL from the environment, and exit early if it's not set.
+	url := envvar.String(eventWebhookURLVariable, "")
+	if url == "" {
+		return
+	}
+
+	// Create a buffered channel for the events, and subscribe to the server with it.
+	events := make(chan Event, BufferSize)
+	gs.Subscribe(events)
+
+	// Using a goroutine, post each event to the webhook as it arrives. This blocks, hence the goroutine.
+	go func() {
+		for event := range events {
+			apiinterface.PostEvent(url, event)
+		}
+	}()
+
+	log.Printf("Posting match events to webhook: %v", url)
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// defaultForfeitConfirmWindow is the default duration after a forfeit is requested, within which it can be confirmed
+// or cancelled.
+const defaultForfeitConfirmWindow = time.Second * 10
+
+// forfeitConfirmWindow is the duration after a forfeit is requested, within which it can be confirmed or cancelled,
+// after which it takes effect anyway. Configured via the "match_forfeit_confirm_window" environment variable.
+var forfeitConfirmWindow = envvar.Duration("match_forfeit_confirm_window", defaultForfeitConfirmWindow)
+
+// confirmsForfeits returns true if this client must confirm its forfeits.
+func (client *GClient) confirmsForfeits() bool {
+	return client.connection.ProtocolVersion >= protocol.ForfeitConfirmVersion
+}
+
+// requestForfeit handles a forfeit message from the specified client. Clients that confirm forfeits are sent a forfeit
+// pending message (containing the confirmation window, in seconds) for their first forfeit message - the forfeit only
+// takes effect once they send another forfeit message, or the window elapses. Making a move within the window cancels
+// the forfeit (see cancelPendingForfeit). Other clients forfeit immediately.
+//
+// The turn timer keeps running while a forfeit is pending, so the window can't be used to avoid timing out.
+func (match *Match) requestForfeit(client *GClient, other *GClient, player Player) {
+
+	// Forfeit immediately if the client doesn't confirm forfeits, or if this message confirms a pending forfeit.
+	if !client.confirmsForfeits() || !match.forfeitPendingTime(player).IsZero() {
+		match.forfeit(client, other)
+		return
+	}
+
+	match.setForfeitPendingTime(player, time.Now())
+	client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchForfeitPending, strconv.Itoa(int(forfeitConfirmWindow.Seconds()))))
+
+	log.Printf("Match [ %v ] is waiting for client [%s] to confirm their forfeit", match.ID, client.PublicID)
+}
+
+// cancelPendingForfeit cancels the pending forfeit for the specified client, if there is one.
+func (match *Match) cancelPendingForfeit(client *GClient, player Player) {
+	if match.forfeitPendingTime(player).IsZero() {
+		return
+	}
+
+	match.setForfeitPendingTime(player, time.Time{})
+
+	log.Printf("Match [ %v ] cancelled the pending forfeit for client [%s] as they made a move", match.ID, client.PublicID)
+}
+
+// expirePendingForfeits finalizes any pending forfeits that were requested longer than the confirmation window ago.
+// Does nothing if the match is no longer in play.
+func (match *Match) expirePendingForfeits(now time.Time) {
+	if match.GetPhase() != Play {
+		return
+	}
+
+	// Only one forfeit can take effect, as the first one ends the match - if both players have an expired forfeit,
+	// player 1's is used.
+	if match.forfeitExpired(Player1, now) {
+		log.Printf("Match [ %v ] finalized the unconfirmed forfeit for client [%s]", match.ID, match.Client1.PublicID)
+		match.forfeit(match.Client1, match.Client2)
+	} else if match.forfeitExpired(Player2, now) {
+		log.Printf("Match [ %v ] finalized the unconfirmed forfeit for client [%s]", match.ID, match.Client2.PublicID)
+		match.forfeit(match.Client2, match.Client1)
+	}
+}
+
+// forfeitExpired returns true if the specified player has a pending forfeit that was requested longer than the
+// confirmation window ago.
+func (match *Match) forfeitExpired(player Player, now time.Time) bool {
+	pending := match.forfeitPendingTime(player)
+	return !pending.IsZero() && now.Sub(pending) >= forfeitConfirmWindow
+}
+
+// forfeit removes the specified (forfeiting) client, which also ends the match, and sets the winner to the other
+// client. Any pending forfeits are cleared, so that they can't take effect again before the match is removed.
+func (match *Match) forfeit(client *GClient, other *GClient) {
+	match.client1ForfeitPendingTime = time.Time{}
+	match.client2ForfeitPendingTime = time.Time{}
+
+	match.State.Winner = other.DBID
+	match.Server.Remove(client, protocol.WSCMatchForfeit, "")
+}
+
+// forfeitPendingTime returns the time at which the specified player requested a forfeit that has not yet been
+// confirmed, or zero if there is no pending forfeit.
+func (match *Match) forfeitPendingTime(player Player) time.Time {
+	if player == Player1 {
+		return match.client1ForfeitPendingTime
+	}
+
+	return match.client2ForfeitPendingTime
+}
+
+// setForfeitPendingTime records the time at which the specified player requested a forfeit. Set to zero to clear it.
+func (match *Match) setForfeitPendingTime(player Player, pendingTime time.Time) {
+	if player == Player1 {
+		match.client1ForfeitPendingTime = pendingTime
+	} else {
+		match.client2ForfeitPendingTime = pendingTime
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// TestForfeitConfirmation checks, with a fixed clock, that a forfeit from a client that confirms forfeits only takes
+// effect once it is confirmed, or the confirmation window elapses - and never if the client makes a move within the
+// window. Forfeits from older clients take effect straight away.
+func TestForfeitConfirmation(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   uint16
+		confirm   bool
+		move      bool
+		elapsed   time.Duration
+		forfeited bool
+	}{
+		{"Confirmed", protocol.ForfeitConfirmVersion, true, false, 0, true},
+		{"Cancelled by a move", protocol.ForfeitConfirmVersion, false, true, forfeitConfirmWindow, false},
+		{"Window elapsed", protocol.ForfeitConfirmVersion, false, false, forfeitConfirmWindow, true},
+		{"Within the window", protocol.ForfeitConfirmVersion, false, false, forfeitConfirmWindow - time.Second, false},
+		{"Client that doesn't confirm forfeits", protocol.ForfeitConfirmVersion - 1, false, false, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match := newAutoPlayTestMatch(t, midMatchState(GaiusSpear, FiesTwinGunswords), 0)
+			match.Client2.connection.ProtocolVersion = test.version
+
+			// Player 2, whose turn it is, forfeits.
+			match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchForfeit, "")
+			if test.confirm {
+				match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchForfeit, "")
+			}
+
+			if test.move {
+				match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|6:")
+			}
+
+			match.Tick()
+			requested := time.Now()
+
+			// Clients that confirm forfeits are told how long they have to do so.
+			if test.version >= protocol.ForfeitConfirmVersion {
+				pending := match.Client2.connection.GetNextOutboundMessage().Payload
+				if pending.Code != protocol.WSCMatchForfeitPending || pending.Message != strconv.Itoa(int(forfeitConfirmWindow.Seconds())) {
+					t.Fatalf("Forfeiting client was sent [%d: %s], expected the forfeit to be pending", pending.Code, pending.Message)
+				}
+			}
+
+			match.expirePendingForfeits(requested.Add(test.elapsed))
+
+			if forfeited := len(match.Server.disconnect) > 0; forfeited != test.forfeited {
+				t.Fatalf("Forfeited is %v, expected %v", forfeited, test.forfeited)
+			}
+
+			if !test.forfeited {
+				return
+			}
+
+			if request := <-match.Server.disconnect; request.Client != match.Client2 || request.Reason != protocol.WSCMatchForfeit || match.State.Winner != match.Client1.DBID {
+				t.Fatalf("Client %d was removed with reason [%d] and winner [%d], expected client 2 to forfeit to client 1", request.Client.DBID, request.Reason, match.State.Winner)
+			}
+
+			// The forfeit only takes effect once.
+			if match.expirePendingForfeits(requested.Add(forfeitConfirmWindow)); len(match.Server.disconnect) > 0 {
+				t.Fatalf("Forfeit took effect more than once")
+			}
+		})
+	}
+}
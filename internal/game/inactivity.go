@@ -0,0 +1,155 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultMatchSetupTimeout is the default maximum time that a match can wait for both players to connect.
+	defaultMatchSetupTimeout = time.Minute * 2
+
+	// defaultMatchSetupProgressPeriod is the default period with which clients waiting for their opponent to connect
+	// are sent the time remaining before the match is aborted.
+	defaultMatchSetupProgressPeriod = time.Second * 10
+
+	// defaultMatchStallLimit is the default maximum time that a match can be in play without a valid move being made.
+	defaultMatchStallLimit = time.Minute * 5
+
+	// lingeringMatchTickLimit is the number of server ticks that a finished match can remain on the server before it is
+	// removed by the safety sweep. Finished matches are normally removed on the tick that they finish, or the next.
+	lingeringMatchTickLimit = 20
+)
+
+var (
+
+	// matchSetupTimeout is the maximum time that a match can wait for both players to connect, before it is aborted.
+	// Configured via the "match_setup_timeout" environment variable.
+	matchSetupTimeout = envvar.Duration("match_setup_timeout", defaultMatchSetupTimeout)
+
+	// matchSetupProgressPeriod is the period with which clients waiting for their opponent to connect are sent the
+	// time remaining before the match is aborted. Configured via the "match_setup_progress_period" environment variable.
+	matchSetupProgressPeriod = envvar.Duration("match_setup_progress_period", defaultMatchSetupProgressPeriod)
+
+	// matchStallLimit is the maximum time that a match can be in play without a valid move being made, before it is
+	// ended as no contest. The turn timer should always end a match well before this - it's a hard cap, in case the
+	// turn timer fails to. Configured via the "match_stall_limit" environment variable.
+	matchStallLimit = envvar.Duration("match_stall_limit", defaultMatchStallLimit)
+)
+
+// isSetupTimedOut returns true if the match has been waiting for players for longer than the setup timeout. The debug
+// match never times out.
+func (match *Match) isSetupTimedOut(now time.Time) bool {
+	return match.ID != debugGameID && match.GetPhase() == WaitingForPlayers && now.Sub(match.createTime) > matchSetupTimeout
+}
+
+// sendSetupProgress sends any clients that are waiting for their opponent to connect the number of seconds remaining
+// before the match is aborted, if the progress period has elapsed since they were last sent it. The debug match never
+// times out, so is never sent it.
+func (match *Match) sendSetupProgress(now time.Time) {
+	if match.ID == debugGameID || now.Sub(match.lastSetupProgressTime) < matchSetupProgressPeriod {
+		return
+	}
+
+	match.lastSetupProgressTime = now
+
+	// Round the remaining time up to the nearest second, so that zero is only sent when the match is about to abort.
+	remaining := matchSetupTimeout - now.Sub(match.createTime)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionConnectionProgress, strconv.Itoa(seconds)))
+
+	if match.Client1 != nil {
+		match.Client1.SendMessage(message)
+	}
+
+	if match.Client2 != nil {
+		match.Client2.SendMessage(message)
+	}
+}
+
+// isStalled returns true if the match is in play, but a valid move has not been made for longer than the stall limit.
+func (match *Match) isStalled(now time.Time) bool {
+	return match.GetPhase() == Play && now.Sub(match.lastActivityTime) > matchStallLimit
+}
+
+// endStalledMatch ends a stalled match as no contest, as it's not possible to know which player (if any) is at fault.
+func (match *Match) endStalledMatch() {
+	log.Printf("Match [ %v ] stalled - no valid moves for [%v]", match.ID, time.Since(match.lastActivityTime))
+
+	match.Server.Remove(match.Client1, protocol.WSCMatchMutualTimeout, "Match stalled")
+	match.SetPhase(Finished)
+}
+
+// abortMatchSetup aborts a match that timed out while waiting for players, releasing any connected client, and removes
+// it from the server. The match is recorded as aborted, so that it can't be joined later.
+func (gs *Server) abortMatchSetup(match *Match) {
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCOpponentNoShow, "Opponent did not connect in time")
+
+	if match.Client1 != nil {
+		match.Client1.Close(message)
+	}
+
+	if match.Client2 != nil {
+		match.Client2.Close(message)
+	}
+
+	match.SetPhase(Finished)
+	match.SetMatchAborted()
+
+	// Remove the match from the match map, and update the capacity gauge.
+	delete(gs.matches, match.ID)
+	gs.capacity.Set(len(gs.matches))
+
+	log.Printf("Match [%d] aborted - players did not connect within [%v]. Total matches: %v", match.ID, matchSetupTimeout, len(gs.matches))
+}
+
+// isLingering counts the ticks for which the match has been finished, and returns true if it has been finished for
+// longer than the lingering match limit - meaning that it should have been removed from the server by now.
+func (match *Match) isLingering() bool {
+	if match.GetPhase() != Finished {
+		return false
+	}
+
+	match.finishedTicks++
+
+	return match.finishedTicks > lingeringMatchTickLimit
+}
+
+// removeLingeringMatch removes a finished match that was never removed from the server, closing any connections that
+// are still open. This is a safety net to prevent finished matches from leaking - if it is ever needed, there is a
+// bug in the code that should have removed the match, so it is logged as such.
+func (gs *Server) removeLingeringMatch(match *Match) {
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCServerError, "Match already finished")
+
+	if match.Client1 != nil && !match.Client1.isPendingKill() {
+		match.Client1.Close(message)
+	}
+
+	if match.Client2 != nil && !match.Client2.isPendingKill() {
+		match.Client2.Close(message)
+	}
+
+	// Make sure that the match has a result, so that it can't be joined later. This is a noop if the result was
+	// already written.
+	match.SetMatchNoContest()
+
+	// Remove the match from the match map, and update the capacity gauge.
+	delete(gs.matches, match.ID)
+	gs.capacity.Set(len(gs.matches))
+
+	log.Printf("BUG: Match [%d] was still on the server [%d] ticks after it finished, and was removed by the safety sweep. Total matches: %v", match.ID, match.finishedTicks, len(gs.matches))
+}
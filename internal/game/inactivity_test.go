@@ -0,0 +1,172 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+	"github.com/6a/blade-ii-game-server/pkg/capacity"
+)
+
+// TestSetupTimeout checks, with a fixed clock, that only a match that is still waiting for players once the setup
+// timeout has passed is timed out - and never the debug match.
+func TestSetupTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       uint64
+		phase    Phase
+		age      time.Duration
+		expected bool
+	}{
+		{"Waiting within the timeout", 1, WaitingForPlayers, matchSetupTimeout - time.Second, false},
+		{"Waiting for the whole timeout", 1, WaitingForPlayers, matchSetupTimeout, false},
+		{"Waiting past the timeout", 1, WaitingForPlayers, matchSetupTimeout + time.Second, true},
+		{"Debug match waiting past the timeout", debugGameID, WaitingForPlayers, matchSetupTimeout + time.Second, false},
+		{"In play past the timeout", 1, Play, matchSetupTimeout + time.Second, false},
+		{"Finished past the timeout", 1, Finished, matchSetupTimeout + time.Second, false},
+	}
+
+	now := time.Now()
+	for _, test := range tests {
+		match := &Match{ID: test.id, createTime: now.Add(-test.age)}
+		match.SetPhase(test.phase)
+
+		if timedOut := match.isSetupTimedOut(now); timedOut != test.expected {
+			t.Errorf("%s: timed out is %v, expected %v", test.name, timedOut, test.expected)
+		}
+	}
+}
+
+// TestStallLimit checks, with a fixed clock, that only a match that is in play, and hasn't had a valid move for longer
+// than the stall limit, is stalled.
+func TestStallLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		phase    Phase
+		idle     time.Duration
+		expected bool
+	}{
+		{"In play within the limit", Play, matchStallLimit - time.Second, false},
+		{"In play for the whole limit", Play, matchStallLimit, false},
+		{"In play past the limit", Play, matchStallLimit + time.Second, true},
+		{"Waiting past the limit", WaitingForPlayers, matchStallLimit + time.Second, false},
+		{"Finished past the limit", Finished, matchStallLimit + time.Second, false},
+	}
+
+	now := time.Now()
+	for _, test := range tests {
+		match := &Match{ID: 1, lastActivityTime: now.Add(-test.idle)}
+		match.SetPhase(test.phase)
+
+		if stalled := match.isStalled(now); stalled != test.expected {
+			t.Errorf("%s: stalled is %v, expected %v", test.name, stalled, test.expected)
+		}
+	}
+}
+
+// TestEndStalledMatch checks that a stalled match is finished, and its players are removed with a mutual timeout, so
+// that neither of them is held responsible.
+func TestEndStalledMatch(t *testing.T) {
+	server := &Server{disconnect: make(chan DisconnectRequest, 1)}
+
+	match := &Match{ID: 1, Client1: newTestClient(t), Client2: newTestClient(t), Server: server}
+	match.SetPhase(Play)
+
+	match.endStalledMatch()
+
+	if phase := match.GetPhase(); phase != Finished {
+		t.Fatalf("Match is in phase %v, expected %v", phase, Finished)
+	}
+
+	if request := <-server.disconnect; request.Reason != protocol.WSCMatchMutualTimeout {
+		t.Fatalf("Players were removed with reason [%d], expected [%d]", request.Reason, protocol.WSCMatchMutualTimeout)
+	}
+}
+
+// TestSendSetupProgress checks, with a fixed clock, that a client waiting for their opponent is sent the number of
+// seconds until the match is aborted (rounded up, and never negative) once per progress period - and that nothing is
+// sent for the debug match.
+func TestSendSetupProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        uint64
+		age       time.Duration
+		sinceLast time.Duration
+		expected  []string
+	}{
+		{"First progress", 1, 0, 0, []string{strconv.Itoa(int(matchSetupTimeout / time.Second))}},
+		{"Rounded up", 1, matchSetupProgressPeriod + time.Millisecond*500, matchSetupProgressPeriod, []string{strconv.Itoa(int((matchSetupTimeout - matchSetupProgressPeriod) / time.Second))}},
+		{"Within the period", 1, matchSetupProgressPeriod, matchSetupProgressPeriod - time.Second, []string{}},
+		{"Past the timeout", 1, matchSetupTimeout + matchSetupProgressPeriod, matchSetupProgressPeriod, []string{"0"}},
+		{"Debug match", debugGameID, 0, 0, []string{}},
+	}
+
+	now := time.Now()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match := &Match{ID: test.id, Client1: newTestClient(t), createTime: now.Add(-test.age)}
+			if test.sinceLast > 0 {
+				match.lastSetupProgressTime = now.Add(-test.sinceLast)
+			}
+
+			match.sendSetupProgress(now)
+
+			sent := make([]string, 0)
+			for len(match.Client1.connection.OutboundMessageQueue) > 0 {
+				payload := match.Client1.connection.GetNextOutboundMessage().Payload
+				if payload.Code != protocol.WSCMatchData {
+					t.Fatalf("Client was sent code [%d], expected [%d]", payload.Code, protocol.WSCMatchData)
+				}
+
+				sent = append(sent, payload.Message)
+			}
+
+			expected := make([]string, 0, len(test.expected))
+			for _, seconds := range test.expected {
+				expected = append(expected, makeMessageString(InstructionConnectionProgress, seconds))
+			}
+
+			if !reflect.DeepEqual(sent, expected) {
+				t.Fatalf("Client was sent %v, expected %v", sent, expected)
+			}
+		})
+	}
+}
+
+// TestAbortMatchSetup checks that a match whose opponent never connected is aborted - the waiting client is closed as
+// an opponent no show, the match is removed from the server (freeing its capacity), and it is recorded as aborted.
+func TestAbortMatchSetup(t *testing.T) {
+	store := &resultRecordingStore{Store: teststore.NewStore()}
+
+	gs := &Server{store: store, sessions: session.NewRegistry(), capacity: capacity.NewGauge(0)}
+
+	match := &Match{ID: 1, Client1: newTestClient(t), Server: gs}
+	match.Client1.server = gs
+
+	gs.matches = map[uint64]*Match{match.ID: match}
+	gs.capacity.Set(len(gs.matches))
+
+	gs.abortMatchSetup(match)
+
+	if code := match.Client1.connection.GetNextOutboundMessage().Payload.Code; code != protocol.WSCOpponentNoShow || !match.Client1.isPendingKill() {
+		t.Fatalf("Waiting client was sent code [%d], expected to be closed with [%d]", code, protocol.WSCOpponentNoShow)
+	}
+
+	if _, ok := gs.matches[match.ID]; ok || gs.capacity.Current() != 0 {
+		t.Fatalf("Match is still on the server, which reports %d matches", gs.capacity.Current())
+	}
+
+	if phase := match.GetPhase(); phase != Finished {
+		t.Fatalf("Match is in phase %v, expected %v", phase, Finished)
+	}
+
+	waitForResults(t, store, []string{"SetMatchAborted"}, &statsRecorder{}, nil)
+}
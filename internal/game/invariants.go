@@ -0,0 +1,83 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import "fmt"
+
+// cardSnapshot records the sizes of the piles that are constrained between moves, so that the card invariants can be
+// checked once a move has been applied.
+type cardSnapshot struct {
+	total           int
+	fieldSize       int
+	player1Discards int
+	player2Discards int
+}
+
+// takeCardSnapshot returns a snapshot of the specified cards, for use with checkCardInvariants.
+func takeCardSnapshot(cards *Cards) cardSnapshot {
+	return cardSnapshot{
+		total:           countCards(cards),
+		fieldSize:       len(cards.Player1Field) + len(cards.Player2Field),
+		player1Discards: len(cards.Player1Discard),
+		player2Discards: len(cards.Player2Discard),
+	}
+}
+
+// checkCardInvariants returns an error describing the first invariant that the specified cards break, given a
+// snapshot taken before the most recent move was applied, or nil if the cards are consistent.
+//
+// Bolted cards are allowed in the discard piles, as a bolted card is discarded when it is covered by another card,
+// or when the field is cleared.
+func checkCardInvariants(before cardSnapshot, cards *Cards) error {
+
+	// Every card must be somewhere - the total across all the piles should never change. The total depends on the size
+	// of the decks that the match started with, so it's compared to the total before the move.
+	if total := countCards(cards); total != before.total {
+		return fmt.Errorf("expected %v cards in total, found %v", before.total, total)
+	}
+
+	// Hands are dealt once, and only ever shrink.
+	if len(cards.Player1Hand) > int(startingHandSize) || len(cards.Player2Hand) > int(startingHandSize) {
+		return fmt.Errorf("hand size exceeds %v (player 1: %v, player 2: %v)", startingHandSize, len(cards.Player1Hand), len(cards.Player2Hand))
+	}
+
+	// Each move places at most one card onto the field.
+	if fieldSize := len(cards.Player1Field) + len(cards.Player2Field); fieldSize > before.fieldSize+1 {
+		return fmt.Errorf("field grew by %v cards in a single move", fieldSize-before.fieldSize)
+	}
+
+	// Cards are never taken back out of a discard pile.
+	if len(cards.Player1Discard) < before.player1Discards || len(cards.Player2Discard) < before.player2Discards {
+		return fmt.Errorf("discard pile shrank (player 1: %v -> %v, player 2: %v -> %v)",
+			before.player1Discards, len(cards.Player1Discard), before.player2Discards, len(cards.Player2Discard))
+	}
+
+	// Cards can only be bolted while they are on the field, so bolted cards should never be found in a deck or hand.
+	for _, zone := range [][]Card{cards.Player1Deck, cards.Player1Hand, cards.Player2Deck, cards.Player2Hand} {
+		for _, card := range zone {
+			if isBolted(card) {
+				return fmt.Errorf("bolted card [%v] found outside of the field or discard piles", card)
+			}
+		}
+	}
+
+	return nil
+}
+
+// countCards returns the total number of cards across all of the piles.
+func countCards(cards *Cards) int {
+	zones := [][]Card{
+		cards.Player1Deck, cards.Player1Hand, cards.Player1Field, cards.Player1Discard,
+		cards.Player2Deck, cards.Player2Hand, cards.Player2Field, cards.Player2Discard,
+	}
+
+	total := 0
+	for _, zone := range zones {
+		total += len(zone)
+	}
+
+	return total
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// invariantMatches is the number of matches that are played out with random legal moves, checking the card invariants
+// after each one.
+const invariantMatches = 500
+
+// invariantTestCards returns a consistent set of cards, from the middle of a match, with more than a full hand of
+// cards across the decks and hands.
+func invariantTestCards() Cards {
+	return Cards{
+		Player1Deck:    []Card{ElliotsOrbalStaff, GaiusSpear},
+		Player1Hand:    []Card{LaurasGreatsword, FiesTwinGunswords, Bolt},
+		Player1Field:   []Card{JusisSword},
+		Player1Discard: []Card{AlisasOrbalBow},
+		Player2Deck:    []Card{ElliotsOrbalStaff, LaurasGreatsword, Force, Blast},
+		Player2Hand:    []Card{Mirror, MachiasOrbalShotgun, GaiusSpear},
+		Player2Field:   []Card{AlisasOrbalBow},
+		Player2Discard: []Card{},
+	}
+}
+
+// TestCheckCardInvariants checks that each invariant is detected when it is broken by a move, and that the moves that
+// the rules allow are not mistaken for violations.
+func TestCheckCardInvariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		move     func(cards *Cards)
+		violated bool
+	}{
+		{"Card played", func(cards *Cards) {
+			cards.Player1Hand = cards.Player1Hand[:2]
+			cards.Player1Field = append(cards.Player1Field, Bolt)
+		}, false},
+		{"Field cleared", func(cards *Cards) {
+			cards.Player1Discard = append(cards.Player1Discard, cards.Player1Field...)
+			cards.Player2Discard = append(cards.Player2Discard, cards.Player2Field...)
+			cards.Player1Field, cards.Player2Field = nil, nil
+		}, false},
+		{"Bolted card discarded", func(cards *Cards) {
+			cards.Player2Discard = append(cards.Player2Discard, InactiveAlisasOrbalBow)
+			cards.Player2Field = nil
+		}, false},
+		{"Card lost", func(cards *Cards) {
+			cards.Player1Deck = cards.Player1Deck[:1]
+		}, true},
+		{"Card duplicated", func(cards *Cards) {
+			cards.Player2Field = append(cards.Player2Field, GaiusSpear)
+		}, true},
+		{"Hand too large", func(cards *Cards) {
+			hand := append(append(append(cards.Player1Deck, cards.Player1Hand...), cards.Player2Deck...), cards.Player2Hand...)
+			cards.Player1Deck, cards.Player1Hand, cards.Player2Deck, cards.Player2Hand = nil, hand, nil, nil
+		}, true},
+		{"Field grew by two cards", func(cards *Cards) {
+			cards.Player1Field = append(cards.Player1Field, cards.Player1Hand[:2]...)
+			cards.Player1Hand = cards.Player1Hand[2:]
+		}, true},
+		{"Discard pile shrank", func(cards *Cards) {
+			cards.Player1Hand = append(cards.Player1Hand, cards.Player1Discard...)
+			cards.Player1Discard = nil
+		}, true},
+		{"Bolted card in a hand", func(cards *Cards) {
+			cards.Player2Hand[0] = InactiveJusisSword
+		}, true},
+		{"Bolted card in a deck", func(cards *Cards) {
+			cards.Player1Deck[0] = InactiveElliotsOrbalStaff
+		}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cards := invariantTestCards()
+			before := takeCardSnapshot(&cards)
+
+			test.move(&cards)
+
+			if err := checkCardInvariants(before, &cards); (err != nil) != test.violated {
+				t.Fatalf("Invariant check returned [%v], expected a violation: %v", err, test.violated)
+			}
+		})
+	}
+}
+
+// TestRandomMatchInvariants plays out matches with random legal moves, and checks that the card invariants hold after
+// every move that the rules accept.
+func TestRandomMatchInvariants(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < invariantMatches; i++ {
+		cards := GenerateCards(StandardCardPool())
+		rules := NewRules(cards)
+
+		for ended, _ := rules.Ended(); !ended; ended, _ = rules.Ended() {
+			moved := false
+			for _, player := range []Player{Player1, Player2} {
+				moves := rules.LegalMoves(player)
+				if len(moves) == 0 {
+					continue
+				}
+
+				before := takeCardSnapshot(&rules.state.Cards)
+				move := moves[random.Intn(len(moves))]
+				if !rules.Apply(player, move) {
+					t.Fatalf("Legal move [%d:%s] was rejected for player %v, for cards [%s]", move.Instruction, move.Payload, player, cards.Serialized())
+				}
+
+				if err := checkCardInvariants(before, &rules.state.Cards); err != nil {
+					t.Fatalf("Move [%d:%s] by player %v broke an invariant (%v), for cards [%s]", move.Instruction, move.Payload, player, err, cards.Serialized())
+				}
+
+				moved = true
+				break
+			}
+
+			if !moved {
+				t.Fatalf("Match has not ended, but neither player has a legal move, for cards [%s]", cards.Serialized())
+			}
+		}
+	}
+}
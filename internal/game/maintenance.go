@@ -0,0 +1,32 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+// maintenanceServerName is the name that the game server reports to the maintenance mode switch with.
+const maintenanceServerName = "game"
+
+// updateMaintenance picks up any change to maintenance mode, and announces it to every client. Only called from the
+// main loop.
+func (gs *Server) updateMaintenance() {
+	enabled, shutdownTime := gs.maintenance.State()
+	if enabled == gs.maintenanceEnabled && shutdownTime.Equal(gs.maintenanceShutdownTime) {
+		return
+	}
+
+	gs.maintenanceEnabled, gs.maintenanceShutdownTime = enabled, shutdownTime
+
+	announcement := maintenance.Announcement(enabled, shutdownTime)
+	gs.Broadcast(protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAnnouncement, announcement))
+
+	log.Printf("Game server maintenance mode changed: %s", announcement)
+}
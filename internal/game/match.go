@@ -13,9 +13,9 @@ import (
 	"time"
 
 	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
 	"github.com/6a/blade-ii-game-server/pkg/mathplus"
 
-	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 )
 
@@ -32,14 +32,10 @@ const (
 	// the server, and never has the result or state updated.
 	debugGameID uint64 = 20
 
-	// turnMaxWait is the maximum time to wait for a move from a client before they are considered to have lost by
-	// default - that is, they did not play a move within the turn time limit.
-	turnMaxWait = time.Millisecond * 21000
-
-	// cardDrawDelay is extra time that is added to the wait timer for the first turn (after the match starts), that
-	// takes into account the time taken for the card animation to finish client side, as well as a few extra
-	// second to allow for slower computers or networks.
-	cardDrawDelay = time.Millisecond * 15000
+	// defaultCardDrawDelay is the default extra time that is added to the wait timer for the first turn (after the
+	// match starts), that takes into account the time taken for the card animation to finish client side, as well as
+	// a few extra second to allow for slower computers or networks.
+	defaultCardDrawDelay = time.Millisecond * 15000
 
 	// tiedScoreAdditionalWait is an additional delay that is added to the wait timer for a turn when clearing the
 	// field after the score is tied, that takes into account the time taken for the card animation to finish client
@@ -49,14 +45,28 @@ const (
 	// tiedScoreAdditionalWait is an additional delay that is added to the wait timer for a turn when a blast
 	// card is played, that takes into account the time taken for the card animation to finish client side.
 	blastCardAdditionalWait = time.Millisecond * 4500
-)
 
-// ActivePlayer is a uint8 typedef for the active player during a game end check
-type ActivePlayer uint8
+	// forwardedMoveWriteCap is the maximum time to wait for a forwarded move to be written to the other client's
+	// websocket before starting their turn timer anyway.
+	forwardedMoveWriteCap = time.Millisecond * 2000
+)
 
-const activePlayerUndecided ActivePlayer = 0
-const activePlayerTarget ActivePlayer = 1
-const activePlayerOpposite ActivePlayer = 2
+// defaultTurnMaxWait is the maximum time to wait for a move from a client before they are considered to have lost
+// by default - that is, they did not play a move within the turn time limit. Used for matches that were created
+// without a turn time.
+var defaultTurnMaxWait = envvar.Duration("turn_max_wait", time.Millisecond*21000)
+
+// cardDrawDelay is the default extra time that is added to the wait timer for the first turn, unless it is configured
+// for the match's time control (see drawDelayForTurnTime).
+var cardDrawDelay = envvar.Duration("card_draw_delay", defaultCardDrawDelay)
+
+// drawDelayForTurnTime returns the extra time that is added to the wait timer for the first turn, for matches with
+// the specified turn time. This can be configured for each time control with the "card_draw_delay_<seconds>"
+// environment variable, such as "card_draw_delay_45" for matches with a 45 second turn time - otherwise, the specified
+// fallback is used.
+func drawDelayForTurnTime(turnTime time.Duration, fallback time.Duration) time.Duration {
+	return envvar.Duration("card_draw_delay_"+strconv.Itoa(int(turnTime.Seconds())), fallback)
+}
 
 // Match is a wrapper for a matches data and client connections etc
 type Match struct {
@@ -71,6 +81,9 @@ type Match struct {
 	// Match state
 	State MatchState
 
+	// The rules engine that each move is applied with (see updateMatchState).
+	engine Engine
+
 	// A pointer to the game server.
 	Server *Server
 
@@ -78,15 +91,104 @@ type Match struct {
 	// the phase of the game (in State).
 	phaseLock sync.Mutex
 
-	// Timer for each player's turn - used to determine if a player has made a move within the alloted time.
+	// Timer for each player's turn - used to determine if a player has made a move within the alloted time. Only
+	// accessed from the game server's main loop.
 	turnTimer *time.Timer
 
+	// The maximum time to wait for a move from a client, for this match.
+	turnMaxWait time.Duration
+
+	// The extra time that is added to the wait timer for the first turn, for this match.
+	drawDelay time.Duration
+
+	// The number of turn timeouts that each player can have auto-played for them, before a timeout is a loss.
+	timeoutStrikeLimit int
+
+	// Whether this is a ranked (matchmade) match, where the result affects each player's MMR.
+	ranked bool
+
+	// Whether each client has signalled that it has loaded the match, and is ready for the first turn.
+	client1Loaded bool
+	client2Loaded bool
+
+	// Whether the turn timer is waiting to be started, once the most recent move has been written to the other
+	// client's websocket.
+	turnTimerPending bool
+
+	// The period with which the turn timer should be started, once it is no longer pending, and the reason for the
+	// period (for debug logging).
+	pendingTurnPeriod time.Duration
+	pendingTurnReason string
+
+	// The time at which a move was last received from each client (for debug logging).
+	client1LastMoveTime time.Time
+	client2LastMoveTime time.Time
+
+	// The time at which each client requested a forfeit that has not yet been confirmed, or zero if there is no pending
+	// forfeit for the client (see requestForfeit).
+	client1ForfeitPendingTime time.Time
+	client2ForfeitPendingTime time.Time
+
+	// The start of the current rate limiting period for shadow rejection logs, the number of rejections logged during
+	// it, and the number of rejections that were not logged since the last one that was (see logShadowRejection).
+	shadowLogPeriodStart time.Time
+	shadowLogCount       int
+	shadowLogSuppressed  int
+
+	// The most recent moves (see recordMove), the most recent message received from either client (see recordMessage),
+	// and whether a diagnostic dump has been written (see writeDiagnostics) - for debugging matches that end abnormally.
+	moveHistory        []historyMove
+	lastMessage        *diagnosticMessage
+	diagnosticsWritten bool
+
+	// The client to which the most recent move was forwarded, and the queued message count for their connection
+	// after it was forwarded. Once the written message count for the connection reaches this value, the move
+	// has been written.
+	pendingTurnClient   *GClient
+	pendingTurnSequence uint64
+
+	// The time after which the turn timer should be started, even if the forwarded move has not yet been written.
+	pendingTurnDeadline time.Time
+
+	// The time at which the match was created (when the first player connected), and the time at which it started.
+	createTime time.Time
+	startTime  time.Time
+
+	// The time at which the waiting client(s) were last sent the time remaining for their opponent to connect.
+	lastSetupProgressTime time.Time
+
+	// The time at which the match started, or the most recent valid move was made - whichever is later.
+	lastActivityTime time.Time
+
+	// The number of valid moves that have been made during the match.
+	moveCount int
+
+	// The name of the card pool that the decks for the match were drawn from - empty until the match starts.
+	cardPool string
+
+	// The mechanism by which the match was won or drawn, once it has been played out (see Engine.checkForMatchEnd).
+	endReason EndReason
+
+	// The time that the most recent outgoing message was stamped with (see timestamp).
+	lastTimestamp time.Time
+
+	// The number of server ticks for which the match has been finished, without being removed from the server. Only
+	// accessed from the main loop.
+	finishedTicks int
+
 	// Whether this match finished gracefully.
 	matchEndedGracefully bool
 
 	// Mutex lock to protect the critical section that can occur when reading/writing to
 	// matchEndedGracefully.
 	matchGracefulEndLock sync.Mutex
+
+	// Whether the result of this match has been written - the result can only be written once.
+	resultFinalized bool
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to
+	// resultFinalized.
+	resultLock sync.Mutex
 }
 
 // Tick reads any incoming messages and passes outgoing messages to the queue, as well as handling
@@ -99,36 +201,92 @@ func (match *Match) Tick() {
 	// Tick client 2.
 	match.tickClient(match.Client2, match.Client1, Player2)
 
-	// Check for timeouts for each client if the turn timer channel has something in it (which
-	// indicates that the timer has fired). If a player has timed out, end the game, update the
-	// state, and terminate the connection(s) accordingly.
-	if len(match.turnTimer.C) > 0 {
-		select {
+	// Finalize any forfeits that were not confirmed or cancelled within the confirmation window.
+	match.expirePendingForfeits(time.Now())
 
-		// Read from the channel to drain it.
-		case <-match.turnTimer.C:
+	// Resend any forwarded moves that have not been acknowledged in time.
+	match.resendUnacknowledgedMoves(match.Client1)
+	match.resendUnacknowledgedMoves(match.Client2)
 
-			// Determine which player(s) timed out.
+	// Start the turn timer if it's pending, and the most recent move has been written to the other client.
+	match.startPendingTurnTimer()
 
-			if match.Client1.WaitingForMove && match.Client2.WaitingForMove {
+	// If a move earlier in this tick ended the match, any timeout is stale, and must not change the result.
+	if match.GetPhase() != Play {
+		return
+	}
 
-				// Both players timed out (such as failing to perform the first draw when the match starts).
-				match.Server.Remove(match.Client1, protocol.WSCMatchMutualTimeout, "Both players timed out")
-			} else if match.Client1.WaitingForMove {
+	// Check for timeouts for each client if the turn timer has fired. The channel is read without blocking, rather than
+	// checking its length first, as timer channels are unbuffered from Go 1.23 onwards (so their length is always zero).
+	// If a player has timed out, end the game, update the state, and terminate the connection(s) accordingly.
+	select {
 
-				// Player 1 was timed out - Set Player 2 as the winner, and remove the match from the server.
-				match.State.Winner = match.Client2.DBID
-				match.Server.Remove(match.Client1, protocol.WSCMatchTimeOut, "Player 1 timed out")
-			} else {
+	// Read from the channel to drain it.
+	case <-match.turnTimer.C:
 
-				// Player 2 was timed out - Set Player 1 as the winner, and remove the match from the server.
-				match.State.Winner = match.Client1.DBID
-				match.Server.Remove(match.Client2, protocol.WSCMatchTimeOut, "Player 2 timed out")
-			}
+		// Re-check the phase now that the timer has been drained - a timer that fired after the match ended must never
+		// result in a second, contradictory removal.
+		if match.GetPhase() != Play {
+			log.Printf("Match [ %v ] ignored a turn timeout that fired after the match ended", match.ID)
+			return
+		}
+
+		// Record the timeout, so that genuine stalls can be told apart from timer bugs.
+		match.logTurnTimeout()
+
+		// Determine which player(s) timed out. Players with timeout strikes remaining have a move auto-played on their
+		// behalf instead of losing.
+		client1TimedOut := match.Client1.WaitingForMove
+		client2TimedOut := match.Client2.WaitingForMove
+		autoPlayed := false
+
+		if client1TimedOut && match.autoPlay(match.Client1, match.Client2, Player1) {
+			client1TimedOut = false
+			autoPlayed = true
+		}
+
+		if client2TimedOut && match.GetPhase() == Play && match.autoPlay(match.Client2, match.Client1, Player2) {
+			client2TimedOut = false
+			autoPlayed = true
+		}
+
+		// If the auto-played moves ended the match, or covered every player that timed out, there's nothing more to do.
+		if match.GetPhase() != Play || (autoPlayed && !client1TimedOut && !client2TimedOut) {
+			return
+		}
+
+		if client1TimedOut && client2TimedOut {
 
-			// Set the match phase to finished.
-			match.SetPhase(Finished)
+			// Both players timed out (such as failing to perform the first draw when the match starts).
+			match.Server.Remove(match.Client1, protocol.WSCMatchMutualTimeout, "Both players timed out")
+		} else if client1TimedOut {
+
+			// Player 1 was timed out - Set Player 2 as the winner, and remove the match from the server.
+			match.State.Winner = match.Client2.DBID
+			match.Server.Remove(match.Client1, protocol.WSCMatchTimeOut, "Player 1 timed out")
+			match.publishPlayerEvent(EventPlayerTimedOut, match.Client1)
+		} else {
+
+			// Player 2 was timed out - Set Player 1 as the winner, and remove the match from the server.
+			match.State.Winner = match.Client1.DBID
+			match.Server.Remove(match.Client2, protocol.WSCMatchTimeOut, "Player 2 timed out")
+			match.publishPlayerEvent(EventPlayerTimedOut, match.Client2)
 		}
+
+		// Set the match phase to finished.
+		match.SetPhase(Finished)
+	default:
+	}
+}
+
+// discardInboundMessages discards any unprocessed messages from the clients in this match.
+func (match *Match) discardInboundMessages() {
+	if match.Client1 != nil {
+		match.Client1.discardInboundMessages()
+	}
+
+	if match.Client2 != nil {
+		match.Client2.discardInboundMessages()
 	}
 }
 
@@ -140,30 +298,110 @@ func (match *Match) tickClient(client *GClient, other *GClient, player Player) {
 	// If the inbound message queue contains messages...
 	for len(client.connection.InboundMessageQueue) > 0 {
 
-		// Read the next message from the receive queue.
+		// Read the next message from the receive queue, and record it in case the match ends abnormally.
 		message := client.connection.GetNextInboundMessage()
+		match.recordMessage(player, message)
 
 		// If the message is a text message...
 		if message.Type == protocol.Type(protocol.WSMTText) {
 
+			// Moves and forfeits are only processed while the match is in play. They can still be in the inbound queue
+			// after the match has ended (for example, if a move earlier in this tick ended the match), in which case
+			// they are dropped rather than being treated as illegal, so that the result cannot be changed.
+			if (message.Payload.Code == protocol.WSCMatchMove || message.Payload.Code == protocol.WSCMatchForfeit) && match.GetPhase() != Play {
+				log.Printf("Match [ %v ] dropped a message with code [%d] from client [%s] as the match is not in play", match.ID, message.Payload.Code, client.PublicID)
+				continue
+			}
+
 			// If the message is a move update...
 			if message.Payload.Code == protocol.WSCMatchMove {
 
-				// Set the client (the one that is being ticked) to NOT be waiting for a move,
-				// preventing the move timer from timing this client out for now.
-				client.WaitingForMove = false
+				// Clients that use move sequence numbers prefix each move with the next number in the sequence. Moves
+				// that repeat an earlier number (such as a double click, or a duplicated packet) or skip ahead are
+				// ignored rather than treated as illegal, so that the match can continue. The prefix is removed, so that
+				// the move is parsed (and forwarded to the other client) in the usual format. Moves without a valid
+				// prefix are ignored too, as they can't be told apart from a repeat of an earlier move.
+				if client.connection.ProtocolVersion >= protocol.MoveSequenceVersion {
+					sequence, rest, err := splitMoveSequence(message.Payload.Message)
+					if err != nil {
+						log.Printf("Match [ %v ] ignored a move without a sequence number from client [%s]: %s", match.ID, client.PublicID, message.Payload.Message)
+						continue
+					}
+
+					if sequence != client.lastMoveSequence+1 {
+						log.Printf("Match [ %v ] ignored a move with sequence number [%d] from client [%s] - expected [%d]", match.ID, sequence, client.PublicID, client.lastMoveSequence+1)
+						continue
+					}
+
+					client.lastMoveSequence = sequence
+					message.Payload.Message = rest
+				}
+
+				// If the turn is undecided and this client has already drawn onto the field, the move is stale (most likely
+				// a duplicate sent while the client was still animating the field being cleared). It is ignored rather than
+				// treated as an illegal move, so that the match can continue.
+				if match.isStaleDraw(player) {
+					log.Printf("Match [ %v ] ignored a stale draw from client [%s] while the turn was undecided", match.ID, client.PublicID)
+					continue
+				}
+
+				// Store the turn and the deck sizes as they were before the move, so that any changes to the turn flow, or
+				// the decks, can be reported to the clients once the move has been forwarded.
+				previousTurn := match.State.Turn
+				previousDeckCount := match.deckCount()
 
 				// Parse the incoming move message. Errors will end the game, causing this client
 				// to lose (handles in the else branch below).
 				move, err := MoveFromString(message.Payload.Message)
 
+				// Unknown instructions are well formed, but not understood by this server (for example, they
+				// may have been sent by a newer client). These are logged and ignored rather than ending the
+				// game - the client is still expected to make a move within the turn time limit.
+				if err == ErrUnknownInstruction {
+					log.Printf("Match [ %v ] ignored a move with an unknown instruction from client [%s]: %s", match.ID, client.PublicID, message.Payload.Message)
+					continue
+				}
+
+				// Record the move in the recent move history, whether or not it turns out to be valid.
+				if err == nil {
+					match.recordMove(player, move, false)
+				}
+
+				// Set the client (the one that is being ticked) to NOT be waiting for a move,
+				// preventing the move timer from timing this client out for now.
+				client.WaitingForMove = false
+				match.setLastMoveTime(player, time.Now())
+
 				// If there was no error, and the incoming move is considered to be valid given
 				// the current state of the game...
-				if err == nil && match.isValidMove(move, player) {
+				if err == nil && match.isValidMove(move, player) && match.passesStrictValidation(client, player, move) {
+
+					// Take a snapshot of the cards before the move is applied, so that the card invariants can be
+					// checked afterwards.
+					snapshot := takeCardSnapshot(&match.State.Cards)
 
 					// Update the state of the game. The return values are used below to determine
 					// how to continue.
-					valid, matchEnded, winner := match.updateMatchState(player, move)
+					valid, matchEnded, winner, nextToAct := match.updateMatchState(player, move)
+
+					// If the move ended the match, stop the turn timer straight away, so that it can't fire (and time out
+					// the winner) before the removal is processed.
+					if matchEnded {
+						match.stopTurnTimer()
+					}
+
+					// If the move left the cards in an impossible state, the match can't continue - log the full
+					// state for debugging, and end the match as a draw, as neither player can be held responsible.
+					if valid {
+						if err := checkCardInvariants(snapshot, &match.State.Cards); err != nil {
+							log.Printf("Match [ %v ] state corrupted after a move from client [%s]: %v - cards: %+v", match.ID, client.PublicID, err, match.State.Cards)
+
+							match.State.Winner = 0
+							match.removeWithDiagnostics(match.Client1, protocol.WSCMatchStateCorrupted, "Match state corrupted")
+							match.SetPhase(Finished)
+							return
+						}
+					}
 
 					// If the game state was successfully updated, forward the move to the other client.
 					// When (valid) is false, this means that the received move was not valid in the context
@@ -171,58 +409,57 @@ func (match *Match) tickClient(client *GClient, other *GClient, player Player) {
 					// or something caused some moves to be received out of order.
 					if valid {
 
-						// Forward the original message to other client.
-						other.SendMessage(message)
+						// Count the move, for the match audit record, and record the activity.
+						match.moveCount++
+						match.lastActivityTime = time.Now()
 
-						// If the match is determined to have ended...
-						if matchEnded {
+						// Making a move cancels any pending forfeit for the client.
+						match.cancelPendingForfeit(client, player)
 
-							// Set the graceful match end flag for both players, which prevents any post-finish disconnections
-							// being handled as a loss (as the game is already over, its perfectly fine to quit).
-							match.setMatchEndedGracefully(true)
+						// Wait for a move from whoever the move says should act next - and only them, so that an
+						// earlier move in this tick can't leave the other player's flag set.
+						if !matchEnded {
+							match.setWaitingForMove(nextToAct)
+						}
 
-							// Determine which player won (if any).
-							if winner == Player1 {
+						// Forward the original message to other client.
+						match.forwardMove(other, message)
 
-								// Player 1 was the winner - set the winner and remove this match from the server.
-								match.State.Winner = match.Client1.DBID
-								match.Server.Remove(match.Client1, protocol.WSCMatchWin, "")
-							} else if winner == Player2 {
+						// Wait until the forwarded move has been written before starting the turn timer.
+						match.awaitForwardedMove(other)
 
-								// Player 2 was the winner - set the winner and remove this match from the server.
-								match.State.Winner = match.Client2.DBID
-								match.Server.Remove(match.Client2, protocol.WSCMatchWin, "")
-							} else {
+						// Inform both clients of the new deck sizes, if the move was a draw from a deck.
+						match.sendDeckCounts(previousDeckCount)
 
-								// Neither player won - that match ended in a draw. Remove this match from the server,
-								// without setting a winner, so that the server can correctly identify that the game
-								// ended in a draw.
-								match.Server.Remove(match.Client1, protocol.WSCMatchDraw, "")
-							}
+						// Inform both clients if the field was cleared, or the turn was decided, by this move.
+						if !matchEnded {
+							match.sendTurnFlowUpdate(previousTurn)
+						}
 
-							// Set the match phase to finished.
-							match.SetPhase(Finished)
+						// If the match is determined to have ended, end it with the appropriate result.
+						if matchEnded {
+							match.endMatch(winner)
 						}
 					} else {
 
 						// Remove the offending client (this will also end the game) and set the winner
 						// to the other client.
 						match.State.Winner = other.DBID
-						match.Server.Remove(client, protocol.WSCMatchIllegalMove, "")
+						match.removeWithDiagnostics(client, protocol.WSCMatchIllegalMove, "")
+						match.publishPlayerEvent(EventIllegalMove, client)
 					}
 				} else {
 
 					// Remove the offending client (this will also end the game) and set the winner
 					// to the other client.
 					match.State.Winner = other.DBID
-					match.Server.Remove(client, protocol.WSCMatchIllegalMove, "")
+					match.removeWithDiagnostics(client, protocol.WSCMatchIllegalMove, "")
+					match.publishPlayerEvent(EventIllegalMove, client)
 				}
 			} else if message.Payload.Code == protocol.WSCMatchForfeit {
 
-				// Remove the forfeiting client (this will also end the game) and set the winner
-				// to the other client.
-				match.State.Winner = other.DBID
-				match.Server.Remove(client, protocol.WSCMatchForfeit, "")
+				// Forfeit the match, or wait for the forfeit to be confirmed if the client supports it.
+				match.requestForfeit(client, other, player)
 			} else if message.Payload.Code == protocol.WSCMatchRelayMessage {
 
 				// If we reach this point, the payload was just a message that should be
@@ -231,22 +468,183 @@ func (match *Match) tickClient(client *GClient, other *GClient, player Player) {
 				// TODO add filtering? Profanity check? Something to ensure nothing naughty
 				// reaches the other client...
 
-				other.SendMessage(message)
+				other.SendMessage(message.WithTimestamp(match.timestamp()))
+			} else if message.Payload.Code == protocol.WSCMatchClientReady {
+
+				// The client has loaded the match, and is ready for the first turn.
+				match.setClientLoaded(player)
+			} else if message.Payload.Code == protocol.WSCMatchMoveAck {
+
+				// The client received one or more moves forwarded from their opponent.
+				match.acknowledgeMoves(client, message.Payload.Message)
+			} else if message.Payload.Code == protocol.WSCMatchStateRequest {
+
+				// The client requested the card counts, most likely because it has become desynced.
+				match.SendCardCounts(client, player)
 			}
 		} else {
-			// Handle non-text messages?
+
+			// Only text messages are part of the protocol - control messages (ping, pong, close) are handled by the
+			// websocket connection itself, and never reach this point. Any other message type (such as binary) is
+			// counted, logged, and treated as a forfeit by the sending client.
+			match.Server.unsupportedMessageCount++
+			log.Printf("Match [ %v ] received an unsupported message type [ %v ] from client [%s]. Total unsupported messages: %v", match.ID, message.Type, client.PublicID, match.Server.unsupportedMessageCount)
+
+			// Remove the offending client (this will also end the game) and set the winner
+			// to the other client.
+			match.State.Winner = other.DBID
+			match.Server.Remove(client, protocol.WSCUnsupportedMessageType, "Unsupported message type")
+		}
+	}
+}
+
+// endMatch ends a match that was finished by a move, with the specified player as the winner (PlayerUndecided for a
+// draw).
+func (match *Match) endMatch(winner Player) {
+
+	// Set the graceful match end flag for both players, which prevents any post-finish disconnections
+	// being handled as a loss (as the game is already over, its perfectly fine to quit).
+	match.setMatchEndedGracefully(true)
+
+	// Determine which player won (if any).
+	if winner == Player1 {
+
+		// Player 1 was the winner - set the winner and remove this match from the server.
+		match.State.Winner = match.Client1.DBID
+		match.Server.Remove(match.Client1, protocol.WSCMatchWin, "")
+	} else if winner == Player2 {
+
+		// Player 2 was the winner - set the winner and remove this match from the server.
+		match.State.Winner = match.Client2.DBID
+		match.Server.Remove(match.Client2, protocol.WSCMatchWin, "")
+	} else {
+
+		// Neither player won - that match ended in a draw. Remove this match from the server,
+		// without setting a winner, so that the server can correctly identify that the game
+		// ended in a draw.
+		match.Server.Remove(match.Client1, protocol.WSCMatchDraw, "")
+	}
+
+	// Set the match phase to finished.
+	match.SetPhase(Finished)
+}
+
+// setClientLoaded records that the specified player has loaded the match. Once both players have loaded the match,
+// the padded turn timer for the first turn is replaced with a standard one, so that the match doesn't need to wait for
+// the full first turn delay. If either player never signals that they've loaded, the padded timer is used.
+func (match *Match) setClientLoaded(player Player) {
+
+	// Record that the player has loaded, and exit early if they already had (so that the timer is only reset once).
+	if player == Player1 {
+		if match.client1Loaded {
+			return
+		}
+
+		match.client1Loaded = true
+	} else {
+		if match.client2Loaded {
+			return
+		}
+
+		match.client2Loaded = true
+	}
+
+	// The timer is only replaced if both players have loaded, no moves have been made yet, and the first turn delay
+	// has not yet elapsed - so that the first turn is never made longer than it would have been.
+	if !match.client1Loaded || !match.client2Loaded || match.moveCount > 0 || match.turnTimerPending || time.Since(match.startTime) >= match.drawDelay {
+		return
+	}
+
+	// Stop the turn timer, and start it again with a standard turn time (plus the maximum latency of the two clients,
+	// as with all other turns).
+	match.stopTurnTimer()
+	period := match.turnMaxWait + mathplus.MaxDuration(match.Client1.connection.Latency, match.Client2.connection.Latency)
+	match.turnTimer.Reset(period)
+	match.logTurnTimerReset(period, turnTimerReasonClientsLoaded)
+}
+
+// stopTurnTimer stops the turn timer, draining the channel if the timer fired before it could be stopped, so that a
+// stale fire can't be read after the timer is next reset. The timer is only ever accessed from the game server's main
+// loop, so no locking is required.
+func (match *Match) stopTurnTimer() {
+	if !match.turnTimer.Stop() {
+		select {
+		case <-match.turnTimer.C:
+		default:
+		}
+	}
+}
+
+// awaitForwardedMove records that the most recent move was forwarded to the specified client, so that a pending
+// turn timer will only start once the move has been written to their websocket, or the write cap has elapsed.
+func (match *Match) awaitForwardedMove(other *GClient) {
+
+	// Noop if the turn timer is not pending.
+	if !match.turnTimerPending {
+		return
+	}
+
+	// Store the client, and the number of messages queued for them so far (which includes the forwarded move).
+	match.pendingTurnClient = other
+	match.pendingTurnSequence = other.connection.QueuedCount()
+	match.pendingTurnDeadline = time.Now().Add(forwardedMoveWriteCap)
+}
+
+// startPendingTurnTimer starts the turn timer if it is pending, and either the most recent move has been written to
+// the client it was forwarded to, or the write cap has elapsed.
+func (match *Match) startPendingTurnTimer() {
+
+	// Noop if the turn timer is not pending.
+	if !match.turnTimerPending {
+		return
+	}
+
+	// If the move has not been forwarded to anyone, there is nothing to wait for.
+	if match.pendingTurnClient != nil {
+
+		// Determine whether the move has been written, and exit early if it has not, unless the cap has elapsed.
+		written := match.pendingTurnClient.connection.WrittenCount() >= match.pendingTurnSequence
+		if !written && time.Now().Before(match.pendingTurnDeadline) {
+			return
 		}
 	}
+
+	// Start the turn timer, and reset the pending state. The timer was stopped when it became pending, but is stopped
+	// again in case it was reset in the meantime - Reset must only be called on a stopped, drained timer.
+	match.stopTurnTimer()
+	match.turnTimer.Reset(match.pendingTurnPeriod)
+	match.logTurnTimerReset(match.pendingTurnPeriod, match.pendingTurnReason)
+	match.turnTimerPending = false
+	match.pendingTurnClient = nil
 }
 
-// BroadCast sends the specified message to both clients.
+// BroadCast sends the specified message to both clients, stamped with the current time.
 func (match *Match) BroadCast(message protocol.Message) {
 
+	// Stamp the message.
+	message = message.WithTimestamp(match.timestamp())
+
 	// Add the same message to both clients.
 	match.Client1.SendMessage(message)
 	match.Client2.SendMessage(message)
 }
 
+// timestamp returns the time to stamp outgoing messages for this match with. Stamps never go backwards (even if the
+// wall clock does), so that a replay of the match's messages is always in order. Only called from the main loop.
+func (match *Match) timestamp() time.Time {
+
+	// Strip the monotonic clock reading, so that the comparison is made using the wall clock, which the stamp is
+	// based on.
+	now := time.Now().Round(0)
+	if now.Before(match.lastTimestamp) {
+		return match.lastTimestamp
+	}
+
+	match.lastTimestamp = now
+
+	return now
+}
+
 // SendCardData sends starting card data to each client.
 func (match *Match) SendCardData(cards string) {
 
@@ -268,6 +666,12 @@ func (match *Match) SendCardData(cards string) {
 	match.sendMatchData(client1Buffer, client2Buffer, InstructionCards)
 }
 
+// SendTurnTime sends the turn time for this match (in milliseconds) to both clients.
+func (match *Match) SendTurnTime() {
+	turnTime := strconv.FormatInt(match.turnMaxWait.Milliseconds(), 10)
+	match.BroadCast(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionTurnTime, turnTime)))
+}
+
 // SendPlayerData sends each player's (their own) name to the respective client.
 func (match *Match) SendPlayerData() {
 
@@ -325,6 +729,112 @@ func (match *Match) SendOpponentData() {
 	match.sendMatchData(client1Buffer, client2Buffer, InstructionOpponentData)
 }
 
+// SendCardCounts sends the authoritative number of cards in each deck, hand, field and discard pile to the specified
+// client (who is the specified player), so that a client that has become desynced can recover. Only the counts are
+// sent, so that the identities of hidden cards are not revealed.
+//
+// Format: <deck><delim><hand><delim><field><delim><discard><delim><opponent deck><delim><opponent hand><delim><opponent field><delim><opponent discard>
+func (match *Match) SendCardCounts(client *GClient, player Player) {
+
+	// Determine which cards belong to the client, and which belong to their opponent.
+	cards := &match.State.Cards
+	own := [][]Card{cards.Player1Deck, cards.Player1Hand, cards.Player1Field, cards.Player1Discard}
+	opponent := [][]Card{cards.Player2Deck, cards.Player2Hand, cards.Player2Field, cards.Player2Discard}
+	if player == Player2 {
+		own, opponent = opponent, own
+	}
+
+	// Write the count for each set of cards, separated by the client data delimiter.
+	var buffer strings.Builder
+	for index, set := range append(own, opponent...) {
+		if index > 0 {
+			buffer.WriteString(clientDataDelimiter)
+		}
+
+		buffer.WriteString(strconv.Itoa(len(set)))
+	}
+
+	client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionCardCounts, buffer.String())))
+}
+
+// deckCount returns the total number of cards left in both players' decks.
+func (match *Match) deckCount() int {
+	return len(match.State.Cards.Player1Deck) + len(match.State.Cards.Player2Deck)
+}
+
+// sendDeckCounts sends both clients the number of cards left in each player's deck, if the most recent move took a card
+// from a deck, based on the total number of cards in the decks before the move was made (previousDeckCount). Moves
+// that only played cards from a hand leave the decks untouched, and so send nothing.
+//
+// Format: <player 1 deck count><delim><player 2 deck count>
+func (match *Match) sendDeckCounts(previousDeckCount int) {
+	if match.deckCount() >= previousDeckCount {
+		return
+	}
+
+	counts := strconv.Itoa(len(match.State.Cards.Player1Deck)) + clientDataDelimiter + strconv.Itoa(len(match.State.Cards.Player2Deck))
+	match.BroadCast(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionDeckCounts, counts)))
+}
+
+// sendTurnFlowUpdate informs both clients of any change to the turn flow caused by the most recent move, based on
+// the turn before the move was made (previousTurn).
+//
+// If the field was just cleared due to a tied score, a field cleared instruction is sent. If the turn was undecided
+// and has now been decided, a turn decided instruction is sent, containing the player whose turn it now is. The player
+// is written in the same format as the card data (0 for player 1, 1 for player 2).
+func (match *Match) sendTurnFlowUpdate(previousTurn Player) {
+
+	// If the turn is undecided and both fields are empty, the field was cleared by the move that was just made.
+	if match.State.Turn == PlayerUndecided {
+		if len(match.State.Cards.Player1Field) == 0 && len(match.State.Cards.Player2Field) == 0 {
+			match.BroadCast(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionFieldCleared, "")))
+		}
+
+		return
+	}
+
+	// If the turn was undecided before the move, and is no longer, send the player whose turn it now is.
+	if previousTurn == PlayerUndecided {
+
+		// Convert the turn to the card data player format.
+		var turn = "0"
+		if match.State.Turn == Player2 {
+			turn = "1"
+		}
+
+		match.BroadCast(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, makeMessageString(InstructionTurnDecided, turn)))
+	}
+}
+
+// start deals the cards for the match, puts it in play, and sends the match data to both players. Called once both
+// players are present, and their profiles have been refreshed (see refreshProfiles). Only called from the main loop.
+func (match *Match) start() {
+
+	// Generate the cards for this game from the active card pool, and record which pool was used.
+	cardsToSend := GenerateCards(match.Server.cardPool)
+	match.cardPool = match.Server.cardPool.Name
+
+	// Generate the initialized cards, to be set as the initial card state for the match.
+	initializedCards := InitializeCards(cardsToSend)
+
+	// Set the initial card state for the match.
+	match.State.Cards = initializedCards
+
+	// Set the match phase to start.
+	match.SetMatchStart()
+
+	// Send all the match data to each player.
+	match.SendCardData(cardsToSend.Serialized())
+	match.SendPlayerData()
+	match.SendOpponentData()
+	match.SendTurnTime()
+
+	// Inform any subscribers that the match started.
+	match.publishMatchEvent(EventMatchStarted, protocol.WSCNone)
+
+	log.Printf("Match [%v] started with card pool [%s]. Total matches: %v", match.ID, match.cardPool, len(match.Server.matches))
+}
+
 // SetMatchStart sets the phase + start time for the current match.
 //
 // Fails silently but logs errors.
@@ -333,16 +843,23 @@ func (match *Match) SendOpponentData() {
 // the database.
 func (match *Match) SetMatchStart() {
 
-	// Set the match to the play state.
+	// Set the match to the play state, and store the start time.
 	match.SetPhase(Play)
+	match.startTime = time.Now()
+	match.lastActivityTime = match.startTime
 
 	// Start turn timer to a suitable value, that should allow for loading, drawing, and any network delays
 	// client side.
-	match.turnTimer = time.NewTimer(turnMaxWait + cardDrawDelay)
+	match.turnTimer = time.NewTimer(match.turnMaxWait + match.drawDelay)
+	match.logTurnTimerReset(match.turnMaxWait+match.drawDelay, turnTimerReasonFirstDraw)
+
+	// Store the pre-match MMR for each player, so that the result can be calculated and reported relative to the
+	// MMR that each player had when the match started.
+	match.State.Player1MMR = match.Client1.MMR
+	match.State.Player2MMR = match.Client2.MMR
 
 	// Set both players to be waiting for a move - as we are waiting for their initial draw from the deck.
-	match.Client1.WaitingForMove = true
-	match.Client2.WaitingForMove = true
+	match.setWaitingForMove(PlayerUndecided)
 
 	// Early exit if we are currently in the debug match (don't write to the db).
 	if match.ID == debugGameID {
@@ -353,7 +870,7 @@ func (match *Match) SetMatchStart() {
 	go func() {
 
 		// Update the match phase in the database,
-		err := database.SetMatchStart(match.ID)
+		err := match.Server.store.SetMatchStart(match.ID)
 		if err != nil {
 
 			// On error, print to log but don't handle it.
@@ -362,43 +879,175 @@ func (match *Match) SetMatchStart() {
 	}()
 }
 
-// SetMatchResult updates the database with the match result, and also
-// updates the match stats for each player via the Blade II Online REST API.
+// SetMatchResult updates the database with the match result (the winner), and also
+// updates the match stats for each player via the Blade II Online REST API. Draws should
+// be recorded with SetMatchDraw instead - if the winner is not one of the clients, the match
+// is considered to have been aborted, and is recorded as no contest. Only the first result
+// that is set for a match (by this function, SetMatchDraw or SetMatchNoContest) is written.
 //
-// Fails silently but logs errors.
+// Logs errors - failed match stats updates are retried (see updateMatchStats).
 //
 // Performed in a goroutine.
 func (match *Match) SetMatchResult() {
 
-	// Early exit if we are currently in the debug match (don't write to the db).
-	if match.ID == debugGameID {
+	// A match that is missing a client was never started, so it can't have a result. Results are only set for matches
+	// that are in play, so this should not be reachable.
+	if match.Client1 == nil || match.Client2 == nil {
+		log.Printf("Match [ %v ] is missing a client - not recording a result", match.ID)
+		return
+	}
+
+	// Determine the winner of the match.
+	var winner apiinterface.Winner
+	if match.State.Winner == match.Client1.DBID {
+		winner = apiinterface.Player1
+	} else if match.State.Winner == match.Client2.DBID {
+		winner = apiinterface.Player2
+	} else {
+
+		// Without a winner, the match was aborted rather than decided.
+		log.Printf("Match [ %v ] ended without a winner - recording it as no contest", match.ID)
+		match.SetMatchNoContest()
+		return
+	}
+
+	// Early exit if the result was already written, or if we are currently in the debug match (don't write to the db).
+	if !match.finalizeResult() || match.ID == debugGameID {
 		return
 	}
 
+	// Copy everything that the goroutine needs first, as the match can still be modified once the result has been
+	// finalized (such as by a disconnect that races a natural win).
+	server, matchID, winnerID, update := match.Server, match.ID, match.State.Winner, newStatsUpdate(match, winner)
+
 	// Using a goroutine, update the database and send off the match stats update request.
 	go func() {
 
 		// Update the match in the database.
-		err := database.SetMatchResult(match.ID, match.State.Winner)
+		err := server.store.SetMatchResult(matchID, winnerID)
 		if err != nil {
 
 			// On error, print to log but don't handle it.
 			log.Printf("Failed to update match result: %s", err.Error())
 		}
 
-		// Determine the winner of the match.
-		var winner apiinterface.Winner
-		if match.State.Winner == match.Client1.DBID {
-			winner = apiinterface.Player1
-		} else if match.State.Winner == match.Client2.DBID {
-			winner = apiinterface.Player2
-		} else {
-			winner = apiinterface.Draw
+		// Send the match update request (normally to the Blade II Online REST API), along with each player's pre-match
+		// MMR. Failures are retried in the background. This blocks, hence the goroutine.
+		server.updateMatchStats(update)
+	}()
+}
+
+// SetMatchDraw updates the database to show that this match ended in a draw, and also
+// updates the match stats for each player via the Blade II Online REST API.
+//
+// Logs errors - failed match stats updates are retried (see updateMatchStats).
+//
+// Performed in a goroutine.
+func (match *Match) SetMatchDraw() {
+
+	// Early exit if the result was already written, or if we are currently in the debug match (don't write to the db).
+	if !match.finalizeResult() || match.ID == debugGameID {
+		return
+	}
+
+	// Copy everything that the goroutine needs first, as the match can still be modified (see SetMatchResult).
+	server, matchID, update := match.Server, match.ID, newStatsUpdate(match, apiinterface.Draw)
+
+	// Using a goroutine, update the database and send off the match stats update request.
+	go func() {
+
+		// Update the match in the database.
+		err := server.store.SetMatchDraw(matchID)
+		if err != nil {
+
+			// On error, print to log but don't handle it.
+			log.Printf("Failed to update match result: %s", err.Error())
+		}
+
+		// Send the match update request (normally to the Blade II Online REST API), along with each player's pre-match
+		// MMR. Failures are retried in the background. This blocks, hence the goroutine.
+		server.updateMatchStats(update)
+	}()
+}
+
+// SetMatchNoContest updates the database to show that this match ended without a result, such as when both players
+// disconnected. No winner is recorded, and the match stats (including MMR) of both players are left unchanged.
+//
+// Fails silently but logs errors.
+//
+// Performed in a goroutine.
+func (match *Match) SetMatchNoContest() {
+
+	// Early exit if the result was already written, or if we are currently in the debug match (don't write to the db).
+	if !match.finalizeResult() || match.ID == debugGameID {
+		return
+	}
+
+	// Copy everything that the goroutine needs first, as the match can still be modified (see SetMatchResult).
+	store, matchID := match.Server.store, match.ID
+
+	// Using a goroutine, update the database.
+	go func() {
+		err := store.SetMatchNoContest(matchID)
+		if err != nil {
+
+			// On error, print to log but don't handle it.
+			log.Printf("Failed to update match result: %s", err.Error())
+		}
+	}()
+}
+
+// SetMatchAborted updates the database to show that this match was aborted before it started, as one of the players
+// did not connect. No winner is recorded, and the match stats (including MMR) of both players are left unchanged.
+//
+// Fails silently but logs errors.
+//
+// Performed in a goroutine.
+func (match *Match) SetMatchAborted() {
+
+	// Early exit if the result was already written, or if we are currently in the debug match (don't write to the db).
+	if !match.finalizeResult() || match.ID == debugGameID {
+		return
+	}
+
+	// Copy everything that the goroutine needs first, as the match can still be modified (see SetMatchResult).
+	store, matchID := match.Server.store, match.ID
+
+	// Using a goroutine, update the database.
+	go func() {
+		err := store.SetMatchAborted(matchID)
+		if err != nil {
+
+			// On error, print to log but don't handle it.
+			log.Printf("Failed to update match result: %s", err.Error())
 		}
+	}()
+}
+
+// RecordAudit writes an audit record for the conclusion of this match to the database, with the specified reason.
+//
+// Fails silently but logs errors.
+//
+// Performed in a goroutine.
+func (match *Match) RecordAudit(reason protocol.B2Code) {
+
+	// Early exit if we are currently in the debug match (don't write to the db).
+	if match.ID == debugGameID {
+		return
+	}
+
+	// Copy the values to record, so that they are not affected by anything that happens to the match afterwards.
+	player1, player2, winner := match.Client1.DBID, match.Client2.DBID, match.State.Winner
+	duration, moves := time.Now().Sub(match.startTime), match.moveCount
 
-		// Send the match update request to the Blade II Online REST API. This blocks,
-		// hence the goroutine.
-		apiinterface.UpdateMatchStats(match.Client1.DBID, match.Client2.DBID, winner)
+	// Using a goroutine, write the audit record to the database.
+	go func() {
+		err := match.Server.store.RecordMatchAudit(match.ID, player1, player2, winner, uint16(reason), duration, moves)
+		if err != nil {
+
+			// On error, print to log but don't handle it.
+			log.Printf("Failed to record match audit: %s", err.Error())
+		}
 	}()
 }
 
@@ -429,20 +1078,23 @@ func (match *Match) GetPhase() Phase {
 }
 
 // sendMatchData is a helper function that sends match data, based on the two string builders provided, to the respective clients, with
-// the specified instruction.
+// the specified instruction. Both messages are stamped with the same time.
 func (match *Match) sendMatchData(client1Buffer strings.Builder, client2Buffer strings.Builder, instruction B2MatchInstruction) {
 
+	// Get the time to stamp the messages with.
+	timestamp := match.timestamp()
+
 	// Package player 1's string builder as a string along with the specified B2MatchInstruction.
 	client1MessageString := makeMessageString(instruction, client1Buffer.String())
 
 	// Send the packaged message to player 1.
-	match.Client1.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, client1MessageString))
+	match.Client1.SendMessage(protocol.NewTimestampedMessage(protocol.WSMTText, protocol.WSCMatchData, client1MessageString, timestamp))
 
 	// Package player 2's string builder as a string along with the specified B2MatchInstruction.
 	client2MessageString := makeMessageString(instruction, client2Buffer.String())
 
 	// Send the packaged message to player 2.
-	match.Client2.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchData, client2MessageString))
+	match.Client2.SendMessage(protocol.NewTimestampedMessage(protocol.WSMTText, protocol.WSCMatchData, client2MessageString, timestamp))
 }
 
 // makeMessageString is a helper function that returns a string representation of a message payload
@@ -464,505 +1116,73 @@ func makeMessageString(instruction B2MatchInstruction, data string) string {
 	return builder.String()
 }
 
-// updateMatchState takes a move that the specified player made, and updates the match state accordingly.
+// updateMatchState takes a move that the specified player made, and updates the match state accordingly, by applying
+// the move with the rules engine (see Engine.ApplyMove). If the move was accepted and the match continues, the turn
+// timer is stopped, and the period for the next turn is set, ready for when the move has been forwarded.
 //
 // Returns a bool indicating whether the operation was a success, another indicating whether the match ended due
-// to the most, and one more that indicates which player won (if any).
-func (match *Match) updateMatchState(player Player, move Move) (validMove bool, matchEnded bool, winner Player) {
-
-	// Declare variables that will store pointers to the target player's (the one that made the move) cards.
-	var targetHand *[]Card
-	var targetField *[]Card
-	var targetDeck *[]Card
-	var targetDiscard *[]Card
-
-	// Declare variables that will store pointers to the other player's (the one that DID NOT make the move) cards.
-	var oppositeHand *[]Card
-	var oppositeField *[]Card
-	var oppositeDiscard *[]Card
-
-	// Note: using pointers allows us to use the same function for both players, and still be able to modify the
-	// modify - Using non-pointers will change the local array, but the original array will remain unchanged for
-	// operations that don't involve reordering the members by shifting array members.
-
-	// A variable to store the score of the player that made the move.
-	var targetScore uint16
-
-	// Whether or not to update the turn. E.g. when a blast is played, the turn does not change.
-	var updateTurn = false
-
-	// Depending on which player made the move, set values for each card array pointer.
-
-	if player == Player1 {
-		targetHand = &match.State.Cards.Player1Hand
-		targetField = &match.State.Cards.Player1Field
-		targetDeck = &match.State.Cards.Player1Deck
-		targetDiscard = &match.State.Cards.Player1Discard
-		targetScore = match.State.Player1Score
-
-		oppositeHand = &match.State.Cards.Player2Hand
-		oppositeField = &match.State.Cards.Player2Field
-		oppositeDiscard = &match.State.Cards.Player2Discard
-	} else {
-		targetHand = &match.State.Cards.Player2Hand
-		targetField = &match.State.Cards.Player2Field
-		targetDeck = &match.State.Cards.Player2Deck
-		targetDiscard = &match.State.Cards.Player2Discard
-		targetScore = match.State.Player2Score
-
-		oppositeHand = &match.State.Cards.Player1Hand
-		oppositeField = &match.State.Cards.Player1Field
-		oppositeDiscard = &match.State.Cards.Player1Discard
+// to the most, and one more that indicates which player won (if any). The last return value is the player that the
+// match is now waiting for a move from - PlayerUndecided means both players, while the turn is undecided and neither
+// has drawn. It is only meaningful for valid moves that did not end the match, and is derived from the move itself
+// rather than from the turn, so the wait flags should be set from it (see setWaitingForMove), and nowhere else.
+func (match *Match) updateMatchState(player Player, move Move) (validMove bool, matchEnded bool, winner Player, nextToAct Player) {
+
+	// Apply the move - a rejected move leaves the state untouched.
+	state, result := match.engine.ApplyMove(match.State, player, move)
+	if !result.Accepted {
+		return false, false, PlayerUndecided, PlayerUndecided
 	}
 
-	// Get the type of card that was played.
-	inCard := move.Instruction.ToCard()
-
-	// Hack - need to know if the move was a blast so that we can add some additional time to the turn timer, to
-	// account for the long blast animation.
-	var usedBlastEffect bool = false
-
-	// If the turn is currently undecided, this means that the board was cleared and we are waiting for both, or
-	// just one players draw from the deck.
-	if match.State.Turn == PlayerUndecided {
-
-		// If the target7s deck has some cards in it, try to remove one. If it fails (it shouldnt), return false.
-		// Otherwise, try to draw from the player hand. Again, it shouldnt fail, but it if does, return false.
-		if len(*targetDeck) > 0 {
-			if !removeLast(targetDeck) {
-				return false, false, PlayerUndecided
-			}
-		} else {
-			if !removeFirstOfType(targetHand, inCard) {
-				return false, false, PlayerUndecided
-			}
-		}
-
-		// Now that a card has been selected, add it to the target player's field.
-		*targetField = append(*targetField, inCard)
-
-		// For the player that made the move, set them to be longer waiting for a move so
-		// that they do not get timed out.
-		if player == Player1 {
-			match.Client1.WaitingForMove = false
-		} else {
-			match.Client2.WaitingForMove = false
-		}
-
-		// Determine if both players have made their draw from the deck/hand to the field,
-		// by checking that both fields have one card on them. If this is the case, set the update
-		// flag to true, so that further processing occurs below.
-		// Otherwise exit early, indicating that the match has not ended.
-		if len(*targetField) == 1 && len(*oppositeField) == 1 {
-			updateTurn = true
-		} else {
-			return true, false, PlayerUndecided
-		}
-	} else {
-
-		// Reaching this point means that the turn is NOT undecided - i.e. it is someones turn. Try to remove the
-		// first instance of the played card from the target players hand. If this fails, the player sent some bad
-		// data, or the game state on their client was wrong / messed with, and we return false.
-		if !removeFirstOfType(targetHand, inCard) {
-			return false, false, PlayerUndecided
-		}
-
-		// Initialise boolean values that, based on the state of the game, are set to true if a particular effect
-		// card has been played AND THE EFFECT ACTUALLY ACTIVATED. Note that (usedBlastEffect) is declared earlier,
-		// as a hack to ensure that the value can be reused later for the blast edge case.
-		usedRodEffect := inCard == ElliotsOrbalStaff && len(*targetField) > 0 && isBolted(last(*targetField))
-		usedBoltEffect := inCard == Bolt && len(*oppositeField) > 0 && !isBolted(last(*oppositeField))
-		usedMirrorEffect := inCard == Mirror && len(*targetField) > 0 && len(*oppositeField) > 0
-		usedBlastEffect = inCard == Blast && len(*oppositeHand) > 0 // Note: Variable declared above -> See above comment.
-		usedForceEffect := inCard == Force && targetScore > 0
-
-		// Set a separate bool that is used to quickly check if a force, or a normal card was played.
-		usedNormalOrForceCard := (!usedRodEffect && !usedBoltEffect && !usedMirrorEffect && !usedBlastEffect) || usedForceEffect
-
-		// If the selected card was a normal or force card, and the target players latest field card is flipped (bolted),
-		// remove it.
-		if usedNormalOrForceCard && len(*targetField) > 0 && isBolted(last(*targetField)) {
-
-			// Get a copy of the last card on the target player's field (the one about to be removed).
-			removedCard := last(*targetField)
-
-			// Attempt to remove the last card from the target player's field. A failure indicates that a bad instruction was
-			// received, so return false.
-			if !removeFirstOfType(targetField, removedCard) {
-				return false, false, PlayerUndecided
-			}
-
-			// Add the removed card to the target player's discard pile.
-			*targetDiscard = append(*targetDiscard, removedCard)
-		}
-
-		// Determine if the card was an effect card that had its effect activated. Otherwise
-		// just treat it like a normal card, placing it on the target player's field.
-		if len(*targetField) > 0 && !usedNormalOrForceCard {
-
-			// As mentioned earlier - the blast flag is checked here to handle the blast edge case.
-			if usedBlastEffect {
-
-				// Parse the move payload, as it should contain the type (as a string) of the
-				// card that the target player selected to blast (from the other player's) hand.
-				// If it errors, the payload was improperly formatted, empty, or otherwise invalid.
-				blastedCardInt, err := strconv.Atoi(move.Payload)
-				if err != nil {
-					return false, false, PlayerUndecided
-				}
-
-				// If the above parse was successful, determine which card the payload contained by
-				// casting it to a Card.
-				blastedCard := Card(blastedCardInt)
-
-				// Using the card determined aboved, attempt to remove the first instance of that
-				// card from the other players hand. A failure here suggests that the payload had
-				// the wrong value for whatever reason, so we return false.
-				if !removeFirstOfType(oppositeHand, blastedCard) {
-					return false, false, PlayerUndecided
-				}
-
-				// If the above removal call was a success, append the card that was blasted to the other
-				// player's discard pile.
-				*oppositeDiscard = append(*oppositeDiscard, blastedCard)
-
-			} else if usedRodEffect {
-
-				// If a rod effect was detected, unbolt the bolted card on the target player's field.
-				unBolt(targetField)
-			} else if usedBoltEffect {
+	// Store the parts of the state that moves affect. The rest of the state (such as the phase, which other goroutines
+	// read under a lock) is left alone.
+	match.State.Cards, match.State.Turn = state.Cards, state.Turn
+	match.State.Player1Score, match.State.Player2Score = state.Player1Score, state.Player2Score
 
-				// If a bolt effect was detected, bolt the bolted card on the other player's field.
-				bolt(oppositeField)
-			} else if usedMirrorEffect {
-
-				// If a mirror effect was detected, switch the fields for each player. To do so, the
-				// target player's field is first stored in a temporary variable. Then, the target player's
-				// field is overwritten with the other player's field. Finally, the other player's field
-				// is overwritten with the cards stored in the temporary variable.
-				tempTargetField := *targetField
-				*targetField = *oppositeField
-				*oppositeField = tempTargetField
-			}
-
-			// Finally, add the card that the target player played to the target player's discard pile.
-			*targetDiscard = append(*targetDiscard, inCard)
-		} else {
-
-			// Reaching this point means we handle the incoming move as a standard play, and add it directly
-			// to the target player's field.
-			*targetField = append(*targetField, inCard)
-		}
-
-		// If a blast effect was used, set the appropriate wait flag. Otherwise, it was NOT a blast card, and the
-		// update turn flag is set to true.
-		if usedBlastEffect {
-			if match.State.Turn == Player1 {
-				match.Client1.WaitingForMove = true
-			} else {
-				match.Client2.WaitingForMove = true
-			}
-		} else {
-			updateTurn = true
-		}
+	// If the move ended the match, store the reason, and return the winner.
+	if result.Ended {
+		match.endReason = result.Reason
+		return true, true, result.Winner, PlayerUndecided
 	}
 
-	// Update the score for both players.
-	match.State.Player1Score = calculateScore(match.State.Cards.Player1Field)
-	match.State.Player2Score = calculateScore(match.State.Cards.Player2Field)
-
-	// If the match state is NOT undecided, see if one of the players won. This is done here, and not in the previous
-	// if else statement because we need to update the score first.
-	if match.State.Turn != PlayerUndecided {
-		matchEnded, winner = match.checkForMatchEnd(usedBlastEffect)
-		if matchEnded {
-			return true, matchEnded, winner
-		}
-	}
-
-	// If the update turn flag was set to true, we need to determine which player's turn it now is.
-	if updateTurn {
-
-		// Disable wait flags for both players.
-		match.Client1.WaitingForMove = false
-		match.Client2.WaitingForMove = false
-
-		// If the scores are tied, clear the board and enter the undecided state. Otherwise determine
-		// who's turn it now is based on the scores.
-		if match.State.Player1Score == match.State.Player2Score {
-
-			// Set the turn to undecided.
-			match.State.Turn = PlayerUndecided
-
-			// Set both wait flags to true.
-			match.Client1.WaitingForMove = true
-			match.Client2.WaitingForMove = true
-
-			// Dump the target player's field into the target player's discard pile.
-			*targetDiscard = append(*targetDiscard, (*targetField)...)
-			*targetField = nil
-
-			// And do the same for the other player.
-			*oppositeDiscard = append(*oppositeDiscard, (*oppositeField)...)
-			*oppositeField = nil
-
-		} else if match.State.Player1Score < match.State.Player2Score {
-
-			// Set the turn to player 1 and set their wait flag.
-			match.State.Turn = Player1
-			match.Client1.WaitingForMove = true
-		} else {
-
-			// Set the turn to player 2 and set their wait flag.
-			match.State.Turn = Player2
-			match.Client2.WaitingForMove = true
-		}
+	// A draw that leaves the other player still to draw doesn't affect the turn timer, which keeps running until both
+	// players have drawn.
+	if match.State.Turn == PlayerUndecided && result.NextToAct != PlayerUndecided {
+		return true, false, PlayerUndecided, result.NextToAct
 	}
 
 	// Calculate how long the next turn timeout should be, be taking the base value
 	// and adding the maximum latency of the two clients. If one player has a particularly
 	// high latency, this will give them some leeway to account for it.
-	var nextTurnPeriod = turnMaxWait + mathplus.MaxDuration(match.Client1.connection.Latency, match.Client2.connection.Latency)
+	var nextTurnPeriod = match.turnMaxWait + mathplus.MaxDuration(match.Client1.connection.Latency, match.Client2.connection.Latency)
+	var nextTurnReason = turnTimerReasonNormal
 
 	// If the scores are drawn, add some extra time to account for clearing the board. Or, the move was a blast card, add
 	// some time to account for the client side animations.
 	if match.State.Player1Score == match.State.Player2Score {
 		nextTurnPeriod += tiedScoreAdditionalWait
-	} else if usedBlastEffect {
+		nextTurnReason = turnTimerReasonTied
+	} else if result.UsedBlastEffect {
 		nextTurnPeriod += blastCardAdditionalWait
+		nextTurnReason = turnTimerReasonBlast
 	}
 
-	// Reset the turn timer with the newly calculated turn wait time.
-	match.turnTimer.Stop()
-	match.turnTimer.Reset(nextTurnPeriod)
-
-	// Return true, with no winner.
-	return true, false, PlayerUndecided
-}
-
-// checkForMatchEnd returns true, and the player who won, if the match is no longer in a playable
-// state (though not due to error - rather, due to someone winning, or a draw). Pass in a bool
-// that indicates whether or not a blast effect was used on this turn (as it doesnt cause the
-// turn to change, it has to be handled as an edge case).
-func (match *Match) checkForMatchEnd(usedBlastEffect bool) (matchEnded bool, player Player) {
-
-	// Return true and undecided if the match is drawn.
-	if match.isDrawn() {
-		return true, PlayerUndecided
-	}
-
-	// Return true, and player 1 if player 1 won.
-	if match.playerHasWon(Player1, usedBlastEffect) {
-		return true, Player1
-	}
-
-	// Return true, and player 2 if player 2 won.
-	if match.playerHasWon(Player2, usedBlastEffect) {
-		return true, Player2
-	}
-
-	// If none of the win conditions were met, the match is still in progress - return false.
-	return false, PlayerUndecided
-}
-
-// Based on the state of the game (and whether or not a blast cased was played on this
-// turn) determine if the specified player won the game.
-func (match *Match) playerHasWon(player Player, usedBlastEffect bool) bool {
-
-	// Similar to the updateMatchState function, this function takes in a player
-	// as an argument, so we first declare some variables to set once we have
-	// determined which player is the target, and which is the "opposite" player.
-
-	// Unlike the updateMatchState function, however, the arrays are not pointers, as
-	// the arrays will not be modified.
-
-	var targetPlayerScore uint16
-	var targetField []Card
-
-	var oppositePlayerScore uint16
-	var oppositePlayerHand []Card
-	var oppositePlayerField []Card
-
-	var oppositePlayerDeckCount int
-	var activePlayer ActivePlayer = activePlayerUndecided
-
-	// Determine which player's turn it is, and store it in a local variable.
-	if match.State.Turn == player {
-		activePlayer = activePlayerTarget
-	} else {
-		activePlayer = activePlayerOpposite
-	}
-
-	// Depending on which player is currently beind checked to see if they won, set values
-	// for the previously declared variables.
-	if player == Player1 {
-		targetPlayerScore = match.State.Player1Score
-		targetField = match.State.Cards.Player1Field
-
-		oppositePlayerScore = match.State.Player2Score
-		oppositePlayerHand = match.State.Cards.Player2Hand
-		oppositePlayerField = match.State.Cards.Player2Field
-		oppositePlayerDeckCount = len(match.State.Cards.Player2Deck)
-
-	} else if player == Player2 {
-		targetPlayerScore = match.State.Player2Score
-		targetField = match.State.Cards.Player2Field
-
-		oppositePlayerScore = match.State.Player1Score
-		oppositePlayerHand = match.State.Cards.Player1Hand
-		oppositePlayerField = match.State.Cards.Player1Field
-		oppositePlayerDeckCount = len(match.State.Cards.Player1Deck)
-	} else {
-
-		// Edge case - if a non player (undecided) was passed in, exit early.
-		return false
-	}
-
-	// Early exit if the scores are equal, and the opposite player has no more cards left to
-	// try and break a tie. Ensure that the game is checked for a draw state BEFORE this function, as
-	// this check does not check the target player's side of the field.
-	if targetPlayerScore == oppositePlayerScore {
-		if oppositePlayerDeckCount+len(oppositePlayerHand) == 0 {
-			return true
-		}
-	}
-
-	// There are some edge cases to handle for blast effects, so we handle them here.
-	if usedBlastEffect {
-
-		// If the player being checked is the player that just made a move (in this instance, used a blast card).
-		if activePlayer == activePlayerTarget {
-
-			// If the opposite player's hand is empty and the target player's score is greater than the opposite player's
-			// score, thene the target player wins.
-			if len(oppositePlayerHand) == 0 && targetPlayerScore > oppositePlayerScore {
-				return true
-			} else if len(oppositePlayerHand) == 1 && containsOnlyEffectCards(oppositePlayerHand) {
-
-				// Or, if the opposite player has only 1 card in their hand, and it is an effect card, again, the target player wins.
-				return true
-			}
-		} else {
-
-			// Otherwise, if the other player used a blast card, but put themselves in a state where they only have 1 card left,
-			// and that card is an effect card, the target player wins.
-			if len(oppositePlayerHand) == 1 && containsOnlyEffectCards(oppositePlayerHand) {
-				return true
-			}
-		}
-	} else {
-
-		// Extra check for non-blast turns where the opposite player only has effect cards remaining after the target player
-		// makes a move.
-		if activePlayer == activePlayerTarget && len(oppositePlayerHand) == 1 {
-			if targetPlayerScore > oppositePlayerScore && containsOnlyEffectCards(oppositePlayerHand) {
-				return true
-			}
-		}
-	}
-
-	// If the target player's score is greater than the opposite player's score...
-	if targetPlayerScore > oppositePlayerScore {
+	// Stop the turn timer. The timer is started again with the newly calculated turn wait time, once the move has been
+	// written to the other client (see awaitForwardedMove).
+	match.stopTurnTimer()
 
-		// Determine the score gap that must be overcome, or equalled, in order for the opposite player
-		// to be able to continue. No need to abs or cast to signed values, as we can only enter
-		// this clause if (targetPlayerScore) is greater than (oppositePlayerScore).
-		scoreGap := targetPlayerScore - oppositePlayerScore
+	match.turnTimerPending = true
+	match.pendingTurnPeriod = nextTurnPeriod
+	match.pendingTurnReason = nextTurnReason
 
-		// If the opposite players score is lower than the target player's score, and the opposite player
-		// did NOT player a blast card, they have lost as they failed to beat the score for the their turn.
-		// Blast effects are an edge case, as it does not change the turn.
-		if activePlayer == activePlayerOpposite && !usedBlastEffect {
-			return true
-		}
-
-		// If the opposite player's hand is empty, they will not be able to counter the most recent move, and
-		// therefore have lost.
-		if len(oppositePlayerHand) == 0 {
-			return true
-		}
-
-		// From here we check various conditions to see if the opposite player is able to make a valid move.
-
-		// If the opposite player has a card in their hand that will overcome or match the target player's
-		// score, they are ok to continue.
-		if canOvercomeDifference(oppositePlayerHand, scoreGap) {
-			return false
-		}
-
-		// If opposite player has an rod card in their hand, and are able to play it, and playing it would cause their new score to
-		// be equal to or greater than the target score, they are ok to continue.
-		if contains(oppositePlayerHand, ElliotsOrbalStaff) {
-
-			// If the opposite player's field has at least one card, and the last card is bolted...
-			if len(oppositePlayerField) > 0 && isBolted(last(oppositePlayerField)) {
-
-				// If the bolted card is a force card, and applying the force effect would overcome the
-				// difference, they are ok. Or, if the bolted card has a high enough value to overcome
-				// the difference, that's also ok.
-				if last(oppositePlayerField) == InactiveForce {
-					if oppositePlayerScore*2 >= targetPlayerScore {
-						return false
-					}
-				} else if uint16(getBoltedCardrealValue(last(oppositePlayerField))) >= scoreGap {
-					return false
-				}
-			}
-		}
-
-		// If the opposite player has a bolt card in their hand, and the target player's last field card
-		// can be bolted, they are ok to continue.
-		if contains(oppositePlayerHand, Bolt) {
-			if len(targetField) > 0 && !isBolted(last(targetField)) {
-				return false
-			}
-		}
-
-		// If the opposite player has a mirror card in their hand, they are ok.
-		if contains(oppositePlayerHand, Mirror) {
-			return false
-		}
-
-		// If the opposite player has a blast card in their hand, they are ok.
-		if contains(oppositePlayerHand, Blast) {
-			return false
-		}
-
-		// If the opposite player has a force card in their hand, and playing it would increase their
-		// score so that it matches or beats the target player's score, they are ok.
-		if contains(oppositePlayerHand, Force) {
-			if oppositePlayerScore*2 > targetPlayerScore {
-				return false
-			}
-		}
-
-		return true
-	}
-
-	// Reaching this point indicates that none of the conditions were event explored, and the target player
-	// has not won in any fashion.
-	return false
+	// Return true, with no winner.
+	return true, false, PlayerUndecided, result.NextToAct
 }
 
-// isDrawn returns true if the scores are drawn, and both players are unable to make more moves.
-func (match *Match) isDrawn() bool {
-
-	// If both decks are empty...
-	if len(match.State.Cards.Player1Deck)+len(match.State.Cards.Player2Deck) == 0 {
-
-		// If both hands are empty...
-		if len(match.State.Cards.Player1Hand)+len(match.State.Cards.Player2Hand) == 0 {
-
-			// If both scores are equal...
-			if match.State.Player1Score == match.State.Player2Score {
-
-				// The match is drawn.
-				return true
-			}
-		}
-	}
-
-	return false
+// setWaitingForMove sets the wait flags for both players, so that only the specified player (or both players, for
+// PlayerUndecided) can be timed out by the turn timer.
+func (match *Match) setWaitingForMove(nextToAct Player) {
+	match.Client1.WaitingForMove = nextToAct == Player1 || nextToAct == PlayerUndecided
+	match.Client2.WaitingForMove = nextToAct == Player2 || nextToAct == PlayerUndecided
 }
 
 // isBolted returns true if the specified card is bolted.
@@ -998,13 +1218,14 @@ func getBoltedCardrealValue(card Card) uint8 {
 // update function.
 func (match *Match) isValidMove(move Move, player Player) bool {
 
-	// Early exit if the player tried to make a move during the other players turn.
-	if match.State.Turn != player && match.State.Turn != PlayerUndecided {
-		return false
-	}
+	// The move is invalid if the player tried to make a move during the other players turn.
+	return match.engine.isTurn(&match.State, player)
+}
 
-	// Reaching this point means that the move is valid.
-	return true
+// isStaleDraw returns true if the turn is currently undecided, and the specified player has already drawn a card
+// onto their field - meaning that they are no longer expected to make a move until the turn is decided.
+func (match *Match) isStaleDraw(player Player) bool {
+	return match.engine.hasDrawn(&match.State, player)
 }
 
 // isMatchGracefullyFinished is a helper function that returns true if this match, is considered
@@ -1037,16 +1258,55 @@ func (match *Match) setMatchEndedGracefully(finished bool) {
 	match.matchEndedGracefully = finished
 }
 
+// finalizeResult marks the result of this match as finalized, returning true if it was not already - in which case
+// the caller is responsible for writing the result. Returns false if the result was already finalized, so that
+// the result (and any MMR changes) can never be applied twice.
+//
+// Uses a mutex lock to protect the critical section.
+func (match *Match) finalizeResult() bool {
+
+	// Lock the mutex lock, and then defer unlocking.
+	match.resultLock.Lock()
+	defer match.resultLock.Unlock()
+
+	if match.resultFinalized {
+		log.Printf("Match [ %v ] result already finalized - ignoring", match.ID)
+		return false
+	}
+
+	match.resultFinalized = true
+	return true
+}
+
 // NewMatch creates and returns a pointer to a new match, setting the specified client as player 1.
 func NewMatch(matchID uint64, client *GClient, server *Server) *Match {
 
-	// Create a new match, and store its address in a new variable
+	// Get the server's current timeouts, which the match keeps for its lifetime.
+	timeouts := server.getTimeouts()
+
+	// Create a new match, and store its address in a new variable. The turn time is taken from the client, as it
+	// was loaded when their match was validated - falling back to the default if it wasn't set.
 	match := &Match{
-		ID:      matchID,
-		Client1: client,
-		Server:  server,
+		ID:                 matchID,
+		Client1:            client,
+		Server:             server,
+		turnMaxWait:        client.MatchTurnTime,
+		timeoutStrikeLimit: casualTimeoutStrikes,
+		createTime:         time.Now(),
+	}
+
+	match.lastSetupProgressTime = match.createTime
+
+	// Matches without a turn time are ranked (matchmade) matches, where the first timeout is a loss.
+	if match.turnMaxWait <= 0 {
+		match.turnMaxWait = timeouts.TurnMaxWait
+		match.timeoutStrikeLimit = 0
+		match.ranked = true
 	}
 
+	// Determine the first turn delay for the match's time control.
+	match.drawDelay = drawDelayForTurnTime(match.turnMaxWait, timeouts.CardDrawDelay)
+
 	// Return the pointer to the new match.
 	return match
 }
@@ -0,0 +1,629 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// testTurnPeriod is the turn time used when checking when the turn timer starts - long enough that the timer can't
+// fire between checks, and short enough to wait for.
+const testTurnPeriod = time.Millisecond * 200
+
+// newTimerTestMatch returns a match with a stopped turn timer, whose next turn is pending with the test turn period.
+func newTimerTestMatch() *Match {
+	match := &Match{turnTimer: time.NewTimer(time.Hour)}
+	match.stopTurnTimer()
+
+	match.turnTimerPending = true
+	match.pendingTurnPeriod = testTurnPeriod
+
+	return match
+}
+
+// expectTurnTimer fails the test unless the specified match's turn timer has started (and so fires), or hasn't, as
+// specified.
+func expectTurnTimer(t *testing.T, match *Match, started bool) {
+	t.Helper()
+
+	if match.turnTimerPending == started {
+		t.Fatalf("Turn timer pending is %v, expected %v", match.turnTimerPending, !started)
+	}
+
+	select {
+	case <-match.turnTimer.C:
+		if !started {
+			t.Fatalf("Turn timer fired before it was started")
+		}
+	case <-time.After(testTurnPeriod * 2):
+		if started {
+			t.Fatalf("Turn timer did not fire within [%v] of starting", testTurnPeriod*2)
+		}
+	}
+}
+
+// TestTurnTimerWaitsForForwardedMove checks that the turn timer only starts once the move that was forwarded to the
+// other client has been written to their websocket, however long that takes, up until the write cap.
+func TestTurnTimerWaitsForForwardedMove(t *testing.T) {
+	t.Run("Slow write", func(t *testing.T) {
+		match := newTimerTestMatch()
+		other := newTestClient(t)
+
+		other.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|2:"))
+		match.awaitForwardedMove(other)
+
+		// The move is still in the outbound queue.
+		match.startPendingTurnTimer()
+		expectTurnTimer(t, match, false)
+
+		writeNext(t, other)
+
+		match.startPendingTurnTimer()
+		expectTurnTimer(t, match, true)
+	})
+
+	t.Run("Write cap", func(t *testing.T) {
+		match := newTimerTestMatch()
+		other := newTestClient(t)
+
+		other.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|2:"))
+		match.awaitForwardedMove(other)
+
+		if remaining := time.Until(match.pendingTurnDeadline); remaining <= 0 || remaining > forwardedMoveWriteCap {
+			t.Fatalf("Write cap is [%v], expected up to [%v]", remaining, forwardedMoveWriteCap)
+		}
+
+		// The move is never written, but the cap elapses.
+		match.pendingTurnDeadline = time.Now()
+
+		match.startPendingTurnTimer()
+		expectTurnTimer(t, match, true)
+	})
+
+	t.Run("Nothing forwarded", func(t *testing.T) {
+		match := newTimerTestMatch()
+
+		match.startPendingTurnTimer()
+		expectTurnTimer(t, match, true)
+	})
+}
+
+// resultRecordingStore is a test store that records the match results that are written to it.
+type resultRecordingStore struct {
+	*teststore.Store
+
+	// The names of the methods through which results were written, in order.
+	results []string
+	lock    sync.Mutex
+}
+
+// SetMatchResult records the result, and then writes it as the test store would.
+func (store *resultRecordingStore) SetMatchResult(matchID uint64, winnerDatabaseID uint64) (err error) {
+	store.record("SetMatchResult")
+	return store.Store.SetMatchResult(matchID, winnerDatabaseID)
+}
+
+// SetMatchDraw records the result, and then writes it as the test store would.
+func (store *resultRecordingStore) SetMatchDraw(matchID uint64) (err error) {
+	store.record("SetMatchDraw")
+	return store.Store.SetMatchDraw(matchID)
+}
+
+// SetMatchNoContest records the result, and then writes it as the test store would.
+func (store *resultRecordingStore) SetMatchNoContest(matchID uint64) (err error) {
+	store.record("SetMatchNoContest")
+	return store.Store.SetMatchNoContest(matchID)
+}
+
+// SetMatchAborted records the result, and then writes it as the test store would.
+func (store *resultRecordingStore) SetMatchAborted(matchID uint64) (err error) {
+	store.record("SetMatchAborted")
+	return store.Store.SetMatchAborted(matchID)
+}
+
+// record records a result that was written through the specified method.
+func (store *resultRecordingStore) record(method string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.results = append(store.results, method)
+}
+
+// Results returns the names of the methods through which results were written, in order.
+func (store *resultRecordingStore) Results() []string {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return append([]string(nil), store.results...)
+}
+
+// statsRecorder is a stats updater that records the winner of each update that it is sent.
+type statsRecorder struct {
+	winners []apiinterface.Winner
+	lock    sync.Mutex
+}
+
+// UpdateMatchStats records the winner of the update. Never fails.
+func (recorder *statsRecorder) UpdateMatchStats(client1ID uint64, client2ID uint64, client1MMR int, client2MMR int, winner apiinterface.Winner) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.winners = append(recorder.winners, winner)
+	return nil
+}
+
+// Winners returns the winner of each update that was recorded, in order.
+func (recorder *statsRecorder) Winners() []apiinterface.Winner {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return append([]apiinterface.Winner(nil), recorder.winners...)
+}
+
+// newResultTestMatch returns a match in play between two test clients (with database IDs 1 and 2), on a server that
+// writes results to the specified store, and sends stats updates to the specified recorder.
+func newResultTestMatch(t *testing.T, store *resultRecordingStore, stats *statsRecorder) *Match {
+	t.Helper()
+
+	server := &Server{store: store}
+	server.SetStatsUpdater(stats)
+
+	match := &Match{
+		ID:      1,
+		Client1: newTestClient(t),
+		Client2: newTestClient(t),
+		Server:  server,
+	}
+
+	match.Client1.DBID = 1
+	match.Client2.DBID = 2
+	match.SetPhase(Play)
+
+	return match
+}
+
+// waitForResults waits until the store has recorded the specified results, and the recorder the specified stats
+// updates, as both are written asynchronously - and then fails the test if either has recorded anything else.
+func waitForResults(t *testing.T, store *resultRecordingStore, results []string, stats *statsRecorder, winners []apiinterface.Winner) {
+	t.Helper()
+
+	for end := time.Now().Add(time.Second); len(store.Results()) < len(results) || len(stats.Winners()) < len(winners); {
+		if time.Now().After(end) {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Anything else would have been written alongside the expected results.
+	time.Sleep(time.Millisecond * 50)
+
+	if recorded := store.Results(); !reflect.DeepEqual(recorded, results) {
+		t.Fatalf("Store recorded results %v, expected %v", recorded, results)
+	}
+
+	if recorded := stats.Winners(); !reflect.DeepEqual(recorded, winners) {
+		t.Fatalf("Stats updates were sent with winners %v, expected %v", recorded, winners)
+	}
+}
+
+// TestMatchOutcomes checks that each way of ending a match writes its own kind of result to the store - a win, a draw,
+// no contest (for a match that ended without a winner), or an abort - and that only wins and draws are reported to the
+// stats API, with a winner that tells them apart.
+func TestMatchOutcomes(t *testing.T) {
+	tests := []struct {
+		name    string
+		end     func(match *Match)
+		results []string
+		winners []apiinterface.Winner
+	}{
+		{
+			name: "Player 1 wins",
+			end: func(match *Match) {
+				match.State.Winner = match.Client1.DBID
+				match.SetMatchResult()
+			},
+			results: []string{"SetMatchResult"},
+			winners: []apiinterface.Winner{apiinterface.Player1},
+		},
+		{
+			name: "Player 2 wins",
+			end: func(match *Match) {
+				match.State.Winner = match.Client2.DBID
+				match.SetMatchResult()
+			},
+			results: []string{"SetMatchResult"},
+			winners: []apiinterface.Winner{apiinterface.Player2},
+		},
+		{
+			name:    "Draw",
+			end:     func(match *Match) { match.SetMatchDraw() },
+			results: []string{"SetMatchDraw"},
+			winners: []apiinterface.Winner{apiinterface.Draw},
+		},
+		{
+			name:    "No winner",
+			end:     func(match *Match) { match.SetMatchResult() },
+			results: []string{"SetMatchNoContest"},
+		},
+		{
+			name:    "Abort",
+			end:     func(match *Match) { match.SetMatchAborted() },
+			results: []string{"SetMatchAborted"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &resultRecordingStore{Store: teststore.NewStore()}
+			stats := &statsRecorder{}
+
+			test.end(newResultTestMatch(t, store, stats))
+
+			waitForResults(t, store, test.results, stats, test.winners)
+		})
+	}
+}
+
+// TestResultFinalizedOnce ends the same match more than once - one after the other, and at the same time, as when a
+// disconnect races a natural win - and checks that only the first result is written to the store, and only one stats
+// update (and so one MMR update) is sent.
+func TestResultFinalizedOnce(t *testing.T) {
+	win := func(match *Match) {
+		match.State.Winner = match.Client1.DBID
+		match.SetMatchResult()
+	}
+
+	tests := []struct {
+		name    string
+		ends    []func(match *Match)
+		results []string
+		winners []apiinterface.Winner
+	}{
+		{
+			name:    "Win twice",
+			ends:    []func(match *Match){win, win},
+			results: []string{"SetMatchResult"},
+			winners: []apiinterface.Winner{apiinterface.Player1},
+		},
+		{
+			name:    "Win then draw",
+			ends:    []func(match *Match){win, func(match *Match) { match.SetMatchDraw() }},
+			results: []string{"SetMatchResult"},
+			winners: []apiinterface.Winner{apiinterface.Player1},
+		},
+		{
+			name:    "Draw then no contest",
+			ends:    []func(match *Match){func(match *Match) { match.SetMatchDraw() }, func(match *Match) { match.SetMatchNoContest() }},
+			results: []string{"SetMatchDraw"},
+			winners: []apiinterface.Winner{apiinterface.Draw},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &resultRecordingStore{Store: teststore.NewStore()}
+			stats := &statsRecorder{}
+
+			match := newResultTestMatch(t, store, stats)
+			for _, end := range test.ends {
+				end(match)
+			}
+
+			waitForResults(t, store, test.results, stats, test.winners)
+		})
+	}
+
+	t.Run("Concurrent wins", func(t *testing.T) {
+		store := &resultRecordingStore{Store: teststore.NewStore()}
+		stats := &statsRecorder{}
+
+		match := newResultTestMatch(t, store, stats)
+		match.State.Winner = match.Client1.DBID
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				match.SetMatchResult()
+			}()
+		}
+
+		wg.Wait()
+
+		waitForResults(t, store, []string{"SetMatchResult"}, stats, []apiinterface.Winner{apiinterface.Player1})
+	})
+}
+
+// TestWinningMoveWithExpiredTurnTimer makes a move that ends the match after the turn timer has already fired, while
+// the winner is still flagged as waiting for a move, and checks that the timer is drained and the match is removed
+// only once - as a win for the correct player, rather than a timeout - however many times it is ticked before the
+// removal is processed.
+func TestWinningMoveWithExpiredTurnTimer(t *testing.T) {
+	state := MatchState{
+		Turn: Player2,
+		Cards: Cards{
+			Player1Hand:  []Card{LaurasGreatsword},
+			Player1Field: []Card{JusisSword},
+			Player2Hand:  []Card{ElliotsOrbalStaff, FiesTwinGunswords},
+			Player2Field: []Card{FiesTwinGunswords},
+		},
+		Player1Score: 4,
+		Player2Score: 2,
+	}
+
+	match := newAutoPlayTestMatch(t, state, 0)
+	match.Client1.WaitingForMove = true
+	match.Client2.WaitingForMove = true
+
+	match.turnTimer = time.NewTimer(0)
+	time.Sleep(time.Millisecond * 10)
+
+	// Elliot's orbal staff leaves player 1's score unbeaten, so player 1 wins.
+	match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|1:")
+	for tick := 0; tick < 3; tick++ {
+		match.Tick()
+	}
+
+	select {
+	case <-match.turnTimer.C:
+		t.Fatalf("Turn timer was not drained when the match ended")
+	default:
+	}
+
+	if removals := len(match.Server.disconnect); removals != 1 {
+		t.Fatalf("Match was removed %d times, expected once", removals)
+	}
+
+	if request := <-match.Server.disconnect; request.Client != match.Client1 || request.Reason != protocol.WSCMatchWin || match.State.Winner != match.Client1.DBID {
+		t.Fatalf("Client %d was removed with reason [%d] and winner [%d], expected client 1 with reason [%d] and winner [%d]", request.Client.DBID, request.Reason, match.State.Winner, protocol.WSCMatchWin, match.Client1.DBID)
+	}
+}
+
+// TestMovesOutsideOfPlay checks that moves and forfeits that are received while the match is not in play are dropped -
+// the state is unchanged, no result is written, and neither client is sent anything.
+func TestMovesOutsideOfPlay(t *testing.T) {
+	tests := []struct {
+		name    string
+		phase   Phase
+		code    protocol.B2Code
+		message string
+	}{
+		{"Move while waiting for players", WaitingForPlayers, protocol.WSCMatchMove, "1|2:"},
+		{"Move after the match finished", Finished, protocol.WSCMatchMove, "1|2:"},
+		{"Forfeit after the match finished", Finished, protocol.WSCMatchForfeit, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &resultRecordingStore{Store: teststore.NewStore()}
+
+			match := &Match{
+				ID:      1,
+				Client1: newTestClient(t),
+				Client2: newTestClient(t),
+				State:   midMatchState(FiesTwinGunswords, LaurasGreatsword),
+				Server:  &Server{store: store},
+			}
+			match.SetPhase(test.phase)
+
+			original := match.State
+			original.Cards = match.State.Cards.clone()
+
+			// The move is legal for player 2, whose turn it is (instruction 2 is Fie's twin gunswords).
+			match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, test.code, test.message)
+			match.tickClient(match.Client2, match.Client1, Player2)
+
+			if !reflect.DeepEqual(match.State, original) {
+				t.Fatalf("State was modified from %+v to %+v", original, match.State)
+			}
+
+			if results := store.Results(); len(results) != 0 {
+				t.Fatalf("Results %v were written, expected none", results)
+			}
+
+			for _, client := range []*GClient{match.Client1, match.Client2} {
+				if queued := client.connection.QueuedCount(); queued != 0 {
+					t.Fatalf("%d messages were sent, expected none", queued)
+				}
+			}
+		})
+	}
+}
+
+// TestWaitingForMoveAroundBlast processes queued moves in a single tick around a blast, and checks that only the player
+// who must act next is left waiting for a move - the player who blasted, as a blast doesn't change the turn, or their
+// opponent once they have followed the blast with another card.
+func TestWaitingForMoveAroundBlast(t *testing.T) {
+
+	// It is player 1's turn, and they play Laura's greatsword, after which player 2 blasts their Gaius' spear.
+	cardThenBlast := MatchState{
+		Turn: Player1,
+		Cards: Cards{
+			Player1Deck:  []Card{ElliotsOrbalStaff},
+			Player1Hand:  []Card{LaurasGreatsword, GaiusSpear, ElliotsOrbalStaff},
+			Player1Field: []Card{FiesTwinGunswords},
+			Player2Deck:  []Card{ElliotsOrbalStaff},
+			Player2Hand:  []Card{Blast, GaiusSpear, ElliotsOrbalStaff},
+			Player2Field: []Card{JusisSword},
+		},
+		Player1Score: 2,
+		Player2Score: 4,
+	}
+
+	tests := []struct {
+		name     string
+		state    MatchState
+		player1  []string
+		player2  []string
+		expected Player
+	}{
+		{"Blast", midMatchState(Blast, GaiusSpear), nil, []string{"1|10:5"}, Player2},
+		{"Blast then a card", midMatchState(Blast, GaiusSpear, FiesTwinGunswords), nil, []string{"1|10:5", "2|6:"}, Player1},
+		{"Card then a blast", cardThenBlast, []string{"1|7:"}, []string{"1|10:5"}, Player2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match := newAutoPlayTestMatch(t, test.state, 0)
+
+			// Both players start out waiting, so that a flag that is left set (rather than cleared) is caught.
+			match.Client1.WaitingForMove, match.Client2.WaitingForMove = true, true
+
+			for _, queued := range []struct {
+				client *GClient
+				moves  []string
+			}{{match.Client1, test.player1}, {match.Client2, test.player2}} {
+				for _, move := range queued.moves {
+					queued.client.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, move)
+				}
+			}
+
+			match.Tick()
+
+			if phase := match.GetPhase(); phase != Play || match.moveCount != len(test.player1)+len(test.player2) {
+				t.Fatalf("Match is in phase %v after %d valid moves, expected every move to be valid and the match to continue", phase, match.moveCount)
+			}
+
+			if match.Client1.WaitingForMove != (test.expected == Player1) || match.Client2.WaitingForMove != (test.expected == Player2) {
+				t.Fatalf("Players waiting for a move are [%v, %v], expected only player %v", match.Client1.WaitingForMove, match.Client2.WaitingForMove, test.expected)
+			}
+		})
+	}
+}
+
+// TestForwardedMoveTimestamps forwards moves over several ticks, and checks that each forwarded move is stamped, and
+// that the stamps never go backwards - even if the clock does.
+func TestForwardedMoveTimestamps(t *testing.T) {
+	tests := []struct {
+		name      string
+		clockStep time.Duration
+	}{
+		{"Steady clock", 0},
+		{"Clock stepped back", -time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match := newAutoPlayTestMatch(t, midMatchState(Blast, GaiusSpear, FiesTwinGunswords), 0)
+
+			// A clock that was stepped back leaves the last stamp in the future.
+			match.lastTimestamp = time.Now().Round(0).Add(-test.clockStep)
+
+			moves := []struct {
+				client *GClient
+				other  *GClient
+				move   string
+			}{
+				{match.Client2, match.Client1, "1|10:5"},
+				{match.Client2, match.Client1, "2|6:"},
+				{match.Client1, match.Client2, "1|7:"},
+			}
+
+			last := match.lastTimestamp.UnixMilli()
+			for _, move := range moves {
+				move.client.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, move.move)
+				match.Tick()
+
+				var forwarded []protocol.Message
+				for len(move.other.connection.OutboundMessageQueue) > 0 {
+					if message := move.other.connection.GetNextOutboundMessage(); message.Payload.Code == protocol.WSCMatchMove {
+						forwarded = append(forwarded, message)
+					}
+				}
+
+				if len(forwarded) != 1 {
+					t.Fatalf("Move [%s] was forwarded %d times, expected once", move.move, len(forwarded))
+				}
+
+				stamp := forwarded[0].Payload.Timestamp
+				if stamp < last {
+					t.Fatalf("Move [%s] was stamped [%d], after a previous stamp of [%d]", move.move, stamp, last)
+				}
+
+				last = stamp
+			}
+		})
+	}
+}
+
+// TestDeckCounts checks that both clients are sent the number of cards left in each player's deck after each draw from
+// a deck - the same for the debug match as for any other - and that nothing is sent for cards played from a hand.
+func TestDeckCounts(t *testing.T) {
+	undecided := MatchState{
+		Turn: PlayerUndecided,
+		Cards: Cards{
+			Player1Deck: []Card{ElliotsOrbalStaff, GaiusSpear},
+			Player1Hand: []Card{FiesTwinGunswords},
+			Player2Deck: []Card{FiesTwinGunswords, JusisSword},
+			Player2Hand: []Card{FiesTwinGunswords},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		id       uint64
+		state    MatchState
+		player1  []string
+		player2  []string
+		expected []string
+	}{
+		{"Both players draw", 1, undecided, []string{"1|6:"}, []string{"1|4:"}, []string{"1.2", "1.1"}},
+		{"Debug match draw", debugGameID, undecided, []string{"1|6:"}, nil, []string{"1.2"}},
+		{"Hand play", 1, midMatchState(GaiusSpear, FiesTwinGunswords), nil, []string{"1|6:"}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			state.Cards = test.state.Cards.Copy()
+
+			match := newAutoPlayTestMatch(t, state, 0)
+			match.ID = test.id
+
+			for _, move := range test.player1 {
+				match.Client1.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, move)
+			}
+
+			for _, move := range test.player2 {
+				match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, move)
+			}
+
+			match.Tick()
+
+			if match.moveCount != len(test.player1)+len(test.player2) {
+				t.Fatalf("%d moves were valid, expected all of them", match.moveCount)
+			}
+
+			expected := make([]string, 0, len(test.expected))
+			for _, counts := range test.expected {
+				expected = append(expected, makeMessageString(InstructionDeckCounts, counts))
+			}
+
+			for _, client := range []*GClient{match.Client1, match.Client2} {
+				sent := make([]string, 0)
+				for len(client.connection.OutboundMessageQueue) > 0 {
+					message := client.connection.GetNextOutboundMessage()
+					if message.Payload.Code == protocol.WSCMatchData && strings.HasPrefix(message.Payload.Message, makeMessageString(InstructionDeckCounts, "")) {
+						sent = append(sent, message.Payload.Message)
+					}
+				}
+
+				if !reflect.DeepEqual(sent, expected) {
+					t.Fatalf("Client %d was sent deck counts %v, expected %v", client.DBID, sent, expected)
+				}
+			}
+		})
+	}
+}
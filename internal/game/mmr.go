@@ -0,0 +1,77 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultMMRKFactor is the K-factor used for MMR delta calculations, if one is not set via the environment.
+	defaultMMRKFactor = 32
+
+	// mmrScaleFactor is the rating difference at which the higher rated player is expected to be 10 times as likely
+	// to win (standard Elo).
+	mmrScaleFactor = 400.0
+
+	// Score values used for MMR delta calculations (standard Elo).
+	mmrScoreWin  = 1.0
+	mmrScoreDraw = 0.5
+	mmrScoreLoss = 0.0
+)
+
+// mmrKFactor is the K-factor used for MMR delta calculations - the maximum change in MMR for a single match.
+// Configured via the "mmr_k_factor" environment variable.
+var mmrKFactor = envvar.Int("mmr_k_factor", defaultMMRKFactor)
+
+// calculateMMRDelta returns the change in MMR for a player with the specified MMR, after playing against an opponent
+// with the specified MMR, with the specified score (mmrScoreWin, mmrScoreDraw, or mmrScoreLoss). Uses standard Elo.
+func calculateMMRDelta(mmr int, opponentMMR int, score float64) int {
+
+	// Calculate the expected score for the player, based on the rating difference.
+	expected := 1 / (1 + math.Pow(10, float64(opponentMMR-mmr)/mmrScaleFactor))
+
+	// Scale the difference between the actual and expected score by the K-factor, and round to the nearest integer.
+	return int(math.Round(float64(mmrKFactor) * (score - expected)))
+}
+
+// mmrDeltas returns the change in MMR for each player, based on the pre-match MMR of each player (stored when the
+// match started) and the current winner of the match. A winner of zero is considered to be a draw.
+func (match *Match) mmrDeltas() (client1Delta int, client2Delta int) {
+
+	// Determine the score for each player.
+	client1Score, client2Score := mmrScoreDraw, mmrScoreDraw
+	if match.State.Winner == match.Client1.DBID {
+		client1Score, client2Score = mmrScoreWin, mmrScoreLoss
+	} else if match.State.Winner == match.Client2.DBID {
+		client1Score, client2Score = mmrScoreLoss, mmrScoreWin
+	}
+
+	// Calculate and return the delta for each player.
+	client1Delta = calculateMMRDelta(match.State.Player1MMR, match.State.Player2MMR, client1Score)
+	client2Delta = calculateMMRDelta(match.State.Player2MMR, match.State.Player1MMR, client2Score)
+
+	return client1Delta, client2Delta
+}
+
+// appendMMRDelta is a helper function that returns the specified match end message with the specified MMR delta
+// appended to it, as a signed integer.
+//
+// Format: <message><delim><delta>
+func appendMMRDelta(message string, delta int) string {
+
+	// Write a plus sign for non negative deltas, so that the sign is always present.
+	sign := ""
+	if delta >= 0 {
+		sign = "+"
+	}
+
+	return message + payloadDelimiter + sign + strconv.Itoa(delta)
+}
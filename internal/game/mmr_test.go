@@ -0,0 +1,57 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import "testing"
+
+// TestCalculateMMRDelta checks the change in MMR for a range of rating differences and results, with the default
+// K-factor.
+func TestCalculateMMRDelta(t *testing.T) {
+	if mmrKFactor != defaultMMRKFactor {
+		t.Skipf("The K-factor is configured as %d - the expected deltas assume %d", mmrKFactor, defaultMMRKFactor)
+	}
+
+	tests := []struct {
+		name        string
+		mmr         int
+		opponentMMR int
+		score       float64
+		expected    int
+	}{
+		{"Win against an equal opponent", 1000, 1000, mmrScoreWin, 16},
+		{"Loss against an equal opponent", 1000, 1000, mmrScoreLoss, -16},
+		{"Draw against an equal opponent", 1000, 1000, mmrScoreDraw, 0},
+		{"Win against a stronger opponent", 1000, 1400, mmrScoreWin, 29},
+		{"Loss against a weaker opponent", 1400, 1000, mmrScoreLoss, -29},
+		{"Win against a weaker opponent", 1400, 1000, mmrScoreWin, 3},
+		{"Draw against a stronger opponent", 1000, 1400, mmrScoreDraw, 13},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if delta := calculateMMRDelta(test.mmr, test.opponentMMR, test.score); delta != test.expected {
+				t.Fatalf("Delta is %d, expected %d", delta, test.expected)
+			}
+		})
+	}
+}
+
+// TestAppendMMRDelta checks that the sign of the delta is always present.
+func TestAppendMMRDelta(t *testing.T) {
+	tests := []struct {
+		delta    int
+		expected string
+	}{
+		{16, "Result:+16"},
+		{0, "Result:+0"},
+		{-16, "Result:-16"},
+	}
+
+	for _, test := range tests {
+		if message := appendMMRDelta("Result", test.delta); message != test.expected {
+			t.Fatalf("Message with delta %d is [%s], expected [%s]", test.delta, message, test.expected)
+		}
+	}
+}
@@ -12,8 +12,33 @@ import (
 	"strings"
 )
 
-// Regex to determine if a move string is valid.
-var validMoveStringRegex = regexp.MustCompile("^[^:]+:[^:]*$")
+const (
+
+	// maxMoveStringLength is the maximum length of a serialised move (instruction, delimiter and payload).
+	maxMoveStringLength = 64
+
+	// maxMovePayloadLength is the maximum length of the payload section of a serialised move.
+	maxMovePayloadLength = 32
+
+	// moveSequenceDelimiter separates the sequence number from the rest of a serialised move, for clients that use
+	// move sequence numbers.
+	moveSequenceDelimiter = "|"
+)
+
+// Regex to determine if a move string is valid. The instruction must be a plain decimal number with no leading
+// zeros, and neither part may contain whitespace, as these variants could be parsed differently by the clients.
+var validMoveStringRegex = regexp.MustCompile(`^(0|[1-9][0-9]*):[^:\s]*$`)
+
+// Regex to determine if a move string starts with a valid sequence number - a plain decimal number with no leading
+// zeros, followed by the sequence delimiter.
+var moveSequenceRegex = regexp.MustCompile(`^(0|[1-9][0-9]{0,9})\|`)
+
+// Errors that can be returned when parsing a move, so that the caller can decide how to handle each case.
+var (
+	ErrBadFormat          = errors.New("Serialised move format invalid")
+	ErrUnknownInstruction = errors.New("Could not parse the code for the incoming move (not valid b2serverupdate)")
+	ErrPayloadTooLarge    = errors.New("Serialised move payload is too large")
+)
 
 // Move represents a client match data packet.
 type Move struct {
@@ -22,15 +47,21 @@ type Move struct {
 }
 
 // MoveFromString attempts to parse a move from the specified move string
-// Non nil error means something went wrong.
+// Non nil error means something went wrong - one of ErrBadFormat, ErrUnknownInstruction or ErrPayloadTooLarge.
 func MoveFromString(moveString string) (move Move, err error) {
 
 	// Create a new move
 	move = Move{}
 
+	// Check the length of the move string before doing anything else, so that oversized strings are never run
+	// through the regex.
+	if len(moveString) > maxMoveStringLength {
+		return move, ErrPayloadTooLarge
+	}
+
 	// Check if the move string is valid, using the validation regex. If not, return an error.
 	if !validMoveStringRegex.MatchString(moveString) {
-		return move, errors.New("Serialised move format invalid")
+		return move, ErrBadFormat
 	}
 
 	// Attempt to split the move string using the payload delimiter, storing each part as
@@ -41,12 +72,12 @@ func MoveFromString(moveString string) (move Move, err error) {
 	// A failure returns an error.
 	outInt, err := strconv.Atoi(data[0])
 	if err != nil {
-		return move, errors.New("Could not parse the code for the incoming move (wrong type)")
+		return move, ErrBadFormat
 	}
 
 	// Ensure that it's a valid move update.
 	if outInt < 0 || outInt > int(CardForce) {
-		return move, errors.New("Could not parse the code for the incoming move (not valid b2serverupdate)")
+		return move, ErrUnknownInstruction
 	}
 
 	// Cast the int value to an instruction code.
@@ -55,8 +86,34 @@ func MoveFromString(moveString string) (move Move, err error) {
 	// If there is a second member in the array, that means that there is payload data. This should be
 	// store as the Payload member of the move. Otherwise, the payload will remain as an empty string.
 	if len(data) == 2 {
+
+		// Ensure that the payload is not too large, as it may be forwarded to the other client.
+		if len(data[1]) > maxMovePayloadLength {
+			return move, ErrPayloadTooLarge
+		}
+
 		move.Payload = data[1]
 	}
 
 	return move, nil
 }
+
+// splitMoveSequence splits a serialised move that is prefixed with a sequence number (in the format
+// "sequence|instruction:payload") into the sequence number, and the rest of the move string. Returns ErrBadFormat if
+// the move string does not start with a valid sequence number.
+func splitMoveSequence(moveString string) (sequence uint64, rest string, err error) {
+
+	// Check that the move string starts with a valid sequence number.
+	prefix := moveSequenceRegex.FindString(moveString)
+	if prefix == "" {
+		return 0, moveString, ErrBadFormat
+	}
+
+	// Parse the sequence number, excluding the delimiter.
+	sequence, err = strconv.ParseUint(prefix[:len(prefix)-len(moveSequenceDelimiter)], 10, 64)
+	if err != nil {
+		return 0, moveString, ErrBadFormat
+	}
+
+	return sequence, moveString[len(prefix):], nil
+}
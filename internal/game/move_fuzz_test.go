@@ -0,0 +1,46 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+//go:build go1.18
+// +build go1.18
+
+package game
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// FuzzMoveFromString checks that parsing any move string never panics, and either returns one of the documented
+// errors, or a move that is within bounds and serializes back to the same move string.
+func FuzzMoveFromString(f *testing.F) {
+	for _, seed := range []string{"7:", "10:3", "00007:x", "-1:", "12:", " 7:", "7:a b", "7:3:4", "1:" + strings.Repeat("x", maxMovePayloadLength+1)} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, moveString string) {
+		move, err := MoveFromString(moveString)
+
+		switch err {
+		case nil:
+		case ErrBadFormat, ErrUnknownInstruction, ErrPayloadTooLarge:
+			return
+		default:
+			t.Fatalf("Undocumented error for [%q]: %v", moveString, err)
+		}
+
+		if move.Instruction > CardForce {
+			t.Fatalf("Instruction %d for [%q] is out of range", move.Instruction, moveString)
+		}
+
+		if len(move.Payload) > maxMovePayloadLength {
+			t.Fatalf("Payload of %d bytes for [%q] is too large", len(move.Payload), moveString)
+		}
+
+		if serialized := strconv.Itoa(int(move.Instruction)) + payloadDelimiter + move.Payload; serialized != moveString {
+			t.Fatalf("Move for [%q] serializes as [%q]", moveString, serialized)
+		}
+	})
+}
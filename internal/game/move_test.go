@@ -0,0 +1,83 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMoveFromString checks the moves that are parsed from valid move strings, and the error that is returned for
+// each kind of invalid move string.
+func TestMoveFromString(t *testing.T) {
+	tests := []struct {
+		name       string
+		moveString string
+		expected   Move
+		err        error
+	}{
+		{"Card without a payload", "7:", Move{Instruction: CardLaurasGreatsword}, nil},
+		{"Card with a payload", "10:3", Move{Instruction: CardBlast, Payload: "3"}, nil},
+		{"Lowest instruction", "0:", Move{Instruction: None}, nil},
+		{"Highest instruction", "11:", Move{Instruction: CardForce}, nil},
+		{"Longest payload", "1:" + strings.Repeat("x", maxMovePayloadLength), Move{Instruction: CardElliotsOrbalStaff, Payload: strings.Repeat("x", maxMovePayloadLength)}, nil},
+
+		{"Empty", "", Move{}, ErrBadFormat},
+		{"Missing delimiter", "7", Move{}, ErrBadFormat},
+		{"Missing instruction", ":3", Move{}, ErrBadFormat},
+		{"Leading zeros", "00007:x", Move{}, ErrBadFormat},
+		{"Negative instruction", "-1:", Move{}, ErrBadFormat},
+		{"Signed instruction", "+7:", Move{}, ErrBadFormat},
+		{"Leading whitespace", " 7:", Move{}, ErrBadFormat},
+		{"Whitespace in the payload", "7:a b", Move{}, ErrBadFormat},
+		{"Trailing newline", "7:\n", Move{}, ErrBadFormat},
+		{"Extra delimiter", "7:3:4", Move{}, ErrBadFormat},
+		{"Instruction that overflows", "99999999999999999999:", Move{}, ErrBadFormat},
+
+		{"Instruction past the cards", "12:", Move{}, ErrUnknownInstruction},
+		{"Large instruction", "1000:", Move{}, ErrUnknownInstruction},
+
+		{"Payload too long", "1:" + strings.Repeat("x", maxMovePayloadLength+1), Move{}, ErrPayloadTooLarge},
+		{"Move string too long", strings.Repeat("1", maxMoveStringLength+1), Move{}, ErrPayloadTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			move, err := MoveFromString(test.moveString)
+			if err != test.err {
+				t.Fatalf("Error for [%q] is [%v], expected [%v]", test.moveString, err, test.err)
+			}
+
+			if err == nil && move != test.expected {
+				t.Fatalf("Move for [%q] is %+v, expected %+v", test.moveString, move, test.expected)
+			}
+		})
+	}
+}
+
+// TestSplitMoveSequence checks the sequence numbers that are split from move strings.
+func TestSplitMoveSequence(t *testing.T) {
+	tests := []struct {
+		moveString string
+		sequence   uint64
+		rest       string
+		err        error
+	}{
+		{"0|7:", 0, "7:", nil},
+		{"42|10:3", 42, "10:3", nil},
+		{"9999999999|7:", 9999999999, "7:", nil},
+		{"7:", 0, "7:", ErrBadFormat},
+		{"|7:", 0, "|7:", ErrBadFormat},
+		{"042|7:", 0, "042|7:", ErrBadFormat},
+		{"99999999999|7:", 0, "99999999999|7:", ErrBadFormat},
+	}
+
+	for _, test := range tests {
+		sequence, rest, err := splitMoveSequence(test.moveString)
+		if sequence != test.sequence || rest != test.rest || err != test.err {
+			t.Fatalf("Split [%s] into (%d, [%s], %v), expected (%d, [%s], %v)", test.moveString, sequence, rest, err, test.sequence, test.rest, test.err)
+		}
+	}
+}
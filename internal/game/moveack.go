@@ -0,0 +1,130 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultMoveAckTimeout is the default duration to wait for a client to acknowledge a forwarded move, before it
+	// is resent.
+	defaultMoveAckTimeout = time.Second * 2
+
+	// maxMoveResends is the maximum number of times that an unacknowledged move is resent, before the server gives up
+	// on it - the client can still recover with a state request.
+	maxMoveResends = 3
+)
+
+// moveAckTimeout is the duration to wait for a client to acknowledge a forwarded move, before it is resent.
+// Configured via the "match_move_ack_timeout" environment variable.
+var moveAckTimeout = envvar.Duration("match_move_ack_timeout", defaultMoveAckTimeout)
+
+// pendingMove is a move that was forwarded to a client, and has not yet been acknowledged.
+type pendingMove struct {
+
+	// The sequence number of the move, and the message that was sent.
+	sequence uint64
+	message  protocol.Message
+
+	// The time at which the move was last sent, and the number of times that it has been resent.
+	sentTime time.Time
+	resends  int
+}
+
+// acknowledgesMoves returns true if this client acknowledges the moves that are forwarded to it.
+func (client *GClient) acknowledgesMoves() bool {
+	return client.connection.ProtocolVersion >= protocol.MoveAckVersion
+}
+
+// forwardMove forwards the specified move message to the specified client, stamped with the current time. If the client
+// acknowledges moves, the move is prefixed with the next sequence number for the client, and tracked until it is
+// acknowledged.
+func (match *Match) forwardMove(client *GClient, message protocol.Message) {
+
+	// Stamp the move with the time that it was forwarded. Resent moves keep the original stamp.
+	message = message.WithTimestamp(match.timestamp())
+
+	// Clients that don't acknowledge moves receive the move as is.
+	if !client.acknowledgesMoves() {
+		client.SendMessage(message)
+		return
+	}
+
+	// Prefix the move with the next sequence number, in the same format used by clients when sending moves.
+	client.forwardedMoveSequence++
+	message.Payload.Message = strconv.FormatUint(client.forwardedMoveSequence, 10) + moveSequenceDelimiter + message.Payload.Message
+
+	// Track the move until it is acknowledged, and send it.
+	client.pendingMoves = append(client.pendingMoves, pendingMove{
+		sequence: client.forwardedMoveSequence,
+		message:  message,
+		sentTime: time.Now(),
+	})
+
+	client.SendMessage(message)
+}
+
+// acknowledgeMoves handles an acknowledgement from the specified client. Acknowledgements are cumulative - the
+// acknowledged sequence number, and all those before it, are no longer pending. Malformed acknowledgements are logged
+// and ignored.
+func (match *Match) acknowledgeMoves(client *GClient, payload string) {
+	sequence, err := strconv.ParseUint(payload, 10, 64)
+	if err != nil {
+		log.Printf("Match [ %v ] ignored a malformed move acknowledgement from client [%s]: %s", match.ID, client.PublicID, payload)
+		return
+	}
+
+	// Pending moves are in ascending sequence order, so find the first one that is still unacknowledged.
+	index := 0
+	for index < len(client.pendingMoves) && client.pendingMoves[index].sequence <= sequence {
+		index++
+	}
+
+	client.pendingMoves = client.pendingMoves[index:]
+}
+
+// resendUnacknowledgedMoves resends any moves that the specified client has not acknowledged within the ack timeout.
+// Moves that have already been resent the maximum number of times are dropped.
+func (match *Match) resendUnacknowledgedMoves(client *GClient) {
+
+	// Noop if there are no pending moves (which is always the case for clients that don't acknowledge moves).
+	if client == nil || len(client.pendingMoves) == 0 {
+		return
+	}
+
+	now := time.Now()
+	remaining := client.pendingMoves[:0]
+
+	for _, move := range client.pendingMoves {
+
+		// Keep moves that are still within the ack timeout.
+		if now.Sub(move.sentTime) < moveAckTimeout {
+			remaining = append(remaining, move)
+			continue
+		}
+
+		// Give up on moves that have been resent too many times.
+		if move.resends >= maxMoveResends {
+			log.Printf("Match [ %v ] gave up resending move [%d] to client [%s] - not acknowledged after [%d] resends", match.ID, move.sequence, client.PublicID, move.resends)
+			continue
+		}
+
+		// Resend the move.
+		move.resends++
+		move.sentTime = now
+		client.SendMessage(move.message)
+		remaining = append(remaining, move)
+	}
+
+	client.pendingMoves = remaining
+}
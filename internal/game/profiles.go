@@ -0,0 +1,79 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+)
+
+// profileRefresh is the result of refreshing the profiles of the players in a match that is ready to start.
+type profileRefresh struct {
+
+	// The match, and the clients that were in it when the refresh started.
+	match   *Match
+	client1 *GClient
+	client2 *GClient
+
+	// The refreshed profiles, keyed by database ID, or the error that the refresh failed with.
+	profiles map[uint64]database.ClientProfile
+	err      error
+}
+
+// refreshProfiles fetches the current display name and avatar for both players, in a single query, so that the player
+// and opponent data reflect any changes made since the players connected. The store is queried in its own goroutine,
+// so that the main loop isn't held up by the database - the match is started once the result arrives (see
+// startRefreshedMatches). The debug match keeps the values that the players connected with, and starts immediately.
+// Only called from the main loop.
+func (match *Match) refreshProfiles() {
+	if match.ID == debugGameID {
+		match.start()
+		return
+	}
+
+	refresh := profileRefresh{
+		match:   match,
+		client1: match.Client1,
+		client2: match.Client2,
+	}
+
+	go func() {
+		refresh.profiles, refresh.err = match.Server.store.GetClientsNameAndAvatar([]uint64{refresh.client1.DBID, refresh.client2.DBID})
+		match.Server.profileRefreshes <- refresh
+	}()
+}
+
+// startRefreshedMatches starts the matches whose profile refreshes have finished. If a refresh failed, or a player is
+// missing from the result, the values that they connected with are kept. Refreshes for matches that have since been
+// removed, started, or had a player leave or reconnect are discarded - a player reconnecting starts a new refresh.
+// Only called from the main loop.
+func (gs *Server) startRefreshedMatches() {
+	for {
+		select {
+		case refresh := <-gs.profileRefreshes:
+			match := refresh.match
+			if gs.matches[match.ID] != match || match.GetPhase() != WaitingForPlayers || match.Client1 != refresh.client1 || match.Client2 != refresh.client2 {
+				continue
+			}
+
+			if refresh.err != nil {
+				log.Printf("Match [ %v ] failed to refresh player profiles: %s", match.ID, refresh.err.Error())
+			}
+
+			for _, client := range []*GClient{match.Client1, match.Client2} {
+				if profile, ok := refresh.profiles[client.DBID]; ok {
+					client.DisplayName = profile.DisplayName
+					client.Avatar = profile.Avatar
+				}
+			}
+
+			match.start()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import "fmt"
+
+// ReplayMatch re-runs the specified moves, in order, for a match that started with the specified cards - in the format
+// sent to the clients, before they are dealt (see DeserializeDecks) - and returns the final state of the match. The
+// moves are applied with the same logic as the server (see Rules), along with the strict validators (see
+// passesStrictValidation), so that a recorded match can be verified without any clients or timers. Returns an error if
+// any move is illegal, or if there are moves after the match ended.
+//
+// Moves are not recorded with the player that made them, so each one is attributed to the player whose turn it is.
+// While the turn is undecided, both players draw, so a draw is attributed to whichever player could have made it - if
+// either could have, player 1 is tried first, and then player 2 if the rest of the moves can't be replayed that way. In
+// that case the order of the cards in the discard piles may differ from the original match, but the rest of the state
+// does not.
+//
+// As there are no database IDs in a replay, the winner in the final state is the winning Player (Player1 or Player2),
+// or zero if the match was drawn, or hasn't ended. The phase is Finished if the match has ended, or Play otherwise.
+func ReplayMatch(initial Cards, moves []Move) (final MatchState, err error) {
+	rules, err := replayMoves(NewRules(initial), moves, 0)
+	if err != nil {
+		return final, err
+	}
+
+	// Build the final state from a copy of the replayed state, so that it can't be modified through the rules.
+	final = rules.state
+	final.Cards = rules.state.Cards.clone()
+	final.Winner = 0
+	final.Phase = Play
+
+	if ended, winner := rules.Ended(); ended {
+		final.Winner = uint64(winner)
+		final.Phase = Finished
+	}
+
+	return final, nil
+}
+
+// replayMoves applies the specified moves, from the specified index onwards, to the specified rules, and returns the
+// rules with every move applied. Draws that either player could have made are tried for each player in turn, on a copy
+// of the rules. Returns an error if any move is illegal.
+func replayMoves(rules *Rules, moves []Move, index int) (*Rules, error) {
+	for ; index < len(moves); index++ {
+		move := moves[index]
+
+		if ended, _ := rules.Ended(); ended {
+			return nil, fmt.Errorf("Move [ %v ] (%d:%s) was made after the match ended", index, move.Instruction, move.Payload)
+		}
+
+		// Determine which players could have made the move.
+		players := make([]Player, 0, 2)
+		for _, player := range []Player{Player1, Player2} {
+			if rules.isLegal(player, move) {
+				players = append(players, player)
+			}
+		}
+
+		switch len(players) {
+		case 0:
+			return nil, fmt.Errorf("Move [ %v ] (%d:%s) is illegal", index, move.Instruction, move.Payload)
+		case 1:
+			rules.Apply(players[0], move)
+		default:
+
+			// Either player could have made the move, so try the rest of the moves with each of them having made it,
+			// returning the first that succeeds - or the error from player 1's attempt, if neither does.
+			var firstErr error
+			for _, player := range players {
+				branch := rules.clone()
+				branch.Apply(player, move)
+
+				replayed, err := replayMoves(branch, moves, index+1)
+				if err == nil {
+					return replayed, nil
+				}
+
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+
+			return nil, firstErr
+		}
+	}
+
+	return rules, nil
+}
+
+// isLegal returns true if the specified player could make the specified move in the current state - it is valid as
+// far as the server is concerned (see Apply), and passes the strict validators.
+func (rules *Rules) isLegal(player Player, move Move) bool {
+	if !rules.ExpectsMove(player) {
+		return false
+	}
+
+	if _, result := rules.engine.ApplyMove(rules.state, player, move); !result.Accepted {
+		return false
+	}
+
+	// The validators only read the state, so a match that holds nothing else is enough.
+	match := &Match{State: rules.state}
+	for _, validate := range strictValidators {
+		if validate(match, player, move) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clone returns a copy of the rules, which can be modified without affecting the original.
+func (rules *Rules) clone() *Rules {
+	state := rules.state
+	state.Cards = rules.state.Cards.clone()
+
+	return &Rules{
+		state:  state,
+		ended:  rules.ended,
+		winner: rules.winner,
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import "strconv"
+
+// Rules follows a match from outside of the server (such as from a simulated client), applying each move with the
+// same rules engine as the server does (see Engine), so that the state always matches the server's. Not safe for
+// concurrent use.
+type Rules struct {
+
+	// The rules engine, and the current state of the match.
+	engine Engine
+	state  MatchState
+
+	// Whether the match has ended, and if so, the winner (PlayerUndecided for a draw).
+	ended  bool
+	winner Player
+}
+
+// NewRules creates and returns a pointer to a new rules instance, for a match that starts with the specified cards -
+// in the format sent to the clients, before they are dealt (see DeserializeDecks).
+func NewRules(cards Cards) *Rules {
+	return &Rules{
+		state: MatchState{Cards: InitializeCards(cards)},
+	}
+}
+
+// Turn returns the player whose turn it currently is (PlayerUndecided while both players are drawing).
+func (rules *Rules) Turn() Player {
+	return rules.state.Turn
+}
+
+// Ended returns true if the match has ended, along with the winner (PlayerUndecided for a draw).
+func (rules *Rules) Ended() (ended bool, winner Player) {
+	return rules.ended, rules.winner
+}
+
+// ExpectsMove returns true if the match is waiting for a move from the specified player - either because it is their
+// turn, or because the turn is undecided and they have not yet drawn.
+func (rules *Rules) ExpectsMove(player Player) bool {
+	if rules.ended {
+		return false
+	}
+
+	return rules.engine.ExpectsMove(rules.state, player)
+}
+
+// Apply applies the specified move, made by the specified player. Returns false if the move is not valid, in which
+// case the state is left untouched, as the server would end the match.
+func (rules *Rules) Apply(player Player, move Move) bool {
+	if !rules.ExpectsMove(player) {
+		return false
+	}
+
+	state, result := rules.engine.ApplyMove(rules.state, player, move)
+	if !result.Accepted {
+		return false
+	}
+
+	rules.state, rules.ended, rules.winner = state, result.Ended, result.Winner
+
+	return true
+}
+
+// LegalMoves returns every distinct move that the specified player could make in the current state. Blast moves
+// target each distinct card in the opponent's hand. Returns nil if the match is not waiting for a move from the player.
+func (rules *Rules) LegalMoves(player Player) (moves []Move) {
+	if !rules.ExpectsMove(player) {
+		return nil
+	}
+
+	// Get the player's deck and hand, and the opponent's hand.
+	cards := &rules.state.Cards
+	deck, hand, opponentHand := cards.Player1Deck, cards.Player1Hand, cards.Player2Hand
+	if player == Player2 {
+		deck, hand, opponentHand = cards.Player2Deck, cards.Player2Hand, cards.Player1Hand
+	}
+
+	// While the turn is undecided, the only move is the draw from the top of the deck - unless it is empty, in which
+	// case any card can be drawn from the hand.
+	candidates := make([]Move, 0)
+	if rules.state.Turn == PlayerUndecided && len(deck) > 0 {
+		candidates = append(candidates, Move{Instruction: last(deck).ToInstruction()})
+	} else {
+		tried := make(map[Card]bool)
+		for _, card := range hand {
+			if tried[card] {
+				continue
+			}
+
+			tried[card] = true
+
+			// Blast cards need a target, unless they are being drawn.
+			if card != Blast || rules.state.Turn == PlayerUndecided || len(opponentHand) == 0 {
+				candidates = append(candidates, Move{Instruction: card.ToInstruction()})
+				continue
+			}
+
+			targeted := make(map[Card]bool)
+			for _, target := range opponentHand {
+				if !targeted[target] {
+					targeted[target] = true
+					candidates = append(candidates, Move{Instruction: card.ToInstruction(), Payload: strconv.Itoa(int(target))})
+				}
+			}
+		}
+	}
+
+	// Keep the candidates that the server would accept.
+	for _, move := range candidates {
+		if _, result := rules.engine.ApplyMove(rules.state, player, move); result.Accepted {
+			moves = append(moves, move)
+		}
+	}
+
+	return moves
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import "testing"
+
+// TestMatchEndAfterDraw drives matches through a draw phase in which both players draw from their decks, and checks
+// that a match that can't continue once the turn is decided ends as soon as the second player draws (see
+// checkForMatchEndAfterDraw) - rather than stalling with a player who has no legal move, until they time out - and
+// that a match that can continue is left waiting for the player with the lower score.
+func TestMatchEndAfterDraw(t *testing.T) {
+	tests := []struct {
+		name   string
+		cards  Cards
+		ended  bool
+		winner Player
+	}{
+		{
+			name: "Lower score with an empty hand",
+			cards: Cards{
+				Player1Deck: []Card{LaurasGreatsword},
+				Player1Hand: []Card{FiesTwinGunswords},
+				Player2Deck: []Card{ElliotsOrbalStaff},
+			},
+			ended:  true,
+			winner: Player1,
+		},
+		{
+			name: "Lower score that can't be beaten",
+			cards: Cards{
+				Player1Deck: []Card{ElliotsOrbalStaff},
+				Player1Hand: []Card{FiesTwinGunswords},
+				Player2Deck: []Card{LaurasGreatsword},
+				Player2Hand: []Card{FiesTwinGunswords},
+			},
+			ended:  true,
+			winner: Player2,
+		},
+		{
+			name: "Tie with nothing left to draw",
+			cards: Cards{
+				Player1Deck: []Card{JusisSword},
+				Player1Hand: []Card{FiesTwinGunswords},
+				Player2Deck: []Card{JusisSword},
+			},
+			ended:  true,
+			winner: Player1,
+		},
+		{
+			name: "Tie with both players exhausted",
+			cards: Cards{
+				Player1Deck: []Card{JusisSword},
+				Player2Deck: []Card{JusisSword},
+			},
+			ended:  true,
+			winner: PlayerUndecided,
+		},
+		{
+			name: "Lower score that can be beaten",
+			cards: Cards{
+				Player1Deck: []Card{LaurasGreatsword},
+				Player1Hand: []Card{FiesTwinGunswords},
+				Player2Deck: []Card{ElliotsOrbalStaff},
+				Player2Hand: []Card{LaurasGreatsword},
+			},
+			ended: false,
+		},
+		{
+			name: "Tie with cards left to draw",
+			cards: Cards{
+				Player1Deck: []Card{FiesTwinGunswords, JusisSword},
+				Player2Deck: []Card{FiesTwinGunswords, JusisSword},
+			},
+			ended: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			// Each player draws in turn - in both orders, as the player that draws last is used to break ties.
+			for _, order := range [][2]Player{{Player1, Player2}, {Player2, Player1}} {
+				rules := &Rules{state: MatchState{Turn: PlayerUndecided, Cards: test.cards.Copy()}}
+
+				for _, player := range order {
+					moves := rules.LegalMoves(player)
+					if len(moves) == 0 {
+						t.Fatalf("Player %v can't draw", player)
+					}
+
+					if !rules.Apply(player, moves[0]) {
+						t.Fatalf("Player %v's draw [%d] was rejected", player, moves[0].Instruction)
+					}
+				}
+
+				ended, winner := rules.Ended()
+				if ended != test.ended || (ended && winner != test.winner) {
+					t.Fatalf("Drawing in order %v ended the match: %v, winner: %v - expected %v, %v", order, ended, winner, test.ended, test.winner)
+				}
+
+				// A match that continues must be waiting for a player that has a legal move.
+				if !ended {
+					turn := rules.Turn()
+					if turn == PlayerUndecided {
+						turn = Player1
+					}
+
+					if len(rules.LegalMoves(turn)) == 0 {
+						t.Fatalf("Drawing in order %v left player %v with no legal move", order, turn)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+// EvaluateField returns the score for the specified field (in play order), using the same rules as the server - the
+// sum of the values of each card, except for bolted cards (which are worth nothing), and force cards that are not the
+// first card on the field (which double the running total at the point at which they were played). Pure, so it can be
+// used to verify client side scoring.
+func EvaluateField(cards []Card) uint16 {
+	return calculateScore(cards)
+}
+
+// CardValue returns the point value of the specified card, if it were to be played on the field - 1 to 7 for basic
+// cards, 1 for effect cards, and 0 for bolted (inactive) cards and invalid values.
+func CardValue(c Card) uint8 {
+	return c.Value()
+}
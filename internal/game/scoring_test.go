@@ -0,0 +1,83 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// scoreFixturesPath is the path of the scoring fixtures that are shared with the clients, so that both sides can check
+// that they score fields in the same way.
+const scoreFixturesPath = "testdata/scores.json"
+
+// scoreFixtures is the format of the scoring fixtures.
+type scoreFixtures struct {
+	CardValues []struct {
+		Card  Card  `json:"card"`
+		Value uint8 `json:"value"`
+	} `json:"cardValues"`
+
+	Fields []struct {
+		Description string `json:"description"`
+		Field       []Card `json:"field"`
+		Score       uint16 `json:"score"`
+	} `json:"fields"`
+}
+
+// loadScoreFixtures loads and returns the scoring fixtures.
+func loadScoreFixtures(t *testing.T) (fixtures scoreFixtures) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(scoreFixturesPath)
+	if err != nil {
+		t.Fatalf("Failed to read the scoring fixtures: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatalf("Failed to parse the scoring fixtures: %v", err)
+	}
+
+	return fixtures
+}
+
+// TestCardValueFixtures checks the value of every card against the scoring fixtures, and that the fixtures cover every
+// card.
+func TestCardValueFixtures(t *testing.T) {
+	fixtures := loadScoreFixtures(t)
+
+	covered := make(map[Card]bool)
+	for _, fixture := range fixtures.CardValues {
+		covered[fixture.Card] = true
+
+		if value := CardValue(fixture.Card); value != fixture.Value {
+			t.Errorf("Card %d is worth %d, expected %d", fixture.Card, value, fixture.Value)
+		}
+	}
+
+	for card := ElliotsOrbalStaff; card <= InactiveForce; card++ {
+		if !covered[card] {
+			t.Errorf("Card %d is not covered by the scoring fixtures", card)
+		}
+	}
+}
+
+// TestEvaluateFieldFixtures checks the score of every field in the scoring fixtures.
+func TestEvaluateFieldFixtures(t *testing.T) {
+	fixtures := loadScoreFixtures(t)
+
+	if len(fixtures.Fields) == 0 {
+		t.Fatalf("The scoring fixtures contain no fields")
+	}
+
+	for _, fixture := range fixtures.Fields {
+		t.Run(fixture.Description, func(t *testing.T) {
+			if score := EvaluateField(fixture.Field); score != fixture.Score {
+				t.Fatalf("Field %v scores %d, expected %d", fixture.Field, score, fixture.Score)
+			}
+		})
+	}
+}
@@ -7,10 +7,19 @@ package game
 
 import (
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/pkg/capacity"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
 	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
 )
 
 const (
@@ -18,16 +27,25 @@ const (
 	// BufferSize is the size of each message queue's buffer.
 	BufferSize = 2048
 
-	// How frequently to update the matchmaking queue (minimum wait between iterations).
-	pollTime = 250 * time.Millisecond
+	// How frequently to update the game server by default (minimum wait between iterations).
+	defaultPollTime = 250 * time.Millisecond
+
+	// The longest poll time that can be set with a command.
+	maximumPollTime = 2 * time.Second
 )
 
+// The maximum number of matches that can exist at the same time. Zero means that there is no limit.
+var maxConcurrentMatches = envvar.Int("max_concurrent_matches", 1000)
+
 // Server is the game server itself
 type Server struct {
 
 	// A map containing all the matches, keyed by match ID.
 	matches map[uint64]*Match
 
+	// The store used to read and write match data.
+	store database.Store
+
 	// Channel for new client's that have been successfully authenticated, and have
 	// been confirmed to eligible for a match.
 	connect chan *GClient
@@ -43,13 +61,98 @@ type Server struct {
 
 	// Channel for server commands.
 	commands chan protocol.Command
+
+	// The minimum wait between iterations of the main loop. Only accessed from the main loop.
+	pollTime time.Duration
+
+	// Channel for the results of ban sweeps - the database IDs of the players that were found to be banned.
+	bannedUsers chan []uint64
+
+	// Channel for the refreshed profiles of the players in matches that are ready to start.
+	profileRefreshes chan profileRefresh
+
+	// The time at which the next ban sweep is due, and whether one is in progress. Only accessed from the main loop.
+	nextBanSweep    time.Time
+	banSweepRunning bool
+
+	// The time limits used for new matches.
+	timeouts Timeouts
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to timeouts.
+	timeoutsLock sync.Mutex
+
+	// The stats updater through which the match stats for each player are updated once a match has a result.
+	statsUpdater apiinterface.StatsUpdater
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to statsUpdater.
+	statsUpdaterLock sync.Mutex
+
+	// The number of match stats updates that failed, and are waiting to be retried - accessed atomically.
+	pendingStatsRetries int64
+
+	// The number of match stats update attempts that have failed, and the number of updates that were abandoned -
+	// accessed atomically.
+	statsUpdateFailures   uint64
+	statsUpdatesAbandoned uint64
+
+	// How the strict move validators are applied to moves in every match. Only accessed from the main loop.
+	validationMode ValidationMode
+
+	// The card pool that the decks for every match are drawn from. Set on initialization, and never modified.
+	cardPool CardPool
+
+	// The number of messages of an unsupported type (such as binary messages) received from clients since the
+	// server started. Only accessed from the main loop.
+	unsupportedMessageCount uint64
+
+	// Gauge tracking the number of matches against the concurrent match limit. Shared with the matchmaking queue
+	// so that it can stop creating matches while the game server is full.
+	capacity *capacity.Gauge
+
+	// The number of clients that are currently in a match - updated by the main loop, and accessed atomically.
+	playerCount int64
+
+	// The ID of the match that each player is in, keyed by database ID. Rebuilt every tick, and updated as players
+	// join matches. Only accessed from the main loop.
+	activePlayers map[uint64]uint64
+
+	// The registry of active connections for each user, shared with the matchmaking server (if it is running in the
+	// same process).
+	sessions *session.Registry
+
+	// The maintenance mode switch, shared with the matchmaking server (if it is running in the same process).
+	maintenance *maintenance.Mode
+
+	// The maintenance mode state as of the last tick, so that changes can be announced. Only accessed from the main
+	// loop.
+	maintenanceEnabled      bool
+	maintenanceShutdownTime time.Time
+
+	// Channels that are subscribed to match events.
+	subscribers []chan<- Event
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to
+	// subscribers.
+	subscriberLock sync.Mutex
 }
 
-// Init initializes the game server including starting the internal loop.
-func (gs *Server) Init() {
+// Init initializes the game server including starting the internal loop. Pass in the store that should be used
+// to read and write match data, the registry of active connections for each user, and the maintenance mode switch.
+func (gs *Server) Init(store database.Store, sessions *session.Registry, mode *maintenance.Mode) {
 
-	// Initialize the matches map.
+	// Store the store, the session registry, and the maintenance mode switch - which the game server must drain
+	// before the process can exit during maintenance.
+	gs.store = store
+	gs.sessions = sessions
+	gs.maintenance = mode
+	gs.maintenance.Register(maintenanceServerName)
+
+	// Initialize the matches map, and the active players map.
 	gs.matches = make(map[uint64]*Match)
+	gs.activePlayers = make(map[uint64]uint64)
+
+	// Initialize the capacity gauge.
+	gs.capacity = capacity.NewGauge(maxConcurrentMatches)
 
 	// Initialize the various channels.
 	gs.connect = make(chan *GClient, BufferSize)
@@ -57,41 +160,91 @@ func (gs *Server) Init() {
 	gs.immediateDisconnect = make(chan DisconnectRequest, BufferSize)
 	gs.broadcast = make(chan protocol.Message, BufferSize)
 	gs.commands = make(chan protocol.Command, BufferSize)
+	gs.bannedUsers = make(chan []uint64, 1)
+	gs.profileRefreshes = make(chan profileRefresh, BufferSize)
+
+	// Set the default poll time, the default timeouts, and the default stats updater.
+	gs.pollTime = defaultPollTime
+	gs.timeouts = DefaultTimeouts()
+	gs.statsUpdater = apiinterface.APIStatsUpdater{}
+
+	// Set the move validation mode, which is configured via the "move_validation_mode" environment variable.
+	gs.validationMode = initialValidationMode(envvar.String("move_validation_mode", defaultValidationMode))
+
+	// Load the card pool, which is configured via the "card_pool" or "card_pool_file" environment variables.
+	gs.cardPool = mustLoadCardPool()
+
+	// Schedule the first ban sweep.
+	gs.nextBanSweep = time.Now().Add(banSweepPeriod)
 
 	go gs.MainLoop()
 }
 
-// NewServer creates and returns a pointer to a new game server.
-func NewServer() *Server {
+// NewServer creates and returns a pointer to a new game server, that uses the specified store, session registry and
+// maintenance mode switch.
+func NewServer(store database.Store, sessions *session.Registry, mode *maintenance.Mode) *Server {
 
 	// Create a new game server.
 	gs := Server{}
 
 	// Initialize the game server.
-	gs.Init()
+	gs.Init(store, sessions, mode)
 
 	// Return a pointer to the newly created game server.
 	return &gs
 }
 
+// Capacity returns the gauge that tracks the number of matches against the concurrent match limit.
+func (gs *Server) Capacity() *capacity.Gauge {
+	return gs.capacity
+}
+
+// MatchCount returns the number of matches that currently exist on the server. Safe to call from any goroutine.
+func (gs *Server) MatchCount() int {
+	return gs.capacity.Current()
+}
+
+// PlayerCount returns the number of clients that are currently in a match. Safe to call from any goroutine.
+func (gs *Server) PlayerCount() int {
+	return int(atomic.LoadInt64(&gs.playerCount))
+}
+
 // AddClient takes a websocket connection various data, wraps them up and adds them to the game server as a client, to be processed later.
-func (gs *Server) AddClient(wsconn *websocket.Conn, dbid uint64, pid string, displayname string, avatar uint8, matchID uint64) {
+func (gs *Server) AddClient(wsconn *websocket.Conn, dbid uint64, pid string, displayname string, avatar uint8, mmr int, matchID uint64, turnTime time.Duration, protocolVersion uint16, encoding protocol.Encoding) {
 
 	// Create a new client
-	client := NewClient(wsconn, dbid, pid, displayname, matchID, avatar, gs)
+	client := NewClient(wsconn, dbid, pid, displayname, matchID, turnTime, avatar, mmr, protocolVersion, encoding, gs)
+
+	// Register the client's connection, evicting (or refusing, depending on the policy) any matchmaking connections
+	// for the same user.
+	evict := func() {
+		gs.Remove(client, protocol.WSCDuplicateConnection, "Connected to the matchmaking server")
+	}
+
+	if !gs.sessions.Register(dbid, session.Game, client.ConnectionID(), evict) {
+		client.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCDuplicateConnection, "Already connected to the matchmaking server"))
+		log.Printf("Client [%s] (connection [%s]) was refused from the game server (already connected to the matchmaking server)", client.PublicID, client.ConnectionID())
+		return
+	}
 
 	// Add it to the connect queue.
 	gs.connect <- client
 }
 
+// Broadcast adds a message to the broadcast queue, to be sent to all connected clients.
+func (gs *Server) Broadcast(message protocol.Message) {
+	gs.broadcast <- message
+}
+
 // Remove adds a client to the disconnect queue, to be disconnected later, along with a reason code and a message.
 func (gs *Server) Remove(client *GClient, reason protocol.B2Code, message string) {
 
 	// Create a new disconnect request
 	disconnectRequest := DisconnectRequest{
-		Client:  client,
-		Reason:  reason,
-		Message: message,
+		Client:       client,
+		ConnectionID: client.ConnectionID(),
+		Reason:       reason,
+		Message:      message,
 	}
 
 	// Add it to the disconnect queue
@@ -115,12 +268,22 @@ func (gs *Server) MainLoop() {
 			select {
 			case client := <-gs.connect:
 
-				// If the match ID specified by the incoming client already exists, it should be ok to join in some fashion.
-				// Otherwise, the match needs to be created.
-				if match, ok := gs.matches[client.MatchID]; ok {
-
-					// If the game is already in play, the player cannot be added, and are booted out. Otherwise, add them to the game.
-					if match.GetPhase() >= Play {
+				// If the player is already in a different match that is still live, they are booted out, so that they
+				// can't stall one match while playing another. Otherwise, if the match ID specified by the incoming
+				// client already exists, it should be ok to join in some fashion. Otherwise, the match needs to be
+				// created.
+				if otherMatchID, ok := gs.liveMatchFor(client); ok {
+					gs.Remove(client, protocol.WSCAlreadyInMatch, "Already in another match")
+
+					log.Printf("Client [%s] (connection [%s]) was refused from match [%v] - already in match [%v]", client.PublicID, client.ConnectionID(), client.MatchID, otherMatchID)
+				} else if match, ok := gs.matches[client.MatchID]; ok {
+
+					// If the incoming connection is already registered in the match, it was somehow connected twice - ignore the
+					// duplicate, as processing it again would remove (or pair up) the connection with itself. If the game is
+					// already in play, the player cannot be added, and are booted out. Otherwise, add them to the game.
+					if client.IsSameConnection(match.Client1) || client.IsSameConnection(match.Client2) {
+						log.Printf("Ignoring duplicate connect for client [%s] (connection [%s]) in match [%v]", client.PublicID, client.ConnectionID(), client.MatchID)
+					} else if match.GetPhase() >= Play {
 						gs.Remove(client, protocol.WSCMatchFull, "Attempted to join a match which already has both clients registered")
 					} else {
 
@@ -137,7 +300,7 @@ func (gs *Server) MainLoop() {
 								// Send a message to the client informing them that they joined a match.
 								client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchJoined, "Joined match"))
 
-								log.Printf("Client [%s] joined match [%v]. Total matches: %v", client.PublicID, client.MatchID, len(gs.matches))
+								log.Printf("Client [%s] (connection [%s]) joined match [%v]. Total matches: %v", client.PublicID, client.ConnectionID(), client.MatchID, len(gs.matches))
 							} else if client.DBID == match.Client2.DBID {
 
 								// If client 2's database ID is the same as the incoming client's database ID, they are the same client, and
@@ -152,7 +315,7 @@ func (gs *Server) MainLoop() {
 								// Send a message to the client informing them that they joined a match.
 								client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchJoined, "Joined match"))
 
-								log.Printf("Client [%s] joined match [%v]. Total matches: %v", client.PublicID, client.MatchID, len(gs.matches))
+								log.Printf("Client [%s] (connection [%s]) joined match [%v]. Total matches: %v", client.PublicID, client.ConnectionID(), client.MatchID, len(gs.matches))
 							} else {
 
 								// If we reach here, client 2 is either nil or has a different database ID to the incoming client, so
@@ -162,7 +325,7 @@ func (gs *Server) MainLoop() {
 								// Send a message to the client informing them that they joined a match.
 								client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchJoined, "Joined match"))
 
-								log.Printf("Client [%s] joined match [%v]. Total matches: %v", client.PublicID, client.MatchID, len(gs.matches))
+								log.Printf("Client [%s] (connection [%s]) joined match [%v]. Total matches: %v", client.PublicID, client.ConnectionID(), client.MatchID, len(gs.matches))
 							}
 						} else if match.Client1.DBID == client.DBID {
 
@@ -178,7 +341,7 @@ func (gs *Server) MainLoop() {
 							// Send a message to the client informing them that they joined a match.
 							client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchJoined, "Joined match"))
 
-							log.Printf("Client [%s] joined match [%v]. Total matches: %v", client.PublicID, client.MatchID, len(gs.matches))
+							log.Printf("Client [%s] (connection [%s]) joined match [%v]. Total matches: %v", client.PublicID, client.ConnectionID(), client.MatchID, len(gs.matches))
 						} else {
 
 							// Finally, if we reach here, it means player 1 is valid (and is another user), and therefore we assign the
@@ -188,49 +351,72 @@ func (gs *Server) MainLoop() {
 							// Send a message to the client informing them that they joined a match.
 							client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchJoined, "Joined match"))
 
-							log.Printf("Client [%s] joined match [%v]. Total matches: %v", client.PublicID, client.MatchID, len(gs.matches))
+							log.Printf("Client [%s] (connection [%s]) joined match [%v]. Total matches: %v", client.PublicID, client.ConnectionID(), client.MatchID, len(gs.matches))
 						}
 
-						// At this stage, if both clients are now present, the match is ready to start.
-						if match.Client1 != nil && match.Client2 != nil {
+						// A user can never be paired against themselves - same user connections replace each other above, so this
+						// should not be reachable, but if it is, refuse the incoming connection rather than starting a match where
+						// one user plays both sides.
+						if match.Client1 != nil && match.Client2 != nil && match.Client1.DBID == match.Client2.DBID {
+							if client.IsSameConnection(match.Client1) {
+								match.Client1 = nil
+							} else {
+								match.Client2 = nil
+							}
 
-							// Generate the cards for this game.
-							cardsToSend := GenerateCards()
+							client.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchInvalid, "Cannot join a match against yourself"))
 
-							// Generate the initialized cards, to be set as the initial card state for the match.
-							initializedCards := InitializeCards(cardsToSend)
+							log.Printf("Client [%s] (connection [%s]) rejected from match [%v] - attempted to pair against themselves", client.PublicID, client.ConnectionID(), client.MatchID)
+						}
 
-							// Set the initial card state for the match.
-							match.State.Cards = initializedCards
+						// At this stage, if both clients are now present, the match is ready to start - once each player's
+						// display name and avatar have been refreshed, as they may have changed since the players connected.
+						if match.Client1 != nil && match.Client2 != nil {
+							match.refreshProfiles()
+						}
+					}
+				} else if gs.maintenanceEnabled {
 
-							// Set the match phase to start.
-							match.SetMatchStart()
+					// If the server is in maintenance mode, no new matches can be created, so the client is booted out.
+					// Matches that already exist can still be joined, so that they can be played to completion.
+					gs.Remove(client, protocol.WSCServerMaintenance, "Server is in maintenance")
 
-							// Send all the match data to each player.
-							match.SendCardData(cardsToSend.Serialized())
-							match.SendPlayerData()
-							match.SendOpponentData()
+					log.Printf("Client [%s] (connection [%s]) was refused from the game server (maintenance). Total matches: %v", client.PublicID, client.ConnectionID(), len(gs.matches))
+				} else if gs.capacity.AtCapacity() {
 
-							log.Printf("Match [%v] started. Total matches: %v", client.MatchID, len(gs.matches))
-						}
-					}
+					// If the server is already hosting the maximum number of matches, no more can be created, so the
+					// client is booted out.
+					gs.Remove(client, protocol.WSCServerAtCapacity, "Server is at capacity")
+
+					log.Printf("Client [%s] (connection [%s]) was refused from the game server (at capacity). Total matches: %v", client.PublicID, client.ConnectionID(), len(gs.matches))
 				} else {
 
 					// Create a new match with the client that just joined, and add it to the match map.
 					gs.matches[client.MatchID] = NewMatch(client.MatchID, client, gs)
 
+					// Update the capacity gauge.
+					gs.capacity.Set(len(gs.matches))
+
 					// Send a message to the client informing them that they joined a match.
 					client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchJoined, "Joined match"))
 
-					log.Printf("Client [%s] joined match [%v]. Total matches: %v", client.PublicID, client.MatchID, len(gs.matches))
+					log.Printf("Client [%s] (connection [%s]) joined match [%v]. Total matches: %v", client.PublicID, client.ConnectionID(), client.MatchID, len(gs.matches))
 				}
 
+				// Record the match that the player is now in, if they were added to one.
+				gs.trackActivePlayer(client)
+
 				break
 			case message := <-gs.broadcast:
 
-				// Broadcasted messages are simply broadcasted to all matches in the match map.
+				// Broadcasted messages are simply broadcasted to all clients in the match map - including clients in
+				// matches that are still waiting for players, so each client is checked.
 				for _, match := range gs.matches {
-					match.BroadCast(message)
+					for _, client := range []*GClient{match.Client1, match.Client2} {
+						if client != nil {
+							client.SendMessage(message)
+						}
+					}
 				}
 
 				break
@@ -250,34 +436,146 @@ func (gs *Server) MainLoop() {
 		}
 
 		// Tick all matches
+		now := time.Now()
 		for _, match := range gs.matches {
 
-			// only tick a match if it is current in a play state.
+			// only tick a match if it is current in a play state. Messages from clients in matches that are still
+			// waiting for players are discarded, so that their inbound queues don't fill up. Matches that have been
+			// waiting for players for too long are aborted, and matches that are stuck in play are ended. Finished
+			// matches that were never removed are cleaned up.
 			if match.GetPhase() == Play {
-				match.Tick()
+				gs.tickMatch(match)
+
+				if match.isStalled(now) {
+					match.endStalledMatch()
+				}
+			} else if match.isSetupTimedOut(now) {
+				gs.abortMatchSetup(match)
+			} else if match.GetPhase() == WaitingForPlayers {
+				match.discardInboundMessages()
+				match.sendSetupProgress(now)
+			} else if match.isLingering() {
+				gs.removeLingeringMatch(match)
 			}
 		}
 
+		// Start any matches whose players' profiles have been refreshed.
+		gs.startRefreshedMatches()
+
+		// Remove any players that were banned after they connected.
+		gs.sweepBans(now)
+
 		// Handle any pending disconnect requests.
 		gs.handleDisconnectRequests()
 
+		// Update the player count and the active players, now that any disconnected clients have been removed.
+		gs.updatePlayerCount()
+		gs.indexActivePlayers()
+
+		// Announce any change to maintenance mode, and report whether the server has drained - which it has once every
+		// match has finished.
+		gs.updateMaintenance()
+		gs.maintenance.ReportDrained(maintenanceServerName, len(gs.matches) == 0)
+
 		// Add a delay before the next iteration if the time taken is less than the designated poll time.
 		elapsed := time.Now().Sub(start)
-		remainingPollTime := pollTime - elapsed
+		remainingPollTime := gs.pollTime - elapsed
 		if remainingPollTime > 0 {
 			time.Sleep(remainingPollTime)
 		}
 	}
 }
 
+// tickMatch ticks the specified match, recovering from any panic (see recoverMatchPanic).
+func (gs *Server) tickMatch(match *Match) {
+	defer gs.recoverMatchPanic(match)
+
+	match.Tick()
+}
+
+// updatePlayerCount counts the clients in all the matches, and stores the result so that it can be read from other
+// goroutines.
+func (gs *Server) updatePlayerCount() {
+	count := 0
+	for _, match := range gs.matches {
+		if match.Client1 != nil {
+			count++
+		}
+
+		if match.Client2 != nil {
+			count++
+		}
+	}
+
+	atomic.StoreInt64(&gs.playerCount, int64(count))
+}
+
+// indexActivePlayers rebuilds the map of the match that each player is in, from the clients in all the matches.
+func (gs *Server) indexActivePlayers() {
+	gs.activePlayers = make(map[uint64]uint64, len(gs.activePlayers))
+	for _, match := range gs.matches {
+		for _, client := range []*GClient{match.Client1, match.Client2} {
+			if client != nil {
+				gs.activePlayers[client.DBID] = match.ID
+			}
+		}
+	}
+}
+
+// trackActivePlayer records the match that the specified client is in, if they are in the match for their match ID.
+func (gs *Server) trackActivePlayer(client *GClient) {
+	if match, ok := gs.matches[client.MatchID]; ok && (client.IsSameConnection(match.Client1) || client.IsSameConnection(match.Client2)) {
+		gs.activePlayers[client.DBID] = match.ID
+	}
+}
+
+// liveMatchFor returns the ID of the match that the player for the specified client is already in, and true, if it's
+// a different match to the one that they are joining, and it has not finished. The active players map can be up to a
+// tick out of date, so the match is checked to make sure that the player is still in it.
+func (gs *Server) liveMatchFor(client *GClient) (matchID uint64, ok bool) {
+	matchID, ok = gs.activePlayers[client.DBID]
+	if !ok || matchID == client.MatchID {
+		return matchID, false
+	}
+
+	match, ok := gs.matches[matchID]
+	if !ok || match.GetPhase() == Finished {
+		return matchID, false
+	}
+
+	for _, existing := range []*GClient{match.Client1, match.Client2} {
+		if existing != nil && existing.DBID == client.DBID && !existing.isPendingKill() {
+			return matchID, true
+		}
+	}
+
+	return matchID, false
+}
+
 // handleDisconnectRequests handles disconnect requests for clients in the server.
 func (gs *Server) handleDisconnectRequests() {
 
+	// Keep track of the connections that have been handled, so that a connection that was enqueued more than once
+	// (such as when the read and write pumps both fail at the same time) is only processed once.
+	handled := make(map[xid.ID]bool)
+
+	// If both players in a match have gone, make sure that the match ends as no contest, rather than whichever
+	// player's request happens to be handled first losing.
+	gs.coalesceMutualDisconnects()
+
 	// Loop while there are disconnect requests in the disconnect queue.
 	for len(gs.immediateDisconnect) > 0 {
 		select {
 		case req := <-gs.immediateDisconnect:
 
+			// Skip duplicate requests for the same connection.
+			if handled[req.ConnectionID] {
+				log.Printf("Ignoring duplicate disconnect request for client [%s] (connection [%s])", req.Client.PublicID, req.ConnectionID)
+				break
+			}
+
+			handled[req.ConnectionID] = true
+
 			// If the match exists, determine if we need to remove just the client, end the match etc.. Otherwise,
 			// just remove the client.
 			if match, ok := gs.matches[req.Client.MatchID]; ok {
@@ -288,6 +586,15 @@ func (gs *Server) handleDisconnectRequests() {
 					break
 				}
 
+				// If the connection in the request is no longer in the match (such as an old connection that was replaced
+				// by a new connection from the same user), it is stale - close it without touching the match or its result.
+				if !req.Client.IsSameConnection(match.Client1) && !req.Client.IsSameConnection(match.Client2) {
+					req.Client.Close(protocol.NewMessage(protocol.WSMTText, req.Reason, req.Message))
+
+					log.Printf("Client [%s] (connection [%s]) left the game server - stale connection - match [%d] still active", req.Client.PublicID, req.Client.ConnectionID(), match.ID)
+					break
+				}
+
 				// Set up some variables that will allow us to use the same logic regardless of whether the
 				// client that requested the disconnect was client 1 or 2.
 				initiator := req.Client
@@ -299,7 +606,7 @@ func (gs *Server) handleDisconnectRequests() {
 				var otherMessage string
 
 				// Determine which of the clients is the other client; the one that did not initiase the disconnect.
-				if match.Client1.DBID == req.Client.DBID {
+				if req.Client.IsSameConnection(match.Client1) {
 					other = match.Client2
 				} else {
 					other = match.Client1
@@ -328,6 +635,47 @@ func (gs *Server) handleDisconnectRequests() {
 						// Set the winner to the other player.
 						match.State.Winner = other.DBID
 
+						// Update the match in the database.
+						match.SetMatchResult()
+					}
+				} else if req.Reason == protocol.WSCClientFlooding {
+
+					// Flooding means that a player sent messages faster than they could be processed.
+					// Set the reason and message payloads accordingly.
+					initiatorReason = protocol.WSCClientFlooding
+					initiatorMessage = "Post-flooding forfeit quit"
+
+					otherReason = protocol.WSCMatchForfeit
+					otherMessage = "Opponent forfeited the match"
+
+					// As with disconnections, this was triggered by the websocket rather than the match, so if the
+					// match has started, the winner needs to be determined here - the flooding player loses.
+					if match.GetPhase() > WaitingForPlayers {
+
+						// Set the winner to the other player.
+						match.State.Winner = other.DBID
+
+						// Update the match in the database.
+						match.SetMatchResult()
+					}
+				} else if req.Reason == protocol.WSCAuthBanned || req.Reason == protocol.WSCDroppedByServer ||
+					req.Reason == protocol.WSCDuplicateConnection || req.Reason == protocol.WSCConnectionTimeOut {
+
+					// The player was removed by the server - because they were banned after they connected, by an
+					// operator, because they logged in to the matchmaking server (see session.Registry), or because
+					// their connection went idle. Set the reason and message payloads accordingly.
+					initiatorReason = req.Reason
+					initiatorMessage = req.Message
+
+					otherReason = protocol.WSCMatchForfeit
+					otherMessage = "Opponent forfeited the match"
+
+					// The removed player forfeits the match, so if it is in play, the winner is the other player.
+					if match.GetPhase() == Play {
+
+						// Set the winner to the other player.
+						match.State.Winner = other.DBID
+
 						// Update the match in the database.
 						match.SetMatchResult()
 					}
@@ -353,6 +701,18 @@ func (gs *Server) handleDisconnectRequests() {
 					otherReason = protocol.WSCMatchForfeit
 					otherMessage = "Opponent forfeited the match"
 
+					// Update the match in the database.
+					match.SetMatchResult()
+				} else if req.Reason == protocol.WSCUnsupportedMessageType {
+
+					// Unsupported message type means that a player sent a message that is not part of the protocol.
+					// Set the reason and message payloads accordingly.
+					initiatorReason = protocol.WSCUnsupportedMessageType
+					initiatorMessage = "Post-unsupported message forfeit quit"
+
+					otherReason = protocol.WSCMatchForfeit
+					otherMessage = "Opponent forfeited the match"
+
 					// Update the match in the database.
 					match.SetMatchResult()
 				} else if req.Reason == protocol.WSCMatchTimeOut {
@@ -380,6 +740,32 @@ func (gs *Server) handleDisconnectRequests() {
 
 					// Update the match in the database.
 					match.SetMatchResult()
+				} else if req.Reason == protocol.WSCMatchMutualTimeout {
+
+					// Mutual timeout means that both players vanished, so the match ends without a result, and
+					// neither player is penalized.
+					// Set the reason and message payloads accordingly.
+					initiatorReason = protocol.WSCMatchNoContest
+					initiatorMessage = req.Message
+
+					otherReason = protocol.WSCMatchNoContest
+					otherMessage = req.Message
+
+					// Update the match in the database, without a winner.
+					match.SetMatchNoContest()
+				} else if req.Reason == protocol.WSCMatchDraw || req.Reason == protocol.WSCMatchStateCorrupted {
+
+					// A draw means that neither player won - either the match was played out to a draw, or the
+					// match state became corrupted, and neither player can be held responsible.
+					// Set the reason and message payloads accordingly.
+					initiatorReason = req.Reason
+					initiatorMessage = req.Message
+
+					otherReason = req.Reason
+					otherMessage = req.Message
+
+					// Update the match in the database, as a draw.
+					match.SetMatchDraw()
 				} else if req.Reason == protocol.WSCMatchLoss {
 
 					// Note that this should never be reached - to declare a loss, simply declare the winner instead.
@@ -395,8 +781,30 @@ func (gs *Server) handleDisconnectRequests() {
 					otherReason = req.Reason
 					otherMessage = req.Message
 
-					// Update the match in the database.
-					match.SetMatchResult()
+					// Update the match in the database - if it is in play. A match that is still waiting for players
+					// has no result, and may be missing a client.
+					if match.GetPhase() == Play && match.Client1 != nil && match.Client2 != nil {
+						match.SetMatchResult()
+					}
+				}
+
+				// If a ranked match was started, the result will affect each player's MMR - so append a preview of the
+				// change in MMR for each player to their respective messages. The authoritative update is performed
+				// by the Blade II Online REST API. Casual matches and no contest results do not affect MMR.
+				if match.ranked && match.GetPhase() > WaitingForPlayers && match.ID != debugGameID && initiatorReason != protocol.WSCMatchNoContest {
+					client1Delta, client2Delta := match.mmrDeltas()
+					if match.Client1.DBID == initiator.DBID {
+						initiatorMessage = appendMMRDelta(initiatorMessage, client1Delta)
+						otherMessage = appendMMRDelta(otherMessage, client2Delta)
+					} else {
+						initiatorMessage = appendMMRDelta(initiatorMessage, client2Delta)
+						otherMessage = appendMMRDelta(otherMessage, client1Delta)
+					}
+				}
+
+				// If the match was started, send both players a summary of how it ended, before their close messages.
+				if match.GetPhase() > WaitingForPlayers {
+					match.sendMatchResult(endReasonFromCode(req.Reason, match.endReason))
 				}
 
 				// Once we reach this point, the match results have been written to the database, and the initiator
@@ -419,14 +827,23 @@ func (gs *Server) handleDisconnectRequests() {
 						// Close the other clients connection.
 						other.Close(protocol.NewMessage(protocol.WSMTText, otherReason, otherMessage))
 
+						// Record how the match ended, now that the result is final.
+						match.RecordAudit(req.Reason)
+
+						// Inform any subscribers that the match ended.
+						match.publishMatchEvent(EventMatchEnded, req.Reason)
+
 						// Remove the map from the match map.
 						delete(gs.matches, match.ID)
 
-						log.Printf("Client's [%s][%s] left the game server - match [%d] ended", match.Client1.PublicID, match.Client2.PublicID, match.ID)
+						// Update the capacity gauge.
+						gs.capacity.Set(len(gs.matches))
+
+						log.Printf("Client's [%s][%s] (connections [%s][%s]) left the game server - match [%d] ended", match.Client1.PublicID, match.Client2.PublicID, match.Client1.ConnectionID(), match.Client2.ConnectionID(), match.ID)
 					} else {
 
 						// Noop, as the disconnection request came from a connection that was already replaced.
-						log.Printf("Client [%s] left the game server - stale connection - match [%d] still active", initiator.PublicID, match.ID)
+						log.Printf("Client [%s] (connection [%s]) left the game server - stale connection - match [%d] still active", initiator.PublicID, initiator.ConnectionID(), match.ID)
 					}
 				} else {
 
@@ -439,7 +856,7 @@ func (gs *Server) handleDisconnectRequests() {
 						match.Client2 = nil
 					}
 
-					log.Printf("Client [%s] left the game server - match [%d] still waiting for clients", initiator.PublicID, match.ID)
+					log.Printf("Client [%s] (connection [%s]) left the game server - match [%d] still waiting for clients", initiator.PublicID, initiator.ConnectionID(), match.ID)
 				}
 			} else {
 
@@ -447,15 +864,8 @@ func (gs *Server) handleDisconnectRequests() {
 				// exist - in this case, just kill the connection.
 				req.Client.Close(protocol.NewMessage(protocol.WSMTText, req.Reason, req.Message))
 
-				log.Printf("Client [%s] left the game server (was not in match)", req.Client.PublicID)
+				log.Printf("Client [%s] (connection [%s]) left the game server (was not in match)", req.Client.PublicID, req.Client.ConnectionID())
 			}
 		}
 	}
 }
-
-// processCommand handles server commands.
-//
-// Note - not yet implemented, but prints out some diagonstics and returns with a noop.
-func (gs *Server) processCommand(command protocol.Command) {
-	log.Printf("Processing command of type [ %v ] with data [ %v ]", command.Type, command.Data)
-}
@@ -0,0 +1,247 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+	"github.com/6a/blade-ii-game-server/pkg/capacity"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+// testDeadline is how long the tests in this file wait for a message from the game server.
+const testDeadline = time.Second * 5
+
+// TestConcurrentMatchLimit sets a limit of two matches, and checks that the clients creating the first two matches join
+// them, and that the client creating a third is refused - with the gauge (which is shared with the matchmaking queue)
+// reporting that the server is at capacity.
+func TestConcurrentMatchLimit(t *testing.T) {
+	limit := maxConcurrentMatches
+	maxConcurrentMatches = 2
+	t.Cleanup(func() { maxConcurrentMatches = limit })
+
+	gs := NewServer(teststore.NewStore(), session.NewRegistry(), maintenance.NewMode(time.Minute))
+
+	// Each client is a different user, creating a different match.
+	for match := uint64(1); match <= 3; match++ {
+		conn, peer := newTestWebsocket(t)
+		gs.AddClient(conn, match, "loadtest-"+strconv.FormatUint(match, 10), "Player", 0, 0, match, 0, protocol.CurrentVersion, protocol.EncodingJSON)
+
+		if match <= 2 {
+			expectPeerMessage(t, peer, protocol.WSCMatchJoined, testDeadline)
+			continue
+		}
+
+		expectPeerMessage(t, peer, protocol.WSCServerAtCapacity, testDeadline)
+	}
+
+	if current := gs.Capacity().Current(); current != 2 {
+		t.Fatalf("Gauge reports %d matches, expected 2", current)
+	}
+
+	if !gs.Capacity().AtCapacity() {
+		t.Fatalf("Gauge does not report that the server is at capacity")
+	}
+}
+
+// TestDuplicateConnect puts the same client on the connect queue twice, and checks that the duplicate is ignored - the
+// client stays in the match (rather than being removed as a stale connection, or paired against itself), and the match
+// starts once their opponent joins.
+func TestDuplicateConnect(t *testing.T) {
+	gs := NewServer(teststore.NewStore(), session.NewRegistry(), maintenance.NewMode(time.Minute))
+
+	conn, peer := newTestWebsocket(t)
+	client := NewClient(conn, 1, "loadtest-1", "Player", 1, 0, 0, 0, protocol.CurrentVersion, protocol.EncodingJSON, gs)
+	gs.connect <- client
+	gs.connect <- client
+
+	opponentConn, opponentPeer := newTestWebsocket(t)
+	gs.AddClient(opponentConn, 2, "loadtest-2", "Player", 0, 0, 1, 0, protocol.CurrentVersion, protocol.EncodingJSON)
+
+	// The client should be sent the cards once the match starts, having only joined it once, and never been removed.
+	joined := 0
+	peer.SetReadDeadline(time.Now().Add(testDeadline))
+	for {
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read the cards: %v", err)
+		}
+
+		payload := protocol.NewPayloadFromBytes(data)
+		if payload.Code == protocol.WSCMatchData {
+			break
+		}
+
+		switch payload.Code {
+		case protocol.WSCMatchJoined:
+			joined++
+		case protocol.WSCMatchMultipleConnections, protocol.WSCMatchInvalid:
+			t.Fatalf("Client was removed from the match with code [%d]", payload.Code)
+		}
+	}
+
+	if joined != 1 {
+		t.Fatalf("Client joined the match %d times, expected once", joined)
+	}
+
+	expectPeerMessage(t, opponentPeer, protocol.WSCMatchData, testDeadline)
+}
+
+// outboundCodes returns the codes of the messages in the specified client's outbound queue, emptying it.
+func outboundCodes(client *GClient) []protocol.B2Code {
+	codes := make([]protocol.B2Code, 0)
+	for len(client.connection.OutboundMessageQueue) > 0 {
+		codes = append(codes, client.connection.GetNextOutboundMessage().Payload.Code)
+	}
+
+	return codes
+}
+
+// newRemovalTestMatch returns a match in play, as newResultTestMatch does, on a server that it has been added to, and
+// from which its clients can be removed.
+func newRemovalTestMatch(t *testing.T, store *resultRecordingStore, stats *statsRecorder) *Match {
+	t.Helper()
+
+	match := newResultTestMatch(t, store, stats)
+
+	gs := match.Server
+	gs.matches = map[uint64]*Match{match.ID: match}
+	gs.disconnect = make(chan DisconnectRequest, 4)
+	gs.immediateDisconnect = make(chan DisconnectRequest, 4)
+	gs.sessions = session.NewRegistry()
+	gs.capacity = capacity.NewGauge(0)
+
+	for _, client := range []*GClient{match.Client1, match.Client2} {
+		client.MatchID = match.ID
+		client.server = gs
+	}
+
+	return match
+}
+
+// TestDuplicateDisconnect enqueues two disconnect requests for the same connection in one tick, as when the read and
+// write pumps fail together, and checks that only the first is processed - the match ends once, with a single result,
+// and each client is only sent the result and their close message once.
+func TestDuplicateDisconnect(t *testing.T) {
+	tests := []struct {
+		name      string
+		reasons   [2]protocol.B2Code
+		initiator protocol.B2Code
+	}{
+		{"Both pumps fail", [2]protocol.B2Code{protocol.WSCUnknownConnectionError, protocol.WSCUnknownConnectionError}, protocol.WSCMatchForfeit},
+		{"Timed out, then the connection fails", [2]protocol.B2Code{protocol.WSCMatchTimeOut, protocol.WSCUnknownConnectionError}, protocol.WSCMatchTimeOut},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &resultRecordingStore{Store: teststore.NewStore()}
+			stats := &statsRecorder{}
+
+			match := newRemovalTestMatch(t, store, stats)
+			match.State.Winner = match.Client2.DBID
+
+			gs := match.Server
+
+			events := make(chan Event, 4)
+			gs.Subscribe(events)
+
+			for _, reason := range test.reasons {
+				gs.immediateDisconnect <- DisconnectRequest{Client: match.Client1, ConnectionID: match.Client1.ConnectionID(), Reason: reason}
+			}
+
+			gs.handleDisconnectRequests()
+
+			if _, ok := gs.matches[match.ID]; ok {
+				t.Fatalf("Match was not removed")
+			}
+
+			if ended := len(events); ended != 1 {
+				t.Fatalf("Match ended %d times, expected once", ended)
+			}
+
+			if codes := outboundCodes(match.Client1); !reflect.DeepEqual(codes, []protocol.B2Code{protocol.WSCMatchData, test.initiator}) {
+				t.Fatalf("Disconnected client was sent %v, expected the result and [%d]", codes, test.initiator)
+			}
+
+			if codes := outboundCodes(match.Client2); !reflect.DeepEqual(codes, []protocol.B2Code{protocol.WSCMatchData, protocol.WSCMatchForfeit}) {
+				t.Fatalf("Other client was sent %v, expected the result and [%d]", codes, protocol.WSCMatchForfeit)
+			}
+
+			waitForResults(t, store, []string{"SetMatchResult"}, stats, []apiinterface.Winner{apiinterface.Player2})
+		})
+	}
+}
+
+// TestMutualDisconnect enqueues disconnect requests for both players in one tick - connection errors from both of their
+// pumps, a mutual timeout, or both - in various orders, and checks that they all converge on a single no contest
+// result, rather than whichever request happened to be handled first deciding the winner.
+func TestMutualDisconnect(t *testing.T) {
+	const (
+		client1Error = iota
+		client2Error
+		mutualTimeout
+	)
+
+	tests := []struct {
+		name     string
+		requests []int
+	}{
+		{"Both pumps fail", []int{client1Error, client2Error}},
+		{"Both pumps fail in the other order", []int{client2Error, client1Error}},
+		{"Both time out", []int{mutualTimeout}},
+		{"Both time out, then one pump fails", []int{mutualTimeout, client2Error}},
+		{"Both pumps fail around a mutual timeout", []int{client2Error, mutualTimeout, client1Error}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &resultRecordingStore{Store: teststore.NewStore()}
+			stats := &statsRecorder{}
+
+			match := newRemovalTestMatch(t, store, stats)
+
+			gs := match.Server
+
+			events := make(chan Event, 4)
+			gs.Subscribe(events)
+
+			for _, request := range test.requests {
+				switch request {
+				case client1Error:
+					gs.immediateDisconnect <- DisconnectRequest{Client: match.Client1, ConnectionID: match.Client1.ConnectionID(), Reason: protocol.WSCUnknownConnectionError}
+				case client2Error:
+					gs.immediateDisconnect <- DisconnectRequest{Client: match.Client2, ConnectionID: match.Client2.ConnectionID(), Reason: protocol.WSCUnknownConnectionError}
+				case mutualTimeout:
+					gs.immediateDisconnect <- DisconnectRequest{Client: match.Client1, ConnectionID: match.Client1.ConnectionID(), Reason: protocol.WSCMatchMutualTimeout}
+				}
+			}
+
+			gs.handleDisconnectRequests()
+
+			if _, ok := gs.matches[match.ID]; ok {
+				t.Fatalf("Match was not removed")
+			}
+
+			if ended := len(events); ended != 1 {
+				t.Fatalf("Match ended %d times, expected once", ended)
+			}
+
+			for _, client := range []*GClient{match.Client1, match.Client2} {
+				if codes := outboundCodes(client); !reflect.DeepEqual(codes, []protocol.B2Code{protocol.WSCMatchData, protocol.WSCMatchNoContest}) {
+					t.Fatalf("Client %d was sent %v, expected the result and [%d]", client.DBID, codes, protocol.WSCMatchNoContest)
+				}
+			}
+
+			waitForResults(t, store, []string{"SetMatchNoContest"}, stats, nil)
+		})
+	}
+}
@@ -17,6 +17,18 @@ const (
 	Player2         Player = 2
 )
 
+// Opponent returns the other player - or PlayerUndecided, if the player is undecided.
+func (player Player) Opponent() Player {
+	switch player {
+	case Player1:
+		return Player2
+	case Player2:
+		return Player1
+	}
+
+	return PlayerUndecided
+}
+
 // Phase is a typedef for the different states that a match can be in.
 type Phase uint8
 
@@ -44,6 +56,10 @@ type MatchState struct {
 	Player1Score uint16
 	Player2Score uint16
 
+	// The MMR of each player at the start of the match.
+	Player1MMR int
+	Player2MMR int
+
 	// Match phase (used by the server to determine whether to, for example, tick the match or not).
 	Phase Phase
 }
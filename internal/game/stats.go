@@ -0,0 +1,26 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import "github.com/6a/blade-ii-game-server/internal/apiinterface"
+
+// SetStatsUpdater replaces the stats updater through which the match stats for each player are updated, once a match
+// has a result - such as with a mock, so that the results can be checked without the Blade II Online REST API. Safe to
+// call from any goroutine.
+func (gs *Server) SetStatsUpdater(statsUpdater apiinterface.StatsUpdater) {
+	gs.statsUpdaterLock.Lock()
+	defer gs.statsUpdaterLock.Unlock()
+
+	gs.statsUpdater = statsUpdater
+}
+
+// getStatsUpdater returns the stats updater through which the match stats for each player are updated.
+func (gs *Server) getStatsUpdater() apiinterface.StatsUpdater {
+	gs.statsUpdaterLock.Lock()
+	defer gs.statsUpdaterLock.Unlock()
+
+	return gs.statsUpdater
+}
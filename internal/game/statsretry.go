@@ -0,0 +1,137 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultStatsRetryAttempts is the default number of times that a failed match stats update is retried.
+	defaultStatsRetryAttempts = 5
+
+	// defaultStatsRetryDelay is the default delay before the first retry of a failed match stats update.
+	defaultStatsRetryDelay = time.Second * 30
+
+	// maximumStatsRetryDelay is the maximum delay between retries of a failed match stats update.
+	maximumStatsRetryDelay = time.Minute * 10
+
+	// maximumPendingStatsRetries is the maximum number of failed match stats updates that can be waiting to be retried
+	// at once - any more are abandoned.
+	maximumPendingStatsRetries = BufferSize
+)
+
+var (
+
+	// statsRetryAttempts is the number of times that a failed match stats update is retried, before it is abandoned.
+	// Configured via the "match_stats_retry_attempts" environment variable - zero disables retries.
+	statsRetryAttempts = envvar.Int("match_stats_retry_attempts", defaultStatsRetryAttempts)
+
+	// statsRetryDelay is the delay before the first retry of a failed match stats update. The delay is doubled for
+	// each subsequent retry, up to a maximum. Configured via the "match_stats_retry_delay" environment variable.
+	statsRetryDelay = envvar.Duration("match_stats_retry_delay", defaultStatsRetryDelay)
+)
+
+// statsUpdate is a match stats update, along with the number of times that it has failed.
+type statsUpdate struct {
+	matchID    uint64
+	client1ID  uint64
+	client2ID  uint64
+	client1MMR int
+	client2MMR int
+	winner     apiinterface.Winner
+	failures   int
+}
+
+// newStatsUpdate creates and returns a match stats update for the specified match, with each player's pre-match MMR,
+// and the specified winner.
+func newStatsUpdate(match *Match, winner apiinterface.Winner) statsUpdate {
+	return statsUpdate{
+		matchID:    match.ID,
+		client1ID:  match.Client1.DBID,
+		client2ID:  match.Client2.DBID,
+		client1MMR: match.State.Player1MMR,
+		client2MMR: match.State.Player2MMR,
+		winner:     winner,
+	}
+}
+
+// StatsUpdateFailures returns the number of match stats update attempts that have failed since the server started,
+// and the number of updates that were abandoned after failing too many times (or because too many were waiting to be
+// retried).
+// Safe to call from any goroutine.
+func (gs *Server) StatsUpdateFailures() (failed uint64, abandoned uint64) {
+	return atomic.LoadUint64(&gs.statsUpdateFailures), atomic.LoadUint64(&gs.statsUpdatesAbandoned)
+}
+
+// updateMatchStats sends the specified match stats update via the current stats updater. On failure, the failure is
+// counted, and the update is scheduled to be retried after a delay (see retryStatsUpdate) - or abandoned if it has
+// already been retried too many times. Blocks, so it should not be called from the main loop.
+func (gs *Server) updateMatchStats(update statsUpdate) {
+	err := gs.getStatsUpdater().UpdateMatchStats(update.client1ID, update.client2ID, update.client1MMR, update.client2MMR, update.winner)
+	if err == nil {
+		if update.failures > 0 {
+			log.Printf("Updated match stats for match [ %v ] after %v failed attempts", update.matchID, update.failures)
+		}
+
+		return
+	}
+
+	atomic.AddUint64(&gs.statsUpdateFailures, 1)
+	update.failures++
+
+	if update.failures > statsRetryAttempts {
+		gs.abandonStatsUpdate(update, err)
+		return
+	}
+
+	// Double the delay for each failure, up to the maximum.
+	delay := statsRetryDelay
+	for attempt := 1; attempt < update.failures && delay < maximumStatsRetryDelay; attempt++ {
+		delay *= 2
+	}
+
+	if delay > maximumStatsRetryDelay {
+		delay = maximumStatsRetryDelay
+	}
+
+	if !gs.retryStatsUpdate(update, delay) {
+		gs.abandonStatsUpdate(update, err)
+		return
+	}
+
+	log.Printf("Failed to update match stats for match [ %v ] (attempt %v) - retrying in %v: %s", update.matchID, update.failures, delay, err.Error())
+}
+
+// abandonStatsUpdate gives up on the specified match stats update, which failed with the specified error.
+func (gs *Server) abandonStatsUpdate(update statsUpdate, err error) {
+	atomic.AddUint64(&gs.statsUpdatesAbandoned, 1)
+
+	log.Printf("Failed to update match stats for match [ %v ] after %v attempts - giving up: %s", update.matchID, update.failures, err.Error())
+}
+
+// retryStatsUpdate schedules the specified match stats update to be retried after the specified delay, independently
+// of any other updates that are waiting to be retried. Returns false without scheduling the update if too many are
+// already waiting.
+func (gs *Server) retryStatsUpdate(update statsUpdate, delay time.Duration) bool {
+	if atomic.AddInt64(&gs.pendingStatsRetries, 1) > maximumPendingStatsRetries {
+		atomic.AddInt64(&gs.pendingStatsRetries, -1)
+		return false
+	}
+
+	time.AfterFunc(delay, func() {
+		atomic.AddInt64(&gs.pendingStatsRetries, -1)
+		gs.updateMatchStats(update)
+	})
+
+	return true
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+)
+
+// flakyStatsUpdater is a stats updater that fails the first update for each match (identified by the database ID of
+// its first client), and records the matches of the updates that succeed.
+type flakyStatsUpdater struct {
+	failed    map[uint64]bool
+	succeeded []uint64
+	lock      sync.Mutex
+}
+
+// UpdateMatchStats fails if this is the first update for the match, and records it otherwise.
+func (updater *flakyStatsUpdater) UpdateMatchStats(client1ID uint64, client2ID uint64, client1MMR int, client2MMR int, winner apiinterface.Winner) error {
+	updater.lock.Lock()
+	defer updater.lock.Unlock()
+
+	if !updater.failed[client1ID] {
+		updater.failed[client1ID] = true
+		return errors.New("stats API unavailable")
+	}
+
+	updater.succeeded = append(updater.succeeded, client1ID)
+	return nil
+}
+
+// Succeeded returns the matches of the updates that succeeded, in order.
+func (updater *flakyStatsUpdater) Succeeded() []uint64 {
+	updater.lock.Lock()
+	defer updater.lock.Unlock()
+
+	return append([]uint64(nil), updater.succeeded...)
+}
+
+// TestStatsRetryOrder fails an update that has already failed a few times, and so is retried after a long delay, and
+// then a fresh update that is retried after a short delay - and checks that the later update is retried first, rather
+// than waiting behind the earlier one.
+func TestStatsRetryOrder(t *testing.T) {
+	delay := statsRetryDelay
+	t.Cleanup(func() {
+		statsRetryDelay = delay
+	})
+
+	statsRetryDelay = time.Millisecond * 20
+
+	updater := &flakyStatsUpdater{failed: make(map[uint64]bool)}
+
+	server := &Server{}
+	server.SetStatsUpdater(updater)
+
+	// The first update is retried after 8 times the initial delay, and the second after the initial delay.
+	server.updateMatchStats(statsUpdate{matchID: 1, client1ID: 1, client2ID: 2, failures: 3})
+	server.updateMatchStats(statsUpdate{matchID: 2, client1ID: 3, client2ID: 4})
+
+	for end := time.Now().Add(testDeadline); len(updater.Succeeded()) < 2; time.Sleep(time.Millisecond * 10) {
+		if time.Now().After(end) {
+			t.Fatalf("Updates were not retried within [%v]", testDeadline)
+		}
+	}
+
+	if succeeded := updater.Succeeded(); !reflect.DeepEqual(succeeded, []uint64{3, 1}) {
+		t.Fatalf("Updates for clients %v succeeded, expected the update for client 3 before the update for client 1", succeeded)
+	}
+
+	if failed, abandoned := server.StatsUpdateFailures(); failed != 2 || abandoned != 0 {
+		t.Fatalf("Server counted [%d] failures and [%d] abandoned updates, expected 2 failures and none abandoned", failed, abandoned)
+	}
+}
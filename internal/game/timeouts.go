@@ -0,0 +1,46 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import "time"
+
+// Timeouts are the time limits used by the game server for new matches. They default to the values configured via the
+// environment (see DefaultTimeouts), and can be replaced with SetTimeouts - such as to shorten them for tests.
+type Timeouts struct {
+
+	// The maximum time to wait for a move, for matches that were created without a turn time.
+	TurnMaxWait time.Duration
+
+	// The extra time that is added to the wait timer for the first turn, unless one is configured for the match's time
+	// control (see drawDelayForTurnTime).
+	CardDrawDelay time.Duration
+}
+
+// DefaultTimeouts returns the timeouts configured via the "turn_max_wait" and "card_draw_delay" environment
+// variables, or their defaults.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		TurnMaxWait:   defaultTurnMaxWait,
+		CardDrawDelay: cardDrawDelay,
+	}
+}
+
+// SetTimeouts replaces the timeouts used for new matches. Matches that have already been created keep the timeouts
+// that they started with. Safe to call from any goroutine.
+func (gs *Server) SetTimeouts(timeouts Timeouts) {
+	gs.timeoutsLock.Lock()
+	defer gs.timeoutsLock.Unlock()
+
+	gs.timeouts = timeouts
+}
+
+// getTimeouts returns the timeouts used for new matches.
+func (gs *Server) getTimeouts() Timeouts {
+	gs.timeoutsLock.Lock()
+	defer gs.timeoutsLock.Unlock()
+
+	return gs.timeouts
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/debuglog"
+)
+
+// Reasons for which the turn timer can be reset, for debug logging.
+const (
+	turnTimerReasonFirstDraw     = "first-draw"
+	turnTimerReasonClientsLoaded = "clients-loaded"
+	turnTimerReasonNormal        = "normal"
+	turnTimerReasonBlast         = "blast"
+	turnTimerReasonTied          = "tied"
+)
+
+// logTurnTimerReset writes a debug log line recording that the turn timer was reset, with the period it was reset to
+// and the reason it was reset.
+func (match *Match) logTurnTimerReset(period time.Duration, reason string) {
+	debuglog.Printf("Match [ %v ] turn timer reset to [%v] (%s)", match.ID, period, reason)
+}
+
+// logTurnTimeout writes a debug log line recording that the turn timer fired, with the player(s) that timed out and
+// the time at which a move was last received from each of them.
+func (match *Match) logTurnTimeout() {
+	debuglog.Printf("Match [ %v ] turn timer fired - player 1 waiting [%v] last move [%v], player 2 waiting [%v] last move [%v], turn [%v]",
+		match.ID, match.Client1.WaitingForMove, formatLastMoveTime(match.client1LastMoveTime),
+		match.Client2.WaitingForMove, formatLastMoveTime(match.client2LastMoveTime), match.State.Turn)
+}
+
+// setLastMoveTime records the time at which a move was received from the specified player.
+func (match *Match) setLastMoveTime(player Player, moveTime time.Time) {
+	if player == Player1 {
+		match.client1LastMoveTime = moveTime
+	} else {
+		match.client2LastMoveTime = moveTime
+	}
+}
+
+// formatLastMoveTime is a helper function that formats a last move time for logging, as the time elapsed since the
+// move was received.
+func formatLastMoveTime(moveTime time.Time) string {
+	if moveTime.IsZero() {
+		return "never"
+	}
+
+	return time.Since(moveTime).Round(time.Millisecond).String() + " ago"
+}
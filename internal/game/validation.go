@@ -0,0 +1,278 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package game implements the Blade II Online game server.
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+// ValidationMode is an enum type that represents how the strict move validators are applied (see
+// passesStrictValidation). The basic validation that is part of applying a move is always enforced.
+type ValidationMode uint8
+
+// Validation mode enums.
+const (
+
+	// ValidationEnforce treats moves that fail the strict validators as illegal.
+	ValidationEnforce ValidationMode = 0
+
+	// ValidationShadow logs moves that fail the strict validators, but accepts them as usual.
+	ValidationShadow ValidationMode = 1
+
+	// ValidationOff does not run the strict validators.
+	ValidationOff ValidationMode = 2
+)
+
+const (
+
+	// defaultValidationMode is the default validation mode. Shadow mode is used, so that the strict validators can be
+	// checked for false positives before they are enforced.
+	defaultValidationMode = "shadow"
+
+	// shadowLogLimit is the maximum number of shadow rejections logged for each match per shadowLogPeriod. Any more
+	// are counted, and the count is included in the next rejection that is logged.
+	shadowLogLimit = 5
+
+	// shadowLogPeriod is the period over which shadowLogLimit applies.
+	shadowLogPeriod = time.Minute
+)
+
+// Errors returned by the strict move validators, describing why a move would be rejected.
+var (
+	ErrDrawNotFromDeck     = errors.New("Drawn card is not the top card of the deck")
+	ErrUnexpectedPayload   = errors.New("Move has a payload, but is not a blast")
+	ErrNonCanonicalPayload = errors.New("Blast target is not in the canonical format")
+)
+
+// strictValidators are the checks that are applied to each move (before the state is updated) according to the
+// validation mode, on top of the basic validation. Each returns an error describing why the move would be rejected,
+// or nil if the move passes.
+var strictValidators = []func(match *Match, player Player, move Move) error{
+	validateDrawFromDeck,
+	validateMovePayload,
+}
+
+// String returns the name of the validation mode.
+func (mode ValidationMode) String() string {
+	switch mode {
+	case ValidationEnforce:
+		return "enforce"
+	case ValidationShadow:
+		return "shadow"
+	case ValidationOff:
+		return "off"
+	}
+
+	return "unknown"
+}
+
+// validationModeFromString returns the validation mode with the specified name ("enforce", "shadow" or "off"). Returns
+// false if there is no such mode.
+func validationModeFromString(name string) (mode ValidationMode, ok bool) {
+	for _, mode := range []ValidationMode{ValidationEnforce, ValidationShadow, ValidationOff} {
+		if mode.String() == name {
+			return mode, true
+		}
+	}
+
+	return ValidationEnforce, false
+}
+
+// initialValidationMode returns the validation mode configured via the "move_validation_mode" environment variable,
+// falling back to the default for unknown modes.
+func initialValidationMode(name string) ValidationMode {
+	if mode, ok := validationModeFromString(name); ok {
+		return mode
+	}
+
+	log.Printf("Unknown move validation mode [%s] - falling back to [%s]", name, defaultValidationMode)
+
+	mode, _ := validationModeFromString(defaultValidationMode)
+	return mode
+}
+
+// shadowRejection is the structured log entry for a move that would have been rejected by the strict validators in
+// shadow mode.
+type shadowRejection struct {
+	Event      string      `json:"event"`
+	MatchID    uint64      `json:"matchid"`
+	Client     string      `json:"client"`
+	Player     Player      `json:"player"`
+	Move       shadowMove  `json:"move"`
+	Reasons    []string    `json:"reasons"`
+	Turn       Player      `json:"turn"`
+	Scores     [2]uint16   `json:"scores"`
+	Cards      loggedCards `json:"cards"`
+	Suppressed int         `json:"suppressed,omitempty"`
+}
+
+// shadowMove is the move in a shadow rejection log entry.
+type shadowMove struct {
+	Instruction int    `json:"instruction"`
+	Payload     string `json:"payload"`
+}
+
+// loggedCards is the state of the cards in a structured log entry (such as a shadow rejection, or a diagnostic dump). The
+// cards are stored as ints, as slices of cards would otherwise be encoded as base64 strings.
+type loggedCards struct {
+	Player1Deck    []int `json:"p1deck"`
+	Player1Hand    []int `json:"p1hand"`
+	Player1Field   []int `json:"p1field"`
+	Player1Discard []int `json:"p1discard"`
+	Player2Deck    []int `json:"p2deck"`
+	Player2Hand    []int `json:"p2hand"`
+	Player2Field   []int `json:"p2field"`
+	Player2Discard []int `json:"p2discard"`
+}
+
+// passesStrictValidation runs the strict validators against the specified move, made by the specified client, before
+// it is applied. Returns false only if a validator fails while the validation mode is enforce - in shadow mode, the
+// failure is logged (see logShadowRejection), and the move is accepted as usual.
+func (match *Match) passesStrictValidation(client *GClient, player Player, move Move) bool {
+	mode := match.Server.validationMode
+	if mode == ValidationOff {
+		return true
+	}
+
+	// Collect the reasons for which the move would be rejected.
+	reasons := make([]string, 0)
+	for _, validate := range strictValidators {
+		if err := validate(match, player, move); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+
+	if len(reasons) == 0 {
+		return true
+	}
+
+	if mode == ValidationEnforce {
+		log.Printf("Match [ %v ] rejected a move from client [%s] after strict validation: %v", match.ID, client.PublicID, reasons)
+		return false
+	}
+
+	match.logShadowRejection(client, player, move, reasons)
+
+	return true
+}
+
+// logShadowRejection writes a structured (JSON) log entry for a move that would have been rejected by the strict
+// validators, with the full state of the match before the move. Rate limited per match - rejections beyond the limit
+// are counted, and the count is included in the next entry that is logged.
+func (match *Match) logShadowRejection(client *GClient, player Player, move Move, reasons []string) {
+
+	// Start a new rate limiting period if the last one has elapsed.
+	now := time.Now()
+	if now.Sub(match.shadowLogPeriodStart) >= shadowLogPeriod {
+		match.shadowLogPeriodStart = now
+		match.shadowLogCount = 0
+	}
+
+	if match.shadowLogCount >= shadowLogLimit {
+		match.shadowLogSuppressed++
+		return
+	}
+
+	match.shadowLogCount++
+
+	entry := shadowRejection{
+		Event:      "shadow_rejection",
+		MatchID:    match.ID,
+		Client:     client.PublicID,
+		Player:     player,
+		Move:       shadowMove{Instruction: int(move.Instruction), Payload: move.Payload},
+		Reasons:    reasons,
+		Turn:       match.State.Turn,
+		Scores:     [2]uint16{match.State.Player1Score, match.State.Player2Score},
+		Cards:      newLoggedCards(&match.State.Cards),
+		Suppressed: match.shadowLogSuppressed,
+	}
+
+	match.shadowLogSuppressed = 0
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Match [ %v ] failed to encode a shadow rejection: %s", match.ID, err.Error())
+		return
+	}
+
+	log.Printf("%s", data)
+}
+
+// validateDrawFromDeck checks that a draw onto the field while the turn is undecided is the top card of the player's
+// deck. Draws from the hand (once the deck is empty) are checked when the move is applied.
+func validateDrawFromDeck(match *Match, player Player, move Move) error {
+	if match.State.Turn != PlayerUndecided {
+		return nil
+	}
+
+	deck := match.State.Cards.Player1Deck
+	if player == Player2 {
+		deck = match.State.Cards.Player2Deck
+	}
+
+	if len(deck) > 0 && move.Instruction.ToCard() != last(deck) {
+		return ErrDrawNotFromDeck
+	}
+
+	return nil
+}
+
+// validateMovePayload checks that only a blast that has its effect activated has a payload, and that the payload is
+// the target card in the canonical format (a plain decimal number, with no sign or leading zeros).
+func validateMovePayload(match *Match, player Player, move Move) error {
+
+	// Determine whether the move is a blast that targets a card in the opponent's hand, as the move is applied.
+	opponentHand := match.State.Cards.Player2Hand
+	if player == Player2 {
+		opponentHand = match.State.Cards.Player1Hand
+	}
+
+	targeted := move.Instruction.ToCard() == Blast && match.State.Turn != PlayerUndecided && len(opponentHand) > 0
+
+	if !targeted {
+		if move.Payload != "" {
+			return ErrUnexpectedPayload
+		}
+
+		return nil
+	}
+
+	// The target itself is checked when the move is applied - only the format is checked here.
+	if target, err := strconv.Atoi(move.Payload); err == nil && strconv.Itoa(target) != move.Payload {
+		return ErrNonCanonicalPayload
+	}
+
+	return nil
+}
+
+// newLoggedCards returns the specified cards, in the format used for structured log entries.
+func newLoggedCards(cards *Cards) loggedCards {
+	return loggedCards{
+		Player1Deck:    cardInts(cards.Player1Deck),
+		Player1Hand:    cardInts(cards.Player1Hand),
+		Player1Field:   cardInts(cards.Player1Field),
+		Player1Discard: cardInts(cards.Player1Discard),
+		Player2Deck:    cardInts(cards.Player2Deck),
+		Player2Hand:    cardInts(cards.Player2Hand),
+		Player2Field:   cardInts(cards.Player2Field),
+		Player2Discard: cardInts(cards.Player2Discard),
+	}
+}
+
+// cardInts is a helper function that returns the specified cards as ints.
+func cardInts(cards []Card) []int {
+	ints := make([]int, len(cards))
+	for index, card := range cards {
+		ints[index] = int(card)
+	}
+
+	return ints
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// captureLog redirects the standard logger to a buffer until the test finishes, and returns the buffer.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	return &buffer
+}
+
+// shadowRejections returns the shadow rejections in the specified log output.
+func shadowRejections(t *testing.T, output string) []shadowRejection {
+	t.Helper()
+
+	rejections := make([]shadowRejection, 0)
+	for _, line := range strings.Split(output, "\n") {
+		start := strings.Index(line, `{"event":"shadow_rejection"`)
+		if start < 0 {
+			continue
+		}
+
+		var rejection shadowRejection
+		if err := json.Unmarshal([]byte(line[start:]), &rejection); err != nil {
+			t.Fatalf("Malformed shadow rejection [%s]: %v", line[start:], err)
+		}
+
+		rejections = append(rejections, rejection)
+	}
+
+	return rejections
+}
+
+// TestValidationModes makes the same move - one that passes the basic validation, but fails the strict validators -
+// under each validation mode, and checks that the player is removed for an illegal move in enforce mode, that the move
+// is accepted and logged in shadow mode, and that it is accepted silently when validation is off.
+func TestValidationModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     ValidationMode
+		accepted bool
+		logged   bool
+	}{
+		{"Enforce", ValidationEnforce, false, false},
+		{"Shadow", ValidationShadow, true, true},
+		{"Off", ValidationOff, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := captureLog(t)
+
+			match := newAutoPlayTestMatch(t, midMatchState(GaiusSpear, FiesTwinGunswords), 0)
+			match.Server.validationMode = test.mode
+
+			// Gaius' spear is legal for player 2, but isn't a blast, so mustn't have a payload.
+			match.Client2.connection.InboundMessageQueue <- protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|6:5")
+			match.Tick()
+
+			if accepted := match.moveCount == 1; accepted != test.accepted {
+				t.Fatalf("Move accepted is %v, expected %v", accepted, test.accepted)
+			}
+
+			if !test.accepted {
+				if request := <-match.Server.disconnect; request.Client != match.Client2 || request.Reason != protocol.WSCMatchIllegalMove {
+					t.Fatalf("Client %d was removed with reason [%d], expected client 2 with reason [%d]", request.Client.DBID, request.Reason, protocol.WSCMatchIllegalMove)
+				}
+			} else if len(match.Server.disconnect) > 0 {
+				t.Fatalf("Client was removed after an accepted move")
+			}
+
+			rejections := shadowRejections(t, output.String())
+			if logged := len(rejections) > 0; logged != test.logged {
+				t.Fatalf("Shadow rejections %+v were logged, expected any: %v", rejections, test.logged)
+			}
+
+			if test.logged {
+				rejection := rejections[0]
+				if rejection.MatchID != match.ID || rejection.Player != Player2 || rejection.Move != (shadowMove{Instruction: int(CardGaiusSpear), Payload: "5"}) || !reflect.DeepEqual(rejection.Reasons, []string{ErrUnexpectedPayload.Error()}) {
+					t.Fatalf("Logged shadow rejection %+v, expected player 2's move [6:5] in match [%d] to be rejected as [%v]", rejection, match.ID, ErrUnexpectedPayload)
+				}
+
+				// The state is logged as it was before the move.
+				if !reflect.DeepEqual(rejection.Cards.Player2Hand, []int{int(GaiusSpear), int(FiesTwinGunswords)}) {
+					t.Fatalf("Logged player 2's hand as %v, expected it before the move", rejection.Cards.Player2Hand)
+				}
+			}
+		})
+	}
+}
+
+// TestShadowLogRateLimit logs more shadow rejections than the limit for a match, and checks that the rest are counted,
+// and that the count is included in the first entry that is logged once the period has elapsed.
+func TestShadowLogRateLimit(t *testing.T) {
+	output := captureLog(t)
+
+	match := newAutoPlayTestMatch(t, midMatchState(GaiusSpear), 0)
+	move := Move{Instruction: CardGaiusSpear, Payload: "5"}
+
+	for count := 0; count < shadowLogLimit+2; count++ {
+		match.logShadowRejection(match.Client2, Player2, move, []string{ErrUnexpectedPayload.Error()})
+	}
+
+	if logged := len(shadowRejections(t, output.String())); logged != shadowLogLimit {
+		t.Fatalf("Logged %d shadow rejections, expected %d", logged, shadowLogLimit)
+	}
+
+	output.Reset()
+	match.shadowLogPeriodStart = time.Now().Add(-shadowLogPeriod)
+	match.logShadowRejection(match.Client2, Player2, move, []string{ErrUnexpectedPayload.Error()})
+
+	if rejections := shadowRejections(t, output.String()); len(rejections) != 1 || rejections[0].Suppressed != 2 {
+		t.Fatalf("Logged %+v once the period elapsed, expected a single entry with 2 suppressed", rejections)
+	}
+}
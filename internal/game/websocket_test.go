@@ -0,0 +1,96 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package game
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/6a/blade-ii-game-server/internal/connection"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// newTestWebsocket returns both ends of a real websocket - the server side, as the game server would be given it, and
+// the peer (client) side. Both are closed when the test finishes.
+func newTestWebsocket(t *testing.T) (conn *websocket.Conn, peer *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade the connection: %v", err)
+			return
+		}
+
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial the test server: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	conn = <-conns
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, peer
+}
+
+// expectPeerMessage reads messages from the specified peer until one with the specified code arrives, and fails the
+// test if it doesn't arrive before the deadline.
+func expectPeerMessage(t *testing.T, peer *websocket.Conn, code protocol.B2Code, deadline time.Duration) protocol.Payload {
+	t.Helper()
+
+	peer.SetReadDeadline(time.Now().Add(deadline))
+	for {
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read a message with code [%d]: %v", code, err)
+		}
+
+		if payload := protocol.NewPayloadFromBytes(data); payload.Code == code {
+			return payload
+		}
+	}
+}
+
+// newTestClient returns a client whose connection is the server side of a real websocket, without starting its message
+// pumps - so that queued messages are only written when the test writes them (see writeNext).
+func newTestClient(t *testing.T) *GClient {
+	t.Helper()
+
+	conn, peer := newTestWebsocket(t)
+
+	// Read (and discard) everything that is written to the peer, so that writes never block.
+	go func() {
+		for {
+			if _, _, err := peer.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return &GClient{connection: connection.NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON)}
+}
+
+// writeNext writes the next message in the specified client's outbound queue to their websocket, as their send pump
+// would.
+func writeNext(t *testing.T, client *GClient) {
+	t.Helper()
+
+	if err := client.connection.WriteMessage(client.connection.GetNextOutboundMessage()); err != nil {
+		t.Fatalf("Failed to write a message: %v", err)
+	}
+}
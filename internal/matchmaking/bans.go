@@ -0,0 +1,90 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// defaultBanSweepPeriod is the default period between checks for clients that were banned after they connected.
+const defaultBanSweepPeriod = time.Minute * 3
+
+// banSweepPeriod is the period between checks for clients that were banned after they connected. Configured via the
+// "ban_sweep_period" environment variable.
+var banSweepPeriod = envvar.Duration("ban_sweep_period", defaultBanSweepPeriod)
+
+// sweepBans removes any clients that the most recent ban sweep found to be banned, and starts the next ban sweep if
+// it's due. The sweep queries the store in its own goroutine, so that the main loop isn't held up by the database.
+// Only called from the main loop.
+func (queue *Queue) sweepBans(now time.Time) {
+
+	// Remove the clients that were found to be banned, if the sweep in progress has finished. A banned client that is
+	// ready checking drops out of the ready check, in the same way as a client that disconnected.
+	select {
+	case banned := <-queue.bannedUsers:
+		for _, databaseID := range banned {
+			if queue.removeUser(databaseID, protocol.WSCAuthBanned, "Account banned") {
+				log.Printf("User [%d] was removed from the matchmaking queue after being banned", databaseID)
+			}
+		}
+
+		queue.banSweepRunning = false
+	default:
+	}
+
+	// Early exit if a sweep is still in progress, the next sweep isn't due yet, or there is nobody to check.
+	if queue.banSweepRunning || now.Before(queue.nextBanSweep) {
+		return
+	}
+
+	queue.nextBanSweep = now.Add(banSweepPeriod)
+
+	if len(queue.queue)+len(queue.idle) == 0 {
+		return
+	}
+
+	// Collect the database IDs of every client in the queue, and every idle client.
+	databaseIDs := make([]uint64, 0, len(queue.queue)+len(queue.idle))
+	for databaseID := range queue.queue {
+		databaseIDs = append(databaseIDs, databaseID)
+	}
+
+	for databaseID := range queue.idle {
+		databaseIDs = append(databaseIDs, databaseID)
+	}
+
+	// Check which of them are banned. The result is always sent, so that the next sweep can start.
+	queue.banSweepRunning = true
+	go func() {
+		banned, err := queue.store.GetBannedAmong(databaseIDs)
+		if err != nil {
+			log.Printf("Ban sweep failed: %s", err.Error())
+		}
+
+		queue.bannedUsers <- banned
+	}()
+}
+
+// removeUser removes the specified user from the queue (or disconnects them if they are idle), with the specified
+// reason and message. Returns false if the user is not connected. Only called from the main loop.
+func (queue *Queue) removeUser(databaseID uint64, reason protocol.B2Code, message string) bool {
+	client, ok := queue.queue[databaseID]
+	if !ok {
+		client, ok = queue.idle[databaseID]
+	}
+
+	if !ok || client.isPendingKill() {
+		return false
+	}
+
+	queue.Remove(client, reason, message)
+
+	return true
+}
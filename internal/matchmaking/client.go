@@ -10,20 +10,27 @@ import (
 	"time"
 
 	"github.com/6a/blade-ii-game-server/internal/connection"
+	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
 )
 
-// closeWaitPeriod is the time to wait between sending a close message, and closing a websocket.
-const closeWaitPeriod = time.Second * 1
-
 // MMClient is a container for a websocket connection and its associate player data.
 type MMClient struct {
 
 	// Database values for this client.
-	DBID     uint64
-	PublicID string
-	MMR      int
+	DBID        uint64
+	PublicID    string
+	DisplayName string
+	Avatar      uint8
+	MMR         int
+
+	// The region hint specified by the client - empty if the client has no region preference.
+	Region string
+
+	// The time at which the client joined the matchmaking queue.
+	JoinTime time.Time
 
 	// Whether the client is ready (for ready checking).
 	Ready bool
@@ -37,6 +44,35 @@ type MMClient struct {
 	// Whether the other client is ready (for ready checking).
 	AcceptMessageSentToOpponent bool
 
+	// Whether the client has responded to the match found message, either by acknowledging or accepting it (for
+	// ready checking).
+	MatchFoundAcknowledged bool
+
+	// The number of times the match found message has been resent to this client, and the time at which it was last
+	// sent (for ready checking).
+	matchFoundResends  int
+	matchFoundSentTime time.Time
+
+	// Whether the client is prioritized for matchmaking, because their last ready check failed through no fault of
+	// their own. Cleared once they are in a match that goes ahead.
+	priority bool
+
+	// The time at which this client was first seen to have vanished from the queue during a ready check - zero if it
+	// hasn't (for ready checking).
+	vanishedTime time.Time
+
+	// The time at which the client left the queue - only meaningful while they are idle.
+	idleSince time.Time
+
+	// The client's recent opponents, as read from the database when they connected. Merged into the queue's recent
+	// opponents when they join it.
+	recentOpponents []recentOpponent
+
+	// Whether a preview of the client (their display name, avatar and MMR) can be shown to their opponents, and whether
+	// they have chosen to hide their MMR in it. Set when they connect (see lookupPreview).
+	previewAvailable bool
+	mmrHidden        bool
+
 	// A pointer to the websocket connection for this client.
 	connection *connection.Connection
 
@@ -75,6 +111,20 @@ func (client *MMClient) pollReceive() {
 			break
 		}
 
+		// If the client sent messages faster than they could be processed, remove this client from the server
+		// and break out of the loop.
+		if err == connection.ErrFlooding {
+			client.queue.Remove(client, protocol.WSCClientFlooding, err.Error())
+			break
+		}
+
+		// If the client hasn't sent any messages for too long, remove this client from the server and break out of the
+		// loop.
+		if err == connection.ErrIdleTimeout {
+			client.queue.Remove(client, protocol.WSCConnectionTimeOut, err.Error())
+			break
+		}
+
 		// If the read function returned an error, remove this client from the server and
 		// break out of the loop.
 		if err != nil {
@@ -97,8 +147,13 @@ func (client *MMClient) pollSend() {
 		err := client.connection.WriteMessage(message)
 
 		// If the client is pending kill (most likely due to being terminated by another thread)
-		// break out of the loop without doing anything.
+		// break out of the loop without doing anything - unless there are more messages queued, such
+		// as the message explaining why the client was removed, in which case keep writing until they are sent.
 		if client.isPendingKill() {
+			if err == nil && len(client.connection.OutboundMessageQueue) > 0 {
+				continue
+			}
+
 			break
 		}
 
@@ -126,10 +181,51 @@ func (client *MMClient) Tick() {
 		if message.Payload.Code == protocol.WSCMatchMakingAccept {
 			client.Ready = true
 			client.ReadyTime = time.Now()
+			client.MatchFoundAcknowledged = true
+		} else if message.Payload.Code == protocol.WSCMatchFoundAck {
+
+			// If the message was an acknowledgement of the match found message, stop resending it.
+			client.MatchFoundAcknowledged = true
+		} else if message.Payload.Code == protocol.WSCRecentMatchesRequest {
+
+			// If the message was a request for recent matches, fetch and send them without blocking.
+			client.sendRecentMatches()
+		} else if message.Payload.Code == protocol.WSCLeaveQueue {
+
+			// If the message was a request to leave the queue, remove the client from it, keeping the connection open.
+			client.queue.leaveQueue(client)
+		} else if message.Payload.Code == protocol.WSCRejoinQueue {
+
+			// If the message was a request to rejoin the queue (after leaving it), add the client back to the queue,
+			// with the region hint in the message (if any).
+			client.queue.rejoinQueue(client, message.Payload.Message)
 		}
 	}
 }
 
+// resetReadyCheck resets the ready checking state for this client, so that they can be paired again.
+func (client *MMClient) resetReadyCheck() {
+	client.IsReadyChecking = false
+	client.Ready = false
+	client.MatchFoundAcknowledged = false
+	client.AcceptMessageSentToOpponent = false
+}
+
+// matchPlayer returns the client's database ID, display name, avatar and MMR, to be stored with a match.
+func (client *MMClient) matchPlayer() database.MatchPlayer {
+	return database.MatchPlayer{
+		DatabaseID:  client.DBID,
+		DisplayName: client.DisplayName,
+		Avatar:      client.Avatar,
+		MMR:         client.MMR,
+	}
+}
+
+// ConnectionID returns the unique ID of the client's underlying connection.
+func (client *MMClient) ConnectionID() xid.ID {
+	return client.connection.UUID
+}
+
 // SendMessage adds a message to the outbound queue.
 func (client *MMClient) SendMessage(message protocol.Message) {
 
@@ -137,25 +233,30 @@ func (client *MMClient) SendMessage(message protocol.Message) {
 	client.connection.SendMessage(message)
 }
 
-// Close sends a message to the client, and closes the connection after a delay.
-// The delay is asynchronous, as it is wrapped in a goroutine.
+// Close sends a message to the client, and closes the connection with a close handshake after a delay.
+// The delay is asynchronous, so this does not block.
 func (client *MMClient) Close(message protocol.Message) {
 
 	// Send the specified message to the client.
 	client.SendMessage(message)
 
+	// The connection is no longer active, so remove it from the session registry.
+	client.unregisterSession()
+
 	// Using the client kill lock mutex to avoid race conditions, set pendingKill
 	// to true, so that the next read/writes cause their respective pumps to exit.
 	client.killLock.Lock()
 	client.pendingKill = true
 	client.killLock.Unlock()
 
-	// Spin up a goroutine, which sleeps for a set amount for a set amount of time before closing
-	// the websocket connection.
-	go func() {
-		time.Sleep(closeWaitPeriod)
-		client.connection.WS.Close()
-	}()
+	// Close the websocket connection once the close wait period has elapsed, without blocking.
+	client.connection.CloseAfterWait(message)
+}
+
+// unregisterSession removes the client's connection from the session registry, so that the user can connect to the
+// game server without it counting as a duplicate login. Noop if it was already removed.
+func (client *MMClient) unregisterSession() {
+	client.queue.sessions.Unregister(client.DBID, client.ConnectionID())
 }
 
 // isPendingKill is a helper function that returns true if this client is due to be killed.
@@ -174,14 +275,17 @@ func (client *MMClient) isPendingKill() bool {
 
 // NewClient creates a and retruns a pointer to a new Client, and starts its
 // message pumps in two seperate go routines.
-func NewClient(wsconn *websocket.Conn, dbid uint64, pid string, mmr int, queue *Queue) *MMClient {
-	connection := connection.NewConnection(wsconn)
+func NewClient(wsconn *websocket.Conn, dbid uint64, pid string, displayname string, avatar uint8, mmr int, region string, protocolVersion uint16, encoding protocol.Encoding, queue *Queue) *MMClient {
+	connection := connection.NewConnection(wsconn, protocolVersion, encoding)
 	client := &MMClient{
-		connection: connection,
-		DBID:       dbid,
-		PublicID:   pid,
-		MMR:        mmr,
-		queue:      queue,
+		connection:  connection,
+		DBID:        dbid,
+		PublicID:    pid,
+		DisplayName: displayname,
+		Avatar:      avatar,
+		MMR:         mmr,
+		Region:      region,
+		queue:       queue,
 	}
 
 	// Start the event loop for the new client.
@@ -12,6 +12,23 @@ import (
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 )
 
+const (
+
+	// matchConfirmedDelimiter is the delimiter used to separate the match ID and opponent region in a match
+	// confirmation.
+	matchConfirmedDelimiter = ":"
+
+	// matchFoundDelimiter is the delimiter used to separate the opponent data in a match found message.
+	matchFoundDelimiter = "."
+
+	// matchFoundResendInterval is the time to wait for a client to respond to a match found message, before it is
+	// resent.
+	matchFoundResendInterval = time.Second * 3
+
+	// maximumMatchFoundResends is the maximum number of times that a match found message is resent to a client.
+	maximumMatchFoundResends = 2
+)
+
 // ClientPair is a light wrapper for a pair of client connections.
 type ClientPair struct {
 
@@ -36,7 +53,7 @@ func NewPair(client1 *MMClient, client2 *MMClient) *ClientPair {
 	}
 }
 
-// SendMatchFoundMessage sends a match found message to both clients.
+// SendMatchFoundMessage sends a match found message to both clients, with a preview of their opponent.
 func (pair *ClientPair) SendMatchFoundMessage() {
 
 	// Update the state of the pair.
@@ -44,21 +61,64 @@ func (pair *ClientPair) SendMatchFoundMessage() {
 	pair.IsReadyChecking = true
 
 	// Send a match found message to client 1, and set their internal ready checking flag to true.
-	pair.Client1.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMakingMatchFound, ""))
+	sendMatchFoundMessage(pair.Client1, pair.Client2)
 	pair.Client1.IsReadyChecking = true
+	pair.Client1.MatchFoundAcknowledged = false
+	pair.Client1.matchFoundResends = 0
 
 	// Send a match found message to client 2, and set their internal ready checking flag to true.
-	pair.Client2.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMakingMatchFound, ""))
+	sendMatchFoundMessage(pair.Client2, pair.Client1)
 	pair.Client2.IsReadyChecking = true
+	pair.Client2.MatchFoundAcknowledged = false
+	pair.Client2.matchFoundResends = 0
+}
+
+// ResendMatchFoundMessage resends the match found message to each client that has not yet responded to it, if the
+// resend interval has elapsed since it was last sent, up to a maximum number of resends.
+func (pair *ClientPair) ResendMatchFoundMessage() {
+	for _, clients := range [][2]*MMClient{{pair.Client1, pair.Client2}, {pair.Client2, pair.Client1}} {
+		client, opponent := clients[0], clients[1]
+		if client.MatchFoundAcknowledged || client.matchFoundResends >= maximumMatchFoundResends {
+			continue
+		}
+
+		if time.Since(client.matchFoundSentTime) >= matchFoundResendInterval {
+			sendMatchFoundMessage(client, opponent)
+			client.matchFoundResends++
+		}
+	}
 }
 
-// SendMatchConfirmedMessage sends a match confirmation message with match ID to both clients.
+// sendMatchFoundMessage is a helper function that sends a match found message to the specified client, with a preview
+// of their opponent (see previewPayload), and records the time at which it was sent.
+func sendMatchFoundMessage(client *MMClient, opponent *MMClient) {
+
+	// The message is coalescable, so that a resend replaces the original (or an earlier resend) if it hasn't been sent yet.
+	client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMakingMatchFound, previewPayload(opponent)).AsCoalescable())
+	client.matchFoundSentTime = time.Now()
+}
+
+// SendMatchConfirmedMessage sends a match confirmation message with match ID to both clients. Clients that specified
+// a region hint also receive the region of their opponent, which is empty if the opponent had no region preference.
+//
+// Format: <match ID>[<delim><opponent region>]
 func (pair *ClientPair) SendMatchConfirmedMessage(matchID uint64) {
 
 	// Get a string representation of the match ID.
 	matchIDString := strconv.FormatUint(matchID, 10)
 
 	// Send the match ID string to both clients.
-	pair.Client1.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchConfirmed, matchIDString))
-	pair.Client2.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchConfirmed, matchIDString))
+	pair.Client1.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchConfirmed, matchConfirmedPayload(matchIDString, pair.Client1, pair.Client2)))
+	pair.Client2.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchConfirmed, matchConfirmedPayload(matchIDString, pair.Client2, pair.Client1)))
+}
+
+// matchConfirmedPayload is a helper function that returns the match confirmation payload for the specified client.
+func matchConfirmedPayload(matchIDString string, client *MMClient, opponent *MMClient) string {
+
+	// Clients without a region hint may not understand the extended format, so only send them the match ID.
+	if client.Region == "" {
+		return matchIDString
+	}
+
+	return matchIDString + matchConfirmedDelimiter + opponent.Region
 }
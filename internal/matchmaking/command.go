@@ -0,0 +1,117 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+// SendCommand adds a command to the command queue, to be processed by the main loop. Returns false if the queue is
+// full, in which case the command is dropped. Safe to call from any goroutine.
+func (ms *Server) SendCommand(command protocol.Command) bool {
+	select {
+	case ms.queue.commands <- command:
+		return true
+	default:
+		return false
+	}
+}
+
+// processCommand handles server commands, and reports the outcome to the sender of the command.
+func (queue *Queue) processCommand(command protocol.Command) {
+	log.Printf("Processing command of type [ %v ] with data [ %v ]", command.Type, command.Data)
+
+	switch command.Type {
+	case protocol.QCTBroadcastMessage:
+
+		// Send the message to every client in the queue.
+		message := protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAnnouncement, command.Data)
+		for _, client := range queue.queue {
+			client.SendMessage(message)
+		}
+
+		for _, client := range queue.idle {
+			client.SendMessage(message)
+		}
+
+		command.Reply(true, fmt.Sprintf("Broadcast to %d clients", len(queue.queue)+len(queue.idle)))
+	case protocol.QCTDropAll:
+
+		// Disconnect every client, and empty the queue. The clients are closed directly rather than through the
+		// disconnect queue, as it may not have room for all of them. Any ready checks in progress are abandoned, so that
+		// the dropped clients can't be accepted into them if they reconnect.
+		count := len(queue.queue) + len(queue.idle)
+		message := protocol.NewMessage(protocol.WSMTText, protocol.WSCDroppedByServer, command.Data)
+		for _, client := range queue.queue {
+			client.Close(message)
+		}
+
+		for _, client := range queue.idle {
+			client.Close(message)
+		}
+
+		queue.queue = make(map[uint64]*MMClient)
+		queue.idle = make(map[uint64]*MMClient)
+		queue.clientIndex = make([]uint64, 0)
+		queue.matchedPairs = make([]ClientPair, 0)
+		atomic.StoreInt64(&queue.queuedCount, 0)
+
+		log.Printf("[%d] clients were dropped from the matchmaking queue", count)
+
+		command.Reply(true, fmt.Sprintf("Dropped %d clients", count))
+	case protocol.QCTChangePollTime:
+
+		// The poll time is specified as a duration string, such as "100ms".
+		pollTime, err := time.ParseDuration(command.Data)
+		if err != nil || pollTime <= 0 || pollTime > maximumPollTime {
+			command.Reply(false, fmt.Sprintf("Poll time must be a duration greater than zero, and no longer than %v", maximumPollTime))
+			return
+		}
+
+		queue.pollTime = pollTime
+		command.Reply(true, fmt.Sprintf("Poll time set to %v", pollTime))
+	case protocol.QCTForceDisconnectUser:
+
+		// The user is specified by their database ID.
+		databaseID, err := strconv.ParseUint(command.Data, 10, 64)
+		if err != nil {
+			command.Reply(false, "Database ID bad format")
+			return
+		}
+
+		if !queue.removeUser(databaseID, protocol.WSCDroppedByServer, "Disconnected by the server") {
+			command.Reply(false, fmt.Sprintf("User [%d] is not in the queue", databaseID))
+			return
+		}
+
+		command.Reply(true, fmt.Sprintf("Disconnected user [%d]", databaseID))
+	case protocol.QCTBanSweep:
+
+		// Run the ban sweep on this tick, rather than waiting for the next one to be due.
+		queue.nextBanSweep = time.Time{}
+		command.Reply(true, "Ban sweep scheduled")
+	case protocol.QCTMaintenance:
+
+		// The data is either "off", or the delay until the planned shutdown (such as "15m" - the default delay is used
+		// if it's empty). The switch is shared with any other servers in the process, and each one announces the change
+		// on its next tick.
+		if err := queue.maintenance.Set(command.Data, time.Now()); err != nil {
+			command.Reply(false, err.Error())
+			return
+		}
+
+		command.Reply(true, maintenance.Announcement(queue.maintenance.State()))
+	default:
+		command.Reply(false, fmt.Sprintf("Unknown command type [%d]", command.Type))
+	}
+}
@@ -7,6 +7,7 @@ package matchmaking
 
 import (
 	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/rs/xid"
 )
 
 // DisconnectRequest is a wrapper for the information required to remove a client from the matchmaking queue.
@@ -15,6 +16,9 @@ type DisconnectRequest struct {
 	// A pointer to the client that will be removed.
 	Client *MMClient
 
+	// The unique ID of the client's connection, for identifying stale connections and duplicate requests.
+	ConnectionID xid.ID
+
 	// The reason for removal.
 	Reason protocol.B2Code
 
@@ -0,0 +1,146 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/6a/blade-ii-game-server/pkg/slice"
+)
+
+// defaultIdleTimeout is the default maximum time that a client can stay connected after leaving the queue.
+const defaultIdleTimeout = time.Minute * 10
+
+// idleTimeout is the maximum time that a client can stay connected after leaving the queue, before their connection
+// is closed. Configured via the "mm_idle_timeout" environment variable.
+var idleTimeout = envvar.Duration("mm_idle_timeout", defaultIdleTimeout)
+
+// leaveQueue moves the specified client out of the queue, and confirms it with a left queue message. The connection is
+// kept open, so that the client can rejoin the queue later (see rejoinQueue) without reconnecting. A client that
+// leaves during a ready check is treated as having declined the match. Only called from the main loop.
+func (queue *Queue) leaveQueue(client *MMClient) {
+
+	// Ignore the request if the client is not in the queue - such as if they already left it.
+	if !queue.isQueued(client) {
+		return
+	}
+
+	// Fail the ready check that the client is part of, if any.
+	if client.IsReadyChecking {
+		queue.abandonReadyCheck(client)
+	}
+
+	// Delete the client from the queue and the client index.
+	delete(queue.queue, client.DBID)
+	for index, databaseID := range queue.clientIndex {
+		if databaseID == client.DBID {
+			slice.RemoveAtIndexUInt64(&queue.clientIndex, index)
+			break
+		}
+	}
+
+	// Keep track of the client until they rejoin, disconnect, or are idle for too long.
+	client.idleSince = time.Now()
+	queue.idle[client.DBID] = client
+
+	client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCLeftQueue, "Removed from matchmaking queue"))
+
+	log.Printf("Client [%s] (connection [%s]) left the matchmaking queue, and is now idle. Total clients: %v", client.PublicID, client.ConnectionID(), len(queue.queue))
+}
+
+// rejoinQueue adds the specified client, which previously left the queue, back to the end of the queue with the
+// specified region hint. Only called from the main loop.
+func (queue *Queue) rejoinQueue(client *MMClient, region string) {
+
+	// Ignore the request if the client is not idle - such as if they are already in the queue.
+	if queued, ok := queue.idle[client.DBID]; !ok || queued != client {
+		return
+	}
+
+	delete(queue.idle, client.DBID)
+
+	// Clear any state left over from the client's last ready check (including any priority, as they chose to leave),
+	// and rejoin with the new region hint.
+	client.resetReadyCheck()
+	client.vanishedTime = time.Time{}
+	client.priority = false
+	client.Region = normalizeRegion(region)
+
+	queue.join(client)
+}
+
+// abandonReadyCheck fails the ready check that the specified client is part of, because they left the queue. The
+// failure is recorded against the client, and their opponent keeps their place in the queue. Only called from the
+// main loop.
+func (queue *Queue) abandonReadyCheck(client *MMClient) {
+	for index := range queue.matchedPairs {
+		pair := queue.matchedPairs[index]
+
+		// Find the client's opponent, skipping pairs that the client is not part of.
+		opponent := pair.Client2
+		if pair.Client2 == client {
+			opponent = pair.Client1
+		} else if pair.Client1 != client {
+			continue
+		}
+
+		queue.metrics.recordFailedReadyCheck()
+		queue.recordReadyCheckFailure(client.DBID)
+
+		// Make the opponent eligible for matchmaking again (with priority, as they did nothing wrong), and let them
+		// know that the match won't go ahead.
+		opponent.resetReadyCheck()
+		opponent.priority = true
+		opponent.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCOpponentDidNotAccept, ""))
+
+		// Remove the pair, so that it isn't polled again.
+		queue.matchedPairs = append(queue.matchedPairs[:index], queue.matchedPairs[index+1:]...)
+
+		break
+	}
+
+	client.resetReadyCheck()
+}
+
+// tickIdle ticks every client that has left the queue, and closes the connections of clients that have been idle for
+// longer than the idle timeout. Only called from the main loop.
+func (queue *Queue) tickIdle(now time.Time) {
+	for databaseID, client := range queue.idle {
+
+		// The client may rejoin the queue while ticking, in which case they are no longer idle.
+		client.Tick()
+		if queue.idle[databaseID] != client {
+			continue
+		}
+
+		if now.Sub(client.idleSince) > idleTimeout {
+			delete(queue.idle, databaseID)
+			client.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCNone, "Idle timeout"))
+
+			log.Printf("Client [%s] (connection [%s]) was disconnected after being idle for too long", client.PublicID, client.ConnectionID())
+		}
+	}
+}
+
+// removeIdle closes the connection for the specified disconnect request, if it is for a client that has left the
+// queue. Returns false if the request is not for an idle client, in which case it should be handled as normal. Only
+// called from the main loop.
+func (queue *Queue) removeIdle(request DisconnectRequest) bool {
+	client, ok := queue.idle[request.Client.DBID]
+	if !ok || client.ConnectionID() != request.ConnectionID {
+		return false
+	}
+
+	delete(queue.idle, request.Client.DBID)
+	client.Close(protocol.NewMessage(protocol.WSMTText, request.Reason, request.Message))
+
+	log.Printf("Idle client [%s] (connection [%s]) was disconnected", client.PublicID, request.ConnectionID)
+
+	return true
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+// maintenanceServerName is the name that the matchmaking queue reports to the maintenance mode switch with.
+const maintenanceServerName = "matchmaking"
+
+// updateMaintenance picks up any change to maintenance mode, and announces it to every client - including idle
+// clients. Only called from the main loop.
+func (queue *Queue) updateMaintenance() {
+	enabled, shutdownTime := queue.maintenance.State()
+	if enabled == queue.maintenanceEnabled && shutdownTime.Equal(queue.maintenanceShutdownTime) {
+		return
+	}
+
+	queue.maintenanceEnabled, queue.maintenanceShutdownTime = enabled, shutdownTime
+
+	announcement := maintenance.Announcement(enabled, shutdownTime)
+	queue.Broadcast(protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAnnouncement, announcement))
+
+	log.Printf("Matchmaking maintenance mode changed: %s", announcement)
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/6a/blade-ii-game-server/pkg/histogram"
+)
+
+// defaultMetricsLogPeriod is the default duration between each log line summarising the matchmaking metrics.
+const defaultMetricsLogPeriod = time.Minute * 5
+
+// metricsLogPeriod is the duration between each log line summarising the matchmaking metrics. Configured via the
+// "mm_metrics_log_period" environment variable.
+var metricsLogPeriod = envvar.Duration("mm_metrics_log_period", defaultMetricsLogPeriod)
+
+// waitBuckets are the upper bounds (in seconds) of the buckets used to record queue wait durations.
+var waitBuckets = []float64{1, 2, 5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600}
+
+// Metrics is a snapshot of the matchmaking metrics, accumulated since the server started.
+type Metrics struct {
+
+	// The estimated median and 95th percentile queue wait duration, from joining the queue to a match being confirmed.
+	WaitP50 time.Duration
+	WaitP95 time.Duration
+
+	// The average absolute difference in MMR between the two players in each confirmed match.
+	AverageMMRGap float64
+
+	// The number of ready checks that were accepted by both players, and the number that failed.
+	ReadyChecksAccepted uint64
+	ReadyChecksFailed   uint64
+
+	// The proportion of ready checks that were accepted by both players - zero if there have been no ready checks.
+	AcceptRate float64
+}
+
+// queueMetrics accumulates the metrics for a matchmaking queue.
+type queueMetrics struct {
+
+	// Histogram of the queue wait durations (in seconds) for clients whose match was confirmed.
+	wait *histogram.Histogram
+
+	// The sum of the MMR gaps for all confirmed matches.
+	mmrGapSum int
+
+	// Ready check outcome counts.
+	readyChecksAccepted uint64
+	readyChecksFailed   uint64
+
+	// The time at which the metrics were last logged.
+	lastLogged time.Time
+
+	// Mutex lock to protect the critical section that can occur when the metrics are read from another goroutine.
+	lock sync.Mutex
+}
+
+// newQueueMetrics creates and returns a pointer to a new, empty set of queue metrics.
+func newQueueMetrics() *queueMetrics {
+	return &queueMetrics{
+		wait:       histogram.New(waitBuckets...),
+		lastLogged: time.Now(),
+	}
+}
+
+// recordConfirmedPair records the wait duration for each client in the specified pair, and the MMR gap between them,
+// as well as a successful ready check.
+func (metrics *queueMetrics) recordConfirmedPair(pair ClientPair) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	now := time.Now()
+	metrics.wait.Observe(now.Sub(pair.Client1.JoinTime).Seconds())
+	metrics.wait.Observe(now.Sub(pair.Client2.JoinTime).Seconds())
+
+	gap := pair.Client1.MMR - pair.Client2.MMR
+	if gap < 0 {
+		gap = -gap
+	}
+
+	metrics.mmrGapSum += gap
+	metrics.readyChecksAccepted++
+}
+
+// recordFailedReadyCheck records a ready check that was not accepted by both players.
+func (metrics *queueMetrics) recordFailedReadyCheck() {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	metrics.readyChecksFailed++
+}
+
+// snapshot returns a snapshot of the current metrics.
+func (metrics *queueMetrics) snapshot() Metrics {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	snapshot := Metrics{
+		WaitP50:             secondsToDuration(metrics.wait.Quantile(0.5)),
+		WaitP95:             secondsToDuration(metrics.wait.Quantile(0.95)),
+		ReadyChecksAccepted: metrics.readyChecksAccepted,
+		ReadyChecksFailed:   metrics.readyChecksFailed,
+	}
+
+	if metrics.readyChecksAccepted > 0 {
+		snapshot.AverageMMRGap = float64(metrics.mmrGapSum) / float64(metrics.readyChecksAccepted)
+	}
+
+	if total := metrics.readyChecksAccepted + metrics.readyChecksFailed; total > 0 {
+		snapshot.AcceptRate = float64(metrics.readyChecksAccepted) / float64(total)
+	}
+
+	return snapshot
+}
+
+// logPeriodically logs a summary of the metrics, if the log period has elapsed since they were last logged.
+func (metrics *queueMetrics) logPeriodically() {
+	if time.Since(metrics.lastLogged) < metricsLogPeriod {
+		return
+	}
+
+	metrics.lastLogged = time.Now()
+
+	snapshot := metrics.snapshot()
+	log.Printf("Matchmaking metrics: wait p50 [%v] p95 [%v], average MMR gap [%.1f], ready checks accepted [%d] failed [%d] (accept rate %.2f)",
+		snapshot.WaitP50, snapshot.WaitP95, snapshot.AverageMMRGap, snapshot.ReadyChecksAccepted, snapshot.ReadyChecksFailed, snapshot.AcceptRate)
+}
+
+// secondsToDuration is a helper function that converts a number of seconds to a duration. Infinite values (such as
+// from the overflow bucket of a histogram) are returned as the largest bucket bound.
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds > waitBuckets[len(waitBuckets)-1] {
+		seconds = waitBuckets[len(waitBuckets)-1]
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
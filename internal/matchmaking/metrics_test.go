@@ -0,0 +1,73 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"testing"
+	"time"
+)
+
+// TestQueueMetrics checks the metrics that are recorded for simulated ready checks - two confirmed pairs, and one
+// that failed.
+func TestQueueMetrics(t *testing.T) {
+	metrics := newQueueMetrics()
+	if snapshot := metrics.snapshot(); snapshot != (Metrics{}) {
+		t.Fatalf("Metrics with no ready checks are %+v, expected them to be empty", snapshot)
+	}
+
+	now := time.Now()
+	pairs := []ClientPair{
+		{
+			Client1: &MMClient{MMR: 1000, JoinTime: now.Add(-time.Second * 3)},
+			Client2: &MMClient{MMR: 1100, JoinTime: now.Add(-time.Second * 4)},
+		},
+		{
+			Client1: &MMClient{MMR: 1300, JoinTime: now.Add(-time.Second * 8)},
+			Client2: &MMClient{MMR: 1250, JoinTime: now.Add(-time.Second * 40)},
+		},
+	}
+
+	for _, pair := range pairs {
+		metrics.recordConfirmedPair(pair)
+	}
+
+	metrics.recordFailedReadyCheck()
+
+	// The waits are 3, 4, 8 and 40 seconds - so the median is in the 5 second bucket, and the 95th percentile in the
+	// 45 second bucket.
+	expected := Metrics{
+		WaitP50:             time.Second * 5,
+		WaitP95:             time.Second * 45,
+		AverageMMRGap:       75,
+		ReadyChecksAccepted: 2,
+		ReadyChecksFailed:   1,
+		AcceptRate:          2.0 / 3.0,
+	}
+
+	if snapshot := metrics.snapshot(); snapshot != expected {
+		t.Fatalf("Metrics are %+v, expected %+v", snapshot, expected)
+	}
+}
+
+func TestSecondsToDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		seconds  float64
+		expected time.Duration
+	}{
+		{"Zero", 0, 0},
+		{"Fraction", 1.5, time.Millisecond * 1500},
+		{"Largest bucket", 600, time.Minute * 10},
+		{"Overflow", 10000, time.Minute * 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if duration := secondsToDuration(test.seconds); duration != test.expected {
+				t.Fatalf("%v seconds converted to [%v], expected [%v]", test.seconds, duration, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import "sort"
+
+// pairByMMR pairs up the specified clients so that the total MMR difference across all of the pairs is as small as
+// possible, and returns the pairs, along with the client that was left over (nil if there was an even number of
+// clients). The result is deterministic - ties in MMR are broken by join order (client ID).
+//
+// Once the clients are sorted by MMR, pairing neighbours is optimal, as a pairing in which two pairs overlap can
+// always be improved by swapping their partners. With an odd number of clients, the client that is left over must be
+// at an even position in the sorted order (so that the clients either side of it can be paired with neighbours), and
+// the best one is found with prefix and suffix sums of the neighbour differences. Prioritized clients are only left
+// over if every client is prioritized, and otherwise the latest joiner is left over when the cost is tied. O(n log n).
+func pairByMMR(clients []*MMClient) (pairs []ClientPair, leftover *MMClient) {
+
+	// Sort a copy of the clients by MMR, and then join order, so that the caller's slice is not modified.
+	sorted := append([]*MMClient(nil), clients...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].MMR != sorted[j].MMR {
+			return sorted[i].MMR < sorted[j].MMR
+		}
+
+		return sorted[i].ClientID < sorted[j].ClientID
+	})
+
+	// With an odd number of clients, choose the one to leave over, and remove it from the sorted slice.
+	if len(sorted)%2 == 1 {
+		skip := chooseLeftover(sorted)
+		leftover = sorted[skip]
+		sorted = append(sorted[:skip], sorted[skip+1:]...)
+	}
+
+	// Pair up neighbours. The client that joined first is client 1.
+	pairs = make([]ClientPair, 0, len(sorted)/2)
+	for index := 0; index+1 < len(sorted); index += 2 {
+		client1, client2 := sorted[index], sorted[index+1]
+		if client2.ClientID < client1.ClientID {
+			client1, client2 = client2, client1
+		}
+
+		pairs = append(pairs, ClientPair{
+			Client1: client1,
+			Client2: client2,
+		})
+	}
+
+	return pairs, leftover
+}
+
+// pairAllowedByMMR pairs up the specified clients as pairByMMR does, except that clients are only paired if allowed
+// returns true for them. Returns the pairs, along with the clients that were left unpaired (in MMR order).
+//
+// The optimal pairs are found first. Any pair that is not allowed is split up, and the clients from those pairs (along
+// with the client that was left over, if any) are then paired greedily in MMR order - each with the closest client
+// after them in the same order that they are allowed to be paired with. Disallowed pairs are rare, so this keeps the
+// result close to optimal, without affecting the clients that were paired as normal.
+func pairAllowedByMMR(clients []*MMClient, allowed func(client1 *MMClient, client2 *MMClient) bool) (pairs []ClientPair, unpaired []*MMClient) {
+	optimal, leftover := pairByMMR(clients)
+
+	// Keep the allowed pairs, and pool the clients that still need a partner.
+	pairs = make([]ClientPair, 0, len(optimal))
+	pool := make([]*MMClient, 0)
+	for _, pair := range optimal {
+		if allowed(pair.Client1, pair.Client2) {
+			pairs = append(pairs, pair)
+		} else {
+			pool = append(pool, pair.Client1, pair.Client2)
+		}
+	}
+
+	if leftover != nil {
+		pool = append(pool, leftover)
+	}
+
+	// Nothing more can be done without at least two clients in the pool.
+	if len(pool) < 2 {
+		return pairs, pool
+	}
+
+	// Sort the pool by MMR, and then join order, as in pairByMMR.
+	sort.Slice(pool, func(i, j int) bool {
+		if pool[i].MMR != pool[j].MMR {
+			return pool[i].MMR < pool[j].MMR
+		}
+
+		return pool[i].ClientID < pool[j].ClientID
+	})
+
+	// Pair each client with the closest client after them that they are allowed to be paired with. The client that
+	// joined first is client 1.
+	paired := make([]bool, len(pool))
+	for index, client1 := range pool {
+		if paired[index] {
+			continue
+		}
+
+		for other := index + 1; other < len(pool); other++ {
+			client2 := pool[other]
+			if paired[other] || !allowed(client1, client2) {
+				continue
+			}
+
+			paired[index], paired[other] = true, true
+			if client2.ClientID < client1.ClientID {
+				client1, client2 = client2, client1
+			}
+
+			pairs = append(pairs, ClientPair{
+				Client1: client1,
+				Client2: client2,
+			})
+
+			break
+		}
+
+		if !paired[index] {
+			unpaired = append(unpaired, client1)
+		}
+	}
+
+	return pairs, unpaired
+}
+
+// chooseLeftover returns the index of the client to leave over when pairing the specified (odd number of) clients,
+// which must be sorted by MMR. See pairByMMR.
+func chooseLeftover(sorted []*MMClient) int {
+	count := len(sorted)
+
+	// prefix[i] is the total difference when pairing neighbours in sorted[:i], and suffix[i] is the same for
+	// sorted[i:]. Only even values of i (for prefix) and odd values of i (for suffix) are used.
+	prefix := make([]int, count+1)
+	for index := 2; index <= count; index += 2 {
+		prefix[index] = prefix[index-2] + sorted[index-1].MMR - sorted[index-2].MMR
+	}
+
+	suffix := make([]int, count+2)
+	for index := count - 2; index >= 1; index -= 2 {
+		suffix[index] = suffix[index+2] + sorted[index+1].MMR - sorted[index].MMR
+	}
+
+	// Compare each candidate by whether they are prioritized, then by the cost of leaving them over, and then by join
+	// order (later joiners are left over first).
+	best := -1
+	bestCost := 0
+	for index := 0; index < count; index += 2 {
+		cost := prefix[index] + suffix[index+1]
+
+		if best >= 0 {
+			candidate, current := sorted[index], sorted[best]
+			if candidate.priority != current.priority {
+				if candidate.priority {
+					continue
+				}
+			} else if cost > bestCost || (cost == bestCost && candidate.ClientID < current.ClientID) {
+				continue
+			}
+		}
+
+		best, bestCost = index, cost
+	}
+
+	return best
+}
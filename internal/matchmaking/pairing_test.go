@@ -0,0 +1,71 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPairByMMR pairs clients with known MMRs, and checks the pairs that are produced (by client ID, first joiner
+// first), and the client that is left over - which minimizes the total MMR difference, is never a prioritized client
+// unless they all are, and is otherwise the latest joiner when the cost is tied.
+func TestPairByMMR(t *testing.T) {
+	tests := []struct {
+		name        string
+		mmrs        []int
+		prioritized []uint64
+		pairs       [][2]uint64
+		leftover    uint64
+	}{
+		{"Nearest neighbours", []int{1200, 1000, 1100, 1300}, nil, [][2]uint64{{2, 3}, {1, 4}}, 0},
+		{"Odd client out", []int{1000, 1500, 1010, 1490, 1200}, nil, [][2]uint64{{1, 3}, {2, 4}}, 5},
+		{"Better than join order", []int{1000, 1400, 1390, 1010}, nil, [][2]uint64{{1, 4}, {2, 3}}, 0},
+		{"Equal MMRs", []int{1000, 1000, 1000}, nil, [][2]uint64{{1, 2}}, 3},
+		{"Prioritized client kept", []int{1000, 1010, 1200}, []uint64{3}, [][2]uint64{{2, 3}}, 1},
+		{"Every client prioritized", []int{1000, 1010, 1200}, []uint64{1, 2, 3}, [][2]uint64{{1, 2}}, 3},
+		{"Single client", []int{1000}, nil, [][2]uint64{}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clients := make([]*MMClient, 0, len(test.mmrs))
+			for index, mmr := range test.mmrs {
+				clients = append(clients, &MMClient{ClientID: uint64(index + 1), MMR: mmr})
+			}
+
+			for _, id := range test.prioritized {
+				clients[id-1].priority = true
+			}
+
+			pairs, leftover := pairByMMR(clients)
+
+			ids := make([][2]uint64, 0, len(pairs))
+			for _, pair := range pairs {
+				ids = append(ids, [2]uint64{pair.Client1.ClientID, pair.Client2.ClientID})
+			}
+
+			if !reflect.DeepEqual(ids, test.pairs) {
+				t.Fatalf("Clients were paired as %v, expected %v", ids, test.pairs)
+			}
+
+			var leftoverID uint64
+			if leftover != nil {
+				leftoverID = leftover.ClientID
+			}
+
+			if leftoverID != test.leftover {
+				t.Fatalf("Client [%d] was left over, expected [%d]", leftoverID, test.leftover)
+			}
+
+			// The caller's slice is left in join order.
+			for index, client := range clients {
+				if client.ClientID != uint64(index+1) {
+					t.Fatalf("Clients were reordered")
+				}
+			}
+		})
+	}
+}
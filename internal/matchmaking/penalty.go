@@ -0,0 +1,114 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultPenaltyThreshold is the default number of ready check failures after which a client is given a cooldown.
+	defaultPenaltyThreshold = 3
+
+	// defaultPenaltyCooldown is the default duration for which a penalized client cannot rejoin the matchmaking queue.
+	defaultPenaltyCooldown = time.Minute * 5
+
+	// defaultPenaltyDecay is the default duration after which a single ready check failure is forgotten.
+	defaultPenaltyDecay = time.Minute * 30
+)
+
+var (
+
+	// penaltyThreshold is the number of ready check failures after which a client is given a cooldown.
+	// Configured via the "mm_penalty_threshold" environment variable.
+	penaltyThreshold = envvar.Int("mm_penalty_threshold", defaultPenaltyThreshold)
+
+	// penaltyCooldown is the duration for which a penalized client cannot rejoin the matchmaking queue.
+	// Configured via the "mm_penalty_cooldown" environment variable.
+	penaltyCooldown = envvar.Duration("mm_penalty_cooldown", defaultPenaltyCooldown)
+
+	// penaltyDecay is the duration after which a single ready check failure is forgotten.
+	// Configured via the "mm_penalty_decay" environment variable.
+	penaltyDecay = envvar.Duration("mm_penalty_decay", defaultPenaltyDecay)
+)
+
+// readyCheckPenalty keeps track of the ready check failures for a single client.
+type readyCheckPenalty struct {
+
+	// The number of recent ready check failures.
+	failures int
+
+	// The time from which the next failure will decay.
+	decayStart time.Time
+
+	// The time at which the current cooldown ends (if any).
+	cooldownEnd time.Time
+}
+
+// decay forgets any failures that are older than the decay duration, one failure per decay duration.
+func (penalty *readyCheckPenalty) decay(now time.Time) {
+
+	// Remove one failure for each full decay period that has elapsed.
+	for penalty.failures > 0 && now.Sub(penalty.decayStart) >= penaltyDecay {
+		penalty.failures--
+		penalty.decayStart = penalty.decayStart.Add(penaltyDecay)
+	}
+}
+
+// recordReadyCheckFailure records a ready check failure for the client with the specified database ID, starting a
+// cooldown if they have failed too many ready checks recently.
+//
+// Should only be called from the main loop.
+func (queue *Queue) recordReadyCheckFailure(dbid uint64) {
+
+	// Get the penalty for this client, creating it if it doesn't exist.
+	now := time.Now()
+	penalty, ok := queue.penalties[dbid]
+	if !ok {
+		penalty = &readyCheckPenalty{}
+		queue.penalties[dbid] = penalty
+	}
+
+	// Forget old failures before adding this one. If there were no failures remaining, the decay starts from now.
+	penalty.decay(now)
+	if penalty.failures == 0 {
+		penalty.decayStart = now
+	}
+
+	penalty.failures++
+
+	// If the threshold has been reached, start the cooldown and reset the failure count.
+	if penalty.failures >= penaltyThreshold {
+		penalty.cooldownEnd = now.Add(penaltyCooldown)
+		penalty.failures = 0
+	}
+}
+
+// remainingCooldown returns the remaining matchmaking cooldown for the client with the specified database ID. A
+// value of zero or less means that the client is not on cooldown.
+//
+// Also removes penalties that no longer have any effect. Should only be called from the main loop.
+func (queue *Queue) remainingCooldown(dbid uint64) time.Duration {
+
+	// Clients without a penalty are not on cooldown.
+	penalty, ok := queue.penalties[dbid]
+	if !ok {
+		return 0
+	}
+
+	// Forget old failures, and remove the penalty entirely if it's no longer relevant.
+	now := time.Now()
+	penalty.decay(now)
+	remaining := penalty.cooldownEnd.Sub(now)
+	if remaining <= 0 && penalty.failures == 0 {
+		delete(queue.penalties, dbid)
+	}
+
+	return remaining
+}
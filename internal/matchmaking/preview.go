@@ -0,0 +1,62 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// hiddenMMR is sent in place of the MMR of an opponent that has chosen to hide it.
+const hiddenMMR = "?"
+
+// lookupPreview fetches the MMR privacy setting for the specified client from the database, and determines whether a
+// preview of the client can be shown to their opponents. There is no preview if the client's display name could not
+// be read (in which case it is empty), or if the privacy setting could not be read - errors are logged, so that a
+// database failure results in a match found message without a preview, rather than holding up the pairing. Blocks,
+// so it should not be called from the main loop.
+func (queue *Queue) lookupPreview(client *MMClient) {
+	if client.DisplayName == "" {
+		return
+	}
+
+	hidden, err := queue.store.GetMMRHidden(client.DBID)
+	if err != nil {
+		log.Printf("Error getting MMR privacy setting for user [ %d ]: %s", client.DBID, err.Error())
+		return
+	}
+
+	client.mmrHidden = hidden
+	client.previewAvailable = true
+}
+
+// previewPayload is a helper function that returns the preview of the specified opponent that is sent in a match
+// found message. The MMR is replaced with hiddenMMR if the opponent has chosen to hide it, and the payload is empty if
+// there is no preview of the opponent.
+//
+// Format: <opponent avatar><delim><opponent MMR><delim><opponent display name>
+//
+// The display name is last, so that it can contain the delimiter.
+func previewPayload(opponent *MMClient) string {
+	if !opponent.previewAvailable {
+		return ""
+	}
+
+	mmr := strconv.Itoa(opponent.MMR)
+	if opponent.mmrHidden {
+		mmr = hiddenMMR
+	}
+
+	var builder strings.Builder
+	builder.WriteString(strconv.Itoa(int(opponent.Avatar)))
+	builder.WriteString(matchFoundDelimiter)
+	builder.WriteString(mmr)
+	builder.WriteString(matchFoundDelimiter)
+	builder.WriteString(opponent.DisplayName)
+
+	return builder.String()
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// failingPrivacyStore is a test store that fails to read MMR privacy settings.
+type failingPrivacyStore struct {
+	*teststore.Store
+}
+
+// GetMMRHidden always fails.
+func (store failingPrivacyStore) GetMMRHidden(databaseID uint64) (hidden bool, err error) {
+	return false, errors.New("database unavailable")
+}
+
+// TestMatchFoundPreview looks up the preview of each client in a pair as they connect, sends them the match found
+// message, and checks the preview of their opponent in each payload - which hides the MMR of an opponent that chose to
+// hide it, and is empty if the opponent's display name or privacy setting couldn't be read. Either way, the pair goes
+// on to the ready check.
+func TestMatchFoundPreview(t *testing.T) {
+	tests := []struct {
+		name        string
+		hidden      bool
+		failing     bool
+		displayName string
+		expected    string
+	}{
+		{"Preview", false, false, "Opponent.Name", "3.1450.Opponent.Name"},
+		{"Hidden MMR", true, false, "Opponent.Name", "3.?.Opponent.Name"},
+		{"Display name unavailable", false, false, "", ""},
+		{"Privacy setting unavailable", false, true, "Opponent.Name", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := teststore.NewStore()
+			store.SetMMRHidden(2, test.hidden)
+
+			queue := &Queue{store: store}
+			if test.failing {
+				queue.store = failingPrivacyStore{store}
+			}
+
+			client := newTestMMClient(t, 1, 1)
+			client.DisplayName, client.Avatar = "Client", 1
+
+			opponent := newTestMMClient(t, 2, 2)
+			opponent.DisplayName, opponent.Avatar, opponent.MMR = test.displayName, 3, 1450
+
+			for _, connected := range []*MMClient{client, opponent} {
+				queue.lookupPreview(connected)
+			}
+
+			NewPair(client, opponent).SendMatchFoundMessage()
+
+			message := client.connection.GetNextOutboundMessage()
+			if message.Payload.Code != protocol.WSCMatchMakingMatchFound || message.Payload.Message != test.expected {
+				t.Fatalf("Client was sent [%d] with payload [%s], expected [%d] with payload [%s]", message.Payload.Code, message.Payload.Message, protocol.WSCMatchMakingMatchFound, test.expected)
+			}
+
+			if !client.IsReadyChecking || !opponent.IsReadyChecking {
+				t.Fatalf("Pair is not ready checking")
+			}
+		})
+	}
+}
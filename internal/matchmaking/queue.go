@@ -8,12 +8,19 @@ package matchmaking
 import (
 	"log"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/pkg/capacity"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
 	"github.com/6a/blade-ii-game-server/pkg/slice"
+	"github.com/rs/xid"
 )
 
 const (
@@ -21,13 +28,20 @@ const (
 	// BufferSize is the size of each message queue's buffer.
 	BufferSize = 2048
 
-	// readyCheckTime is maximum time to wait for a ready check.
-	readyCheckTime = time.Second * 20
+	// defaultReadyCheckTime is the default maximum time to wait for a ready check.
+	defaultReadyCheckTime = time.Second * 20
 
-	// How frequently to update the matchmaking queue (minimum wait between iterations).
-	pollTime = 250 * time.Millisecond
+	// How frequently to update the matchmaking queue by default (minimum wait between iterations).
+	defaultPollTime = 250 * time.Millisecond
+
+	// The longest poll time that can be set with a command.
+	maximumPollTime = 2 * time.Second
 )
 
+// readyCheckTime is the maximum time to wait for a ready check. Configured via the "mm_ready_check_time" environment
+// variable.
+var readyCheckTime = envvar.Duration("mm_ready_check_time", defaultReadyCheckTime)
+
 // Queue is a wrapper for the matchmaking queue
 type Queue struct {
 
@@ -49,6 +63,42 @@ type Queue struct {
 	// A map containing all the clients that are currently matchmaking - essentially the matchmaking queue itself.
 	queue map[uint64]*MMClient
 
+	// A map containing the clients that left the queue, but kept their connection open so that they can rejoin it,
+	// keyed by database ID.
+	idle map[uint64]*MMClient
+
+	// A map containing the ready check penalties for clients that recently failed a ready check, keyed by database ID.
+	penalties map[uint64]*readyCheckPenalty
+
+	// A map containing the recent opponents of each client, most recent first, keyed by database ID - along with the
+	// time at which they are next pruned (see pruneRecentOpponents). Only accessed from the main loop.
+	recentOpponents         map[uint64][]recentOpponent
+	nextRecentOpponentPrune time.Time
+
+	// The store used to create matches and read match history.
+	store database.Store
+
+	// Metrics for queue wait times, match quality and ready check outcomes.
+	metrics *queueMetrics
+
+	// Gauge tracking the number of matches on the game server. While it's at capacity, no new pairs are made.
+	gameCapacity *capacity.Gauge
+
+	// The registry of active connections for each user, shared with the game server (if it is running in the same
+	// process).
+	sessions *session.Registry
+
+	// The maintenance mode switch, shared with the game server (if it is running in the same process).
+	maintenance *maintenance.Mode
+
+	// The maintenance mode state as of the last tick, so that changes can be announced. Only accessed from the main
+	// loop.
+	maintenanceEnabled      bool
+	maintenanceShutdownTime time.Time
+
+	// The number of clients in the queue - updated by the main loop, and accessed atomically.
+	queuedCount int64
+
 	// Channel for new client's that have been successfully authenticated
 	connect chan *MMClient
 
@@ -60,10 +110,34 @@ type Queue struct {
 
 	// Channel for server commands.
 	commands chan protocol.Command
+
+	// The minimum wait between iterations of the main loop. Only accessed from the main loop.
+	pollTime time.Duration
+
+	// The time limits used by the queue.
+	timeouts Timeouts
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to timeouts.
+	timeoutsLock sync.Mutex
+
+	// Channel for the results of ban sweeps - the database IDs of the clients that were found to be banned.
+	bannedUsers chan []uint64
+
+	// The time at which the next ban sweep is due, and whether one is in progress. Only accessed from the main loop.
+	nextBanSweep    time.Time
+	banSweepRunning bool
 }
 
 // Init initializes the matchmaking server including starting the internal loop.
-func (queue *Queue) Init() {
+func (queue *Queue) Init(store database.Store, gameCapacity *capacity.Gauge, sessions *session.Registry, mode *maintenance.Mode) {
+
+	// Store the store, the game server capacity gauge, the session registry, and the maintenance mode switch - which
+	// the queue must drain before the process can exit during maintenance.
+	queue.store = store
+	queue.gameCapacity = gameCapacity
+	queue.sessions = sessions
+	queue.maintenance = mode
+	queue.maintenance.Register(maintenanceServerName)
 
 	// Initialize the client index slice. (used to keep track of the order clients in the matchmaking queue, as maps are not ordered in golang).
 	queue.clientIndex = make([]uint64, 0)
@@ -74,11 +148,31 @@ func (queue *Queue) Init() {
 	// Initialize the actual queue.
 	queue.queue = make(map[uint64]*MMClient)
 
+	// Initialize the idle client map.
+	queue.idle = make(map[uint64]*MMClient)
+
+	// Initialize the ready check penalties map.
+	queue.penalties = make(map[uint64]*readyCheckPenalty)
+
+	// Initialize the recent opponents map.
+	queue.recentOpponents = make(map[uint64][]recentOpponent)
+
+	// Initialize the metrics.
+	queue.metrics = newQueueMetrics()
+
 	// Initialize the various channels.
 	queue.connect = make(chan *MMClient, BufferSize)
 	queue.disconnect = make(chan DisconnectRequest, BufferSize)
 	queue.broadcast = make(chan protocol.Message, BufferSize)
 	queue.commands = make(chan protocol.Command, BufferSize)
+	queue.bannedUsers = make(chan []uint64, 1)
+
+	// Set the default poll time, and the default timeouts.
+	queue.pollTime = defaultPollTime
+	queue.timeouts = DefaultTimeouts()
+
+	// Schedule the first ban sweep.
+	queue.nextBanSweep = time.Now().Add(banSweepPeriod)
 
 	go queue.MainLoop()
 }
@@ -93,55 +187,45 @@ func (queue *Queue) MainLoop() {
 		// the minimum wait, to reduce server load.
 		start := time.Now()
 
-		// Make an empty slice of disconnect requests, so that client disconnects can be handled later.
+		// Make an empty slice of disconnect requests, so that client disconnects can be handled later, along with a
+		// set of the connections that they are for, so that a connection that is enqueued more than once (such as when
+		// the read and write pumps both fail at the same time) is only removed once.
 		toRemove := make([]DisconnectRequest, 0)
+		pendingRemoval := make(map[xid.ID]bool)
 
 		// If any of the queues have something in them, process their data until all the queues are empty.
 		for len(queue.connect)+len(queue.disconnect)+len(queue.broadcast)+len(queue.commands) > 0 {
 			select {
 			case client := <-queue.connect:
 
-				// If a client with the same DBID already exists, we need to set it to be removed, and then
-				// update the new clients values to match
-				if oldClient, ok := queue.queue[client.DBID]; ok {
-
-					// Disconnect the old client
-					queue.Remove(oldClient, protocol.WSCDuplicateConnection, "Removing stale connection")
-
-					// Set the client ID on the new client to match the old one
-					client.ClientID = oldClient.ClientID
-
-				} else {
-
-					// Add the key to the client index, which doubles as a record of the join order of the clients.
-					queue.clientIndex = append(queue.clientIndex, client.DBID)
-
-					// Set the client ID on the client wit a new ID
-					client.ClientID = queue.getNextClientID()
-				}
-
-				// Add the client to the queue
-				queue.queue[client.DBID] = client
-
-				// Send a message to the client informing it that it has joined the matchmaking queue.
-				client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCJoinedQueue, "Added to matchmaking queue"))
-
-				log.Printf("Client [%s] joined the matchmaking queue. Total clients: %v", client.PublicID, len(queue.queue))
+				// Add the client to the queue.
+				queue.join(client)
 
 				break
 			case disconnectRequest := <-queue.disconnect:
 
-				// Disconnect are handled later, so just add it to the removal queue.
+				// Disconnect are handled later, so just add it to the removal queue - unless the connection is already
+				// pending removal.
+				if pendingRemoval[disconnectRequest.ConnectionID] {
+					log.Printf("Ignoring duplicate disconnect request for client [%s] (connection [%s])", disconnectRequest.Client.PublicID, disconnectRequest.ConnectionID)
+					break
+				}
+
+				pendingRemoval[disconnectRequest.ConnectionID] = true
 				toRemove = append(toRemove, disconnectRequest)
 
 				break
 			case message := <-queue.broadcast:
 
-				// Broadcasted messages are simply broadcasted to all matches in the match map.
+				// Broadcasted messages are simply broadcasted to all matches in the match map, and to idle clients.
 				for _, client := range queue.queue {
 					client.SendMessage(message)
 
 				}
+
+				for _, client := range queue.idle {
+					client.SendMessage(message)
+				}
 				break
 			case command := <-queue.commands:
 
@@ -161,6 +245,11 @@ func (queue *Queue) MainLoop() {
 		// Remove any clients that are pending removal.
 		for index := len(toRemove) - 1; index >= 0; index-- {
 
+			// Idle clients are not in the queue, so they are removed separately.
+			if queue.removeIdle(toRemove[index]) {
+				continue
+			}
+
 			// If the client to be removed is found in the queue...
 			if client, ok := queue.queue[toRemove[index].Client.DBID]; ok {
 
@@ -173,7 +262,7 @@ func (queue *Queue) MainLoop() {
 				// Check to see if the connection identifier is the same - if it is, then we remove it.
 				// If not, it means that this client is actually a stale connection, and it has already
 				// been removed from the matchmaking queue.
-				if client.connection.UUID == toRemove[index].Client.connection.UUID {
+				if client.ConnectionID() == toRemove[index].ConnectionID {
 
 					// Delete the client from the matchmaking queue.
 					delete(queue.queue, toRemove[index].Client.DBID)
@@ -198,9 +287,9 @@ func (queue *Queue) MainLoop() {
 						indexIterator--
 					}
 
-					log.Printf("Client [%s] left the matchmaking queue. Total clients: %v", deletedClientPID, len(queue.queue))
+					log.Printf("Client [%s] (connection [%s]) left the matchmaking queue. Total clients: %v", deletedClientPID, toRemove[index].ConnectionID, len(queue.queue))
 				} else {
-					log.Printf("Client [%s] (stale connection) was removed from the matchmaking queue. Total clients: %v", deletedClientPID, len(queue.queue))
+					log.Printf("Client [%s] (stale connection [%s]) was removed from the matchmaking queue. Total clients: %v", deletedClientPID, toRemove[index].ConnectionID, len(queue.queue))
 				}
 			}
 		}
@@ -210,11 +299,29 @@ func (queue *Queue) MainLoop() {
 			client.Tick()
 		}
 
-		// Get a container containing all the clients that were paired up for a match.
-		newMatchedPairs := queue.matchMake()
+		// Tick the clients that left the queue, and disconnect any that have been idle for too long.
+		queue.tickIdle(start)
+
+		// Remove any clients that were banned after they connected.
+		queue.sweepBans(start)
+
+		// Forget recent opponents that are outside of the cooldown.
+		queue.pruneRecentOpponents(start)
+
+		// Announce any change to maintenance mode.
+		queue.updateMaintenance()
 
-		// Append all the new matchmade pairs to the matched pairs slice.
-		queue.matchedPairs = append(queue.matchedPairs, newMatchedPairs...)
+		// Pair up clients for a match - unless the game server is at capacity, in which case matchmaking is paused
+		// until the load drops, or the servers are in maintenance mode. Pairs that are already ready checking are
+		// unaffected.
+		if !queue.gameCapacity.AtCapacity() && !queue.maintenanceEnabled {
+
+			// Get a container containing all the clients that were paired up for a match.
+			newMatchedPairs := queue.matchMake()
+
+			// Append all the new matchmade pairs to the matched pairs slice.
+			queue.matchedPairs = append(queue.matchedPairs, newMatchedPairs...)
+		}
 
 		// Iterate backwards over the matched pairs - backwards so that they can be removed from the slice while
 		// iterating.
@@ -222,28 +329,33 @@ func (queue *Queue) MainLoop() {
 
 			// if the pair is not currently ready checking, it means that it is new to the matched pairs slice. In
 			// this case, we start inform the clients that a match was found, and start the ready checking process.
+			// Otherwise, resend the match found message to any clients that have not yet acknowledged it, in case the
+			// original message was lost.
 			if !queue.matchedPairs[index].IsReadyChecking {
 				queue.matchedPairs[index].SendMatchFoundMessage()
+			} else {
+				queue.matchedPairs[index].ResendMatchFoundMessage()
 			}
 
 			// Poll the ready check for the matched pair at the current index. If the function returns true,
 			// It means that the process has finished, and this pair should be removed from the matched pairs slice.
-			if queue.pollReadyCheck(queue.matchedPairs[index]) {
-
-				// If the slice only has 1 client pair, handle this as an edge case because we cant shrink it -
-				// instead we just overwrite it with a new empty slice. Otherwise, remove the last member of the
-				// matched pairs slice.
-				if len(queue.matchedPairs) == 1 {
-					queue.matchedPairs = make([]ClientPair, 0)
-				} else {
-					queue.matchedPairs = queue.matchedPairs[:len(queue.matchedPairs)-1]
-				}
+			if queue.pollReadyCheck(&queue.matchedPairs[index]) {
+				queue.removeMatchedPair(index)
 			}
 		}
 
+		// Update the queued client count, so that it can be read from other goroutines.
+		atomic.StoreInt64(&queue.queuedCount, int64(len(queue.queue)))
+
+		// Report whether the queue has drained - which it has once every ready check has finished.
+		queue.maintenance.ReportDrained(maintenanceServerName, len(queue.matchedPairs) == 0)
+
+		// Log the metrics, if it's time to do so.
+		queue.metrics.logPeriodically()
+
 		// Add a delay before the next iteration if the time taken is less than the designated poll time.
 		elapsed := time.Now().Sub(start)
-		remainingPollTime := pollTime - elapsed
+		remainingPollTime := queue.pollTime - elapsed
 		if remainingPollTime > 0 {
 			time.Sleep(remainingPollTime)
 		}
@@ -255,14 +367,80 @@ func (queue *Queue) AddClient(client *MMClient) {
 	queue.connect <- client
 }
 
+// join adds the specified client to the end of the matchmaking queue (or in place of an existing connection for the
+// same user), unless they are on a matchmaking cooldown. Only called from the main loop.
+func (queue *Queue) join(client *MMClient) {
+
+	// If the client is on a matchmaking cooldown due to failing too many ready checks, close the connection
+	// with the remaining cooldown (in seconds), and don't add them to the queue.
+	if remaining := queue.remainingCooldown(client.DBID); remaining > 0 {
+		client.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchmakingCooldown, strconv.Itoa(int(remaining.Seconds()+1))))
+
+		log.Printf("Client [%s] (connection [%s]) was refused from the matchmaking queue (cooldown)", client.PublicID, client.ConnectionID())
+
+		return
+	}
+
+	// If the user has an idle connection (one that left the queue), close it, as it is replaced by this one.
+	if idleClient, ok := queue.idle[client.DBID]; ok {
+		delete(queue.idle, client.DBID)
+		idleClient.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCDuplicateConnection, "Removing stale connection"))
+	}
+
+	// If a client with the same DBID already exists, we need to set it to be removed, and then
+	// update the new clients values to match
+	if oldClient, ok := queue.queue[client.DBID]; ok {
+
+		// Disconnect the old client
+		queue.Remove(oldClient, protocol.WSCDuplicateConnection, "Removing stale connection")
+
+		// Set the client ID, join time and priority on the new client to match the old one
+		client.ClientID = oldClient.ClientID
+		client.JoinTime = oldClient.JoinTime
+		client.priority = oldClient.priority
+
+	} else {
+
+		// Add the key to the client index, which doubles as a record of the join order of the clients.
+		queue.clientIndex = append(queue.clientIndex, client.DBID)
+
+		// Set the client ID on the client wit a new ID, and store the time at which they joined
+		client.ClientID = queue.getNextClientID()
+		client.JoinTime = time.Now()
+	}
+
+	// Add the client to the queue, and remember their recent opponents from the database (looked up as they connected).
+	queue.queue[client.DBID] = client
+	queue.recordRecentOpponents(client.DBID, client.recentOpponents, time.Now())
+
+	// If the client reconnected during a ready check that their previous connection was part of, resume it.
+	queue.resumeReadyCheck(client)
+
+	// Send a message to the client informing it that it has joined the matchmaking queue - and if the servers are in
+	// maintenance mode, that they won't be paired until it ends.
+	client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCJoinedQueue, "Added to matchmaking queue"))
+	if queue.maintenanceEnabled {
+		client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCServerAnnouncement, maintenance.Announcement(queue.maintenanceEnabled, queue.maintenanceShutdownTime)))
+	}
+
+	log.Printf("Client [%s] (connection [%s]) joined the matchmaking queue. Total clients: %v", client.PublicID, client.ConnectionID(), len(queue.queue))
+}
+
+// QueuedCount returns the number of clients in the queue, including those that are ready checking. Safe to call
+// from any goroutine.
+func (queue *Queue) QueuedCount() int {
+	return int(atomic.LoadInt64(&queue.queuedCount))
+}
+
 // Remove adds a client to the disconnect queue, to be disconnected next later, along with a reason code and a message.
 func (queue *Queue) Remove(client *MMClient, reason protocol.B2Code, message string) {
 
 	// Create a new disconnect request
 	disconnectRequest := DisconnectRequest{
-		Client:  client,
-		Reason:  reason,
-		Message: message,
+		Client:       client,
+		ConnectionID: client.ConnectionID(),
+		Reason:       reason,
+		Message:      message,
 	}
 
 	// Add it to the disconnect queue
@@ -274,18 +452,47 @@ func (queue *Queue) Broadcast(message protocol.Message) {
 	queue.broadcast <- message
 }
 
+// removeMatchedPair removes the pair at the specified index from the matched pairs slice. Only the pairs after it are
+// shifted down, so a backwards iteration over the slice can continue as normal.
+func (queue *Queue) removeMatchedPair(index int) {
+	queue.matchedPairs = append(queue.matchedPairs[:index], queue.matchedPairs[index+1:]...)
+}
+
+// isQueued returns true if the specified client (with the same connection) is still in the matchmaking queue.
+func (queue *Queue) isQueued(client *MMClient) bool {
+	queued, ok := queue.queue[client.DBID]
+	return ok && queued.connection.UUID == client.connection.UUID
+}
+
 // pollReadyCheck checks if the ready check for the specified client pair is complete. If complete, returns true.
 // This function also handles the ready checking logic, such as checking for failures, updating the a client that
 // the other client has "readied up".
-func (queue *Queue) pollReadyCheck(clientPair ClientPair) (finished bool) {
+func (queue *Queue) pollReadyCheck(clientPair *ClientPair) (finished bool) {
+
+	// Determine whether either client has vanished (their connection was closed, and they were removed from the queue)
+	// during the ready check.
+	client1Queued := queue.isQueued(clientPair.Client1)
+	client2Queued := queue.isQueued(clientPair.Client2)
+
+	// Determine whether either vanished client may still reconnect and be accepted automatically, in which case the
+	// ready check is kept alive until they do, or until the auto-accept window has elapsed.
+	now := time.Now()
+	client1Awaited := !client1Queued && queue.awaitingReconnect(clientPair.Client1, now)
+	client2Awaited := !client2Queued && queue.awaitingReconnect(clientPair.Client2, now)
+	if client1Awaited || client2Awaited {
+		return false
+	}
 
-	// Determine if this ready check has finished, by means of timing out.
-	timedOut := time.Now().Sub(clientPair.ReadyStart) > readyCheckTime
+	// Determine if this ready check has finished, by means of timing out. If either client vanished, there is no
+	// need to wait for the rest of the ready check.
+	readyCheckTime := queue.getTimeouts().ReadyCheckTime
+	timedOut := now.Sub(clientPair.ReadyStart) > readyCheckTime || !client1Queued || !client2Queued
 
 	// Determine the ready validity for each client. Essentially, a client is ready if they confirmed that they
-	// where ready within the ready check maximum time. The ready flag is checked first as it's fast and allows for an early exit.
-	client1ReadyValid := clientPair.Client1.Ready && clientPair.Client1.ReadyTime.Sub(clientPair.ReadyStart) <= readyCheckTime
-	client2ReadyValid := clientPair.Client2.Ready && clientPair.Client2.ReadyTime.Sub(clientPair.ReadyStart) <= readyCheckTime
+	// where ready within the ready check maximum time, and are still in the queue. The ready flag is checked first as
+	// it's fast and allows for an early exit.
+	client1ReadyValid := clientPair.Client1.Ready && clientPair.Client1.ReadyTime.Sub(clientPair.ReadyStart) <= readyCheckTime && client1Queued
+	client2ReadyValid := clientPair.Client2.Ready && clientPair.Client2.ReadyTime.Sub(clientPair.ReadyStart) <= readyCheckTime && client2Queued
 
 	// If the ready check is complete (either both clients are ready and valid, or the ready check ended with one or more
 	// clients not confirming that they where ready)...
@@ -294,6 +501,9 @@ func (queue *Queue) pollReadyCheck(clientPair ClientPair) (finished bool) {
 		// If the request timed out, and one of the clients was invalid, the match cannot be created.
 		if timedOut && (!client1ReadyValid || !client2ReadyValid) {
 
+			// Record the failed ready check.
+			queue.metrics.recordFailedReadyCheck()
+
 			// For each client, if they failed the ready check, boot them from the queue. Otherwise, make
 			// them elligible for matchmaking again.
 
@@ -301,11 +511,15 @@ func (queue *Queue) pollReadyCheck(clientPair ClientPair) (finished bool) {
 
 				// Remove the client from the matchmaking queue.
 				queue.Remove(clientPair.Client1, protocol.WSCReadyCheckFailed, "")
+
+				// Record the failure, so that clients that repeatedly fail ready checks can be penalized.
+				queue.recordReadyCheckFailure(clientPair.Client1.DBID)
 			} else {
 
 				// Reset their ready checking flags, so that they can be picked up by the matchmaking function again.
-				clientPair.Client1.IsReadyChecking = false
-				clientPair.Client1.Ready = false
+				// They keep their place in the queue, and are prioritized, as they did nothing wrong.
+				clientPair.Client1.resetReadyCheck()
+				clientPair.Client1.priority = true
 
 				// Then send a message to the client informing them that their opponent did not accept the match.
 				clientPair.Client1.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCOpponentDidNotAccept, ""))
@@ -315,11 +529,15 @@ func (queue *Queue) pollReadyCheck(clientPair ClientPair) (finished bool) {
 
 				// Remove the client from the matchmaking queue.
 				queue.Remove(clientPair.Client2, protocol.WSCReadyCheckFailed, "")
+
+				// Record the failure, so that clients that repeatedly fail ready checks can be penalized.
+				queue.recordReadyCheckFailure(clientPair.Client2.DBID)
 			} else {
 
 				// Reset their ready checking flags, so that they can be picked up by the matchmaking function again.
-				clientPair.Client2.IsReadyChecking = false
-				clientPair.Client2.Ready = false
+				// They keep their place in the queue, and are prioritized, as they did nothing wrong.
+				clientPair.Client2.resetReadyCheck()
+				clientPair.Client2.priority = true
 
 				// Then send a message to the client informing them that their opponent did not accept the match.
 				clientPair.Client2.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCOpponentDidNotAccept, ""))
@@ -332,18 +550,42 @@ func (queue *Queue) pollReadyCheck(clientPair ClientPair) (finished bool) {
 
 		// If we reach here, then both clients accepted the match and therefore a match can be created.
 
-		// Create a match, and get the returned match ID. Failures are not not handled properly at the moment.
-		matchID, err := database.CreateMatch(clientPair.Client1.DBID, clientPair.Client2.DBID)
+		// Create a match, and get the returned match ID. Matchmade matches are ranked, so they use the default turn time.
+		// The clients' display names, avatars and MMRs are stored with the match, so that the game server doesn't need
+		// to fetch them again.
+		matchID, err := queue.store.CreateMatch(clientPair.Client1.matchPlayer(), clientPair.Client2.matchPlayer(), 0)
 		if err != nil {
 
-			// In the event of an error, the match was not created properly, so just boot the players out
-			// with a ready check failed code and hope they try again.
-			queue.Remove(clientPair.Client1, protocol.WSCReadyCheckFailed, "")
-			queue.Remove(clientPair.Client2, protocol.WSCReadyCheckFailed, "")
+			// In the event of an error, the match was not created properly. Neither client is at fault, so inform
+			// them, and reset their ready checking flags so that they can be paired again - keeping their places in
+			// the queue.
+			clientPair.Client1.resetReadyCheck()
+			clientPair.Client2.resetReadyCheck()
+
+			clientPair.Client1.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchCreationFailed, ""))
+			clientPair.Client2.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchCreationFailed, ""))
 
 			log.Printf("Failed to create a match: %s", err.Error())
+
+			// Return true, indicating that the specified client pair should be removed from the matched pairs slice.
+			return true
 		}
 
+		// Record the wait times and match quality for the newly created match, and remember that the clients played
+		// each other, so that they aren't paired with each other again straight away.
+		queue.metrics.recordConfirmedPair(*clientPair)
+		queue.recordConfirmedOpponents(clientPair, now)
+
+		// The match is going ahead, so neither client needs to be prioritized any more.
+		clientPair.Client1.priority = false
+		clientPair.Client2.priority = false
+
+		// Both clients are about to move to the game server, so their connections are removed from the session
+		// registry before they are told about the match - rather than when the queue removes them on a later tick, by
+		// which time they may already be connecting to the game server, and be refused as a duplicate login.
+		clientPair.Client1.unregisterSession()
+		clientPair.Client2.unregisterSession()
+
 		// Send the match confirmation message to both clients, with the newly created match's ID.
 		clientPair.SendMatchConfirmedMessage(matchID)
 
@@ -380,52 +622,70 @@ func (queue *Queue) pollReadyCheck(clientPair ClientPair) (finished bool) {
 	return false
 }
 
-// matchMake goes through the matchmaking queue and pairs up clients based various factors*
+// matchMake goes through the matchmaking queue and pairs up clients, so that the players in each pair are as close in
+// MMR as possible (see pairByMMR), without pairing recent opponents with each other (see canPair).
 //
-// Note - Currently just works on a first come first serve basis, but should be changed to take into account ELO, queue
-// size, wait time, position in the queue etc.. An empty return array indicates that no clients were paired up.
+// Clients with a region hint are first paired with clients from the same region. Then, every remaining client that is
+// allowed to be paired cross-region (see canPairCrossRegion) is paired regardless of region. Prioritized clients
+// (whose last ready check failed through no fault of their own) are only left unpaired if there is no alternative. An
+// empty return array indicates that no clients were paired up.
 func (queue *Queue) matchMake() (pairs []ClientPair) {
 
 	// Initialize an empty slice to return.
 	pairs = make([]ClientPair, 0)
 
-	// Initialize an empty client pair, which will be replaced after being filled.
-	currentPair := ClientPair{}
-
-	// Iterate over all the clients indices in the client index slice.
+	// Group the clients that are eligible for matchmaking by region, in join order. Invalid indices are ignored, as
+	// are clients that are currently ready checking. Clients without a region hint go straight to the cross-region
+	// pool.
+	regions := make(map[string][]*MMClient)
+	regionOrder := make([]string, 0)
+	crossRegion := make([]*MMClient, 0)
 	for _, clientIndex := range queue.clientIndex {
+		client, ok := queue.queue[clientIndex]
+		if !ok || client.IsReadyChecking {
+			continue
+		}
 
-		// Attempt to get the client - validate the index first. Invalid indices are ignored.
-		if client, ok := queue.queue[clientIndex]; ok {
+		if client.Region == "" {
+			crossRegion = append(crossRegion, client)
+			continue
+		}
 
-			// Ignore the client if it is currently ready checking as this means it is not eligible for matchmaking.
-			if !client.IsReadyChecking {
+		if _, ok := regions[client.Region]; !ok {
+			regionOrder = append(regionOrder, client.Region)
+		}
 
-				// If the client pair declared earlier has a nil value for client 1, set this client as client 1.
-				// Otherwise, set it as client 2, append it to the pairs slice, and then reset the client pair
-				// back to an empty one.
-				if currentPair.Client1 == nil {
-					currentPair.Client1 = client
-				} else {
-					currentPair.Client2 = client
-					pairs = append(pairs, currentPair)
-					currentPair = ClientPair{}
-				}
+		regions[client.Region] = append(regions[client.Region], client)
+	}
+
+	// Clients that were recently paired with each other are not paired again, unless one of them has waited long
+	// enough (see canPair).
+	now := time.Now()
+	allowed := func(client1 *MMClient, client2 *MMClient) bool {
+		return queue.canPair(client1, client2, now)
+	}
+
+	// Pair up the clients within each region. The regions are visited in a fixed order, so that the result is
+	// deterministic. Clients that are left unpaired join the cross-region pool, if they have waited long enough.
+	for _, region := range regionOrder {
+		regionPairs, unpaired := pairAllowedByMMR(regions[region], allowed)
+		pairs = append(pairs, regionPairs...)
+
+		for _, client := range unpaired {
+			if client.canPairCrossRegion(now) {
+				crossRegion = append(crossRegion, client)
 			}
 		}
 	}
 
+	// Pair up the clients in the cross-region pool.
+	crossRegionPairs, _ := pairAllowedByMMR(crossRegion, allowed)
+	pairs = append(pairs, crossRegionPairs...)
+
 	// Return the pairs that were found
 	return pairs
 }
 
-// processCommand handles server commands.
-//
-// Note - not yet implemented, but prints out some diagonstics and returns with a noop.
-func (queue *Queue) processCommand(command protocol.Command) {
-	log.Printf("Processing command of type [ %v ] with data [ %v ]", command.Type, command.Data)
-}
-
 //
 func (queue *Queue) getNextClientID() uint64 {
 
@@ -0,0 +1,210 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/6a/blade-ii-game-server/internal/connection"
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// TestRemoveMatchedPair checks that the finished pairs are removed from the matched pairs, wherever they are in the
+// slice, while iterating backwards over it as the main loop does - and that the pairs that are still ready checking
+// are kept. Previously, the last pair was removed rather than the finished one, so the finished pair was polled again
+// forever, and the last pair was never matched.
+func TestRemoveMatchedPair(t *testing.T) {
+	tests := []struct {
+		name     string
+		finished []bool
+		expected [][2]uint64
+	}{
+		{"Only pair", []bool{true}, [][2]uint64{}},
+		{"First pair", []bool{true, false, false}, [][2]uint64{{3, 4}, {5, 6}}},
+		{"Middle pair", []bool{false, true, false}, [][2]uint64{{1, 2}, {5, 6}}},
+		{"Last pair", []bool{false, false, true}, [][2]uint64{{1, 2}, {3, 4}}},
+		{"Several pairs", []bool{true, false, true, false}, [][2]uint64{{3, 4}, {7, 8}}},
+		{"Every pair", []bool{true, true, true}, [][2]uint64{}},
+		{"No pairs", []bool{false, false}, [][2]uint64{{1, 2}, {3, 4}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := &Queue{}
+			finished := make(map[uint64]bool)
+			for index, done := range test.finished {
+				dbid := uint64(index*2 + 1)
+				queue.matchedPairs = append(queue.matchedPairs, ClientPair{Client1: &MMClient{DBID: dbid}, Client2: &MMClient{DBID: dbid + 1}})
+				finished[dbid] = done
+			}
+
+			for index := len(queue.matchedPairs) - 1; index >= 0; index-- {
+				if finished[queue.matchedPairs[index].Client1.DBID] {
+					queue.removeMatchedPair(index)
+				}
+			}
+
+			if ids := pairIDs(queue.matchedPairs); !reflect.DeepEqual(ids, test.expected) {
+				t.Fatalf("Matched pairs are %v, expected %v", ids, test.expected)
+			}
+		})
+	}
+}
+
+// failingCreateStore is a test store that fails to create matches.
+type failingCreateStore struct {
+	*teststore.Store
+}
+
+// CreateMatch always fails.
+func (store failingCreateStore) CreateMatch(player1 database.MatchPlayer, player2 database.MatchPlayer, turnTime time.Duration) (matchID uint64, err error) {
+	return 0, errors.New("database unavailable")
+}
+
+// newTestMMClient returns a client with the specified database ID and client ID, whose connection is the server side
+// of a real websocket, without starting its message pumps - so that the messages sent to it stay in its outbound queue.
+func newTestMMClient(t *testing.T, dbid uint64, clientID uint64) *MMClient {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade the connection: %v", err)
+			return
+		}
+
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial the test server: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	conn := <-conns
+	t.Cleanup(func() { conn.Close() })
+
+	return &MMClient{
+		DBID:       dbid,
+		ClientID:   clientID,
+		MMR:        1000,
+		connection: connection.NewConnection(conn, protocol.CurrentVersion, protocol.EncodingJSON),
+	}
+}
+
+// sentCodes returns the codes of the messages in the specified client's outbound queue, emptying it.
+func sentCodes(client *MMClient) []protocol.B2Code {
+	codes := make([]protocol.B2Code, 0)
+	for len(client.connection.OutboundMessageQueue) > 0 {
+		codes = append(codes, client.connection.GetNextOutboundMessage().Payload.Code)
+	}
+
+	return codes
+}
+
+// TestReadyCheckFailure checks the ready checks that fail through no fault of the client that accepted them - either
+// because their opponent vanished, or because the match couldn't be created. Each client that accepted is told why,
+// and keeps their place in the queue (their client ID, and their position in the join order), rather than being
+// re-appended at the back. A client that vanished is removed as having failed the ready check, and their opponent is
+// prioritized.
+func TestReadyCheckFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		vanished bool
+		expected [2][]protocol.B2Code
+		priority bool
+	}{
+		{
+			name:     "Opponent vanished",
+			vanished: true,
+			expected: [2][]protocol.B2Code{{protocol.WSCOpponentDidNotAccept}, {}},
+			priority: true,
+		},
+		{
+			name:     "Match creation failed",
+			vanished: false,
+			expected: [2][]protocol.B2Code{{protocol.WSCMatchCreationFailed}, {protocol.WSCMatchCreationFailed}},
+			priority: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := &Queue{
+				queue:      make(map[uint64]*MMClient),
+				penalties:  make(map[uint64]*readyCheckPenalty),
+				metrics:    newQueueMetrics(),
+				disconnect: make(chan DisconnectRequest, 2),
+				store:      failingCreateStore{teststore.NewStore()},
+				timeouts:   DefaultTimeouts(),
+			}
+
+			// Three clients join in order, and the first two are paired and accept the ready check.
+			now := time.Now()
+			clients := []*MMClient{newTestMMClient(t, 1, 1), newTestMMClient(t, 2, 2), newTestMMClient(t, 3, 3)}
+			for _, client := range clients {
+				queue.queue[client.DBID] = client
+				queue.clientIndex = append(queue.clientIndex, client.DBID)
+			}
+
+			pair := ClientPair{Client1: clients[0], Client2: clients[1], ReadyStart: now, IsReadyChecking: true}
+			for _, client := range clients[:2] {
+				client.IsReadyChecking = true
+				client.Ready = true
+				client.ReadyTime = now
+			}
+
+			// The second client's connection closes, removing them from the queue.
+			if test.vanished {
+				delete(queue.queue, clients[1].DBID)
+			}
+
+			if finished := queue.pollReadyCheck(&pair); !finished {
+				t.Fatalf("Ready check didn't finish")
+			}
+
+			for index, client := range clients[:2] {
+				if codes := sentCodes(client); !reflect.DeepEqual(codes, test.expected[index]) {
+					t.Fatalf("Client %d was sent %v, expected %v", client.DBID, codes, test.expected[index])
+				}
+			}
+
+			if test.vanished {
+				if request := <-queue.disconnect; request.Client != clients[1] || request.Reason != protocol.WSCReadyCheckFailed {
+					t.Fatalf("Client %d was removed with reason [%d], expected client 2 with reason [%d]", request.Client.DBID, request.Reason, protocol.WSCReadyCheckFailed)
+				}
+			}
+
+			if len(queue.disconnect) != 0 {
+				t.Fatalf("%d more clients were removed from the queue, expected none", len(queue.disconnect))
+			}
+
+			// The accepting client keeps their place ahead of the client that joined after them, and can be paired again.
+			accepted := queue.queue[clients[0].DBID]
+			if accepted != clients[0] || accepted.ClientID != 1 || accepted.IsReadyChecking || accepted.priority != test.priority {
+				t.Fatalf("Accepted client is %+v, expected client 1 to still be queued and not ready checking, with priority %v", accepted, test.priority)
+			}
+
+			if !reflect.DeepEqual(queue.clientIndex, []uint64{1, 2, 3}) {
+				t.Fatalf("Join order is %v, expected [1 2 3]", queue.clientIndex)
+			}
+		})
+	}
+}
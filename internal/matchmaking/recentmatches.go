@@ -0,0 +1,96 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+const (
+
+	// recentMatchesLimit is the maximum number of recent matches that are sent to a client.
+	recentMatchesLimit = 10
+
+	// recentMatchDelimiter is the delimiter used to separate each recent match in a recent matches response.
+	recentMatchDelimiter = ":"
+
+	// recentMatchDataDelimiter is the delimiter used to separate the fields of a single recent match.
+	recentMatchDataDelimiter = "."
+)
+
+// Results for a recent match, from the perspective of the client that requested them.
+const (
+	recentMatchLoss = "0"
+	recentMatchWin  = "1"
+	recentMatchDraw = "2"
+)
+
+// sendRecentMatches asynchronously fetches the recent matches for this client from the database, and sends them to
+// the client. The database query is performed in a goroutine so that the matchmaking queue is not blocked.
+func (client *MMClient) sendRecentMatches() {
+	go func() {
+
+		// Fetch the recent matches - on error, log it and send an empty list.
+		matches, err := client.queue.store.GetRecentMatches(client.DBID, recentMatchesLimit)
+		if err != nil {
+			log.Printf("Error getting recent matches for user [ %d ]: %s", client.DBID, err.Error())
+		}
+
+		// Don't bother sending the response if the client was disconnected in the meantime.
+		if client.isPendingKill() {
+			return
+		}
+
+		client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCRecentMatchesResponse, serializeRecentMatches(client.DBID, matches)))
+	}()
+}
+
+// serializeRecentMatches returns the string representation of the specified recent matches, from the perspective of
+// the user with the specified database ID.
+//
+// Format:
+//
+// <name>.<result>.<end>:<name>.<result>.<end>...
+//
+// Where result is 0 for a loss, 1 for a win, and 2 for a draw, and end is the unix timestamp (in seconds) at which
+// the match ended.
+func serializeRecentMatches(databaseID uint64, matches []database.RecentMatch) string {
+
+	// Create a string builder.
+	var builder strings.Builder
+
+	// Write each match to the string builder.
+	for index, match := range matches {
+
+		// Write the delimiter between matches.
+		if index > 0 {
+			builder.WriteString(recentMatchDelimiter)
+		}
+
+		// Determine the result of the match.
+		result := recentMatchLoss
+		if match.Winner == 0 {
+			result = recentMatchDraw
+		} else if match.Winner == databaseID {
+			result = recentMatchWin
+		}
+
+		// Write the opponent's display name, the result, and the end time.
+		builder.WriteString(match.OpponentDisplayName)
+		builder.WriteString(recentMatchDataDelimiter)
+		builder.WriteString(result)
+		builder.WriteString(recentMatchDataDelimiter)
+		builder.WriteString(strconv.FormatInt(match.End.Unix(), 10))
+	}
+
+	// Return the string builder as a string.
+	return builder.String()
+}
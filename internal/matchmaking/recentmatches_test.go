@@ -0,0 +1,44 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+)
+
+// TestSerializeRecentMatches checks the serialized recent matches, from the perspective of the user with database ID 1.
+func TestSerializeRecentMatches(t *testing.T) {
+	end := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name     string
+		matches  []database.RecentMatch
+		expected string
+	}{
+		{"No matches", nil, ""},
+		{"Win", []database.RecentMatch{{OpponentDisplayName: "Rean", Winner: 1, End: end}}, "Rean.1.1600000000"},
+		{"Loss", []database.RecentMatch{{OpponentDisplayName: "Rean", Winner: 2, End: end}}, "Rean.0.1600000000"},
+		{"Draw", []database.RecentMatch{{OpponentDisplayName: "Rean", End: end}}, "Rean.2.1600000000"},
+		{
+			"Several matches",
+			[]database.RecentMatch{
+				{OpponentDisplayName: "Rean", Winner: 1, End: end.Add(time.Minute)},
+				{OpponentDisplayName: "Alisa", Winner: 3, End: end},
+			},
+			"Rean.1.1600000060:Alisa.0.1600000000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if serialized := serializeRecentMatches(1, test.matches); serialized != test.expected {
+				t.Fatalf("Serialized [%s], expected [%s]", serialized, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+const (
+
+	// defaultRecentOpponentLimit is the default number of recent opponents that are remembered for each client.
+	defaultRecentOpponentLimit = 3
+
+	// defaultRecentOpponentCooldown is the default duration after a match, during which its players are not paired
+	// with each other again.
+	defaultRecentOpponentCooldown = time.Minute * 10
+
+	// defaultRecentOpponentRelaxWait is the default time in the queue after which a client can be paired with a recent
+	// opponent anyway.
+	defaultRecentOpponentRelaxWait = time.Second * 30
+)
+
+var (
+
+	// recentOpponentLimit is the number of recent opponents that are remembered for each client. Configured via the
+	// "mm_recent_opponent_limit" environment variable.
+	recentOpponentLimit = envvar.Int("mm_recent_opponent_limit", defaultRecentOpponentLimit)
+
+	// recentOpponentCooldown is the duration after a match, during which its players are not paired with each other
+	// again. Configured via the "mm_recent_opponent_cooldown" environment variable.
+	recentOpponentCooldown = envvar.Duration("mm_recent_opponent_cooldown", defaultRecentOpponentCooldown)
+
+	// recentOpponentRelaxWait is the time in the queue after which a client can be paired with a recent opponent
+	// anyway, so that the queue isn't starved when there is no one else to play. Configured via the
+	// "mm_recent_opponent_relax_wait" environment variable.
+	recentOpponentRelaxWait = envvar.Duration("mm_recent_opponent_relax_wait", defaultRecentOpponentRelaxWait)
+)
+
+// recentOpponent is an opponent that a client was recently paired with, and the time at which they were paired (or
+// at which their match ended, if it was read from the database).
+type recentOpponent struct {
+	dbid uint64
+	time time.Time
+}
+
+// lookupRecentOpponents fetches the recent opponents for the client with the specified database ID from the database,
+// so that matches played before the client rejoined the queue (or before the server was restarted) are taken into
+// account. Errors are logged, and no opponents are returned. Blocks, so it should not be called from the main loop.
+func (queue *Queue) lookupRecentOpponents(dbid uint64) []recentOpponent {
+	if recentOpponentLimit <= 0 {
+		return nil
+	}
+
+	opponents, err := queue.store.GetRecentOpponents(dbid, recentOpponentLimit)
+	if err != nil {
+		log.Printf("Error getting recent opponents for user [ %d ]: %s", dbid, err.Error())
+		return nil
+	}
+
+	return toRecentOpponents(opponents)
+}
+
+// toRecentOpponents is a helper function that converts the specified recent opponents, as read from the database.
+func toRecentOpponents(opponents []database.RecentOpponent) []recentOpponent {
+	converted := make([]recentOpponent, len(opponents))
+	for index, opponent := range opponents {
+		converted[index] = recentOpponent{dbid: opponent.DatabaseID, time: opponent.End}
+	}
+
+	return converted
+}
+
+// recordRecentOpponents merges the specified recent opponents into those remembered for the client with the specified
+// database ID. Only the latest time is kept for each opponent, and only the most recent opponents (up to the limit)
+// that are still within the cooldown are kept. Only called from the main loop.
+func (queue *Queue) recordRecentOpponents(dbid uint64, opponents []recentOpponent, now time.Time) {
+	merged := queue.recentOpponents[dbid]
+
+	for _, opponent := range opponents {
+
+		// Update the time for an opponent that is already remembered, or add them if they aren't.
+		found := false
+		for index := range merged {
+			if merged[index].dbid == opponent.dbid {
+				if opponent.time.After(merged[index].time) {
+					merged[index].time = opponent.time
+				}
+
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			merged = append(merged, opponent)
+		}
+	}
+
+	queue.setRecentOpponents(dbid, merged, now)
+}
+
+// setRecentOpponents stores the specified recent opponents for the client with the specified database ID, after
+// dropping those that are outside of the cooldown and keeping only the most recent (up to the limit). Only called from
+// the main loop.
+func (queue *Queue) setRecentOpponents(dbid uint64, opponents []recentOpponent, now time.Time) {
+
+	// Drop the opponents that are outside of the cooldown.
+	kept := opponents[:0]
+	for _, opponent := range opponents {
+		if now.Sub(opponent.time) < recentOpponentCooldown {
+			kept = append(kept, opponent)
+		}
+	}
+
+	// Keep the most recent opponents, up to the limit - with a simple insertion sort, as there are only a few.
+	for index := 1; index < len(kept); index++ {
+		for sorted := index; sorted > 0 && kept[sorted].time.After(kept[sorted-1].time); sorted-- {
+			kept[sorted], kept[sorted-1] = kept[sorted-1], kept[sorted]
+		}
+	}
+
+	if len(kept) > recentOpponentLimit {
+		kept = kept[:recentOpponentLimit]
+	}
+
+	if len(kept) == 0 {
+		delete(queue.recentOpponents, dbid)
+		return
+	}
+
+	queue.recentOpponents[dbid] = kept
+}
+
+// recordConfirmedOpponents remembers that the clients in the specified pair were paired with each other, as their
+// match was confirmed. Only called from the main loop.
+func (queue *Queue) recordConfirmedOpponents(clientPair *ClientPair, now time.Time) {
+	queue.recordRecentOpponents(clientPair.Client1.DBID, []recentOpponent{{dbid: clientPair.Client2.DBID, time: now}}, now)
+	queue.recordRecentOpponents(clientPair.Client2.DBID, []recentOpponent{{dbid: clientPair.Client1.DBID, time: now}}, now)
+}
+
+// playedRecently returns true if the clients with the specified database IDs were paired with each other within the
+// cooldown. Only called from the main loop.
+func (queue *Queue) playedRecently(dbid1 uint64, dbid2 uint64, now time.Time) bool {
+	for _, opponent := range queue.recentOpponents[dbid1] {
+		if opponent.dbid == dbid2 && now.Sub(opponent.time) < recentOpponentCooldown {
+			return true
+		}
+	}
+
+	for _, opponent := range queue.recentOpponents[dbid2] {
+		if opponent.dbid == dbid1 && now.Sub(opponent.time) < recentOpponentCooldown {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canPair returns true if the specified clients can be paired with each other - either because they haven't played
+// each other within the cooldown, or because one of them has waited long enough that they'd rather play a recent
+// opponent than wait for someone else. Only called from the main loop.
+func (queue *Queue) canPair(client1 *MMClient, client2 *MMClient, now time.Time) bool {
+	if !queue.playedRecently(client1.DBID, client2.DBID, now) {
+		return true
+	}
+
+	return now.Sub(client1.JoinTime) >= recentOpponentRelaxWait || now.Sub(client2.JoinTime) >= recentOpponentRelaxWait
+}
+
+// pruneRecentOpponents forgets the recent opponents that are outside of the cooldown, for every client. Runs at most
+// once per cooldown, as the remembered opponents are otherwise only pruned when they are updated. Only called from the
+// main loop.
+func (queue *Queue) pruneRecentOpponents(now time.Time) {
+	if now.Before(queue.nextRecentOpponentPrune) {
+		return
+	}
+
+	queue.nextRecentOpponentPrune = now.Add(recentOpponentCooldown)
+
+	for dbid, opponents := range queue.recentOpponents {
+		queue.setRecentOpponents(dbid, opponents, now)
+	}
+}
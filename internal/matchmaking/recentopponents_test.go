@@ -0,0 +1,79 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRecentOpponentCooldown simulates two players re-queuing repeatedly, along with a third occasional player, and
+// checks that recent opponents are only paired with each other again once one of them has waited for the relax wait,
+// or the cooldown has elapsed - and that the occasional player is paired with whoever they didn't just play.
+func TestRecentOpponentCooldown(t *testing.T) {
+	rounds := []struct {
+		name            string
+		join            []uint64
+		relax           []uint64
+		cooldownElapsed bool
+		expected        [][2]uint64
+	}{
+		{"First match", []uint64{1, 2}, nil, false, [][2]uint64{{1, 2}}},
+		{"Both re-queue", []uint64{1, 2}, nil, false, [][2]uint64{}},
+		{"Occasional player joins", []uint64{3}, nil, false, [][2]uint64{{1, 3}}},
+		{"Occasional player re-queues", []uint64{1, 3}, nil, false, [][2]uint64{{2, 3}}},
+		{"Recent opponent re-queues", []uint64{2}, nil, false, [][2]uint64{}},
+		{"Relax wait", nil, []uint64{1}, false, [][2]uint64{{1, 2}}},
+		{"Cooldown elapsed", []uint64{1, 2}, nil, true, [][2]uint64{{1, 2}}},
+	}
+
+	queue := &Queue{queue: make(map[uint64]*MMClient), recentOpponents: make(map[uint64][]recentOpponent)}
+
+	var nextClientID uint64
+	for _, round := range rounds {
+		now := time.Now()
+
+		for _, dbid := range round.join {
+			nextClientID++
+			queue.queue[dbid] = &MMClient{DBID: dbid, MMR: 1000, JoinTime: now, ClientID: nextClientID}
+			queue.clientIndex = append(queue.clientIndex, dbid)
+		}
+
+		for _, dbid := range round.relax {
+			queue.queue[dbid].JoinTime = now.Add(-recentOpponentRelaxWait)
+		}
+
+		if round.cooldownElapsed {
+			for _, opponents := range queue.recentOpponents {
+				for index := range opponents {
+					opponents[index].time = opponents[index].time.Add(-recentOpponentCooldown)
+				}
+			}
+		}
+
+		pairs := queue.matchMake()
+		if ids := pairIDs(pairs); !reflect.DeepEqual(ids, round.expected) {
+			t.Fatalf("%s: clients were paired as %v, expected %v", round.name, ids, round.expected)
+		}
+
+		// Confirm the matches, and take the players out of the queue.
+		for index := range pairs {
+			queue.recordConfirmedOpponents(&pairs[index], now)
+
+			delete(queue.queue, pairs[index].Client1.DBID)
+			delete(queue.queue, pairs[index].Client2.DBID)
+		}
+
+		remaining := make([]uint64, 0, len(queue.clientIndex))
+		for _, dbid := range queue.clientIndex {
+			if _, ok := queue.queue[dbid]; ok {
+				remaining = append(remaining, dbid)
+			}
+		}
+
+		queue.clientIndex = remaining
+	}
+}
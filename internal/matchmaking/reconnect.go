@@ -0,0 +1,98 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"log"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// reconnectAutoAcceptWindow is the duration for which a ready check is kept alive after one of its clients vanishes,
+// so that the client can reconnect and be accepted automatically. Zero (the default) disables auto-accepting, in which
+// case a ready check fails as soon as one of its clients vanishes. Configured via the
+// "mm_reconnect_auto_accept_window" environment variable.
+var reconnectAutoAcceptWindow = envvar.Duration("mm_reconnect_auto_accept_window", 0)
+
+// awaitingReconnect returns true if the specified client has vanished from the queue during a ready check, but may
+// still reconnect within the auto-accept window. The time at which the client was first seen to have vanished is
+// recorded on the client.
+func (queue *Queue) awaitingReconnect(client *MMClient, now time.Time) bool {
+
+	// Noop if auto-accepting is disabled.
+	if reconnectAutoAcceptWindow <= 0 {
+		return false
+	}
+
+	// Record the time at which the client vanished, if this is the first time it has been noticed.
+	if client.vanishedTime.IsZero() {
+		client.vanishedTime = now
+	}
+
+	return now.Sub(client.vanishedTime) <= reconnectAutoAcceptWindow
+}
+
+// resumeReadyCheck looks for a ready check that the specified (newly connected) client's previous connection was part
+// of, and if the client reconnected within the auto-accept window, swaps them into the pair in place of the previous
+// connection, and treats them as ready. Returns true if the client was swapped into a pair.
+func (queue *Queue) resumeReadyCheck(client *MMClient) bool {
+
+	// Noop if auto-accepting is disabled.
+	if reconnectAutoAcceptWindow <= 0 {
+		return false
+	}
+
+	now := time.Now()
+
+	for index := range queue.matchedPairs {
+		pair := &queue.matchedPairs[index]
+		if !pair.IsReadyChecking {
+			continue
+		}
+
+		// Find the slot (if any) that holds a previous connection for the client, along with the opponent.
+		slot, opponent := &pair.Client1, pair.Client2
+		if pair.Client2.DBID == client.DBID {
+			slot, opponent = &pair.Client2, pair.Client1
+		} else if pair.Client1.DBID != client.DBID {
+			continue
+		}
+
+		// The pair is only still valid if the opponent is still in the queue, and the previous connection vanished
+		// (or is being replaced right now) within the auto-accept window.
+		previous := *slot
+		if previous == client || !queue.isQueued(opponent) {
+			return false
+		}
+
+		if !previous.vanishedTime.IsZero() && now.Sub(previous.vanishedTime) > reconnectAutoAcceptWindow {
+			return false
+		}
+
+		// Swap the client into the pair, and treat them as having accepted the match when the ready check started, so
+		// that the acceptance is within the ready check time.
+		*slot = client
+		client.IsReadyChecking = true
+		client.MatchFoundAcknowledged = true
+		client.Ready = true
+		client.ReadyTime = pair.ReadyStart
+
+		// Let the client know about the match that they were accepted into, and whether their opponent has already
+		// accepted it.
+		sendMatchFoundMessage(client, opponent)
+		if opponent.Ready {
+			client.SendMessage(protocol.NewMessage(protocol.WSMTText, protocol.WSCOpponentAccepted, ""))
+		}
+
+		log.Printf("Client [%s] (connection [%s]) reconnected during a ready check, and was accepted automatically", client.PublicID, client.ConnectionID())
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// defaultRegionFallbackWait is the default duration that a client with a region hint waits in the queue before they
+// can be paired with clients from other regions.
+const defaultRegionFallbackWait = time.Second * 30
+
+// regionFallbackWait is the duration that a client with a region hint waits in the queue before they can be paired
+// with clients from other regions. Configured via the "mm_region_fallback_wait" environment variable.
+var regionFallbackWait = envvar.Duration("mm_region_fallback_wait", defaultRegionFallbackWait)
+
+// regionRegex matches valid region hints - short, lowercase alphabetic strings such as "eu", "na" or "ap".
+var regionRegex = regexp.MustCompile(`^[a-z]{1,8}$`)
+
+// normalizeRegion returns the specified region hint in its normalized (lowercase) form. Invalid region hints are
+// returned as an empty string, which means that the client has no region preference.
+func normalizeRegion(region string) string {
+	region = strings.ToLower(strings.TrimSpace(region))
+	if !regionRegex.MatchString(region) {
+		return ""
+	}
+
+	return region
+}
+
+// canPairCrossRegion returns true if the specified client can be paired with a client from another region - either
+// because they have no region preference, or because they have waited long enough.
+func (client *MMClient) canPairCrossRegion(now time.Time) bool {
+	return client.Region == "" || now.Sub(client.JoinTime) >= regionFallbackWait
+}
+
+// isSameRegion returns true if the specified clients both have the same region hint.
+func isSameRegion(client1 *MMClient, client2 *MMClient) bool {
+	return client1.Region != "" && client1.Region == client2.Region
+}
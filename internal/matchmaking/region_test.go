@@ -0,0 +1,159 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package matchmaking
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testQueueClient describes a client in a test queue - their region hint, and how long ago they joined the queue.
+type testQueueClient struct {
+	region string
+	waited time.Duration
+}
+
+// newTestQueue returns a queue containing the specified clients, in join order, all with the same MMR. Each client's
+// database ID is their index in the slice, plus one.
+func newTestQueue(clients []testQueueClient) *Queue {
+	queue := &Queue{queue: make(map[uint64]*MMClient)}
+
+	now := time.Now()
+	for index, client := range clients {
+		dbid := uint64(index + 1)
+		queue.queue[dbid] = &MMClient{
+			DBID:     dbid,
+			MMR:      1000,
+			Region:   client.region,
+			JoinTime: now.Add(-client.waited),
+			ClientID: dbid,
+		}
+
+		queue.clientIndex = append(queue.clientIndex, dbid)
+	}
+
+	return queue
+}
+
+// pairIDs returns the database IDs of the clients in each of the specified pairs.
+func pairIDs(pairs []ClientPair) [][2]uint64 {
+	ids := make([][2]uint64, 0, len(pairs))
+	for _, pair := range pairs {
+		ids = append(ids, [2]uint64{pair.Client1.DBID, pair.Client2.DBID})
+	}
+
+	return ids
+}
+
+// TestNormalizeRegion checks that region hints are lowercased and trimmed, and that anything that isn't a short
+// alphabetic code is treated as no region preference.
+func TestNormalizeRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   string
+		expected string
+	}{
+		{"Lowercase", "eu", "eu"},
+		{"Uppercase", "NA", "na"},
+		{"Whitespace", " ap ", "ap"},
+		{"Empty", "", ""},
+		{"Too long", "antarctica", ""},
+		{"Not alphabetic", "eu-1", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if region := normalizeRegion(test.region); region != test.expected {
+				t.Fatalf("Region [%s] was normalized to [%s], expected [%s]", test.region, region, test.expected)
+			}
+		})
+	}
+}
+
+// TestMatchMakeRegions checks that clients are paired with clients from the same region first, and are only paired
+// across regions once both of them have waited for the fallback wait - unless they have no region preference.
+func TestMatchMakeRegions(t *testing.T) {
+	waited := regionFallbackWait + time.Second
+
+	tests := []struct {
+		name     string
+		clients  []testQueueClient
+		expected [][2]uint64
+	}{
+		{
+			name:     "Same region preferred",
+			clients:  []testQueueClient{{"eu", 0}, {"na", 0}, {"eu", 0}},
+			expected: [][2]uint64{{1, 3}},
+		},
+		{
+			name:     "Same region preferred after the fallback wait",
+			clients:  []testQueueClient{{"eu", waited}, {"na", waited}, {"eu", 0}},
+			expected: [][2]uint64{{1, 3}},
+		},
+		{
+			name:     "Different regions before the fallback wait",
+			clients:  []testQueueClient{{"eu", 0}, {"na", 0}},
+			expected: [][2]uint64{},
+		},
+		{
+			name:     "Different regions after only one client waited",
+			clients:  []testQueueClient{{"eu", waited}, {"na", 0}},
+			expected: [][2]uint64{},
+		},
+		{
+			name:     "Different regions after the fallback wait",
+			clients:  []testQueueClient{{"eu", waited}, {"na", waited}},
+			expected: [][2]uint64{{1, 2}},
+		},
+		{
+			name:     "No region preference",
+			clients:  []testQueueClient{{"", 0}, {"", 0}},
+			expected: [][2]uint64{{1, 2}},
+		},
+		{
+			name:     "No region preference and a region before the fallback wait",
+			clients:  []testQueueClient{{"", 0}, {"eu", 0}},
+			expected: [][2]uint64{},
+		},
+		{
+			name:     "No region preference and a region after the fallback wait",
+			clients:  []testQueueClient{{"", 0}, {"eu", waited}},
+			expected: [][2]uint64{{1, 2}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if pairs := pairIDs(newTestQueue(test.clients).matchMake()); !reflect.DeepEqual(pairs, test.expected) {
+				t.Fatalf("Clients were paired as %v, expected %v", pairs, test.expected)
+			}
+		})
+	}
+}
+
+// TestMatchConfirmedPayload checks that the match confirmed payload includes the opponent's region only when the
+// client sent a region hint of their own.
+func TestMatchConfirmedPayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   string
+		opponent string
+		expected string
+	}{
+		{"Both regions", "eu", "na", "12:na"},
+		{"Opponent without a region", "eu", "", "12:"},
+		{"Client without a region", "", "na", "12"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, opponent := &MMClient{Region: test.region}, &MMClient{Region: test.opponent}
+			if payload := matchConfirmedPayload("12", client, opponent); payload != test.expected {
+				t.Fatalf("Payload is [%s], expected [%s]", payload, test.expected)
+			}
+		})
+	}
+}
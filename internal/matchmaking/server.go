@@ -6,6 +6,13 @@
 package matchmaking
 
 import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/pkg/capacity"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
 	"github.com/gorilla/websocket"
 )
 
@@ -15,30 +22,62 @@ type Server struct {
 }
 
 // AddClient takes a new client and their various data, wraps them up and adds them to the matchmaking server to be processed later.
-func (ms *Server) AddClient(wsconn *websocket.Conn, dbid uint64, pid string, mmr int) {
+func (ms *Server) AddClient(wsconn *websocket.Conn, dbid uint64, pid string, displayname string, avatar uint8, mmr int, region string, protocolVersion uint16, encoding protocol.Encoding) {
 
 	// Create a new client
-	client := NewClient(wsconn, dbid, pid, mmr, &ms.queue)
+	client := NewClient(wsconn, dbid, pid, displayname, avatar, mmr, normalizeRegion(region), protocolVersion, encoding, &ms.queue)
+
+	// Register the client's connection, evicting (or refusing, depending on the policy) any game server connections
+	// for the same user.
+	evict := func() {
+		ms.queue.Remove(client, protocol.WSCDuplicateConnection, "Connected to the game server")
+	}
+
+	if !ms.queue.sessions.Register(dbid, session.Matchmaking, client.ConnectionID(), evict) {
+		client.Close(protocol.NewMessage(protocol.WSMTText, protocol.WSCDuplicateConnection, "Already connected to the game server"))
+		log.Printf("Client [%s] (connection [%s]) was refused from the matchmaking queue (already connected to the game server)", client.PublicID, client.ConnectionID())
+		return
+	}
+
+	// Look up the client's recent opponents, so that they aren't paired with them again straight away - this blocks, so
+	// it's done here rather than in the main loop.
+	client.recentOpponents = ms.queue.lookupRecentOpponents(dbid)
+
+	// Determine whether a preview of the client can be shown to their opponents - this blocks too.
+	ms.queue.lookupPreview(client)
 
 	// Add it to the server.
 	ms.queue.AddClient(client)
 }
 
-// Init initializes the matchmaking server including starting the internal loop.
-func (ms *Server) Init() {
+// QueuedCount returns the number of clients in the matchmaking queue.
+func (ms *Server) QueuedCount() int {
+	return ms.queue.QueuedCount()
+}
+
+// Metrics returns a snapshot of the matchmaking metrics.
+func (ms *Server) Metrics() Metrics {
+	return ms.queue.metrics.snapshot()
+}
+
+// Init initializes the matchmaking server including starting the internal loop. The store is used to create
+// matches, the game server capacity gauge is used to pause matchmaking while the game server is full, and the
+// maintenance mode switch is used to pause matchmaking while the servers are being drained.
+func (ms *Server) Init(store database.Store, gameCapacity *capacity.Gauge, sessions *session.Registry, mode *maintenance.Mode) {
 
 	// Start the queue (which is essentially the workhorse for the matchmaking server).
-	ms.queue.Init()
+	ms.queue.Init(store, gameCapacity, sessions, mode)
 }
 
-// NewServer creates and returns a pointer to a new matchmaking server.
-func NewServer() *Server {
+// NewServer creates and returns a pointer to a new matchmaking server, that uses the specified store, session
+// registry and maintenance mode switch.
+func NewServer(store database.Store, gameCapacity *capacity.Gauge, sessions *session.Registry, mode *maintenance.Mode) *Server {
 
 	// Create a new matchmaking server.
 	mms := Server{}
 
 	// Initialize the matchmaking server.
-	mms.Init()
+	mms.Init(store, gameCapacity, sessions, mode)
 
 	// Return a pointer to the newly created matchmaking server.
 	return &mms
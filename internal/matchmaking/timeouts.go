@@ -0,0 +1,41 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package matchmaking implements the Blade II Online matchmaking server.
+package matchmaking
+
+import "time"
+
+// Timeouts are the time limits used by the matchmaking server. They default to the values configured via the
+// environment (see DefaultTimeouts), and can be replaced with SetTimeouts - such as to shorten them for tests.
+type Timeouts struct {
+
+	// The maximum time to wait for both clients to accept a ready check.
+	ReadyCheckTime time.Duration
+}
+
+// DefaultTimeouts returns the timeouts configured via the "mm_ready_check_time" environment variable, or their
+// defaults.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		ReadyCheckTime: readyCheckTime,
+	}
+}
+
+// SetTimeouts replaces the timeouts used by the matchmaking server, from its next tick. Safe to call from any
+// goroutine.
+func (ms *Server) SetTimeouts(timeouts Timeouts) {
+	ms.queue.timeoutsLock.Lock()
+	defer ms.queue.timeoutsLock.Unlock()
+
+	ms.queue.timeouts = timeouts
+}
+
+// getTimeouts returns the timeouts used by the matchmaking server.
+func (queue *Queue) getTimeouts() Timeouts {
+	queue.timeoutsLock.Lock()
+	defer queue.timeoutsLock.Unlock()
+
+	return queue.timeouts
+}
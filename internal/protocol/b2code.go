@@ -18,19 +18,29 @@ const (
 	WSCConnectionTimeOut      B2Code = 100
 	WSCUnknownConnectionError B2Code = 101
 	WSCDuplicateConnection    B2Code = 102
+	WSCUnsupportedMessageType B2Code = 103
+	WSCServerAtCapacity       B2Code = 104
+	WSCClientFlooding         B2Code = 105
+	WSCServerError            B2Code = 106
+	WSCServerAnnouncement     B2Code = 107
+	WSCDroppedByServer        B2Code = 108
+	WSCServerMaintenance      B2Code = 109
+	WSCTooManyConnections     B2Code = 110
 )
 
 // Auth codes.
 const (
-	WSCAuthRequest        B2Code = 200
-	WSCAuthBadFormat      B2Code = 201
-	WSCAuthBadCredentials B2Code = 202
-	WSCAuthExpired        B2Code = 203
-	WSCAuthBanned         B2Code = 204
-	WSCAuthExpected       B2Code = 205
-	WSCAuthNotReceived    B2Code = 206
-	WSCAuthReceived       B2Code = 207
-	WSCAuthSuccess        B2Code = 208
+	WSCAuthRequest                B2Code = 200
+	WSCAuthBadFormat              B2Code = 201
+	WSCAuthBadCredentials         B2Code = 202
+	WSCAuthExpired                B2Code = 203
+	WSCAuthBanned                 B2Code = 204
+	WSCAuthExpected               B2Code = 205
+	WSCAuthNotReceived            B2Code = 206
+	WSCAuthReceived               B2Code = 207
+	WSCAuthSuccess                B2Code = 208
+	WSCProtocolVersionUnsupported B2Code = 209
+	WSCProtocolVersionMismatch    B2Code = 210
 )
 
 // MatchMaking codes.
@@ -42,6 +52,14 @@ const (
 	WSCJoinedQueue           B2Code = 304
 	WSCOpponentAccepted      B2Code = 305
 	WSCOpponentDidNotAccept  B2Code = 306
+	WSCRecentMatchesRequest  B2Code = 307
+	WSCRecentMatchesResponse B2Code = 308
+	WSCMatchmakingCooldown   B2Code = 309
+	WSCMatchFoundAck         B2Code = 310
+	WSCMatchCreationFailed   B2Code = 311
+	WSCLeaveQueue            B2Code = 312
+	WSCLeftQueue             B2Code = 313
+	WSCRejoinQueue           B2Code = 314
 )
 
 // Match codes.
@@ -67,4 +85,20 @@ const (
 	WSCMatchWin                 B2Code = 418
 	WSCMatchDraw                B2Code = 419
 	WSCMatchLoss                B2Code = 420
+	WSCMatchNoContest           B2Code = 421
+	WSCMatchStateRequest        B2Code = 422
+	WSCMatchClientReady         B2Code = 423
+	WSCMatchStateCorrupted      B2Code = 424
+	WSCMatchSetupTimeout        B2Code = 425
+	WSCMatchMoveAck             B2Code = 426
+	WSCOpponentNoShow           B2Code = 427
+	WSCAlreadyInMatch           B2Code = 428
+	WSCMatchForfeitPending      B2Code = 429
+)
+
+// Admin codes.
+const (
+	WSCAdminCommand       B2Code = 500
+	WSCAdminCommandResult B2Code = 501
+	WSCAdminStatus        B2Code = 502
 )
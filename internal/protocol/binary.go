@@ -0,0 +1,75 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package protocol provides utilities for handling websocket messages.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Encoding is a type definition for the encoding used for messages on a connection.
+type Encoding uint8
+
+// Message encodings. JSON is the default, and is always used during the connection handshake.
+const (
+	EncodingJSON   Encoding = 0
+	EncodingBinary Encoding = 1
+)
+
+// binaryHeaderSize is the size (in bytes) of the header of a binary message - a type byte, a uint16 code, and a
+// uint16 payload length.
+const binaryHeaderSize = 5
+
+// Errors that can occur when encoding or decoding binary messages.
+var (
+	ErrBinaryPayloadTooLarge = errors.New("Binary message payload too large")
+	ErrBinaryMalformed       = errors.New("Binary message malformed")
+)
+
+// IsValid returns true if the encoding is supported by this server.
+func (encoding Encoding) IsValid() bool {
+	return encoding == EncodingJSON || encoding == EncodingBinary
+}
+
+// EncodeBinary encodes the specified message into the binary message format.
+//
+// Format: <type (1 byte)><code (uint16)><payload length (uint16)><payload>
+//
+// Multi-byte values are big endian. The payload version is not included, as it is fixed for the connection.
+func EncodeBinary(message Message) ([]byte, error) {
+
+	// The payload length must fit into a uint16.
+	if len(message.Payload.Message) > math.MaxUint16 {
+		return nil, ErrBinaryPayloadTooLarge
+	}
+
+	// Write the header, followed by the payload.
+	data := make([]byte, binaryHeaderSize, binaryHeaderSize+len(message.Payload.Message))
+	data[0] = byte(message.Type)
+	binary.BigEndian.PutUint16(data[1:3], uint16(message.Payload.Code))
+	binary.BigEndian.PutUint16(data[3:5], uint16(len(message.Payload.Message)))
+	data = append(data, message.Payload.Message...)
+
+	return data, nil
+}
+
+// DecodeBinary decodes a message in the binary message format. See EncodeBinary for details on the format.
+func DecodeBinary(data []byte) (Message, error) {
+
+	// The data must be large enough to contain the header, and the payload length in the header must match the
+	// length of the rest of the data.
+	if len(data) < binaryHeaderSize {
+		return Message{}, ErrBinaryMalformed
+	}
+
+	payloadLength := int(binary.BigEndian.Uint16(data[3:5]))
+	if len(data)-binaryHeaderSize != payloadLength {
+		return Message{}, ErrBinaryMalformed
+	}
+
+	return NewMessage(Type(data[0]), B2Code(binary.BigEndian.Uint16(data[1:3])), string(data[binaryHeaderSize:])), nil
+}
@@ -10,10 +10,38 @@ const (
 	QCTBroadcastMessage uint16 = iota
 	QCTDropAll
 	QCTChangePollTime
+	QCTForceDisconnectUser
+	QCTBanSweep
+	QCTMaintenance
+	QCTMoveValidation
 )
 
 // Command is a wrapper for a queue command and any accompanying data.
 type Command struct {
 	Type uint16
 	Data string
+
+	// Optional channel to report the outcome of the command to. Should be buffered, as results are dropped rather
+	// than blocking the server that processed the command.
+	Result chan<- CommandResult
+}
+
+// CommandResult is the outcome of a command, as reported by the server that processed it.
+type CommandResult struct {
+	Type    uint16
+	Success bool
+	Message string
+}
+
+// Reply reports the outcome of the command to the result channel, if there is one. Never blocks - if the channel is
+// full, the result is dropped.
+func (command Command) Reply(success bool, message string) {
+	if command.Result == nil {
+		return
+	}
+
+	select {
+	case command.Result <- CommandResult{Type: command.Type, Success: success, Message: message}:
+	default:
+	}
 }
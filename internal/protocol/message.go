@@ -5,12 +5,18 @@
 // Package protocol provides utilities for handling websocket messages.
 package protocol
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
-// Message is a wrapper for an outgoing websocket message and its message type.
+// Message is a wrapper for an outgoing websocket message and its message type. Coalescable messages are superseded by
+// any newer coalescable message with the same code, if they haven't been sent by the time it's queued (see
+// AsCoalescable).
 type Message struct {
-	Type    Type
-	Payload Payload
+	Type        Type
+	Payload     Payload
+	Coalescable bool
 }
 
 // NewMessage creates and returns new message.
@@ -24,6 +30,11 @@ func NewMessage(wstype Type, instructionCode B2Code, payload string) Message {
 	}
 }
 
+// NewTimestampedMessage creates and returns new message, stamped with the specified time.
+func NewTimestampedMessage(wstype Type, instructionCode B2Code, payload string, timestamp time.Time) Message {
+	return NewMessage(wstype, instructionCode, payload).WithTimestamp(timestamp)
+}
+
 // NewMessageFromPayload creates and returns new message, with the specified payload.
 func NewMessageFromPayload(wstype Type, payload Payload) Message {
 	return Message{
@@ -32,6 +43,21 @@ func NewMessageFromPayload(wstype Type, payload Payload) Message {
 	}
 }
 
+// WithTimestamp returns a copy of the message, stamped with the specified time (replacing any existing timestamp).
+func (r Message) WithTimestamp(timestamp time.Time) Message {
+	r.Payload.Timestamp = timestamp.UnixMilli()
+	return r
+}
+
+// AsCoalescable returns a copy of the message, marked as coalescable - so that if it hasn't been sent by the time a newer
+// coalescable message with the same code is queued for the same connection, it is dropped in favour of the newer one.
+// Only suitable for messages that describe the latest state of something, where a stale copy is of no use - never for
+// moves, match results, or anything else that must be delivered.
+func (r Message) AsCoalescable() Message {
+	r.Coalescable = true
+	return r
+}
+
 // GetPayloadBytes returns the payload of the message as a byte array.
 func (r Message) GetPayloadBytes() []byte {
 
@@ -9,10 +9,17 @@ import (
 	"encoding/json"
 )
 
-// Payload is a wrapper for the payload of a websocket message.
+// Payload is a wrapper for the payload of a websocket message. The version, encoding, region and timestamp are
+// omitted when zero, so that payloads for legacy clients are unchanged. The encoding and region are only read from auth
+// messages. The timestamp (Unix milliseconds) is set on some server-originated messages, for replays and clock skew
+// correction - it is not included in the binary encoding.
 type Payload struct {
-	Code    B2Code `json:"code"`
-	Message string `json:"message"`
+	Code      B2Code   `json:"code"`
+	Message   string   `json:"message"`
+	Version   uint16   `json:"version,omitempty"`
+	Encoding  Encoding `json:"encoding,omitempty"`
+	Region    string   `json:"region,omitempty"`
+	Timestamp int64    `json:"ts,omitempty"`
 }
 
 // NewPayloadFromBytes tries to create a Payload from the bytes of a websocket message.
@@ -0,0 +1,66 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPayloadTimestamp checks that payloads round trip through JSON with and without a timestamp, that the timestamp
+// is omitted when it isn't set (so that payloads for legacy clients are unchanged), and that payloads without the
+// field are still accepted.
+func TestPayloadTimestamp(t *testing.T) {
+	stamp := time.Date(2020, time.June, 1, 12, 0, 0, int(time.Millisecond*250), time.UTC)
+
+	tests := []struct {
+		name    string
+		message Message
+		ts      bool
+	}{
+		{"Timestamped", NewTimestampedMessage(WSMTText, WSCMatchMove, "7:", stamp), true},
+		{"Stamped after creation", NewMessage(WSMTText, WSCMatchMove, "7:").WithTimestamp(stamp), true},
+		{"Not timestamped", NewMessage(WSMTText, WSCMatchMove, "7:"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if stamped := test.message.Payload.Timestamp == stamp.UnixMilli(); stamped != test.ts {
+				t.Fatalf("Payload has timestamp [%d], expected it to be stamped: %v", test.message.Payload.Timestamp, test.ts)
+			}
+
+			data, err := json.Marshal(test.message.Payload)
+			if err != nil {
+				t.Fatalf("Failed to marshal the payload: %v", err)
+			}
+
+			if hasField := strings.Contains(string(data), `"ts"`); hasField != test.ts {
+				t.Fatalf("Payload was marshalled as %s, expected the timestamp field: %v", data, test.ts)
+			}
+
+			if payload := NewPayloadFromBytes(data); payload != test.message.Payload {
+				t.Fatalf("Payload round tripped as %+v, expected %+v", payload, test.message.Payload)
+			}
+		})
+	}
+
+	// Payloads from clients that don't know about the field are accepted as they were before.
+	if payload := NewPayloadFromBytes([]byte(`{"code":413,"message":"7:"}`)); payload != (Payload{Code: WSCMatchMove, Message: "7:"}) {
+		t.Fatalf("Payload without a timestamp was read as %+v", payload)
+	}
+}
+
+// TestWithTimestamp checks that stamping a message replaces any existing timestamp, and leaves the original message as
+// it was.
+func TestWithTimestamp(t *testing.T) {
+	original := NewTimestampedMessage(WSMTText, WSCMatchMove, "7:", time.UnixMilli(1000))
+
+	stamped := original.WithTimestamp(time.UnixMilli(2000))
+	if stamped.Payload.Timestamp != 2000 || original.Payload.Timestamp != 1000 {
+		t.Fatalf("Stamped message has timestamp [%d], and the original [%d] - expected [2000] and [1000]", stamped.Payload.Timestamp, original.Payload.Timestamp)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package protocol provides utilities for handling websocket messages.
+package protocol
+
+// Protocol versions supported by this server - any version from MinimumVersion to CurrentVersion (inclusive) is
+// supported. Clients that do not specify a version are assumed to be using LegacyVersion.
+const (
+	LegacyVersion  uint16 = 1
+	MinimumVersion uint16 = 1
+	CurrentVersion uint16 = 4
+)
+
+// MoveSequenceVersion is the first protocol version in which clients prefix each of their moves with a sequence
+// number, so that duplicate moves can be detected.
+const MoveSequenceVersion uint16 = 2
+
+// MoveAckVersion is the first protocol version in which moves forwarded from the opponent are prefixed with a
+// sequence number, which clients acknowledge so that lost moves can be resent.
+const MoveAckVersion uint16 = 3
+
+// ForfeitConfirmVersion is the first protocol version in which forfeits must be confirmed - the first forfeit message
+// is answered with a forfeit pending message, and the forfeit only takes effect once it is sent again, or the
+// confirmation window elapses.
+const ForfeitConfirmVersion uint16 = 4
+
+// NegotiateVersion returns the highest protocol version supported by both this server, and a client that supports
+// up to (and including) the specified version. Returns false if there is no mutually supported version.
+func NegotiateVersion(clientVersion uint16) (version uint16, ok bool) {
+
+	// Clients that are older than the minimum supported version cannot be served.
+	if clientVersion < MinimumVersion {
+		return 0, false
+	}
+
+	// Clients that are newer than this server are served with the current version.
+	if clientVersion > CurrentVersion {
+		return CurrentVersion, true
+	}
+
+	return clientVersion, true
+}
+
+// IsSupportedVersion returns true if the specified version is within the range of protocol versions supported by this
+// server (MinimumVersion to CurrentVersion, inclusive).
+func IsSupportedVersion(version uint16) bool {
+	return version >= MinimumVersion && version <= CurrentVersion
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package protocol
+
+import (
+	"testing"
+)
+
+// TestNegotiateVersion checks the version that is negotiated with clients that support older, matching and newer
+// protocol versions than the server.
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   uint16
+		expected uint16
+		ok       bool
+	}{
+		{"Older than the minimum", MinimumVersion - 1, 0, false},
+		{"Legacy", LegacyVersion, LegacyVersion, true},
+		{"Older than the current", CurrentVersion - 1, CurrentVersion - 1, true},
+		{"Current", CurrentVersion, CurrentVersion, true},
+		{"Newer than the current", CurrentVersion + 1, CurrentVersion, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if version, ok := NegotiateVersion(test.client); version != test.expected || ok != test.ok {
+				t.Fatalf("Negotiated [%d, %v], expected [%d, %v]", version, ok, test.expected, test.ok)
+			}
+		})
+	}
+}
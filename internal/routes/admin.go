@@ -0,0 +1,32 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package routes defines http endpoint handlers for http/websocket connections to the server.
+package routes
+
+import (
+	"net/http"
+
+	"github.com/6a/blade-ii-game-server/internal/admin"
+)
+
+// SetupAdmin sets up the admin console endpoint on the specified mux. Pass in a pointer to the admin console. The mux
+// should not be shared with any of the player-facing endpoints.
+func SetupAdmin(mux *http.ServeMux, console *admin.Console) {
+
+	// Defines the handler for the /admin endpoint.
+	mux.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
+
+		// On connection, upgrade the connection to a websocket connection. If the upgrade fails, the upgrader has
+		// already responded with an error.
+		wsconn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		// Pass the connection to the admin console (using a goroutine to avoid blocking), which will perform
+		// authentication, and then handle commands from the operator.
+		go console.HandleConnection(wsconn)
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package routes defines http endpoint handlers for http/websocket connections to the server.
+package routes
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/6a/blade-ii-game-server/internal/connection"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/transactions"
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/6a/blade-ii-game-server/pkg/iplimit"
+	"github.com/gorilla/websocket"
+)
+
+// defaultMaxConnectionsPerIP is the default maximum number of concurrent websocket connections from a single IP address.
+const defaultMaxConnectionsPerIP = 32
+
+// connectionLimiter limits the number of concurrent websocket connections from each IP address, across both the game
+// server and the matchmaking server (when they are running in the same process). The limit is configured via the
+// "max_connections_per_ip" environment variable - zero disables the limit.
+var connectionLimiter = iplimit.New(envvar.Int("max_connections_per_ip", defaultMaxConnectionsPerIP))
+
+// upgradeLimited upgrades the specified request to a websocket connection, and counts it against the connection limit
+// for its source IP address until it is closed. Returns false if the upgrade failed (in which case the upgrader has
+// already responded with an error), or if the source IP address is already at the limit (in which case the connection
+// is discarded with a too many connections message).
+func upgradeLimited(w http.ResponseWriter, r *http.Request) (wsconn *websocket.Conn, ok bool) {
+	wsconn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, false
+	}
+
+	ip := sourceIP(r)
+	if !connectionLimiter.Acquire(ip) {
+		log.Printf("Rejected connection from [%s] - already at the limit of [%d] connections", ip, connectionLimiter.Limit())
+		go transactions.Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCTooManyConnections, "Too many connections"))
+		return nil, false
+	}
+
+	// Stop counting the connection once it is closed, however it ends.
+	connection.OnClose(wsconn, func() {
+		connectionLimiter.Release(ip)
+	})
+
+	return wsconn, true
+}
+
+// sourceIP is a helper function that returns the IP address that the specified request was sent from, without the port.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
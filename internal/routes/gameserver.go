@@ -8,28 +8,28 @@ package routes
 import (
 	"net/http"
 
+	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/game"
-	"github.com/6a/blade-ii-game-server/internal/protocol"
 	"github.com/6a/blade-ii-game-server/internal/transactions"
 )
 
-// SetupGameServer sets up the game server endpoint. Pass in a pointer to the game server.
-func SetupGameServer(gs *game.Server) {
+// SetupGameServer sets up the game server endpoint on the specified mux. Pass in a pointer to the game server, and
+// the store used to validate connections.
+func SetupGameServer(mux *http.ServeMux, gs *game.Server, store database.Store) {
 
 	// Defines the handler for the /game endpoint.
-	http.HandleFunc("/game", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/game", func(w http.ResponseWriter, r *http.Request) {
 
-		// On connection, upgrade the connection to a websocket connection.
-		wsconn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-
-			// if errored, discard the connection early.
-			transactions.Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthBadCredentials, err.Error()))
+		// On connection, upgrade the connection to a websocket connection, subject to the connection limit for the source
+		// IP address. If the upgrade fails, or the connection is over the limit, it has already been dealt with.
+		wsconn, ok := upgradeLimited(w, r)
+		if !ok {
+			return
 		}
 
 		// If the upgrade was successful, pass connection and the game server pointer to another handler (using a goroutine to
 		// avoid blocking) which will perform authentication and match validity checking, and handle adding the client to the
 		// game server.
-		go transactions.HandleGSConnection(wsconn, gs)
+		go transactions.HandleGSConnection(wsconn, gs, store)
 	})
 }
@@ -8,27 +8,27 @@ package routes
 import (
 	"net/http"
 
+	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/matchmaking"
-	"github.com/6a/blade-ii-game-server/internal/protocol"
 	"github.com/6a/blade-ii-game-server/internal/transactions"
 )
 
-// SetupMatchMaking sets up the matchmaking server endpoint. Pass in a pointer to the matchmaking server.
-func SetupMatchMaking(mm *matchmaking.Server) {
+// SetupMatchMaking sets up the matchmaking server endpoint on the specified mux. Pass in a pointer to the matchmaking server,
+// and the store used to validate connections.
+func SetupMatchMaking(mux *http.ServeMux, mm *matchmaking.Server, store database.Store) {
 
 	// Defines the handler for the /matchmaking endpoint.
-	http.HandleFunc("/matchmaking", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/matchmaking", func(w http.ResponseWriter, r *http.Request) {
 
-		// On connection, upgrade the connection to a websocket connection.
-		wsconn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-
-			// if errored, discard the connection early.
-			transactions.Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthBadCredentials, err.Error()))
+		// On connection, upgrade the connection to a websocket connection, subject to the connection limit for the source
+		// IP address. If the upgrade fails, or the connection is over the limit, it has already been dealt with.
+		wsconn, ok := upgradeLimited(w, r)
+		if !ok {
+			return
 		}
 
 		// If the upgrade was successful, pass connection and the matchmaking server pointer to another handler (using a goroutine to
 		// avoid blocking) which will perform authentication, and handle adding the client to the matchmaking queue.
-		go transactions.HandleMMConnection(wsconn, mm)
+		go transactions.HandleMMConnection(wsconn, mm, store)
 	})
 }
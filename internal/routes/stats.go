@@ -0,0 +1,23 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package routes defines http endpoint handlers for http/websocket connections to the server.
+package routes
+
+import (
+	"net/http"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/transactions"
+)
+
+// SetupStats sets up the player stats endpoint on the specified mux. Pass in the store used to validate requests and
+// read the stats.
+func SetupStats(mux *http.ServeMux, store database.Store) {
+
+	// Defines the handler for the /stats endpoint.
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		transactions.HandleStatsRequest(w, r, store)
+	})
+}
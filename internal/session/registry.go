@@ -0,0 +1,157 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package session implements an in-process registry of the active connections for each user, so that a user can't be
+// connected to the matchmaking server and the game server at the same time.
+package session
+
+import (
+	"log"
+	"sync"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+	"github.com/rs/xid"
+)
+
+// Kind is a typedef for the kind of server that a connection belongs to.
+type Kind uint8
+
+// Connection kinds.
+const (
+	Matchmaking Kind = 1
+	Game        Kind = 2
+)
+
+// Policy is a typedef for the way in which a duplicate login (a new connection for a user who is already connected
+// to another kind of server) is handled.
+type Policy uint8
+
+// Duplicate login policies.
+const (
+
+	// PolicyEvict removes the existing connection(s), and admits the new one.
+	PolicyEvict Policy = 0
+
+	// PolicyReject refuses the new connection, leaving the existing connection(s) intact.
+	PolicyReject Policy = 1
+)
+
+// policyFromString returns the policy with the specified name ("evict" or "reject"), falling back to PolicyEvict for
+// anything else.
+func policyFromString(name string) Policy {
+	switch name {
+	case "evict":
+		return PolicyEvict
+	case "reject":
+		return PolicyReject
+	}
+
+	log.Printf("Unknown duplicate login policy [%s] - falling back to [evict]", name)
+	return PolicyEvict
+}
+
+// entry is a single registered connection.
+type entry struct {
+
+	// The kind of server that the connection belongs to.
+	kind Kind
+
+	// A function that removes the connection via its owning server.
+	evict func()
+}
+
+// Registry keeps track of the active connections for each user. Safe for concurrent use.
+type Registry struct {
+
+	// The policy for handling duplicate logins.
+	policy Policy
+
+	// The active connections for each user, keyed by database ID and then connection ID.
+	sessions map[uint64]map[xid.ID]entry
+
+	// Mutex lock to protect the sessions map.
+	lock sync.Mutex
+}
+
+// NewRegistry creates and returns a pointer to a new, empty registry. The duplicate login policy is configured via
+// the "duplicate_login_policy" environment variable - either "evict" (the default) or "reject".
+func NewRegistry() *Registry {
+	return NewRegistryWithPolicy(policyFromString(envvar.String("duplicate_login_policy", "evict")))
+}
+
+// NewRegistryWithPolicy creates and returns a pointer to a new, empty registry, that handles duplicate logins with the
+// specified policy.
+func NewRegistryWithPolicy(policy Policy) *Registry {
+	return &Registry{
+		policy:   policy,
+		sessions: make(map[uint64]map[xid.ID]entry),
+	}
+}
+
+// Register records a new connection for the specified user, of the specified kind, along with a function that removes
+// the connection via its owning server. Connections for the same user of another kind are handled according to the
+// policy - evicted (using their evict function), or kept, in which case the new connection is not registered, and
+// false is returned.
+//
+// Connections of the same kind are left for the owning server to handle, as it already deals with duplicate
+// connections itself.
+func (registry *Registry) Register(databaseID uint64, kind Kind, connectionID xid.ID, evict func()) bool {
+	registry.lock.Lock()
+
+	// Find any connections of another kind for the user.
+	connections := registry.sessions[databaseID]
+	conflicts := make([]func(), 0)
+	for id, existing := range connections {
+		if existing.kind != kind {
+			conflicts = append(conflicts, existing.evict)
+
+			// The evicted connections are no longer tracked - they unregister themselves when they close, which is
+			// then a noop.
+			if registry.policy == PolicyEvict {
+				delete(connections, id)
+			}
+		}
+	}
+
+	// Refuse the new connection if there are conflicts, and the policy is to reject.
+	if len(conflicts) > 0 && registry.policy == PolicyReject {
+		registry.lock.Unlock()
+		return false
+	}
+
+	// Register the new connection.
+	if connections == nil {
+		connections = make(map[xid.ID]entry)
+		registry.sessions[databaseID] = connections
+	}
+
+	connections[connectionID] = entry{
+		kind:  kind,
+		evict: evict,
+	}
+
+	registry.lock.Unlock()
+
+	// Evict the conflicting connections outside of the lock, so that the evict functions can't deadlock the registry.
+	for _, evict := range conflicts {
+		evict()
+	}
+
+	return true
+}
+
+// Unregister removes the specified connection for the specified user. Noop if the connection isn't registered.
+func (registry *Registry) Unregister(databaseID uint64, connectionID xid.ID) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	// Remove the connection, and the user if they have no connections remaining.
+	if connections, ok := registry.sessions[databaseID]; ok {
+		delete(connections, connectionID)
+
+		if len(connections) == 0 {
+			delete(registry.sessions, databaseID)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/rs/xid"
+)
+
+// TestRegister checks how a new connection is handled, depending on the connections that the user already has and the
+// duplicate login policy - and which of the existing connections are evicted.
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     Policy
+		existing   []Kind
+		kind       Kind
+		registered bool
+		evicted    int
+	}{
+		{"No connections", PolicyEvict, nil, Game, true, 0},
+		{"Same kind, evict", PolicyEvict, []Kind{Game}, Game, true, 0},
+		{"Same kind, reject", PolicyReject, []Kind{Matchmaking}, Matchmaking, true, 0},
+		{"Other kind, evict", PolicyEvict, []Kind{Matchmaking}, Game, true, 1},
+		{"Other kind, reject", PolicyReject, []Kind{Matchmaking}, Game, false, 0},
+		{"Both kinds, evict", PolicyEvict, []Kind{Game, Matchmaking}, Game, true, 1},
+		{"Several of the other kind, evict", PolicyEvict, []Kind{Matchmaking, Matchmaking}, Game, true, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewRegistryWithPolicy(test.policy)
+
+			evicted := 0
+			for _, kind := range test.existing {
+				registry.Register(1, kind, xid.New(), func() { evicted++ })
+			}
+
+			// Connections for other users are never affected.
+			registry.Register(2, Matchmaking, xid.New(), func() { t.Fatalf("Evicted a connection for another user") })
+
+			// Only the connections evicted by the new connection are counted.
+			evicted = 0
+			if registered := registry.Register(1, test.kind, xid.New(), func() {}); registered != test.registered {
+				t.Fatalf("Register returned %v, expected %v", registered, test.registered)
+			}
+
+			if evicted != test.evicted {
+				t.Fatalf("Evicted %d connections, expected %d", evicted, test.evicted)
+			}
+		})
+	}
+}
+
+// TestEvictedConnectionsAreForgotten checks that an evicted connection is no longer tracked, so that it doesn't
+// conflict with (or get evicted by) later connections.
+func TestEvictedConnectionsAreForgotten(t *testing.T) {
+	registry := NewRegistryWithPolicy(PolicyEvict)
+
+	evictions := 0
+	registry.Register(1, Matchmaking, xid.New(), func() { evictions++ })
+	registry.Register(1, Game, xid.New(), func() {})
+	registry.Register(1, Matchmaking, xid.New(), func() {})
+
+	if evictions != 1 {
+		t.Fatalf("The first connection was evicted %d times, expected once", evictions)
+	}
+}
+
+// TestUnregister checks that once a connection is unregistered, a connection of another kind is admitted under the
+// reject policy, and that unregistering a connection that isn't registered is a noop.
+func TestUnregister(t *testing.T) {
+	registry := NewRegistryWithPolicy(PolicyReject)
+
+	matchmaking := xid.New()
+	registry.Register(1, Matchmaking, matchmaking, func() {})
+
+	if registry.Register(1, Game, xid.New(), func() {}) {
+		t.Fatalf("Game connection was admitted while the matchmaking connection was registered")
+	}
+
+	registry.Unregister(1, matchmaking)
+	registry.Unregister(1, matchmaking)
+	registry.Unregister(2, xid.New())
+
+	if !registry.Register(1, Game, xid.New(), func() {}) {
+		t.Fatalf("Game connection was refused after the matchmaking connection was unregistered")
+	}
+
+	if len(registry.sessions) != 1 {
+		t.Fatalf("Registry has sessions for %d users, expected 1", len(registry.sessions))
+	}
+}
+
+// TestPolicyFromString checks the policy names, and the fallback for unknown names.
+func TestPolicyFromString(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Policy
+	}{
+		{"evict", PolicyEvict},
+		{"reject", PolicyReject},
+		{"", PolicyEvict},
+		{"REJECT", PolicyEvict},
+	}
+
+	for _, test := range tests {
+		if policy := policyFromString(test.name); policy != test.expected {
+			t.Errorf("Policy for [%s] is %v, expected %v", test.name, policy, test.expected)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package teststore implements an in-memory database store that accepts generated credentials, for load testing, for
+// running the servers offline, and for tests. It is INSECURE - the servers only link it into binaries that are built
+// with the "insecure" build tag.
+package teststore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+)
+
+// Ensure that Store implements database.Store.
+var _ database.Store = (*Store)(nil)
+
+const (
+
+	// PublicIDPrefix is the prefix of the public IDs that are accepted by the test store. The rest of the public ID
+	// must be a number, which determines the database ID of the user.
+	PublicIDPrefix = "loadtest-"
+
+	// testMMR is the MMR of every user in the test store.
+	testMMR = 1000
+
+	// lockFileSuffix is appended to the path of the state file of a shared store, for the file that locks it.
+	lockFileSuffix = ".lock"
+
+	// lockRetryInterval is how often a shared store retries locking its state file, while another process holds it.
+	lockRetryInterval = time.Millisecond
+)
+
+// The match phases that the test store records, which match those in the database.
+const (
+	matchPhaseFinished  = 2
+	matchPhaseNoContest = 3
+	matchPhaseDraw      = 4
+	matchPhaseAborted   = 5
+)
+
+// testMatch is a single match in the test store. The fields are exported so that the match can be written to the
+// state file of a shared store (see NewSharedStore).
+type testMatch struct {
+	Player1  uint64
+	Player2  uint64
+	TurnTime time.Duration
+	Phase    int
+	Winner   uint64
+	End      time.Time
+
+	// The players as they were when the match was created, keyed by database ID.
+	Players map[uint64]database.MatchPlayer
+}
+
+// sharedState is the state of a shared store, as it is written to its state file.
+type sharedState struct {
+	Matches     map[uint64]*testMatch
+	NextMatchID uint64
+	Banned      map[uint64]bool
+	MMRHidden   map[uint64]bool
+}
+
+// Store is an in-memory database.Store that accepts any credentials with a public ID in the format
+// "<PublicIDPrefix><number>", so that the servers can be load tested without a database full of real accounts.
+// Nothing is persisted. It is INSECURE, and must never be used in production.
+type Store struct {
+
+	// The matches that have been created, keyed by match ID, along with the ID to use for the next match.
+	matches     map[uint64]*testMatch
+	nextMatchID uint64
+
+	// The database IDs of the users that are banned.
+	banned map[uint64]bool
+
+	// The database IDs of the users that have hidden their MMR.
+	mmrHidden map[uint64]bool
+
+	// Mutex lock to protect the matches, the banned users and the users that have hidden their MMR - see lockState.
+	lock sync.Mutex
+
+	// The path of the state file, for a shared store (see NewSharedStore), or an empty string.
+	path string
+}
+
+// NewStore creates and returns a pointer to a new, empty test store.
+func NewStore() *Store {
+	return &Store{
+		matches:     make(map[uint64]*testMatch),
+		nextMatchID: 1,
+		banned:      make(map[uint64]bool),
+		mmrHidden:   make(map[uint64]bool),
+	}
+}
+
+// NewSharedStore creates and returns a pointer to a test store whose state is kept in the file at the specified path,
+// rather than in memory, so that it can be shared by servers that run in separate processes - such as the standalone
+// matchmaking and game servers, which would otherwise each have their own matches. The file is created if it doesn't
+// exist, and its state is used if it does.
+func NewSharedStore(path string) *Store {
+	store := NewStore()
+	store.path = path
+
+	return store
+}
+
+// lockState locks the store. For a shared store, the state file is also locked against other processes (with an
+// exclusive lock file next to it), and the state is reloaded from it. Every call must be paired with a call to
+// unlockState.
+func (store *Store) lockState() {
+	store.lock.Lock()
+
+	if store.path == "" {
+		return
+	}
+
+	for {
+		file, err := os.OpenFile(store.path+lockFileSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			file.Close()
+			break
+		}
+
+		if !os.IsExist(err) {
+			log.Fatalf("Failed to lock the test store state file [%s]: %v", store.path, err)
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+
+	data, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	state := sharedState{}
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to read the test store state file [%s]: %v", store.path, err)
+	}
+
+	store.matches = state.Matches
+	store.nextMatchID = state.NextMatchID
+	store.banned = state.Banned
+	store.mmrHidden = state.MMRHidden
+}
+
+// unlockState unlocks the store. For a shared store, the state is written back to the state file first, and then the
+// state file is unlocked.
+func (store *Store) unlockState() {
+	defer store.lock.Unlock()
+
+	if store.path == "" {
+		return
+	}
+
+	data, err := json.Marshal(sharedState{
+		Matches:     store.matches,
+		NextMatchID: store.nextMatchID,
+		Banned:      store.banned,
+		MMRHidden:   store.mmrHidden,
+	})
+
+	if err == nil {
+		err = ioutil.WriteFile(store.path, data, 0600)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to write the test store state file [%s]: %v", store.path, err)
+	}
+
+	os.Remove(store.path + lockFileSuffix)
+}
+
+// SetBanned bans or unbans the user with the specified database ID.
+func (store *Store) SetBanned(databaseID uint64, banned bool) {
+	store.lockState()
+	defer store.unlockState()
+
+	if banned {
+		store.banned[databaseID] = true
+	} else {
+		delete(store.banned, databaseID)
+	}
+}
+
+// SetMMRHidden hides or shows the MMR of the user with the specified database ID.
+func (store *Store) SetMMRHidden(databaseID uint64, hidden bool) {
+	store.lockState()
+	defer store.unlockState()
+
+	if hidden {
+		store.mmrHidden[databaseID] = true
+	} else {
+		delete(store.mmrHidden, databaseID)
+	}
+}
+
+// GetBannedAmong returns the database IDs of the users that are banned, out of the specified database IDs.
+func (store *Store) GetBannedAmong(databaseIDs []uint64) (banned []uint64, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	for _, databaseID := range databaseIDs {
+		if store.banned[databaseID] {
+			banned = append(banned, databaseID)
+		}
+	}
+
+	return banned, nil
+}
+
+// ValidateAuth accepts any non-empty auth token for a public ID in the test format, and returns the database ID that
+// the public ID maps to (its number, plus one, so that it is never zero). Banned users are rejected.
+func (store *Store) ValidateAuth(publicID string, authToken string) (databaseID uint64, err error) {
+	if !strings.HasPrefix(publicID, PublicIDPrefix) {
+		return databaseID, database.ErrUserNotFound
+	}
+
+	number, err := strconv.ParseUint(strings.TrimPrefix(publicID, PublicIDPrefix), 10, 63)
+	if err != nil {
+		return databaseID, database.ErrUserNotFound
+	}
+
+	if authToken == "" {
+		return databaseID, database.ErrTokenInvalid
+	}
+
+	store.lockState()
+	defer store.unlockState()
+
+	if store.banned[number+1] {
+		return number + 1, database.ErrUserBanned
+	}
+
+	return number + 1, nil
+}
+
+// GetMMR returns the MMR for the specified user - the same for every user.
+func (store *Store) GetMMR(databaseID uint64) (MMR int, err error) {
+	return testMMR, nil
+}
+
+// CreateMatch creates a match with the two players specified, and returns the match id.
+func (store *Store) CreateMatch(player1 database.MatchPlayer, player2 database.MatchPlayer, turnTime time.Duration) (matchID uint64, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	matchID = store.nextMatchID
+	store.nextMatchID++
+
+	store.matches[matchID] = &testMatch{
+		Player1:  player1.DatabaseID,
+		Player2:  player2.DatabaseID,
+		TurnTime: turnTime.Truncate(time.Second),
+		Players: map[uint64]database.MatchPlayer{
+			player1.DatabaseID: player1,
+			player2.DatabaseID: player2,
+		},
+	}
+
+	return matchID, nil
+}
+
+// ValidateMatch returns true if the specified match exists and has not yet started, and the specified client is part
+// of it, along with the turn time for the match, and the client as they were when the match was created. Clients that
+// were created without a display name are given the test display name and MMR instead, as with the database.
+func (store *Store) ValidateMatch(databaseID uint64, matchID uint64) (valid bool, turnTime time.Duration, player database.MatchPlayer, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	match, ok := store.matches[matchID]
+	if !ok || match.Phase != 0 || (match.Player1 != databaseID && match.Player2 != databaseID) {
+		return false, turnTime, player, errors.New("Invalid - either the match does not exist, or the specified client is not part of it")
+	}
+
+	player = match.Players[databaseID]
+	if player.DisplayName == "" {
+		player = database.MatchPlayer{DatabaseID: databaseID, DisplayName: testDisplayName(databaseID), MMR: testMMR}
+	}
+
+	return true, match.TurnTime, player, nil
+}
+
+// GetClientNameAndAvatar returns a display name based on the database ID of the specified user, and the default
+// avatar.
+func (store *Store) GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8, err error) {
+	return testDisplayName(databaseID), 0, nil
+}
+
+// GetClientsNameAndAvatar returns a display name based on the database ID of each of the specified users, and the
+// default avatar.
+func (store *Store) GetClientsNameAndAvatar(databaseIDs []uint64) (profiles map[uint64]database.ClientProfile, err error) {
+	profiles = make(map[uint64]database.ClientProfile, len(databaseIDs))
+	for _, databaseID := range databaseIDs {
+		profiles[databaseID] = database.ClientProfile{DisplayName: testDisplayName(databaseID)}
+	}
+
+	return profiles, nil
+}
+
+// SetMatchStart sets the specified match to be in play.
+func (store *Store) SetMatchStart(matchID uint64) (err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	if match, ok := store.matches[matchID]; ok {
+		match.Phase = 1
+	}
+
+	return nil
+}
+
+// SetMatchResult records the winner for the specified match.
+func (store *Store) SetMatchResult(matchID uint64, winnerDatabaseID uint64) (err error) {
+	return store.setMatchPhase(matchID, matchPhaseFinished, winnerDatabaseID)
+}
+
+// SetMatchDraw records the specified match as a draw.
+func (store *Store) SetMatchDraw(matchID uint64) (err error) {
+	return store.setMatchPhase(matchID, matchPhaseDraw, 0)
+}
+
+// SetMatchNoContest records the specified match as no contest.
+func (store *Store) SetMatchNoContest(matchID uint64) (err error) {
+	return store.setMatchPhase(matchID, matchPhaseNoContest, 0)
+}
+
+// SetMatchAborted records the specified match as aborted.
+func (store *Store) SetMatchAborted(matchID uint64) (err error) {
+	return store.setMatchPhase(matchID, matchPhaseAborted, 0)
+}
+
+// setMatchPhase records the result of the specified match, if it has not already concluded - so that, as with the
+// database, the result can only be written once.
+func (store *Store) setMatchPhase(matchID uint64, phase int, winnerDatabaseID uint64) error {
+	store.lockState()
+	defer store.unlockState()
+
+	if match, ok := store.matches[matchID]; ok && match.Phase < matchPhaseFinished {
+		match.Phase = phase
+		match.Winner = winnerDatabaseID
+		match.End = time.Now()
+	}
+
+	return nil
+}
+
+// RecordMatchAudit is a noop, as the test store does not keep an audit trail.
+func (store *Store) RecordMatchAudit(matchID uint64, player1DatabaseID uint64, player2DatabaseID uint64, winnerDatabaseID uint64, reason uint16, duration time.Duration, moves int) (err error) {
+	return nil
+}
+
+// GetRecentMatches returns up to (limit) of the most recently finished matches for the specified user, most recent first.
+func (store *Store) GetRecentMatches(databaseID uint64, limit int) (matches []database.RecentMatch, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	for _, match := range store.matches {
+		if (match.Player1 != databaseID && match.Player2 != databaseID) || (match.Phase != matchPhaseFinished && match.Phase != matchPhaseDraw) {
+			continue
+		}
+
+		opponent := match.Player1
+		if opponent == databaseID {
+			opponent = match.Player2
+		}
+
+		matches = append(matches, database.RecentMatch{
+			OpponentDisplayName: testDisplayName(opponent),
+			Winner:              match.Winner,
+			End:                 match.End,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].End.After(matches[j].End) })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches, nil
+}
+
+// GetRecentOpponents returns the opponents from up to (limit) of the most recently finished matches for the specified
+// user, most recent first.
+func (store *Store) GetRecentOpponents(databaseID uint64, limit int) (opponents []database.RecentOpponent, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	for _, match := range store.matches {
+		if (match.Player1 != databaseID && match.Player2 != databaseID) || (match.Phase != matchPhaseFinished && match.Phase != matchPhaseDraw) {
+			continue
+		}
+
+		opponent := match.Player1
+		if opponent == databaseID {
+			opponent = match.Player2
+		}
+
+		opponents = append(opponents, database.RecentOpponent{
+			DatabaseID: opponent,
+			End:        match.End,
+		})
+	}
+
+	sort.Slice(opponents, func(i, j int) bool { return opponents[i].End.After(opponents[j].End) })
+	if len(opponents) > limit {
+		opponents = opponents[:limit]
+	}
+
+	return opponents, nil
+}
+
+// GetPlayerStats returns the number of wins, losses and draws for the specified user, along with their MMR.
+func (store *Store) GetPlayerStats(databaseID uint64) (stats database.PlayerStats, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	for _, match := range store.matches {
+		if match.Player1 != databaseID && match.Player2 != databaseID {
+			continue
+		}
+
+		switch {
+		case match.Phase == matchPhaseDraw || (match.Phase == matchPhaseFinished && match.Winner == 0):
+			stats.Draws++
+		case match.Phase == matchPhaseFinished && match.Winner == databaseID:
+			stats.Wins++
+		case match.Phase == matchPhaseFinished:
+			stats.Losses++
+		}
+	}
+
+	stats.MMR = testMMR
+	stats.PeakMMR = testMMR
+
+	return stats, nil
+}
+
+// GetMMRHidden returns true if the specified user has hidden their MMR (see SetMMRHidden).
+func (store *Store) GetMMRHidden(databaseID uint64) (hidden bool, err error) {
+	store.lockState()
+	defer store.unlockState()
+
+	return store.mmrHidden[databaseID], nil
+}
+
+// testDisplayName returns the display name for the test user with the specified database ID.
+func testDisplayName(databaseID uint64) string {
+	return "Load Tester " + strconv.FormatUint(databaseID-1, 10)
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package teststore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+)
+
+// TestSharedStore checks that stores that share a state file see each other's changes - a match created by one can be
+// validated by another, and its result is reflected in the stats of the first.
+func TestSharedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	matchmaking := NewSharedStore(path)
+	game := NewSharedStore(path)
+
+	matchID, err := matchmaking.CreateMatch(database.MatchPlayer{DatabaseID: 1}, database.MatchPlayer{DatabaseID: 2}, 0)
+	if err != nil {
+		t.Fatalf("Failed to create a match: %v", err)
+	}
+
+	if valid, _, _, err := game.ValidateMatch(2, matchID); !valid {
+		t.Fatalf("Match [%v] created by another store is not valid: %v", matchID, err)
+	}
+
+	game.SetMatchStart(matchID)
+	game.SetMatchResult(matchID, 2)
+
+	if stats, _ := matchmaking.GetPlayerStats(2); stats.Wins != 1 {
+		t.Fatalf("Stats are %+v after a result was recorded by another store, expected a single win", stats)
+	}
+
+	// A new store picks up where the others left off, rather than reusing match IDs.
+	if nextID, _ := NewSharedStore(path).CreateMatch(database.MatchPlayer{DatabaseID: 1}, database.MatchPlayer{DatabaseID: 2}, 0); nextID == matchID {
+		t.Fatalf("Match ID [%v] was reused", matchID)
+	}
+}
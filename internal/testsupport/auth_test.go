@@ -0,0 +1,67 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// TestAuthVersion checks that both servers reply to an auth request with the protocol version that was negotiated for
+// the connection - assuming the legacy version for clients that don't specify one - and that clients with an
+// unsupported version in the message, or an incompatible version in the payload, are discarded.
+func TestAuthVersion(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	credentials := testsupport.TestPublicID(1) + ":token"
+
+	tests := []struct {
+		name     string
+		message  string
+		version  uint16
+		code     protocol.B2Code
+		expected string
+	}{
+		{"Legacy client", credentials, 0, protocol.WSCAuthSuccess, strconv.Itoa(int(protocol.LegacyVersion))},
+		{"Matching version", credentials + ":" + strconv.Itoa(int(protocol.CurrentVersion)), 0, protocol.WSCAuthSuccess, strconv.Itoa(int(protocol.CurrentVersion))},
+		{"Too new version", credentials + ":" + strconv.Itoa(int(protocol.CurrentVersion+1)), 0, protocol.WSCAuthSuccess, strconv.Itoa(int(protocol.CurrentVersion))},
+		{"Unsupported version", credentials + ":0", 0, protocol.WSCProtocolVersionUnsupported, ""},
+		{"Payload version", credentials, protocol.CurrentVersion, protocol.WSCAuthSuccess, strconv.Itoa(int(protocol.CurrentVersion))},
+		{"Incompatible payload version", credentials, protocol.CurrentVersion + 1, protocol.WSCProtocolVersionMismatch, ""},
+	}
+
+	servers := []struct {
+		name string
+		url  string
+	}{
+		{"Game", server.GameURL},
+		{"Matchmaking", server.MatchmakingURL},
+	}
+
+	for _, target := range servers {
+		url := target.url
+		for _, test := range tests {
+			t.Run(target.name+" "+test.name, func(t *testing.T) {
+				client := testsupport.Dial(t, url)
+				client.SendPayload(protocol.Payload{Code: protocol.WSCAuthRequest, Message: test.message, Version: test.version})
+
+				payload := client.Expect(test.code, testsupport.DefaultDeadline)
+				if test.code == protocol.WSCAuthSuccess && payload.Message != test.expected {
+					t.Fatalf("Auth succeeded with version [%s], expected [%s]", payload.Message, test.expected)
+				}
+
+				// The game server also waits for a match ID, so one is sent for a match that doesn't exist, to finish
+				// the exchange before the connection is closed.
+				if test.code == protocol.WSCAuthSuccess && url == server.GameURL {
+					client.Send(protocol.WSCMatchID, "0")
+					client.ExpectClosed(testsupport.DefaultDeadline)
+				}
+			})
+		}
+	}
+}
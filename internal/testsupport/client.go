@@ -0,0 +1,233 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package testsupport provides helpers for testing the servers end to end, over real websocket connections - from the
+// routes, through the transactions, to the servers themselves.
+package testsupport
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+	"github.com/gorilla/websocket"
+)
+
+const (
+
+	// DefaultDeadline is the deadline used when waiting for messages that should arrive straight away, such as the
+	// result of an auth request.
+	DefaultDeadline = time.Second * 5
+
+	// authToken is the auth token sent by every test client - the test store accepts any non-empty token.
+	authToken = "testsupport"
+
+	// payloadDelimiter separates the public ID from the auth token in auth requests.
+	payloadDelimiter = ":"
+)
+
+// TestClient is a websocket client for a test server, that can authenticate, send messages, and wait for messages with
+// a specific code. Its methods report failures to the test, so they must only be called from the test's goroutine.
+type TestClient struct {
+
+	// The test that the client belongs to.
+	t testing.TB
+
+	// The websocket connection.
+	conn *websocket.Conn
+
+	// Channel of the payloads received from the server, which is closed once the connection can no longer be read
+	// from - after which readErr holds the reason.
+	received chan protocol.Payload
+	readErr  error
+}
+
+// Dial opens a websocket connection to the specified URL, and returns a client for it. The connection is closed when
+// the test finishes.
+func Dial(t testing.TB, url string) *TestClient {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial [%s]: %v", url, err)
+	}
+
+	client := &TestClient{
+		t:        t,
+		conn:     conn,
+		received: make(chan protocol.Payload, 256),
+	}
+
+	go client.readPump()
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+// TestPublicID returns the public ID of the test user with the specified number, which the test store maps to the
+// database ID number + 1.
+func TestPublicID(number uint64) string {
+	return teststore.PublicIDPrefix + strconv.FormatUint(number, 10)
+}
+
+// Authenticate sends an auth request for the specified user (see TestPublicID), using the current protocol version,
+// and waits for it to succeed.
+func (client *TestClient) Authenticate(publicID string) {
+	client.t.Helper()
+
+	client.SendPayload(protocol.Payload{
+		Code:    protocol.WSCAuthRequest,
+		Message: publicID + payloadDelimiter + authToken,
+		Version: protocol.CurrentVersion,
+	})
+
+	client.Expect(protocol.WSCAuthSuccess, DefaultDeadline)
+}
+
+// Send sends a text message with the specified code and message to the server.
+func (client *TestClient) Send(code protocol.B2Code, message string) {
+	client.t.Helper()
+
+	client.SendMessage(protocol.NewMessage(protocol.WSMTText, code, message))
+}
+
+// SendPayload sends a text message with the specified payload to the server.
+func (client *TestClient) SendPayload(payload protocol.Payload) {
+	client.t.Helper()
+
+	client.SendMessage(protocol.NewMessageFromPayload(protocol.WSMTText, payload))
+}
+
+// SendMessage sends the specified message to the server.
+func (client *TestClient) SendMessage(message protocol.Message) {
+	client.t.Helper()
+
+	if err := client.conn.WriteMessage(websocket.TextMessage, message.GetPayloadBytes()); err != nil {
+		client.t.Fatalf("Failed to send a message with code [%d]: %v", message.Payload.Code, err)
+	}
+}
+
+// Ping sends a ping control frame to the server, as some client networking stacks do unprompted.
+func (client *TestClient) Ping() {
+	client.t.Helper()
+
+	if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+		client.t.Fatalf("Failed to send a ping: %v", err)
+	}
+}
+
+// Next waits for the next message from the server, and returns its payload. Fails the test if no message arrives
+// before the deadline, or if the connection is closed.
+func (client *TestClient) Next(deadline time.Duration) protocol.Payload {
+	client.t.Helper()
+
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+
+	select {
+	case payload, ok := <-client.received:
+		if !ok {
+			client.t.Fatalf("Connection closed while waiting for a message: %v", client.readErr)
+		}
+
+		return payload
+	case <-timer.C:
+		client.t.Fatalf("No message received within [%v]", deadline)
+	}
+
+	return protocol.Payload{}
+}
+
+// Expect waits for a message with the specified code, skipping any other messages, and returns its payload. Fails the
+// test if no such message arrives before the deadline, or if the connection is closed first - listing the codes of
+// the messages that were skipped.
+func (client *TestClient) Expect(code protocol.B2Code, deadline time.Duration) protocol.Payload {
+	client.t.Helper()
+
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+
+	skipped := make([]protocol.B2Code, 0)
+	for {
+		select {
+		case payload, ok := <-client.received:
+			if !ok {
+				client.t.Fatalf("Connection closed while waiting for code [%d] (skipped %v): %v", code, skipped, client.readErr)
+			}
+
+			if payload.Code == code {
+				return payload
+			}
+
+			skipped = append(skipped, payload.Code)
+		case <-timer.C:
+			client.t.Fatalf("Code [%d] not received within [%v] (skipped %v)", code, deadline, skipped)
+		}
+	}
+}
+
+// ExpectNone waits for the specified duration, skipping any messages, and fails the test if a message with the
+// specified code arrives in that time, or if the connection is closed.
+func (client *TestClient) ExpectNone(code protocol.B2Code, wait time.Duration) {
+	client.t.Helper()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case payload, ok := <-client.received:
+			if !ok {
+				client.t.Fatalf("Connection closed while checking that code [%d] is not received: %v", code, client.readErr)
+			}
+
+			if payload.Code == code {
+				client.t.Fatalf("Code [%d] received, expected nothing within [%v]", code, wait)
+			}
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// ExpectClosed waits for the server to close the connection, skipping any messages. Fails the test if the connection
+// is still open after the deadline.
+func (client *TestClient) ExpectClosed(deadline time.Duration) {
+	client.t.Helper()
+
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+
+	for {
+		select {
+		case _, ok := <-client.received:
+			if !ok {
+				return
+			}
+		case <-timer.C:
+			client.t.Fatalf("Connection not closed within [%v]", deadline)
+		}
+	}
+}
+
+// Close closes the connection. Safe to call more than once.
+func (client *TestClient) Close() {
+	client.conn.Close()
+}
+
+// readPump reads messages from the connection until it fails, passing their payloads to the received channel.
+func (client *TestClient) readPump() {
+	for {
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			client.readErr = err
+			close(client.received)
+			return
+		}
+
+		client.received <- protocol.NewPayloadFromBytes(data)
+	}
+}
@@ -0,0 +1,661 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+	"github.com/6a/blade-ii-game-server/internal/connection"
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+const (
+
+	// maxScriptedMatches is the number of matches that are played while waiting for one to end with a winner, as the
+	// scripted players occasionally draw.
+	maxScriptedMatches = 5
+
+	// maxTieMatches is the number of matches that are started while waiting for one where the first draws are tied, as
+	// the cards are dealt at random.
+	maxTieMatches = 40
+
+	// nearTimeoutTurns is the number of turns that are played with one move made just before the turn time expires.
+	nearTimeoutTurns = 4
+
+	// nearTimeoutMargin is how long before the turn time expires that the moves for near timeouts are made.
+	nearTimeoutMargin = time.Millisecond * 400
+
+	// eventBufferSize is the buffer size for the channels that match events are subscribed with, which is enough that
+	// no events are dropped.
+	eventBufferSize = 64
+)
+
+// TestScriptedWin creates a match in the store, connects both players to the game server, and plays scripted moves
+// until one of them wins - checking the match setup data that each player is sent, the result that each player is
+// sent, and the result that is written to the store and reported to the stats updater.
+func TestScriptedWin(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	for attempt := uint64(0); attempt < maxScriptedMatches; attempt++ {
+
+		// Use new users for each match, so that the results of earlier matches don't get in the way.
+		number1, number2 := attempt*2+1, attempt*2+2
+		databaseID1, databaseID2 := testUserDatabaseID(number1), testUserDatabaseID(number2)
+
+		// Earlier matches that were drawn have already reported their stats.
+		updates := len(server.Stats.Updates())
+
+		matchID := createMatch(t, server, number1, number2)
+
+		player1 := joinMatch(t, server, number1, matchID)
+		player2 := joinMatch(t, server, number2, matchID)
+
+		player1.start()
+		player2.start()
+
+		// Each player is sent their own profile, and then their opponent's.
+		for _, pair := range [][2]*testPlayer{{player1, player2}, {player2, player1}} {
+			own, opponent := pair[0], pair[1]
+			ownDatabaseID, opponentDatabaseID := databaseID1, databaseID2
+			if own == player2 {
+				ownDatabaseID, opponentDatabaseID = databaseID2, databaseID1
+			}
+
+			ownName, _, _ := server.Store.GetClientNameAndAvatar(ownDatabaseID)
+			if data := own.matchData(game.InstructionPlayerData); !strings.HasPrefix(data, ownName) {
+				t.Fatalf("Player data [%s] does not start with [%s]", data, ownName)
+			}
+
+			opponentName, _, _ := server.Store.GetClientNameAndAvatar(opponentDatabaseID)
+			if data := own.matchData(game.InstructionOpponentData); !strings.HasPrefix(data, opponentName) {
+				t.Fatalf("Opponent data [%s] does not start with [%s]", data, opponentName)
+			}
+
+			if own.self == opponent.self {
+				t.Fatalf("Both players were assigned player %v", own.self)
+			}
+		}
+
+		winner := playMatch(t, player1, player2)
+		if winner == game.PlayerUndecided {
+			t.Logf("Match [%v] was drawn - playing another", matchID)
+			continue
+		}
+
+		// Work out the database IDs of the winner and the loser.
+		winnerID, loserID := databaseID1, databaseID2
+		if winner != player1.self {
+			winnerID, loserID = databaseID2, databaseID1
+		}
+
+		// The result is written to the store asynchronously, once the players have been sent it.
+		waitFor(t, testsupport.DefaultDeadline, "the result to be written to the store", func() bool {
+			stats, _ := server.Store.GetPlayerStats(winnerID)
+			return stats.Wins == 1
+		})
+
+		if stats, _ := server.Store.GetPlayerStats(loserID); stats.Losses != 1 || stats.Wins != 0 {
+			t.Fatalf("Loser stats are %+v, expected a single loss", stats)
+		}
+
+		// The stats update is reported with the winner, as player 1 or 2 of the match.
+		waitFor(t, testsupport.DefaultDeadline, "the stats update", func() bool {
+			return len(server.Stats.Updates()) == updates+1
+		})
+
+		var expectedWinner apiinterface.Winner = apiinterface.Player1
+		if winnerID == databaseID2 {
+			expectedWinner = apiinterface.Player2
+		}
+
+		if update := server.Stats.Updates()[updates]; update.Winner != expectedWinner {
+			t.Fatalf("Stats update has winner [%v], expected [%v]", update.Winner, expectedWinner)
+		}
+
+		return
+	}
+
+	t.Fatalf("Every one of %d scripted matches was drawn", maxScriptedMatches)
+}
+
+// TestTieAnnouncements starts matches until the first draws are tied, and checks that both players are told that the
+// field was cleared, and then whose turn it is once it has been decided - and that a stale draw, sent by a player that
+// has already drawn while the turn is undecided, is ignored rather than ending the match.
+func TestTieAnnouncements(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	for attempt := uint64(0); attempt < maxTieMatches; attempt++ {
+		number1, number2 := attempt*2+1, attempt*2+2
+
+		matchID := createMatch(t, server, number1, number2)
+		player1 := joinMatch(t, server, number1, matchID)
+		player2 := joinMatch(t, server, number2, matchID)
+
+		player1.start()
+		player2.start()
+
+		// The turn is undecided until the first draws, so each player's only legal move is to draw.
+		draw1 := player1.rules.LegalMoves(player1.self)[0]
+		draw2 := player2.rules.LegalMoves(player2.self)[0]
+
+		if draw1.Instruction.ToCard().Value() != draw2.Instruction.ToCard().Value() {
+			player1.client.Close()
+			player2.client.Close()
+			continue
+		}
+
+		// The first player draws, and then sends their draw again. The state request is answered once the repeated
+		// draw has been handled, as the messages from each client are handled in order.
+		player1.send(draw1)
+		player1.sendIgnored(draw1)
+		player1.client.Send(protocol.WSCMatchStateRequest, "")
+		player1.matchData(game.InstructionCardCounts)
+
+		player2.send(draw2)
+		player1.receive(player2)
+		player2.receive(player1)
+
+		for _, player := range []*testPlayer{player1, player2} {
+			player.matchData(game.InstructionFieldCleared)
+		}
+
+		// Both players draw again, until the turn is decided - the field is cleared again for each tie.
+		for player1.rules.Turn() == game.PlayerUndecided {
+			if ended, _ := player1.rules.Ended(); ended {
+				t.Fatalf("Match [%v] ended before the turn was decided", matchID)
+			}
+
+			player1.move()
+			player2.move()
+			player1.receive(player2)
+			player2.receive(player1)
+		}
+
+		// The turn is sent in the same format as the card data.
+		expected := "0"
+		if player1.rules.Turn() == game.Player2 {
+			expected = "1"
+		}
+
+		for _, player := range []*testPlayer{player1, player2} {
+			if turn := player.matchData(game.InstructionTurnDecided); turn != expected {
+				t.Fatalf("Player %v was sent turn [%s], expected [%s]", player.self, turn, expected)
+			}
+		}
+
+		// The ignored draw didn't end the match, which can still be played out.
+		playMatch(t, player1, player2)
+		return
+	}
+
+	t.Fatalf("None of %d matches started with tied draws", maxTieMatches)
+}
+
+// TestDuplicateMove checks that a move that is sent again with the same sequence number, as with a double click or a
+// repeated packet, is ignored - it isn't forwarded to the opponent, and isn't treated as a move out of turn (which
+// would forfeit the match), so the match can still be played out to a normal result. The same goes for a move that is
+// sent again without a sequence number, by a client that uses them.
+func TestDuplicateMove(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix func(player *testPlayer) string
+	}{
+		{"Same sequence number", func(player *testPlayer) string { return strconv.FormatUint(player.sent, 10) + "|" }},
+		{"No sequence number", func(player *testPlayer) string { return "" }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := testsupport.StartTestServer(t)
+
+			matchID := createMatch(t, server, 1, 2)
+
+			player1 := joinMatch(t, server, 1, matchID)
+			player2 := joinMatch(t, server, 2, matchID)
+
+			player1.start()
+			player2.start()
+
+			// Play until a player makes a move that passes the turn to their opponent, and then send it again - as it's
+			// no longer their turn, the repeated move would be illegal if it wasn't ignored.
+			for duplicated := false; !duplicated; {
+				if ended, _ := player1.rules.Ended(); ended {
+					t.Fatalf("Match [%v] ended before a move passed the turn", matchID)
+				}
+
+				for _, player := range []*testPlayer{player1, player2} {
+					if player.rules.Turn() != player.self || len(player.rules.LegalMoves(player.self)) == 0 {
+						continue
+					}
+
+					move := player.rules.LegalMoves(player.self)[0]
+					player.send(move)
+
+					if !player.rules.ExpectsMove(player.self) {
+						player.client.Send(protocol.WSCMatchMove, test.prefix(player)+strconv.Itoa(int(move.Instruction))+":"+move.Payload)
+						duplicated = true
+					}
+
+					break
+				}
+
+				if !duplicated {
+					player1.move()
+					player2.move()
+				}
+
+				player1.receive(player2)
+				player2.receive(player1)
+			}
+
+			playMatch(t, player1, player2)
+
+			waitFor(t, testsupport.DefaultDeadline, "the result to be written to the store", func() bool {
+				return server.Store.Calls("SetMatchResult")+server.Store.Calls("SetMatchDraw") == 1
+			})
+		})
+	}
+}
+
+// TestTurnTimeoutLoss checks that a player who doesn't make a move within the turn time of a ranked match loses - their
+// opponent is awarded the win, the result is written to the store, and subscribers are told that the match started,
+// that the player timed out, and that the match ended.
+func TestTurnTimeoutLoss(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	events := make(chan game.Event, eventBufferSize)
+	server.Game.Subscribe(events)
+
+	matchID := createMatch(t, server, 1, 2)
+
+	idle := joinMatch(t, server, 1, matchID)
+	active := joinMatch(t, server, 2, matchID)
+
+	idle.start()
+	active.start()
+
+	// Only the active player draws, so the idle player times out.
+	active.move()
+
+	start := time.Now()
+	idle.client.Expect(protocol.WSCMatchTimeOut, testsupport.TurnMaxWait+testsupport.DefaultDeadline)
+	active.client.Expect(protocol.WSCMatchForfeit, testsupport.DefaultDeadline)
+
+	if elapsed := time.Since(start); elapsed < testsupport.TurnMaxWait/2 {
+		t.Fatalf("Timed out after [%v], well before the turn time of [%v]", elapsed, testsupport.TurnMaxWait)
+	}
+
+	waitFor(t, testsupport.DefaultDeadline, "the result to be written to the store", func() bool {
+		stats, _ := server.Store.GetPlayerStats(testUserDatabaseID(2))
+		return stats.Wins == 1
+	})
+
+	nextEvent(t, events, matchID, game.EventMatchStarted)
+
+	if event := nextEvent(t, events, matchID, game.EventPlayerTimedOut); event.Player != testsupport.TestPublicID(1) {
+		t.Fatalf("Timeout event is for [%s], expected [%s]", event.Player, testsupport.TestPublicID(1))
+	}
+
+	if event := nextEvent(t, events, matchID, game.EventMatchEnded); event.Winner != testsupport.TestPublicID(2) {
+		t.Fatalf("Match ended event has winner [%s], expected [%s]", event.Winner, testsupport.TestPublicID(2))
+	}
+}
+
+// TestMatchEvents checks that subscribers are told when a match starts, with both players, and when it ends, with the
+// winner - and nothing else, for a match that is played out.
+func TestMatchEvents(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	events := make(chan game.Event, eventBufferSize)
+	server.Game.Subscribe(events)
+
+	matchID := createMatch(t, server, 1, 2)
+	player1 := joinMatch(t, server, 1, matchID)
+	player2 := joinMatch(t, server, 2, matchID)
+
+	player1.start()
+	player2.start()
+
+	winner := playMatch(t, player1, player2)
+
+	// The public ID of the winner, which is empty for a draw.
+	var expectedWinner string
+	if winner == player1.self {
+		expectedWinner = testsupport.TestPublicID(1)
+	} else if winner == player2.self {
+		expectedWinner = testsupport.TestPublicID(2)
+	}
+
+	players := []string{testsupport.TestPublicID(1), testsupport.TestPublicID(2)}
+
+	if event := nextEvent(t, events, matchID, game.EventMatchStarted); !reflect.DeepEqual(event.Players, players) {
+		t.Fatalf("Match started event has players %v, expected %v", event.Players, players)
+	}
+
+	event := nextEvent(t, events, matchID, game.EventMatchEnded)
+	if event.Winner != expectedWinner || !reflect.DeepEqual(event.Players, players) {
+		t.Fatalf("Match ended event has winner [%s] and players %v, expected [%s] and %v", event.Winner, event.Players, expectedWinner, players)
+	}
+}
+
+// nextEvent waits for the next event for the specified match, skipping events for other matches, and fails the test if
+// it isn't of the specified type, or doesn't arrive before the default deadline.
+func nextEvent(t *testing.T, events <-chan game.Event, matchID uint64, eventType game.EventType) game.Event {
+	t.Helper()
+
+	timer := time.NewTimer(testsupport.DefaultDeadline)
+	defer timer.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.MatchID != matchID {
+				continue
+			}
+
+			if event.Type != eventType {
+				t.Fatalf("Received event %+v, expected type [%v]", event, eventType)
+			}
+
+			return event
+		case <-timer.C:
+			t.Fatalf("No event of type [%v] received for match [%v] within [%v]", eventType, matchID, testsupport.DefaultDeadline)
+		}
+	}
+}
+
+// TestPreMatchFlood checks that messages sent by a player while they wait for their opponent are discarded, so that
+// they can't fill up the inbound queue and stop the connection from being read - and that a player who sends messages
+// faster than they can be discarded is removed for flooding, rather than when the read deadline passes.
+func TestPreMatchFlood(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	move := protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchMove, "1|2:")
+
+	// Bursts that each fit into the inbound queue, but add up to more than the queue can hold and drop.
+	matchID := createMatch(t, server, 1, 2)
+	player1 := joinMatch(t, server, 1, matchID)
+
+	for burst := 0; burst < 3; burst++ {
+		for i := 0; i < connection.MessageBufferSize-2; i++ {
+			player1.client.SendMessage(move)
+		}
+
+		time.Sleep(time.Millisecond * 600)
+	}
+
+	player2 := joinMatch(t, server, 2, matchID)
+	player1.start()
+	player2.start()
+
+	// A flood that arrives within a single tick.
+	matchID = createMatch(t, server, 3, 4)
+	player3 := joinMatch(t, server, 3, matchID)
+
+	for i := 0; i < connection.MessageBufferSize*4; i++ {
+		player3.client.SendMessage(move)
+	}
+
+	player3.client.Expect(protocol.WSCClientFlooding, testsupport.DefaultDeadline)
+	player3.client.ExpectClosed(testsupport.DefaultDeadline)
+}
+
+// TestGameStoreFailure checks that a client is discarded with a server error if their match can't be validated because
+// of a database error.
+func TestGameStoreFailure(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	matchID := createMatch(t, server, 1, 2)
+	server.Store.FailWith("ValidateMatch", database.ErrDatabase)
+
+	client := testsupport.Dial(t, server.GameURL)
+	client.Authenticate(testsupport.TestPublicID(1))
+	client.Send(protocol.WSCMatchID, strconv.FormatUint(matchID, 10))
+
+	client.Expect(protocol.WSCServerError, testsupport.DefaultDeadline)
+	client.ExpectClosed(testsupport.DefaultDeadline)
+}
+
+// TestProfileRefresh checks that a player's opponent is sent the display name and avatar that the player has when the
+// match starts, rather than the ones that they had when they connected - and that the match still starts, with the
+// ones that they connected with, if they can't be fetched.
+func TestProfileRefresh(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	// Changed between the first player connecting, and the match starting.
+	matchID := createMatch(t, server, 1, 2)
+	player1 := joinMatch(t, server, 1, matchID)
+	server.Store.SetProfile(testUserDatabaseID(1), "Renamed Player", 5)
+	player2 := joinMatch(t, server, 2, matchID)
+
+	player1.start()
+	player2.start()
+
+	expected := "Renamed Player." + testsupport.TestPublicID(1) + ".5"
+	if data := player2.matchData(game.InstructionOpponentData); !strings.HasPrefix(data, expected) {
+		t.Fatalf("Opponent data [%s] does not start with [%s]", data, expected)
+	}
+
+	// The refresh fails.
+	server.Store.FailWith("GetClientsNameAndAvatar", database.ErrDatabase)
+
+	matchID = createMatch(t, server, 3, 4)
+	player3 := joinMatch(t, server, 3, matchID)
+	server.Store.SetProfile(testUserDatabaseID(3), "Unseen Player", 6)
+	player4 := joinMatch(t, server, 4, matchID)
+
+	player3.start()
+	player4.start()
+
+	name, _, _ := server.Store.Store.GetClientNameAndAvatar(testUserDatabaseID(3))
+	expected = name + "." + testsupport.TestPublicID(3) + ".0"
+	if data := player4.matchData(game.InstructionOpponentData); !strings.HasPrefix(data, expected) {
+		t.Fatalf("Opponent data [%s] does not start with [%s]", data, expected)
+	}
+}
+
+// TestMMRPreview checks that the winner of a ranked match is sent a preview of the change in their MMR, and that the
+// winner of a casual match (one created with a turn time) is not, as casual matches don't affect MMR.
+func TestMMRPreview(t *testing.T) {
+	tests := []struct {
+		name     string
+		turnTime time.Duration
+		expected string
+	}{
+		{"Ranked", 0, "Opponent forfeited the match:+16"},
+		{"Casual", time.Second * 30, "Opponent forfeited the match"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := testsupport.StartTestServer(t)
+
+			player1 := database.MatchPlayer{DatabaseID: testUserDatabaseID(1)}
+			player2 := database.MatchPlayer{DatabaseID: testUserDatabaseID(2)}
+
+			matchID, err := server.Store.CreateMatch(player1, player2, test.turnTime)
+			if err != nil {
+				t.Fatalf("Failed to create a match: %v", err)
+			}
+
+			forfeiter := joinMatch(t, server, 1, matchID)
+			winner := joinMatch(t, server, 2, matchID)
+
+			forfeiter.start()
+			winner.start()
+
+			// The first forfeit message is confirmed by the second.
+			forfeiter.client.Send(protocol.WSCMatchForfeit, "")
+			forfeiter.client.Expect(protocol.WSCMatchForfeitPending, testsupport.DefaultDeadline)
+			forfeiter.client.Send(protocol.WSCMatchForfeit, "")
+
+			if payload := winner.client.Expect(protocol.WSCMatchForfeit, testsupport.DefaultDeadline); payload.Message != test.expected {
+				t.Fatalf("Winner was sent [%s], expected [%s]", payload.Message, test.expected)
+			}
+		})
+	}
+}
+
+// TestSameUserJoinRace connects the same user to the game server twice, and has both connections join the same match
+// at once - checks that exactly one of them is admitted (the other is removed as a stale connection), and that the
+// match then starts against their opponent, rather than against the user themselves, without a result being written.
+func TestSameUserJoinRace(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	matchID := createMatch(t, server, 1, 2)
+
+	racers := []*testsupport.TestClient{testsupport.Dial(t, server.GameURL), testsupport.Dial(t, server.GameURL)}
+	for _, racer := range racers {
+		racer.Authenticate(testsupport.TestPublicID(1))
+	}
+
+	for _, racer := range racers {
+		racer.Send(protocol.WSCMatchID, strconv.FormatUint(matchID, 10))
+	}
+
+	for _, racer := range racers {
+		racer.Expect(protocol.WSCMatchJoined, testsupport.DefaultDeadline)
+	}
+
+	opponent := joinMatch(t, server, 2, matchID)
+
+	// Each connection is either replaced, or sent the cards once the match starts.
+	replaced := 0
+	for _, racer := range racers {
+		for done := false; !done; {
+			switch payload := racer.Next(testsupport.DefaultDeadline); payload.Code {
+			case protocol.WSCMatchMultipleConnections:
+				racer.ExpectClosed(testsupport.DefaultDeadline)
+				replaced++
+				done = true
+			case protocol.WSCMatchData:
+				done = strings.HasPrefix(payload.Message, strconv.Itoa(int(game.InstructionCards))+":")
+			}
+		}
+	}
+
+	if replaced != 1 {
+		t.Fatalf("%d connections were replaced, expected 1", replaced)
+	}
+
+	opponent.start()
+
+	if calls := server.Store.Calls("SetMatchResult") + server.Store.Calls("SetMatchNoContest"); calls != 0 {
+		t.Fatalf("The store was sent %d results, expected none", calls)
+	}
+}
+
+// TestRelayMessage checks that a relay message sent as text is forwarded to the sender's opponent, with its content
+// untouched and a server timestamp, is not echoed to the sender, and leaves the match in play.
+func TestRelayMessage(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	matchID := createMatch(t, server, 1, 2)
+
+	sender := joinMatch(t, server, 1, matchID)
+	receiver := joinMatch(t, server, 2, matchID)
+
+	sender.start()
+	receiver.start()
+
+	sender.client.Send(protocol.WSCMatchRelayMessage, "Good luck")
+
+	payload := receiver.client.Expect(protocol.WSCMatchRelayMessage, testsupport.DefaultDeadline)
+	if payload.Message != "Good luck" || payload.Timestamp == 0 {
+		t.Fatalf("Receiver was sent [%s] at [%d], expected [Good luck] with a timestamp", payload.Message, payload.Timestamp)
+	}
+
+	sender.client.ExpectNone(protocol.WSCMatchRelayMessage, time.Second)
+
+	playMatch(t, sender, receiver)
+}
+
+// TestForfeit checks that a forfeit sent as text (and confirmed) ends the match - the forfeiting player is
+// disconnected, their opponent is told that they forfeited, and the opponent's win is written to the store.
+func TestForfeit(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	matchID := createMatch(t, server, 1, 2)
+
+	forfeiter := joinMatch(t, server, 1, matchID)
+	winner := joinMatch(t, server, 2, matchID)
+
+	forfeiter.start()
+	winner.start()
+
+	forfeiter.client.Send(protocol.WSCMatchForfeit, "")
+	forfeiter.client.Expect(protocol.WSCMatchForfeitPending, testsupport.DefaultDeadline)
+	forfeiter.client.Send(protocol.WSCMatchForfeit, "")
+
+	winner.client.Expect(protocol.WSCMatchForfeit, testsupport.DefaultDeadline)
+	forfeiter.client.ExpectClosed(testsupport.DefaultDeadline)
+
+	waitFor(t, testsupport.DefaultDeadline, "the result to be written to the store", func() bool {
+		stats, _ := server.Store.GetPlayerStats(testUserDatabaseID(2))
+		return stats.Wins == 1
+	})
+}
+
+// TestNearTimeoutMoves alternates moves made just before the turn time expires with moves made straight away, and
+// checks that no turn timer fire leaks through to a later turn - the match is played out to a single normal result,
+// and neither player is timed out.
+func TestNearTimeoutMoves(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	events := make(chan game.Event, eventBufferSize)
+	server.Game.Subscribe(events)
+
+	matchID := createMatch(t, server, 1, 2)
+
+	player1 := joinMatch(t, server, 1, matchID)
+	player2 := joinMatch(t, server, 2, matchID)
+
+	player1.start()
+	player2.start()
+
+	for turn := 0; turn < nearTimeoutTurns; turn++ {
+		if ended, _ := player1.rules.Ended(); ended {
+			break
+		}
+
+		// The first move of each turn is made at the last moment, and any reply straight away.
+		time.Sleep(testsupport.TurnMaxWait - nearTimeoutMargin)
+
+		player1.move()
+		player2.move()
+
+		player1.receive(player2)
+		player2.receive(player1)
+	}
+
+	if ended, _ := player1.rules.Ended(); !ended {
+		playMatch(t, player1, player2)
+	}
+
+	// The result is written in the background.
+	results := func() int {
+		return server.Store.Calls("SetMatchResult") + server.Store.Calls("SetMatchDraw")
+	}
+
+	waitFor(t, testsupport.DefaultDeadline, "the result to be written to the store", func() bool {
+		return results() > 0
+	})
+
+	// The match ended without anyone timing out in between.
+	nextEvent(t, events, matchID, game.EventMatchStarted)
+	nextEvent(t, events, matchID, game.EventMatchEnded)
+
+	if calls := results(); calls != 1 {
+		t.Fatalf("The store was sent %d results, expected one", calls)
+	}
+}
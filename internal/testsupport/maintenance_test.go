@@ -0,0 +1,72 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// TestMaintenanceMode enables maintenance mode while a match is in progress, and checks that the queue stops pairing
+// clients and new matches are refused, while the match in progress still plays to completion - after which the servers
+// report that they have drained. Once maintenance mode is disabled, the queue pairs clients again.
+func TestMaintenanceMode(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	matchID := createMatch(t, server, 1, 2)
+
+	player1 := joinMatch(t, server, 1, matchID)
+	player2 := joinMatch(t, server, 2, matchID)
+
+	player1.start()
+	player2.start()
+
+	// The game server picks up the change on its next tick, and announces it to the players. No moves have been made
+	// yet, so nothing that the players need is skipped while waiting for it.
+	server.Maintenance.Enable(time.Now().Add(time.Minute))
+
+	for _, player := range []*testPlayer{player1, player2} {
+		player.client.Expect(protocol.WSCServerAnnouncement, testsupport.DefaultDeadline)
+	}
+
+	// New matches are refused.
+	newMatchID := createMatch(t, server, 3, 4)
+
+	refused := testsupport.Dial(t, server.GameURL)
+	refused.Authenticate(testsupport.TestPublicID(3))
+	refused.Send(protocol.WSCMatchID, strconv.FormatUint(newMatchID, 10))
+	refused.Expect(protocol.WSCServerMaintenance, testsupport.DefaultDeadline)
+
+	// The queue stops pairing clients, for long enough for it to be polled several times.
+	client1 := testsupport.Dial(t, server.MatchmakingURL)
+	client1.Authenticate(testsupport.TestPublicID(5))
+
+	client2 := testsupport.Dial(t, server.MatchmakingURL)
+	client2.Authenticate(testsupport.TestPublicID(6))
+
+	client1.ExpectNone(protocol.WSCMatchMakingMatchFound, time.Second)
+
+	// The match in progress plays to completion, after which there is nothing left to drain.
+	winner := playMatch(t, player1, player2)
+
+	waitFor(t, testsupport.DefaultDeadline, "the result to be written", func() bool {
+		return server.Store.Calls("SetMatchResult")+server.Store.Calls("SetMatchDraw") == 1
+	})
+
+	select {
+	case <-server.Maintenance.Drained():
+	case <-time.After(testsupport.DefaultDeadline):
+		t.Fatalf("Servers did not drain within [%v] of the match ending with winner %v", testsupport.DefaultDeadline, winner)
+	}
+
+	server.Maintenance.Disable()
+
+	client1.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+	client2.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+}
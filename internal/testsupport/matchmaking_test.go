@@ -0,0 +1,293 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// TestMatchCreationFailure checks that when the store fails to create a match after both clients accept the ready
+// check, both clients are told that match creation failed, and stay in the queue - so that they are matched again, and
+// confirmed, once the store recovers.
+func TestMatchCreationFailure(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+	server.Store.FailWith("CreateMatch", errors.New("database unavailable"))
+
+	client1 := testsupport.Dial(t, server.MatchmakingURL)
+	client1.Authenticate(testsupport.TestPublicID(1))
+
+	client2 := testsupport.Dial(t, server.MatchmakingURL)
+	client2.Authenticate(testsupport.TestPublicID(2))
+
+	clients := []*testsupport.TestClient{client1, client2}
+
+	// Accept the ready check - the match can't be created, so both clients should be told, and left in the queue.
+	for _, client := range clients {
+		client.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+		client.Send(protocol.WSCMatchMakingAccept, "")
+	}
+
+	for _, client := range clients {
+		client.Expect(protocol.WSCMatchCreationFailed, testsupport.DefaultDeadline)
+	}
+
+	if calls := server.Store.Calls("CreateMatch"); calls != 1 {
+		t.Fatalf("CreateMatch was called %d times, expected 1", calls)
+	}
+
+	// Once the store recovers, the same clients should be matched again, and the match confirmed.
+	server.Store.FailWith("CreateMatch", nil)
+
+	for _, client := range clients {
+		client.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+		client.Send(protocol.WSCMatchMakingAccept, "")
+	}
+
+	for _, client := range clients {
+		client.Expect(protocol.WSCMatchConfirmed, testsupport.DefaultDeadline)
+	}
+}
+
+// matchmake connects the test users with the specified numbers to the matchmaking server, accepts the ready check for
+// both of them, and returns the ID of the match that they are confirmed for.
+func matchmake(t *testing.T, server *testsupport.TestServer, number1 uint64, number2 uint64) (matchID uint64) {
+	t.Helper()
+
+	client1 := testsupport.Dial(t, server.MatchmakingURL)
+	client1.Authenticate(testsupport.TestPublicID(number1))
+
+	client2 := testsupport.Dial(t, server.MatchmakingURL)
+	client2.Authenticate(testsupport.TestPublicID(number2))
+
+	clients := []*testsupport.TestClient{client1, client2}
+
+	for _, client := range clients {
+		client.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+		client.Send(protocol.WSCMatchMakingAccept, "")
+	}
+
+	// Both clients should be sent the same match ID (the clients have no region hint, so that's all they are sent), and
+	// then be disconnected from the matchmaking server.
+	for _, client := range clients {
+		payload := client.Expect(protocol.WSCMatchConfirmed, testsupport.DefaultDeadline)
+
+		confirmedID, err := strconv.ParseUint(payload.Message, 10, 64)
+		if err != nil {
+			t.Fatalf("Malformed match confirmation [%s]: %v", payload.Message, err)
+		}
+
+		if matchID != 0 && confirmedID != matchID {
+			t.Fatalf("Clients were confirmed for different matches [%v] and [%v]", matchID, confirmedID)
+		}
+
+		matchID = confirmedID
+		client.ExpectClosed(testsupport.DefaultDeadline)
+	}
+
+	return matchID
+}
+
+// TestMatchmakingConfirmation checks that two clients in the queue are matched, and once they accept the ready check,
+// are confirmed for a match that was created in the store for both of them.
+func TestMatchmakingConfirmation(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	matchID := matchmake(t, server, 1, 2)
+
+	for _, number := range []uint64{1, 2} {
+		if valid, _, _, err := server.Store.ValidateMatch(testUserDatabaseID(number), matchID); !valid {
+			t.Fatalf("Match [%v] is not valid for user %d: %v", matchID, number, err)
+		}
+	}
+}
+
+// TestMatchmakingMetrics runs clients through the queue - one pair that is confirmed, and one whose ready check fails -
+// and checks the metrics that are recorded.
+func TestMatchmakingMetrics(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+	server.Store.SetMMR(testUserDatabaseID(1), 1000)
+	server.Store.SetMMR(testUserDatabaseID(2), 1040)
+
+	matchmake(t, server, 1, 2)
+
+	// Only the first client accepts the ready check, so it fails once the ready check time has passed.
+	client3 := testsupport.Dial(t, server.MatchmakingURL)
+	client3.Authenticate(testsupport.TestPublicID(3))
+
+	client4 := testsupport.Dial(t, server.MatchmakingURL)
+	client4.Authenticate(testsupport.TestPublicID(4))
+
+	client3.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+	client4.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+	client3.Send(protocol.WSCMatchMakingAccept, "")
+
+	client4.Expect(protocol.WSCReadyCheckFailed, testsupport.ReadyCheckTime+testsupport.DefaultDeadline)
+
+	metrics := server.Matchmaking.Metrics()
+	if metrics.ReadyChecksAccepted != 1 || metrics.ReadyChecksFailed != 1 || metrics.AcceptRate != 0.5 {
+		t.Fatalf("Ready check metrics are %+v, expected one accepted and one failed", metrics)
+	}
+
+	if metrics.AverageMMRGap != 40 {
+		t.Fatalf("Average MMR gap is %v, expected 40", metrics.AverageMMRGap)
+	}
+
+	// Both clients of the confirmed pair were matched straight away, so they waited for less than a second.
+	if metrics.WaitP50 != time.Second || metrics.WaitP95 != time.Second {
+		t.Fatalf("Wait times are [%v] and [%v], expected both to be in the first bucket", metrics.WaitP50, metrics.WaitP95)
+	}
+}
+
+// TestMatchmadeWin plays a match from the matchmaking queue through to a win on the game server, with scripted
+// players.
+func TestMatchmadeWin(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	for attempt := uint64(0); attempt < maxScriptedMatches; attempt++ {
+		number1, number2 := attempt*2+1, attempt*2+2
+
+		matchID := matchmake(t, server, number1, number2)
+
+		player1 := joinMatch(t, server, number1, matchID)
+		player2 := joinMatch(t, server, number2, matchID)
+
+		player1.start()
+		player2.start()
+
+		if winner := playMatch(t, player1, player2); winner != game.PlayerUndecided {
+			return
+		}
+
+		t.Logf("Match [%v] was drawn - playing another", matchID)
+	}
+
+	t.Fatalf("Every one of %d matchmade matches was drawn", maxScriptedMatches)
+}
+
+// TestMatchHandoff checks that the display name, avatar and MMR that each client had in the matchmaking queue are
+// handed to the game server with the match, rather than being fetched again when they connect to it.
+func TestMatchHandoff(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	server.Store.SetProfile(testUserDatabaseID(1), "Queued Player", 3)
+	server.Store.SetMMR(testUserDatabaseID(1), 1234)
+
+	matchID := matchmake(t, server, 1, 2)
+
+	// Changes made after the match was created are not handed off.
+	server.Store.SetProfile(testUserDatabaseID(1), "Renamed Player", 4)
+	server.Store.SetMMR(testUserDatabaseID(1), 4321)
+
+	valid, _, player, err := server.Store.ValidateMatch(testUserDatabaseID(1), matchID)
+	if !valid {
+		t.Fatalf("Match [%v] is not valid: %v", matchID, err)
+	}
+
+	expected := database.MatchPlayer{DatabaseID: testUserDatabaseID(1), DisplayName: "Queued Player", Avatar: 3, MMR: 1234}
+	if player != expected {
+		t.Fatalf("Match player is %+v, expected %+v", player, expected)
+	}
+
+	profileLookups, mmrLookups := server.Store.Calls("GetClientNameAndAvatar"), server.Store.Calls("GetMMR")
+
+	joinMatch(t, server, 1, matchID)
+	joinMatch(t, server, 2, matchID)
+
+	if calls := server.Store.Calls("GetClientNameAndAvatar"); calls != profileLookups {
+		t.Fatalf("The game server looked up %d profiles, expected none", calls-profileLookups)
+	}
+
+	if calls := server.Store.Calls("GetMMR"); calls != mmrLookups {
+		t.Fatalf("The game server looked up %d MMRs, expected none", calls-mmrLookups)
+	}
+}
+
+// TestMatchmakingStoreFailure checks that a client is discarded with a server error if their MMR can't be fetched when
+// they join the matchmaking queue, without being sent the details of the error.
+func TestMatchmakingStoreFailure(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+	server.Store.FailWith("GetMMR", errors.New("dial tcp 10.0.0.1:3306: connection refused"))
+
+	client := testsupport.Dial(t, server.MatchmakingURL)
+	client.Authenticate(testsupport.TestPublicID(1))
+
+	payload := client.Expect(protocol.WSCServerError, testsupport.DefaultDeadline)
+	if payload.Message != database.ErrDatabase.Error() {
+		t.Fatalf("Server error message is [%s], expected [%s]", payload.Message, database.ErrDatabase.Error())
+	}
+
+	client.ExpectClosed(testsupport.DefaultDeadline)
+}
+
+// TestRecentMatches checks that a client in the matchmaking queue is sent their recent matches when they ask for them,
+// and that the queue keeps matching clients while the matches are being fetched.
+func TestRecentMatches(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	// A finished match, won by the client that asks for their recent matches.
+	matchID := createMatch(t, server, 1, 3)
+	if err := server.Store.SetMatchResult(matchID, testUserDatabaseID(1)); err != nil {
+		t.Fatalf("Failed to set the match result: %v", err)
+	}
+
+	release := server.Store.Block("GetRecentMatches")
+
+	client1 := testsupport.Dial(t, server.MatchmakingURL)
+	client1.Authenticate(testsupport.TestPublicID(1))
+	client1.Send(protocol.WSCRecentMatchesRequest, "")
+
+	waitFor(t, testsupport.DefaultDeadline, "the recent matches to be fetched", func() bool {
+		return server.Store.Calls("GetRecentMatches") == 1
+	})
+
+	// The fetch is still blocked, so the clients can only be matched if it isn't holding up the queue.
+	client2 := testsupport.Dial(t, server.MatchmakingURL)
+	client2.Authenticate(testsupport.TestPublicID(2))
+
+	client1.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+	client2.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+
+	release()
+
+	recent, _ := server.Store.GetRecentMatches(testUserDatabaseID(1), 1)
+	opponent, _, _ := server.Store.GetClientNameAndAvatar(testUserDatabaseID(3))
+
+	expected := opponent + ".1." + strconv.FormatInt(recent[0].End.Unix(), 10)
+	if payload := client1.Expect(protocol.WSCRecentMatchesResponse, testsupport.DefaultDeadline); payload.Message != expected {
+		t.Fatalf("Recent matches are [%s], expected [%s]", payload.Message, expected)
+	}
+}
+
+// TestQueuePausedAtCapacity checks that the queue stops pairing clients while the game server is at its concurrent
+// match limit, and pairs them once the load drops.
+func TestQueuePausedAtCapacity(t *testing.T) {
+	server := testsupport.StartTestServer(t)
+
+	// The gauge is shared with the queue, and is only updated by the game server as matches are created and removed.
+	gauge := server.Game.Capacity()
+	gauge.Set(gauge.Limit())
+
+	client1 := testsupport.Dial(t, server.MatchmakingURL)
+	client1.Authenticate(testsupport.TestPublicID(1))
+
+	client2 := testsupport.Dial(t, server.MatchmakingURL)
+	client2.Authenticate(testsupport.TestPublicID(2))
+
+	// Long enough for the queue to be polled several times.
+	client1.ExpectNone(protocol.WSCMatchMakingMatchFound, time.Second)
+
+	gauge.Set(gauge.Limit() - 1)
+
+	client1.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+	client2.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// testPlayer is a scripted player in a match on a test server. It follows the match with the same rules as the server
+// (see game.Rules), and always makes the first legal move.
+type testPlayer struct {
+	t      *testing.T
+	client *testsupport.TestClient
+
+	// Which player this is in the match, and the rules that follow the match - both set once the cards arrive.
+	self  game.Player
+	rules *game.Rules
+
+	// The number of moves that this player has sent, the number of those that the server is expected to ignore rather
+	// than forward (see sendIgnored), and the number of moves forwarded from their opponent that they have applied.
+	sent     uint64
+	ignored  uint64
+	received uint64
+
+	// The most recent match data received for each instruction, that has not yet been waited for (see matchData).
+	data map[game.B2MatchInstruction]string
+}
+
+// testUserDatabaseID returns the database ID of the test user with the specified number (see
+// testsupport.TestPublicID).
+func testUserDatabaseID(number uint64) uint64 {
+	return number + 1
+}
+
+// createMatch creates a ranked match in the store, between the test users with the specified numbers, and returns its
+// ID. No profiles are stored with the match, so the game server is given the store's current profiles (see
+// testsupport.FakeStore.ValidateMatch).
+func createMatch(t *testing.T, server *testsupport.TestServer, number1 uint64, number2 uint64) uint64 {
+	t.Helper()
+
+	player1 := database.MatchPlayer{DatabaseID: testUserDatabaseID(number1)}
+	player2 := database.MatchPlayer{DatabaseID: testUserDatabaseID(number2)}
+
+	matchID, err := server.Store.CreateMatch(player1, player2, 0)
+	if err != nil {
+		t.Fatalf("Failed to create a match: %v", err)
+	}
+
+	return matchID
+}
+
+// joinMatch connects the test user with the specified number to the game server, and joins the specified match.
+func joinMatch(t *testing.T, server *testsupport.TestServer, number uint64, matchID uint64) *testPlayer {
+	t.Helper()
+
+	client := testsupport.Dial(t, server.GameURL)
+	client.Authenticate(testsupport.TestPublicID(number))
+	client.Send(protocol.WSCMatchID, strconv.FormatUint(matchID, 10))
+	client.Expect(protocol.WSCMatchIDConfirmed, testsupport.DefaultDeadline)
+
+	return &testPlayer{
+		t:      t,
+		client: client,
+		data:   make(map[game.B2MatchInstruction]string),
+	}
+}
+
+// matchData waits for match data with the specified instruction, and returns its data. Other messages are handled
+// while waiting (see next).
+func (player *testPlayer) matchData(instruction game.B2MatchInstruction) string {
+	player.t.Helper()
+
+	for {
+		if data, ok := player.data[instruction]; ok {
+			delete(player.data, instruction)
+			return data
+		}
+
+		player.next()
+	}
+}
+
+// next waits for the next message from the server, and handles it - forwarded moves are applied and acknowledged, the
+// data from match data is recorded by instruction (see data), and other messages are skipped.
+//
+// Match data format: <instruction>:<data>
+// Forwarded move format: <sequence>|<instruction>:<payload>
+func (player *testPlayer) next() {
+	player.t.Helper()
+
+	payload := player.client.Next(testsupport.DefaultDeadline)
+
+	switch payload.Code {
+	case protocol.WSCMatchData:
+		parts := strings.SplitN(payload.Message, ":", 2)
+		if len(parts) != 2 {
+			player.t.Fatalf("Malformed match data [%s]", payload.Message)
+		}
+
+		received, err := strconv.Atoi(parts[0])
+		if err != nil {
+			player.t.Fatalf("Malformed match data instruction [%s]", payload.Message)
+		}
+
+		player.data[game.B2MatchInstruction(received)] = parts[1]
+	case protocol.WSCMatchMove:
+		parts := strings.SplitN(payload.Message, "|", 2)
+		if len(parts) != 2 {
+			player.t.Fatalf("Malformed forwarded move [%s]", payload.Message)
+		}
+
+		player.client.Send(protocol.WSCMatchMoveAck, parts[0])
+
+		move, err := game.MoveFromString(parts[1])
+		if err != nil {
+			player.t.Fatalf("Malformed forwarded move [%s]: %v", payload.Message, err)
+		}
+
+		if !player.rules.Apply(player.self.Opponent(), move) {
+			player.t.Fatalf("Forwarded move [%s] is illegal for player %v", payload.Message, player.self.Opponent())
+		}
+
+		player.received++
+	}
+}
+
+// start waits for the cards for the match, sets up the rules, and tells the server that the player is ready.
+//
+// Card data format: <player>.<cards>, where the player is 0 for player 1, and 1 for player 2.
+func (player *testPlayer) start() {
+	player.t.Helper()
+
+	parts := strings.SplitN(player.matchData(game.InstructionCards), ".", 2)
+	if len(parts) != 2 {
+		player.t.Fatalf("Malformed card data %v", parts)
+	}
+
+	cards, err := game.DeserializeDecks(parts[1])
+	if err != nil {
+		player.t.Fatalf("Failed to deserialize the cards: %v", err)
+	}
+
+	player.self = game.Player1
+	if parts[0] == "1" {
+		player.self = game.Player2
+	}
+
+	player.rules = game.NewRules(cards)
+	player.client.Send(protocol.WSCMatchClientReady, "")
+}
+
+// move sends the first legal move, for as long as the match is waiting for one from this player.
+func (player *testPlayer) move() {
+	player.t.Helper()
+
+	for player.rules.ExpectsMove(player.self) {
+		moves := player.rules.LegalMoves(player.self)
+		if len(moves) == 0 {
+			return
+		}
+
+		player.send(moves[0])
+	}
+}
+
+// send applies the specified move, and sends it to the server with the next sequence number.
+func (player *testPlayer) send(move game.Move) {
+	player.t.Helper()
+
+	if !player.rules.Apply(player.self, move) {
+		player.t.Fatalf("Player %v tried to send an illegal move [%d:%s]", player.self, move.Instruction, move.Payload)
+	}
+
+	player.sent++
+	player.client.Send(protocol.WSCMatchMove, strconv.FormatUint(player.sent, 10)+"|"+strconv.Itoa(int(move.Instruction))+":"+move.Payload)
+}
+
+// sendIgnored sends the specified move to the server with the next sequence number, without applying it, as the server
+// is expected to ignore it rather than forward it to the opponent (such as a stale draw).
+func (player *testPlayer) sendIgnored(move game.Move) {
+	player.t.Helper()
+
+	player.sent++
+	player.ignored++
+	player.client.Send(protocol.WSCMatchMove, strconv.FormatUint(player.sent, 10)+"|"+strconv.Itoa(int(move.Instruction))+":"+move.Payload)
+}
+
+// receive waits for the moves that the opponent has sent, other than those that the server ignores, and applies them
+// (see next).
+func (player *testPlayer) receive(opponent *testPlayer) {
+	player.t.Helper()
+
+	for player.received < opponent.sent-opponent.ignored {
+		player.next()
+	}
+}
+
+// resultCode returns the code that the player should be sent when the match ends with the specified winner.
+func (player *testPlayer) resultCode(winner game.Player) protocol.B2Code {
+	switch winner {
+	case player.self:
+		return protocol.WSCMatchWin
+	case game.PlayerUndecided:
+		return protocol.WSCMatchDraw
+	}
+
+	return protocol.WSCMatchLoss
+}
+
+// playMatch plays out a match between the specified players, which have both started (see start), and returns the
+// winner (PlayerUndecided for a draw) once each player has been sent the result, and been disconnected.
+func playMatch(t *testing.T, player1 *testPlayer, player2 *testPlayer) game.Player {
+	t.Helper()
+
+	for {
+		player1.move()
+		player2.move()
+
+		player1.receive(player2)
+		player2.receive(player1)
+
+		if ended, winner := player1.rules.Ended(); ended {
+			for _, player := range []*testPlayer{player1, player2} {
+				player.client.Expect(player.resultCode(winner), testsupport.DefaultDeadline)
+				player.client.ExpectClosed(testsupport.DefaultDeadline)
+			}
+
+			return winner
+		}
+	}
+}
+
+// waitFor calls the specified condition until it returns true, and fails the test if it doesn't before the deadline.
+// Used for results that are written asynchronously.
+func waitFor(t *testing.T, deadline time.Duration, description string, condition func() bool) {
+	t.Helper()
+
+	for end := time.Now().Add(deadline); !condition(); {
+		if time.Now().After(end) {
+			t.Fatalf("Timed out waiting for %s", description)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
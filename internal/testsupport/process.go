@@ -0,0 +1,141 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const (
+
+	// modulePath is the import path of the module that contains the server binaries.
+	modulePath = "github.com/6a/blade-ii-game-server"
+
+	// processStartDeadline is the maximum time that a server process has to start listening, once it has been started.
+	processStartDeadline = time.Second * 10
+)
+
+// serverProcess is a server binary running in its own process, along with everything that it has logged.
+type serverProcess struct {
+	name   string
+	cmd    *exec.Cmd
+	output bytes.Buffer
+}
+
+// StartServerProcesses builds the standalone matchmaking and game servers (cmd/matchmaking and cmd/gameserver) with the
+// "insecure" build tag, and runs each one in its own process, in offline mode - so that the split deployment can be
+// tested end to end. The servers share a test store through a state file (see teststore.NewSharedStore), as they
+// would share the database.
+//
+// Only the URLs of the returned test server are set, as the servers themselves are in other processes. The test is
+// skipped if the go tool isn't available. The processes are killed when the test finishes, and their logs are written
+// to the test log if it failed.
+func StartServerProcesses(t testing.TB) *TestServer {
+	t.Helper()
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("The go tool is required to build the server binaries: %v", err)
+	}
+
+	// Build both binaries into a temporary directory, which is also used as the working directory for the servers, so
+	// that they don't pick up a .env file.
+	dir := t.TempDir()
+
+	build := exec.Command(goTool, "build", "-tags", "insecure", "-o", dir, modulePath+"/cmd/matchmaking", modulePath+"/cmd/gameserver")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build the server binaries: %v\n%s", err, output)
+	}
+
+	matchmakingAddress := freeAddress(t)
+	gameAddress := freeAddress(t)
+
+	environment := append(os.Environ(),
+		"b2_offline_mode=true",
+		"b2_insecure_test_mode=true",
+		"b2_test_store_path="+filepath.Join(dir, "store.json"),
+		"matchmaking_server_address="+matchmakingAddress,
+		"game_server_address="+gameAddress,
+	)
+
+	startServerProcess(t, dir, "matchmaking", environment, matchmakingAddress)
+	startServerProcess(t, dir, "gameserver", environment, gameAddress)
+
+	return &TestServer{
+		GameURL:        "ws://" + gameAddress + "/game",
+		MatchmakingURL: "ws://" + matchmakingAddress + "/matchmaking",
+	}
+}
+
+// startServerProcess starts the server binary with the specified name, from the specified directory, and waits until
+// it is listening on the specified address.
+func startServerProcess(t testing.TB, dir string, name string, environment []string, address string) {
+	t.Helper()
+
+	binary := filepath.Join(dir, name)
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	process := &serverProcess{name: name, cmd: exec.Command(binary)}
+	process.cmd.Dir = dir
+	process.cmd.Env = environment
+	process.cmd.Stdout = &process.output
+	process.cmd.Stderr = &process.output
+
+	if err := process.cmd.Start(); err != nil {
+		t.Fatalf("Failed to start the %s server: %v", name, err)
+	}
+
+	t.Cleanup(process.stop(t))
+
+	for end := time.Now().Add(processStartDeadline); ; {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return
+		}
+
+		if time.Now().After(end) {
+			t.Fatalf("The %s server didn't start listening on [%s]: %v", name, address, err)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// stop returns a function that kills the process, waits for it to exit, and then writes its logs to the test log if
+// the test failed.
+func (process *serverProcess) stop(t testing.TB) func() {
+	return func() {
+		process.cmd.Process.Kill()
+		process.cmd.Wait()
+
+		if t.Failed() {
+			t.Logf("Output from the %s server:\n%s", process.name, process.output.String())
+		}
+	}
+}
+
+// freeAddress returns a local address with a port that is free to listen on.
+func freeAddress(t testing.TB) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
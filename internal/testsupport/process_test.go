@@ -0,0 +1,31 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"testing"
+
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// TestServerProcesses checks that the standalone matchmaking and game servers, each running in its own process, can
+// take a pair of clients from the queue, through the ready check, to the end of a match.
+func TestServerProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Building and running the server binaries is slow")
+	}
+
+	server := testsupport.StartServerProcesses(t)
+
+	matchID := matchmake(t, server, 1, 2)
+
+	player1 := joinMatch(t, server, 1, matchID)
+	player2 := joinMatch(t, server, 2, matchID)
+
+	player1.start()
+	player2.start()
+
+	playMatch(t, player1, player2)
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package testsupport provides helpers for testing the servers end to end, over real websocket connections - from the
+// routes, through the transactions, to the servers themselves.
+package testsupport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/game"
+	"github.com/6a/blade-ii-game-server/internal/matchmaking"
+	"github.com/6a/blade-ii-game-server/internal/routes"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/pkg/maintenance"
+)
+
+const (
+
+	// TurnMaxWait is the turn time used by the test servers for matches that were created without one (such as
+	// matchmade matches), so that timeouts can be tested quickly.
+	TurnMaxWait = time.Second * 2
+
+	// ReadyCheckTime is the maximum time that the test servers wait for both clients to accept a ready check.
+	ReadyCheckTime = time.Second * 2
+
+	// maintenanceShutdownDelay is the delay until the planned shutdown time, if maintenance mode is enabled for the
+	// test servers.
+	maintenanceShutdownDelay = time.Minute
+)
+
+// TestServer is a game server and a matchmaking server, backed by a fake store, and served on a local httptest
+// server.
+type TestServer struct {
+
+	// The fake store that backs both servers, so that tests can create matches, ban users, and program the store's
+	// responses.
+	Store *FakeStore
+
+	// The servers themselves, so that tests can replace their timeouts, or send them commands.
+	Game        *game.Server
+	Matchmaking *matchmaking.Server
+
+	// The stats updater used by the game server, so that tests can check the results that were reported.
+	Stats *RecordingStatsUpdater
+
+	// The maintenance mode switch shared by both servers.
+	Maintenance *maintenance.Mode
+
+	// The websocket URLs for the game server and the matchmaking server.
+	GameURL        string
+	MatchmakingURL string
+
+	// The underlying httptest server.
+	HTTP *httptest.Server
+}
+
+// StartTestServer starts a game server and a matchmaking server that share a fake store, with short timeouts (see
+// TurnMaxWait and ReadyCheckTime), on a new httptest server. Match stats updates are recorded rather than sent. The httptest server is closed when the test finishes.
+// The servers' main loops keep running until the test binary exits, as they can't be stopped.
+func StartTestServer(t testing.TB) *TestServer {
+	t.Helper()
+
+	return StartTestServerWithSessions(t, session.NewRegistry())
+}
+
+// StartTestServerWithSessions starts a test server (see StartTestServer) whose servers share the specified session
+// registry, so that tests can choose the duplicate login policy.
+func StartTestServerWithSessions(t testing.TB, sessions *session.Registry) *TestServer {
+	t.Helper()
+
+	// Create the store, and the state that is shared between the servers.
+	store := NewFakeStore()
+	mode := maintenance.NewMode(maintenanceShutdownDelay)
+
+	// Create the servers, with short timeouts. The first turn has no extra delay, as there are no card animations.
+	stats := &RecordingStatsUpdater{}
+	gameServer := game.NewServer(store, sessions, mode)
+	gameServer.SetTimeouts(game.Timeouts{TurnMaxWait: TurnMaxWait})
+	gameServer.SetStatsUpdater(stats)
+
+	matchmakingServer := matchmaking.NewServer(store, gameServer.Capacity(), sessions, mode)
+	matchmakingServer.SetTimeouts(matchmaking.Timeouts{ReadyCheckTime: ReadyCheckTime})
+
+	// Serve both servers on a single mux, as the combined server does when they share an address.
+	mux := http.NewServeMux()
+	routes.SetupGameServer(mux, gameServer, store)
+	routes.SetupMatchMaking(mux, matchmakingServer, store)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	websocketURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	return &TestServer{
+		Store:          store,
+		Game:           gameServer,
+		Matchmaking:    matchmakingServer,
+		Stats:          stats,
+		Maintenance:    mode,
+		GameURL:        websocketURL + "/game",
+		MatchmakingURL: websocketURL + "/matchmaking",
+		HTTP:           server,
+	}
+}
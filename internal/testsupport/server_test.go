@@ -0,0 +1,35 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"testing"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// TestSeparateServers checks that two sets of servers can be served side by side in the same process, each on its own
+// mux and port, and that each one accepts clients independently of the other.
+func TestSeparateServers(t *testing.T) {
+	first := testsupport.StartTestServer(t)
+	second := testsupport.StartTestServer(t)
+
+	if first.HTTP.URL == second.HTTP.URL {
+		t.Fatalf("Both servers are served on [%s]", first.HTTP.URL)
+	}
+
+	// The game server also waits for a match ID after auth, so one is sent for a match that doesn't exist, to finish
+	// the exchange.
+	for _, server := range []*testsupport.TestServer{first, second} {
+		client := testsupport.Dial(t, server.MatchmakingURL)
+		client.Authenticate(testsupport.TestPublicID(1))
+
+		client = testsupport.Dial(t, server.GameURL)
+		client.Authenticate(testsupport.TestPublicID(1))
+		client.Send(protocol.WSCMatchID, "0")
+		client.ExpectClosed(testsupport.DefaultDeadline)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package testsupport_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/session"
+	"github.com/6a/blade-ii-game-server/internal/testsupport"
+)
+
+// duplicateLoginWait is how long a connection is watched to make sure that it isn't removed as a duplicate login.
+const duplicateLoginWait = time.Second
+
+// TestQueueThenGame checks what happens when a user who is in the matchmaking queue connects to the game server -
+// under the evict policy, they are removed from the queue, and under the reject policy, the game server refuses them
+// and they stay in the queue.
+func TestQueueThenGame(t *testing.T) {
+	t.Run("Evict", func(t *testing.T) {
+		server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyEvict))
+
+		queued := testsupport.Dial(t, server.MatchmakingURL)
+		queued.Authenticate(testsupport.TestPublicID(1))
+
+		matchID := createMatch(t, server, 1, 2)
+		player1 := joinMatch(t, server, 1, matchID)
+
+		queued.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+		queued.ExpectClosed(testsupport.DefaultDeadline)
+
+		// The game connection was admitted, so the match can start.
+		player2 := joinMatch(t, server, 2, matchID)
+		player1.start()
+		player2.start()
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyReject))
+
+		queued := testsupport.Dial(t, server.MatchmakingURL)
+		queued.Authenticate(testsupport.TestPublicID(1))
+
+		matchID := createMatch(t, server, 1, 2)
+		refused := joinMatch(t, server, 1, matchID)
+
+		refused.client.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+		refused.client.ExpectClosed(testsupport.DefaultDeadline)
+
+		// The matchmaking connection is still queued, so it can be matched.
+		other := testsupport.Dial(t, server.MatchmakingURL)
+		other.Authenticate(testsupport.TestPublicID(3))
+
+		queued.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+		other.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+	})
+}
+
+// TestWaitingThenQueue checks what happens when a user who is waiting alone in a match connects to the matchmaking
+// server - under the evict policy, they are removed from the match, which keeps waiting (and the server keeps running),
+// and under the reject policy, the matchmaking server refuses them.
+func TestWaitingThenQueue(t *testing.T) {
+	t.Run("Evict", func(t *testing.T) {
+		server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyEvict))
+
+		matchID := createMatch(t, server, 1, 2)
+		waiting := joinMatch(t, server, 1, matchID)
+
+		queued := testsupport.Dial(t, server.MatchmakingURL)
+		queued.Authenticate(testsupport.TestPublicID(1))
+
+		waiting.client.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+		waiting.client.ExpectClosed(testsupport.DefaultDeadline)
+
+		// The match has no result, and is still waiting - so the user can rejoin it (leaving the queue), and play it.
+		player1 := joinMatch(t, server, 1, matchID)
+		queued.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+
+		player2 := joinMatch(t, server, 2, matchID)
+		player1.start()
+		player2.start()
+
+		if calls := server.Store.Calls("SetMatchResult") + server.Store.Calls("SetMatchNoContest"); calls != 0 {
+			t.Fatalf("The store was sent %d results, expected none", calls)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyReject))
+
+		matchID := createMatch(t, server, 1, 2)
+		waiting := joinMatch(t, server, 1, matchID)
+
+		refused := testsupport.Dial(t, server.MatchmakingURL)
+		refused.Authenticate(testsupport.TestPublicID(1))
+
+		refused.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+		refused.ExpectClosed(testsupport.DefaultDeadline)
+
+		waiting.client.ExpectNone(protocol.WSCDuplicateConnection, duplicateLoginWait)
+	})
+}
+
+// TestPlayingThenQueue checks what happens when a user who is in a match that is in play connects to the matchmaking
+// server - under the evict policy, they forfeit the match, and their opponent is awarded the win, and under the reject
+// policy, the matchmaking server refuses them and the match can be played out.
+func TestPlayingThenQueue(t *testing.T) {
+	t.Run("Evict", func(t *testing.T) {
+		server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyEvict))
+
+		matchID := createMatch(t, server, 1, 2)
+		player1 := joinMatch(t, server, 1, matchID)
+		player2 := joinMatch(t, server, 2, matchID)
+
+		player1.start()
+		player2.start()
+
+		queued := testsupport.Dial(t, server.MatchmakingURL)
+		queued.Authenticate(testsupport.TestPublicID(1))
+
+		player1.client.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+		player2.client.Expect(protocol.WSCMatchForfeit, testsupport.DefaultDeadline)
+
+		waitFor(t, testsupport.DefaultDeadline, "the result to be written to the store", func() bool {
+			stats, _ := server.Store.GetPlayerStats(testUserDatabaseID(2))
+			return stats.Wins == 1
+		})
+
+		if stats, _ := server.Store.GetPlayerStats(testUserDatabaseID(1)); stats.Losses != 1 {
+			t.Fatalf("Evicted player's stats are %+v, expected a single loss", stats)
+		}
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyReject))
+
+		matchID := createMatch(t, server, 1, 2)
+		player1 := joinMatch(t, server, 1, matchID)
+		player2 := joinMatch(t, server, 2, matchID)
+
+		player1.start()
+		player2.start()
+
+		refused := testsupport.Dial(t, server.MatchmakingURL)
+		refused.Authenticate(testsupport.TestPublicID(1))
+
+		refused.Expect(protocol.WSCDuplicateConnection, testsupport.DefaultDeadline)
+
+		playMatch(t, player1, player2)
+	})
+}
+
+// TestRejectPolicyHandoff checks that under the reject policy, clients that connect to the game server as soon as their
+// match is confirmed - before their matchmaking connections have been closed - are admitted.
+func TestRejectPolicyHandoff(t *testing.T) {
+	server := testsupport.StartTestServerWithSessions(t, session.NewRegistryWithPolicy(session.PolicyReject))
+
+	client1 := testsupport.Dial(t, server.MatchmakingURL)
+	client1.Authenticate(testsupport.TestPublicID(1))
+
+	client2 := testsupport.Dial(t, server.MatchmakingURL)
+	client2.Authenticate(testsupport.TestPublicID(2))
+
+	clients := []*testsupport.TestClient{client1, client2}
+	for _, client := range clients {
+		client.Expect(protocol.WSCMatchMakingMatchFound, testsupport.DefaultDeadline)
+		client.Send(protocol.WSCMatchMakingAccept, "")
+	}
+
+	payload := client1.Expect(protocol.WSCMatchConfirmed, testsupport.DefaultDeadline)
+	matchID, err := strconv.ParseUint(payload.Message, 10, 64)
+	if err != nil {
+		t.Fatalf("Malformed match confirmation [%s]: %v", payload.Message, err)
+	}
+
+	player1 := joinMatch(t, server, 1, matchID)
+	player2 := joinMatch(t, server, 2, matchID)
+
+	player1.start()
+	player2.start()
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package testsupport provides helpers for testing the servers end to end, over real websocket connections - from the
+// routes, through the transactions, to the servers themselves.
+package testsupport
+
+import (
+	"sync"
+
+	"github.com/6a/blade-ii-game-server/internal/apiinterface"
+)
+
+// StatsUpdate is a match stats update that was recorded by a RecordingStatsUpdater.
+type StatsUpdate struct {
+	Client1ID  uint64
+	Client2ID  uint64
+	Client1MMR int
+	Client2MMR int
+	Winner     apiinterface.Winner
+}
+
+// RecordingStatsUpdater is a stats updater that records each update instead of sending it, so that tests can check the
+// results that were reported.
+type RecordingStatsUpdater struct {
+
+	// The updates that have been recorded, in the order in which they were received.
+	updates []StatsUpdate
+
+	// Mutex lock to protect the updates, as they are recorded from the goroutines that finalize each match.
+	lock sync.Mutex
+}
+
+// Ensure that RecordingStatsUpdater implements StatsUpdater.
+var _ apiinterface.StatsUpdater = (*RecordingStatsUpdater)(nil)
+
+// UpdateMatchStats records the specified update. Never fails.
+func (recorder *RecordingStatsUpdater) UpdateMatchStats(client1ID uint64, client2ID uint64, client1MMR int, client2MMR int, winner apiinterface.Winner) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.updates = append(recorder.updates, StatsUpdate{
+		Client1ID:  client1ID,
+		Client2ID:  client2ID,
+		Client1MMR: client1MMR,
+		Client2MMR: client2MMR,
+		Winner:     winner,
+	})
+
+	return nil
+}
+
+// Updates returns a copy of the updates that have been recorded so far. Updates are sent asynchronously once a match
+// has a result, so they may be recorded shortly after the clients are informed of it.
+func (recorder *RecordingStatsUpdater) Updates() []StatsUpdate {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return append([]StatsUpdate(nil), recorder.updates...)
+}
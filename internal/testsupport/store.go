@@ -0,0 +1,344 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package testsupport provides helpers for testing the servers end to end, over real websocket connections - from the
+// routes, through the transactions, to the servers themselves.
+package testsupport
+
+import (
+	"sync"
+	"time"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// Ensure that FakeStore implements Store.
+var _ database.Store = (*FakeStore)(nil)
+
+// FakeStore is an in-memory store with programmable responses, for tests. It behaves like a test store (see
+// teststore.Store) - accepting the test users, and keeping matches in memory - except that any of its methods can
+// be made to fail (see FailWith) or wait (see Block), the MMR and profile of each user can be set (see SetMMR and
+// SetProfile), and the number of calls to each method is counted (see Calls). Safe for concurrent use.
+type FakeStore struct {
+	*teststore.Store
+
+	// The errors that each method fails with, keyed by method name.
+	errors map[string]error
+
+	// The number of times that each method has been called, keyed by method name.
+	calls map[string]int
+
+	// The channels that calls to each blocked method wait on, keyed by method name (see Block).
+	blocks map[string]chan struct{}
+
+	// The MMR and profile of each user that has one set, keyed by database ID.
+	mmrs     map[uint64]int
+	profiles map[uint64]database.ClientProfile
+
+	// Mutex lock to protect the errors, the call counts, the blocks, the MMRs and the profiles.
+	lock sync.Mutex
+}
+
+// NewFakeStore creates and returns a pointer to a new, empty fake store, that doesn't fail.
+func NewFakeStore() *FakeStore {
+	return &FakeStore{
+		Store:    teststore.NewStore(),
+		errors:   make(map[string]error),
+		calls:    make(map[string]int),
+		blocks:   make(map[string]chan struct{}),
+		mmrs:     make(map[uint64]int),
+		profiles: make(map[uint64]database.ClientProfile),
+	}
+}
+
+// FailWith makes every subsequent call to the store method with the specified name (such as "CreateMatch") fail with
+// the specified error, without doing anything else. A nil error stops the method from failing.
+func (store *FakeStore) FailWith(method string, err error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err == nil {
+		delete(store.errors, method)
+	} else {
+		store.errors[method] = err
+	}
+}
+
+// Block makes every subsequent call to the store method with the specified name wait until the returned function is
+// called, which releases the waiting calls, and stops the method from blocking. The returned function must be called
+// exactly once.
+func (store *FakeStore) Block(method string) (release func()) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	block := make(chan struct{})
+	store.blocks[method] = block
+
+	return func() {
+		store.lock.Lock()
+		defer store.lock.Unlock()
+
+		delete(store.blocks, method)
+		close(block)
+	}
+}
+
+// Calls returns the number of times that the store method with the specified name has been called, including calls
+// that failed.
+func (store *FakeStore) Calls(method string) int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.calls[method]
+}
+
+// SetMMR sets the MMR of the user with the specified database ID, in place of the test store's default.
+func (store *FakeStore) SetMMR(databaseID uint64, mmr int) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.mmrs[databaseID] = mmr
+}
+
+// SetProfile sets the display name and avatar of the user with the specified database ID, in place of the test
+// store's defaults.
+func (store *FakeStore) SetProfile(databaseID uint64, displayname string, avatar uint8) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.profiles[databaseID] = database.ClientProfile{DisplayName: displayname, Avatar: avatar}
+}
+
+// call counts a call to the store method with the specified name, waits for the method to be released if it is
+// blocked, and returns the error that it should fail with, if any.
+func (store *FakeStore) call(method string) error {
+	store.lock.Lock()
+	store.calls[method]++
+	block := store.blocks[method]
+	store.lock.Unlock()
+
+	// Wait outside of the lock, so that the store can still be used (and the method released) in the meantime.
+	if block != nil {
+		<-block
+	}
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	return store.errors[method]
+}
+
+// mmr returns the MMR that was set for the specified user, if any.
+func (store *FakeStore) mmr(databaseID uint64) (mmr int, ok bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	mmr, ok = store.mmrs[databaseID]
+	return mmr, ok
+}
+
+// profile returns the profile that was set for the specified user, if any.
+func (store *FakeStore) profile(databaseID uint64) (profile database.ClientProfile, ok bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	profile, ok = store.profiles[databaseID]
+	return profile, ok
+}
+
+// ValidateAuth validates the specified credentials with the test store (see teststore.Store.ValidateAuth).
+func (store *FakeStore) ValidateAuth(publicID string, authToken string) (databaseID uint64, err error) {
+	if err := store.call("ValidateAuth"); err != nil {
+		return databaseID, err
+	}
+
+	return store.Store.ValidateAuth(publicID, authToken)
+}
+
+// GetBannedAmong returns the database IDs of the users that are banned, out of the specified database IDs.
+func (store *FakeStore) GetBannedAmong(databaseIDs []uint64) (banned []uint64, err error) {
+	if err := store.call("GetBannedAmong"); err != nil {
+		return banned, err
+	}
+
+	return store.Store.GetBannedAmong(databaseIDs)
+}
+
+// GetMMR returns the MMR that was set for the specified user (see SetMMR), or the test store's default.
+func (store *FakeStore) GetMMR(databaseID uint64) (MMR int, err error) {
+	if err := store.call("GetMMR"); err != nil {
+		return MMR, err
+	}
+
+	if mmr, ok := store.mmr(databaseID); ok {
+		return mmr, nil
+	}
+
+	return store.Store.GetMMR(databaseID)
+}
+
+// CreateMatch creates a match with the two players specified, and returns the match id.
+func (store *FakeStore) CreateMatch(player1 database.MatchPlayer, player2 database.MatchPlayer, turnTime time.Duration) (matchID uint64, err error) {
+	if err := store.call("CreateMatch"); err != nil {
+		return matchID, err
+	}
+
+	return store.Store.CreateMatch(player1, player2, turnTime)
+}
+
+// ValidateMatch returns true if the specified match exists and has not yet started, and the specified client is part
+// of it, along with the turn time for the match, and the client as they were when the match was created. Clients that
+// were created without a display name are given the profile and MMR that were set for them (see SetProfile and
+// SetMMR), if any, as the database falls back to their current values.
+func (store *FakeStore) ValidateMatch(databaseID uint64, matchID uint64) (valid bool, turnTime time.Duration, player database.MatchPlayer, err error) {
+	if err := store.call("ValidateMatch"); err != nil {
+		return false, turnTime, player, err
+	}
+
+	valid, turnTime, player, err = store.Store.ValidateMatch(databaseID, matchID)
+	if err != nil {
+		return valid, turnTime, player, err
+	}
+
+	// Only the test store's defaults are replaced - values that were stored with the match are kept.
+	defaults, _ := store.Store.GetClientsNameAndAvatar([]uint64{databaseID})
+	if player.DisplayName == defaults[databaseID].DisplayName {
+		if profile, ok := store.profile(databaseID); ok {
+			player.DisplayName, player.Avatar = profile.DisplayName, profile.Avatar
+		}
+
+		if mmr, ok := store.mmr(databaseID); ok {
+			player.MMR = mmr
+		}
+	}
+
+	return valid, turnTime, player, nil
+}
+
+// GetClientNameAndAvatar returns the profile that was set for the specified user (see SetProfile), or the test store's
+// default.
+func (store *FakeStore) GetClientNameAndAvatar(databaseID uint64) (displayname string, avatar uint8, err error) {
+	if err := store.call("GetClientNameAndAvatar"); err != nil {
+		return displayname, avatar, err
+	}
+
+	if profile, ok := store.profile(databaseID); ok {
+		return profile.DisplayName, profile.Avatar, nil
+	}
+
+	return store.Store.GetClientNameAndAvatar(databaseID)
+}
+
+// GetClientsNameAndAvatar returns the profile that was set for each of the specified users (see SetProfile), or the
+// test store's default.
+func (store *FakeStore) GetClientsNameAndAvatar(databaseIDs []uint64) (profiles map[uint64]database.ClientProfile, err error) {
+	if err := store.call("GetClientsNameAndAvatar"); err != nil {
+		return profiles, err
+	}
+
+	profiles, err = store.Store.GetClientsNameAndAvatar(databaseIDs)
+	if err != nil {
+		return profiles, err
+	}
+
+	for _, databaseID := range databaseIDs {
+		if profile, ok := store.profile(databaseID); ok {
+			profiles[databaseID] = profile
+		}
+	}
+
+	return profiles, nil
+}
+
+// SetMatchStart sets the specified match to be in play.
+func (store *FakeStore) SetMatchStart(matchID uint64) (err error) {
+	if err := store.call("SetMatchStart"); err != nil {
+		return err
+	}
+
+	return store.Store.SetMatchStart(matchID)
+}
+
+// SetMatchResult records the winner for the specified match.
+func (store *FakeStore) SetMatchResult(matchID uint64, winnerDatabaseID uint64) (err error) {
+	if err := store.call("SetMatchResult"); err != nil {
+		return err
+	}
+
+	return store.Store.SetMatchResult(matchID, winnerDatabaseID)
+}
+
+// SetMatchDraw records the specified match as a draw.
+func (store *FakeStore) SetMatchDraw(matchID uint64) (err error) {
+	if err := store.call("SetMatchDraw"); err != nil {
+		return err
+	}
+
+	return store.Store.SetMatchDraw(matchID)
+}
+
+// SetMatchNoContest records the specified match as no contest.
+func (store *FakeStore) SetMatchNoContest(matchID uint64) (err error) {
+	if err := store.call("SetMatchNoContest"); err != nil {
+		return err
+	}
+
+	return store.Store.SetMatchNoContest(matchID)
+}
+
+// SetMatchAborted records the specified match as aborted.
+func (store *FakeStore) SetMatchAborted(matchID uint64) (err error) {
+	if err := store.call("SetMatchAborted"); err != nil {
+		return err
+	}
+
+	return store.Store.SetMatchAborted(matchID)
+}
+
+// RecordMatchAudit is a noop, as the fake store does not keep an audit trail - but calls are counted.
+func (store *FakeStore) RecordMatchAudit(matchID uint64, player1DatabaseID uint64, player2DatabaseID uint64, winnerDatabaseID uint64, reason uint16, duration time.Duration, moves int) (err error) {
+	if err := store.call("RecordMatchAudit"); err != nil {
+		return err
+	}
+
+	return store.Store.RecordMatchAudit(matchID, player1DatabaseID, player2DatabaseID, winnerDatabaseID, reason, duration, moves)
+}
+
+// GetRecentMatches returns up to (limit) of the most recently finished matches for the specified user, most recent first.
+func (store *FakeStore) GetRecentMatches(databaseID uint64, limit int) (matches []database.RecentMatch, err error) {
+	if err := store.call("GetRecentMatches"); err != nil {
+		return matches, err
+	}
+
+	return store.Store.GetRecentMatches(databaseID, limit)
+}
+
+// GetRecentOpponents returns the opponents from up to (limit) of the most recently finished matches for the specified
+// user, most recent first.
+func (store *FakeStore) GetRecentOpponents(databaseID uint64, limit int) (opponents []database.RecentOpponent, err error) {
+	if err := store.call("GetRecentOpponents"); err != nil {
+		return opponents, err
+	}
+
+	return store.Store.GetRecentOpponents(databaseID, limit)
+}
+
+// GetPlayerStats returns the number of wins, losses and draws for the specified user, along with their MMR.
+func (store *FakeStore) GetPlayerStats(databaseID uint64) (stats database.PlayerStats, err error) {
+	if err := store.call("GetPlayerStats"); err != nil {
+		return stats, err
+	}
+
+	return store.Store.GetPlayerStats(databaseID)
+}
+
+// GetMMRHidden returns true if the specified user has hidden their MMR (see teststore.Store.SetMMRHidden).
+func (store *FakeStore) GetMMRHidden(databaseID uint64) (hidden bool, err error) {
+	if err := store.call("GetMMRHidden"); err != nil {
+		return hidden, err
+	}
+
+	return store.Store.GetMMRHidden(databaseID)
+}
@@ -8,6 +8,7 @@ package transactions
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 
 	"github.com/6a/blade-ii-game-server/internal/database"
@@ -21,40 +22,103 @@ const (
 
 	// expectedAuthArraySize is the expected size of the array output of splitting the auth message payload.
 	expectedAuthArraySize = 2
+
+	// versionedAuthArraySize is the expected size of the array output of splitting the auth message payload, when
+	// the client has specified a protocol version.
+	versionedAuthArraySize = 3
 )
 
-// checkAuth attempts to extract the credentials from a payload, returning the database and public ID for the
-// user for which the credentials matched. If there was an error, an errorcode is returned as well as an error.
-func checkAuth(payload protocol.Payload) (databaseID uint64, publicID string, b2ErrorCode protocol.B2Code, err error) {
+// checkAuth attempts to extract the credentials from a payload, and validates them against the specified store, returning the database and public ID for the
+// user for which the credentials matched, and the protocol version to use for the connection. If there was an
+// error, an errorcode is returned as well as an error.
+//
+// Format: <public ID><delim><auth token>[<delim><protocol version>]
+//
+// A version in the message is the highest version that the client supports - a newer version than the server's is
+// negotiated down, and an older version than the server supports is rejected with WSCProtocolVersionUnsupported.
+//
+// The protocol version may also be specified with the version field of the payload, in which case it is the version
+// that the client speaks, and it must be within the supported range (see protocol.IsSupportedVersion) - otherwise the
+// client is rejected with WSCProtocolVersionMismatch. If it is specified in both places, the values must match. If the
+// protocol version is omitted, the legacy protocol version is assumed.
+func checkAuth(store database.Store, payload protocol.Payload) (databaseID uint64, publicID string, protocolVersion uint16, b2ErrorCode protocol.B2Code, err error) {
 
 	// If the payload code was not that of an auth request, return immedaitely with an error.
 	if payload.Code != protocol.WSCAuthRequest {
-		return databaseID, publicID, protocol.WSCAuthExpected, errors.New("Auth expected but received something else")
+		return databaseID, publicID, protocolVersion, protocol.WSCAuthExpected, errors.New("Auth expected but received something else")
 	}
 
-	// Attempt to split the payload string into an array containing a public ID and an auth token.
+	// Attempt to split the payload string into an array containing a public ID, an auth token, and optionally a
+	// protocol version.
 	auth := strings.Split(payload.Message, authDelimiter)
 
 	// If the output array is not the right size, return immedaitely with an error.
-	if len(auth) != expectedAuthArraySize {
-		return databaseID, publicID, protocol.WSCAuthBadFormat, errors.New("Auth bad format")
+	if len(auth) != expectedAuthArraySize && len(auth) != versionedAuthArraySize {
+		return databaseID, publicID, protocolVersion, protocol.WSCAuthBadFormat, errors.New("Auth bad format")
 	}
 
 	// Create some local variables for each auth component for clarity.
 	publicID, authToken := auth[0], auth[1]
 
+	// Determine the version requested by the client, assuming the legacy version if it was not specified.
+	clientVersion := protocol.LegacyVersion
+	if len(auth) == versionedAuthArraySize {
+		parsedVersion, err := strconv.ParseUint(auth[2], 10, 16)
+		if err != nil {
+			return databaseID, publicID, protocolVersion, protocol.WSCAuthBadFormat, errors.New("Auth bad format")
+		}
+
+		clientVersion = uint16(parsedVersion)
+	}
+
+	// If the payload also contains a version, use it - but if the message contained a different version, the client
+	// is in an inconsistent state, and if the version is outside of the supported range, the client is incompatible -
+	// in either case, return immediately with an error.
+	if payload.Version != 0 {
+		if len(auth) == versionedAuthArraySize && payload.Version != clientVersion {
+			return databaseID, publicID, protocolVersion, protocol.WSCProtocolVersionMismatch, errors.New("Protocol version mismatch")
+		}
+
+		if !protocol.IsSupportedVersion(payload.Version) {
+			return databaseID, publicID, protocolVersion, protocol.WSCProtocolVersionMismatch, errors.New("Protocol version mismatch")
+		}
+
+		clientVersion = payload.Version
+	}
+
+	// Determine the highest protocol version supported by both the client and the server, returning immediately
+	// with an error if there isn't one.
+	protocolVersion, ok := protocol.NegotiateVersion(clientVersion)
+	if !ok {
+		return databaseID, publicID, protocolVersion, protocol.WSCProtocolVersionUnsupported, errors.New("Protocol version unsupported")
+	}
+
 	// Attempt to validate the credentials.
-	databaseID, err = database.ValidateAuth(publicID, authToken)
+	databaseID, err = store.ValidateAuth(publicID, authToken)
 
 	// If there was a database error, return immedaitely with an error, as it means that either there
 	// was a problem accessing the database, or the credentials were invalid, or the account was banned
-	// etc..
+	// etc.. The error code tells the client which of these it was.
 	if err != nil {
-		// TODO filter by result (banned etc)
-		return databaseID, publicID, protocol.WSCAuthBadCredentials, err
+		return databaseID, publicID, protocolVersion, authErrorCode(err), err
+	}
+
+	// By reaching this point, auth should be confirmed as valid, so return the database ID, the public
+	// ID, and the protocol version, with no error code or error.
+	return databaseID, publicID, protocolVersion, 0, nil
+}
+
+// authErrorCode returns the B2Code that describes the specified error from validating a client's credentials.
+func authErrorCode(err error) protocol.B2Code {
+	switch err {
+	case database.ErrUserBanned:
+		return protocol.WSCAuthBanned
+	case database.ErrTokenExpired:
+		return protocol.WSCAuthExpired
+	case database.ErrDatabase:
+		return protocol.WSCServerError
 	}
 
-	// By reaching this point, auth should be confirmed as valid, so return the database ID and the public
-	// ID, with no error code or error.
-	return databaseID, publicID, 0, nil
+	// Unknown users and invalid tokens (as well as any unexpected errors) are treated as bad credentials.
+	return protocol.WSCAuthBadCredentials
 }
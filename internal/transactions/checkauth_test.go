@@ -0,0 +1,78 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package transactions
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/6a/blade-ii-game-server/internal/teststore"
+)
+
+// TestCheckAuthVersion checks the protocol version that is negotiated from an auth request, whether the client
+// specifies it in the message, in the payload, in both, or not at all.
+func TestCheckAuthVersion(t *testing.T) {
+	credentials := teststore.PublicIDPrefix + "1" + authDelimiter + "token"
+	current := strconv.Itoa(int(protocol.CurrentVersion))
+	newer := strconv.Itoa(int(protocol.CurrentVersion + 1))
+
+	tests := []struct {
+		name     string
+		payload  protocol.Payload
+		expected uint16
+		code     protocol.B2Code
+	}{
+		{"Legacy client", protocol.Payload{Message: credentials}, protocol.LegacyVersion, 0},
+		{"Version in the message", protocol.Payload{Message: credentials + authDelimiter + current}, protocol.CurrentVersion, 0},
+		{"Version in the payload", protocol.Payload{Message: credentials, Version: protocol.CurrentVersion}, protocol.CurrentVersion, 0},
+		{"Version in both", protocol.Payload{Message: credentials + authDelimiter + current, Version: protocol.CurrentVersion}, protocol.CurrentVersion, 0},
+		{"Older version", protocol.Payload{Message: credentials + authDelimiter + "2"}, 2, 0},
+		{"Too new version", protocol.Payload{Message: credentials + authDelimiter + newer}, protocol.CurrentVersion, 0},
+		{"Unsupported version", protocol.Payload{Message: credentials + authDelimiter + "0"}, 0, protocol.WSCProtocolVersionUnsupported},
+		{"Too new version in the payload", protocol.Payload{Message: credentials, Version: protocol.CurrentVersion + 1}, 0, protocol.WSCProtocolVersionMismatch},
+		{"Too new version in both", protocol.Payload{Message: credentials + authDelimiter + newer, Version: protocol.CurrentVersion + 1}, 0, protocol.WSCProtocolVersionMismatch},
+		{"Mismatched versions", protocol.Payload{Message: credentials + authDelimiter + "2", Version: protocol.CurrentVersion}, 0, protocol.WSCProtocolVersionMismatch},
+		{"Malformed version", protocol.Payload{Message: credentials + authDelimiter + "v2"}, 0, protocol.WSCAuthBadFormat},
+		{"Too many fields", protocol.Payload{Message: credentials + authDelimiter + current + authDelimiter}, 0, protocol.WSCAuthBadFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.payload.Code = protocol.WSCAuthRequest
+
+			databaseID, _, version, code, err := checkAuth(teststore.NewStore(), test.payload)
+			if code != test.code {
+				t.Fatalf("Auth failed with code [%d] (%v), expected [%d]", code, err, test.code)
+			}
+
+			if test.code == 0 && (version != test.expected || databaseID != 2) {
+				t.Fatalf("Auth succeeded with version [%d] for user [%d], expected version [%d] for user [2]", version, databaseID, test.expected)
+			}
+		})
+	}
+}
+
+// TestCheckAuthErrors checks the error code for auth requests that fail, other than because of the protocol version.
+func TestCheckAuthErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  protocol.Payload
+		expected protocol.B2Code
+	}{
+		{"Not an auth request", protocol.Payload{Code: protocol.WSCMatchMove, Message: "1"}, protocol.WSCAuthExpected},
+		{"Missing token", protocol.Payload{Code: protocol.WSCAuthRequest, Message: teststore.PublicIDPrefix + "1"}, protocol.WSCAuthBadFormat},
+		{"Unknown user", protocol.Payload{Code: protocol.WSCAuthRequest, Message: "nobody" + authDelimiter + "token"}, protocol.WSCAuthBadCredentials},
+		{"Empty token", protocol.Payload{Code: protocol.WSCAuthRequest, Message: teststore.PublicIDPrefix + "1" + authDelimiter}, protocol.WSCAuthBadCredentials},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, _, code, err := checkAuth(teststore.NewStore(), test.payload); code != test.expected || err == nil {
+				t.Fatalf("Auth failed with code [%d] (%v), expected [%d]", code, err, test.expected)
+			}
+		})
+	}
+}
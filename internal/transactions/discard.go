@@ -7,25 +7,19 @@
 package transactions
 
 import (
-	"time"
-
+	"github.com/6a/blade-ii-game-server/internal/connection"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 	"github.com/gorilla/websocket"
 )
 
-// closeWaitPeriod is the amount of time to wait after sending a close message, before closing a websocket.
-const closeWaitPeriod = time.Second * 1
-
-// Discard sends the specified message down the websocket, and then closes it after blocking for a small
-// period of time.
+// Discard sends the specified message down the websocket, and then closes it with a close handshake, blocking
+// for a small period of time.
 func Discard(wsconn *websocket.Conn, message protocol.Message) {
 
 	// Write the message to the websocket. Errors are ignored.
-	wsconn.WriteMessage(protocol.WSMTText, message.GetPayloadBytes())
-
-	// Sleep for a short time to allow the message to be sent.
-	time.Sleep(closeWaitPeriod)
+	connection.WriteText(wsconn, message)
 
-	// Close the websocket.
-	wsconn.Close()
+	// Close the websocket. The close frame echo cannot be observed here, as the websocket may be being read by
+	// another goroutine.
+	connection.CloseWebsocket(wsconn, message, nil)
 }
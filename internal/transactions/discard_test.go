@@ -0,0 +1,62 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package transactions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// TestDiscard checks that a discarded client is sent the message, and then a close frame with the close code mapped
+// from the message, and the message text as the reason.
+func TestDiscard(t *testing.T) {
+	message := protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthBadCredentials, "Invalid credentials")
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsconn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade the connection: %v", err)
+			return
+		}
+
+		Discard(wsconn, message)
+	}))
+	defer server.Close()
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial the test server: %v", err)
+	}
+	defer peer.Close()
+
+	peer.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	_, data, err := peer.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read the message: %v", err)
+	}
+
+	if payload := protocol.NewPayloadFromBytes(data); payload.Code != message.Payload.Code || payload.Message != message.Payload.Message {
+		t.Fatalf("Received [%d: %s], expected [%d: %s]", payload.Code, payload.Message, message.Payload.Code, message.Payload.Message)
+	}
+
+	_, _, err = peer.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		t.Fatalf("Connection failed without a close frame: %v", err)
+	}
+
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != message.Payload.Message {
+		t.Fatalf("Close frame has code [%d] and reason [%s], expected [%d] and [%s]", closeErr.Code, closeErr.Text, websocket.ClosePolicyViolation, message.Payload.Message)
+	}
+}
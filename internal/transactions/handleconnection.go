@@ -8,6 +8,7 @@ package transactions
 
 import (
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/6a/blade-ii-game-server/internal/game"
@@ -28,7 +29,10 @@ const connectionTimeOut = time.Second * 10
 //
 // If it does not receive an auth message and match ID within the timeout period, it drops the
 // connection.
-func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server) {
+func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server, store database.Store) {
+
+	// Discard the connection cleanly if anything below panics.
+	defer recoverConnectionPanic(wsconn)
 
 	// Set up an async wait queue, to wait for (2) messages from the websocket
 	inChannel := waitForMessageAsync(wsconn, 2)
@@ -36,6 +40,8 @@ func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server) {
 	// Declare some values that set and/or read during various stages of the connection handler.
 	var databaseID uint64
 	var publicID string
+	var protocolVersion uint16
+	var encoding protocol.Encoding
 	var b2ErrorCode protocol.B2Code
 	var err error
 	var authReceived bool = false
@@ -57,14 +63,22 @@ func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server) {
 
 				// Validate the credentials in the payload. Errors lead to this function exiting immediately after
 				// discarding the websocket connection.
-				databaseID, publicID, b2ErrorCode, err = checkAuth(res.Payload)
+				databaseID, publicID, protocolVersion, b2ErrorCode, err = checkAuth(store, res.Payload)
 				if err != nil {
 					Discard(wsconn, protocol.NewMessage(protocol.WSMTText, b2ErrorCode, err.Error()))
 					return
 				}
 
-				// If we reach here, authentication was successfull, and we inform the client accordingly.
-				sendMessage(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthSuccess, ""))
+				// Determine the message encoding requested by the client, for use after the handshake.
+				encoding = res.Payload.Encoding
+				if !encoding.IsValid() {
+					Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthBadFormat, "Unsupported encoding"))
+					return
+				}
+
+				// If we reach here, authentication was successfull, and we inform the client accordingly, along with the
+				// protocol version that will be used for the connection.
+				sendMessage(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthSuccess, strconv.Itoa(int(protocolVersion))))
 
 				// Also set the auth received flag so that the next message from the client is handled as match
 				// data.
@@ -76,7 +90,7 @@ func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server) {
 
 				// Validate the match data. Errors lead to this function exiting immediately after
 				// discarding the websocket connection.
-				matchID, b2code, err := validateMatch(databaseID, res.Payload)
+				matchID, turnTime, player, b2code, err := validateMatch(store, databaseID, res.Payload)
 				if err != nil {
 					Discard(wsconn, protocol.NewMessage(protocol.WSMTText, b2code, err.Error()))
 					return
@@ -85,15 +99,16 @@ func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server) {
 				// If we reach here, the match data was confirmed as valid, and we inform the client accordingly.
 				sendMessage(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCMatchIDConfirmed, ""))
 
-				// Grab the clients display name and avatar as well - if this errors, log it and use a placeholder.
-				displayname, avatar, err := database.GetClientNameAndAvatar(databaseID)
-				if err != nil {
-					log.Printf("Error getting displayname for user [ %d ]: %s", databaseID, err.Error())
+				// The clients display name, avatar and MMR were stored with the match when it was created, so they don't
+				// need to be fetched again here. The display name and avatar are fetched again when the match starts, so
+				// a placeholder is only shown if that fails (or for the debug match).
+				displayname := player.DisplayName
+				if displayname == "" {
 					displayname = "<unknown>"
 				}
 
 				// Pass the websocket connection to the game server to package and add.
-				gs.AddClient(wsconn, databaseID, publicID, displayname, avatar, matchID)
+				gs.AddClient(wsconn, databaseID, publicID, displayname, player.Avatar, player.MMR, matchID, turnTime, protocolVersion, encoding)
 				return
 			}
 		case <-time.After(connectionTimeOut):
@@ -116,7 +131,10 @@ func HandleGSConnection(wsconn *websocket.Conn, gs *game.Server) {
 //
 // If it does not receive an auth message within the timeout period, it drops the
 // connection.
-func HandleMMConnection(wsconn *websocket.Conn, mm *matchmaking.Server) {
+func HandleMMConnection(wsconn *websocket.Conn, mm *matchmaking.Server, store database.Store) {
+
+	// Discard the connection cleanly if anything below panics.
+	defer recoverConnectionPanic(wsconn)
 
 	// Set up an async wait queue, to check for 1 message from the websocket.
 	authChannel := waitForMessageAsync(wsconn, 1)
@@ -128,22 +146,44 @@ func HandleMMConnection(wsconn *websocket.Conn, mm *matchmaking.Server) {
 
 		// Validate the credentials in the payload. Errors lead to this function exiting immediately after
 		// discarding the websocket connection.
-		databaseID, publicID, b2ErrorCode, err := checkAuth(res.Payload)
+		databaseID, publicID, protocolVersion, b2ErrorCode, err := checkAuth(store, res.Payload)
 		if err != nil {
 			Discard(wsconn, protocol.NewMessage(protocol.WSMTText, b2ErrorCode, err.Error()))
 			return
 		}
 
+		// Determine the message encoding requested by the client, for use after the handshake.
+		encoding := res.Payload.Encoding
+		if !encoding.IsValid() {
+			Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthBadFormat, "Unsupported encoding"))
+			return
+		}
+
+		// Inform the client that authentication was successful, along with the protocol version that will be used
+		// for the connection.
+		sendMessage(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCAuthSuccess, strconv.Itoa(int(protocolVersion))))
+
 		// Get the MMR for the authenticated player. Errors cause this function to exit immediately after
-		// discarding the websocket connection.
-		mmr, err := database.GetMMR(databaseID)
+		// discarding the websocket connection. The user was just authenticated, so any error is a server error - the
+		// details are logged, and the client is sent a generic message.
+		mmr, err := store.GetMMR(databaseID)
 		if err != nil {
-			Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCUnknownConnectionError, err.Error()))
+			log.Printf("Error getting MMR for user [ %d ]: %s", databaseID, err.Error())
+			Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCServerError, database.ErrDatabase.Error()))
 			return
 		}
 
-		// Pass the websocket connection to the matchmaking server to package and add.
-		mm.AddClient(wsconn, databaseID, publicID, mmr)
+		// Grab the clients display name and avatar, so that they can be shown to their opponent when a match is found - if
+		// this errors, log it and leave the display name empty, so that their opponent is sent a match found message
+		// without a preview.
+		displayname, avatar, err := store.GetClientNameAndAvatar(databaseID)
+		if err != nil {
+			log.Printf("Error getting displayname for user [ %d ]: %s", databaseID, err.Error())
+			displayname, avatar = "", 0
+		}
+
+		// Pass the websocket connection to the matchmaking server to package and add, along with the client's region hint (if any).
+		mm.AddClient(wsconn, databaseID, publicID, displayname, avatar, mmr, res.Payload.Region, protocolVersion, encoding)
 	case <-time.After(connectionTimeOut):
 
 		// If the connection timed out, discard the connection with an appropriate message.
@@ -0,0 +1,83 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package transactions implements handlers for various interactions with raw websocket connections,
+// before they are packaged and added to the server.
+package transactions
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/6a/blade-ii-game-server/internal/database"
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+)
+
+// statsPublicIDParameter is the name of the optional query parameter that specifies whose stats are requested.
+const statsPublicIDParameter = "id"
+
+// HandleStatsRequest responds to a http request for the stats of the authenticated player, as JSON. The credentials are
+// read from a 'Basic' authorization header, with the public ID as the username and the auth token as the password.
+// Players can only request their own stats - if a public ID is specified, it must be the caller's.
+func HandleStatsRequest(w http.ResponseWriter, r *http.Request, store database.Store) {
+
+	// Only GET requests are supported.
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Read the credentials from the authorization header.
+	publicID, authToken, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Basic")
+		http.Error(w, "Auth expected", http.StatusUnauthorized)
+		return
+	}
+
+	// Validate the credentials, in the same way as for websocket connections.
+	payload := protocol.Payload{
+		Code:    protocol.WSCAuthRequest,
+		Message: publicID + authDelimiter + authToken,
+	}
+
+	databaseID, publicID, _, b2ErrorCode, err := checkAuth(store, payload)
+	if err != nil {
+		http.Error(w, err.Error(), authErrorStatus(b2ErrorCode))
+		return
+	}
+
+	// Reject requests for anyone else's stats.
+	if requested := r.URL.Query().Get(statsPublicIDParameter); requested != "" && requested != publicID {
+		http.Error(w, "Players can only view their own stats", http.StatusForbidden)
+		return
+	}
+
+	// Fetch the stats for the player.
+	stats, err := store.GetPlayerStats(databaseID)
+	if err != nil {
+		log.Printf("Error getting stats for user [ %d ]: %s", databaseID, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Write the stats as JSON.
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// authErrorStatus returns the http status code that best describes the specified auth error code.
+func authErrorStatus(code protocol.B2Code) int {
+	switch code {
+	case protocol.WSCServerError:
+		return http.StatusInternalServerError
+	case protocol.WSCAuthBanned:
+		return http.StatusForbidden
+	case protocol.WSCAuthBadFormat, protocol.WSCProtocolVersionMismatch, protocol.WSCProtocolVersionUnsupported:
+		return http.StatusBadRequest
+	}
+
+	return http.StatusUnauthorized
+}
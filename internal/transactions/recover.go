@@ -0,0 +1,26 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package transactions implements handlers for various interactions with raw websocket connections,
+// before they are packaged and added to the server.
+package transactions
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/6a/blade-ii-game-server/internal/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// recoverConnectionPanic recovers from a panic in a connection handler, logging it along with the stack trace, and
+// discarding the connection with a server error - so that a bug in the handler affects only the connection being
+// handled. Must be called directly by a deferred statement, as recover has no effect otherwise.
+func recoverConnectionPanic(wsconn *websocket.Conn) {
+	if r := recover(); r != nil {
+		log.Printf("Recovered from a panic while handling a connection: %v\n%s", r, debug.Stack())
+
+		Discard(wsconn, protocol.NewMessage(protocol.WSMTText, protocol.WSCServerError, "Internal server error"))
+	}
+}
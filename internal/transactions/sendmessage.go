@@ -7,6 +7,7 @@
 package transactions
 
 import (
+	"github.com/6a/blade-ii-game-server/internal/connection"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 	"github.com/gorilla/websocket"
 )
@@ -15,5 +16,5 @@ import (
 func sendMessage(wsconn *websocket.Conn, message protocol.Message) {
 
 	// Write the message, ignoring any errors.
-	wsconn.WriteMessage(protocol.WSMTText, message.GetPayloadBytes())
+	connection.WriteText(wsconn, message)
 }
@@ -9,25 +9,27 @@ package transactions
 import (
 	"errors"
 	"strconv"
+	"time"
 
 	"github.com/6a/blade-ii-game-server/internal/database"
 	"github.com/6a/blade-ii-game-server/internal/protocol"
 )
 
-// validateMatch checks if the match details contained in the payload, represent a match that is valid, and that
-// the user with the specified database ID is a participant in the match. Returns an error if invalid, or if
-// there was a database error.
-func validateMatch(databaseID uint64, payload protocol.Payload) (matchID uint64, wscode protocol.B2Code, err error) {
+// validateMatch checks (using the specified store) if the match details contained in the payload, represent a match that is valid, and that
+// the user with the specified database ID is a participant in the match, returning the match ID, the turn time
+// for the match, and the user's display name, avatar and MMR from when the match was created. Returns an error if
+// invalid, or if there was a database error.
+func validateMatch(store database.Store, databaseID uint64, payload protocol.Payload) (matchID uint64, turnTime time.Duration, player database.MatchPlayer, wscode protocol.B2Code, err error) {
 
 	// Return an error immediately if the payload code was not the correct type.
 	if payload.Code != protocol.WSCMatchID {
-		return matchID, protocol.WSCMatchIDExpected, errors.New("Match ID expected but received something else")
+		return matchID, turnTime, player, protocol.WSCMatchIDExpected, errors.New("Match ID expected but received something else")
 	}
 
 	// Attempt to parse the payload message into a uint64. Return an error if the parsing failed.
 	matchID, err = strconv.ParseUint(payload.Message, 10, 64)
 	if err != nil {
-		return matchID, protocol.WSCMatchIDBadFormat, errors.New("Match ID format invalid or missing")
+		return matchID, turnTime, player, protocol.WSCMatchIDBadFormat, errors.New("Match ID format invalid or missing")
 	}
 
 	// Expiry check here
@@ -36,13 +38,15 @@ func validateMatch(databaseID uint64, payload protocol.Payload) (matchID uint64,
 	// Check if the specified match exists, and the user with the specified database ID is part of it.
 	// An error being returned indicates that the query failed or there was a database error. If valid
 	// is false, then the match details were invalid.
-	valid, err := database.ValidateMatch(databaseID, matchID)
-	if err != nil {
-		return matchID, protocol.WSCMatchInvalid, err
+	valid, turnTime, player, err := store.ValidateMatch(databaseID, matchID)
+	if err == database.ErrDatabase {
+		return matchID, turnTime, player, protocol.WSCServerError, err
+	} else if err != nil {
+		return matchID, turnTime, player, protocol.WSCMatchInvalid, err
 	} else if !valid {
-		return matchID, protocol.WSCMatchInvalid, errors.New("Could not find a valid match with the specified details")
+		return matchID, turnTime, player, protocol.WSCMatchInvalid, errors.New("Could not find a valid match with the specified details")
 	}
 
 	// Reaching this point means the match is valid.
-	return matchID, wscode, err
+	return matchID, turnTime, player, wscode, err
 }
@@ -0,0 +1,47 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package capacity implements a gauge for tracking resource usage against a limit, that can be safely shared between
+// goroutines.
+package capacity
+
+import "sync/atomic"
+
+// Gauge tracks the current usage of some resource, along with its limit. A limit of zero (or less) means that
+// the resource is unlimited.
+type Gauge struct {
+
+	// The current usage - accessed atomically.
+	current int64
+
+	// The limit - set on creation, and never modified.
+	limit int64
+}
+
+// NewGauge creates and returns a pointer to a new gauge with the specified limit.
+func NewGauge(limit int) *Gauge {
+	return &Gauge{
+		limit: int64(limit),
+	}
+}
+
+// Set updates the current usage for the gauge.
+func (gauge *Gauge) Set(current int) {
+	atomic.StoreInt64(&gauge.current, int64(current))
+}
+
+// Current returns the current usage for the gauge.
+func (gauge *Gauge) Current() int {
+	return int(atomic.LoadInt64(&gauge.current))
+}
+
+// Limit returns the limit for the gauge. Zero (or less) means that there is no limit.
+func (gauge *Gauge) Limit() int {
+	return int(gauge.limit)
+}
+
+// AtCapacity returns true if the gauge has a limit, and the current usage has reached it.
+func (gauge *Gauge) AtCapacity() bool {
+	return gauge.limit > 0 && atomic.LoadInt64(&gauge.current) >= gauge.limit
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package capacity
+
+import "testing"
+
+func TestAtCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		current  int
+		expected bool
+	}{
+		{"Below the limit", 2, 1, false},
+		{"At the limit", 2, 2, true},
+		{"Above the limit", 2, 3, true},
+		{"No limit", 0, 1000, false},
+		{"Negative limit", -1, 1000, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gauge := NewGauge(test.limit)
+			gauge.Set(test.current)
+
+			if gauge.Current() != test.current || gauge.Limit() != test.limit {
+				t.Fatalf("Gauge is %d of %d, expected %d of %d", gauge.Current(), gauge.Limit(), test.current, test.limit)
+			}
+
+			if atCapacity := gauge.AtCapacity(); atCapacity != test.expected {
+				t.Fatalf("AtCapacity returned %v, expected %v", atCapacity, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package debuglog implements debug level logging, which is only written when enabled via the environment.
+package debuglog
+
+import (
+	"log"
+
+	"github.com/6a/blade-ii-game-server/pkg/envvar"
+)
+
+// Enabled is whether debug level log lines are written. Configured via the "debug_logging" environment variable.
+var Enabled = envvar.Bool("debug_logging", false)
+
+// Printf writes a debug level log line, in the same format as log.Printf, if debug logging is enabled.
+func Printf(format string, v ...interface{}) {
+	if !Enabled {
+		return
+	}
+
+	log.Printf("[DEBUG] "+format, v...)
+}
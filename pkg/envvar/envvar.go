@@ -0,0 +1,87 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package envvar implements helper functions for reading optional, typed environment variables.
+package envvar
+
+import (
+	"log"
+	"strconv"
+	"time"
+)
+
+// String returns the value of the specified environment variable. If the variable is not set, or is empty, the
+// fallback value is returned instead.
+func String(name string, fallback string) string {
+
+	// Read the raw value, and return the fallback if it's empty.
+	value := lookup(name)
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// Int returns the value of the specified environment variable as an int. If the variable is not set, or is not a
+// valid int, the fallback value is returned instead.
+func Int(name string, fallback int) int {
+
+	// Read the raw value, and return the fallback if it's empty.
+	raw := lookup(name)
+	if raw == "" {
+		return fallback
+	}
+
+	// Attempt to parse the value - invalid values are logged, and the fallback is returned.
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Environment variable [%s] is not a valid integer - using default value [%v]", name, fallback)
+		return fallback
+	}
+
+	return value
+}
+
+// Duration returns the value of the specified environment variable as a duration (in the format accepted by
+// time.ParseDuration, such as "1m30s"). If the variable is not set, or is not a valid duration, the fallback
+// value is returned instead.
+func Duration(name string, fallback time.Duration) time.Duration {
+
+	// Read the raw value, and return the fallback if it's empty.
+	raw := lookup(name)
+	if raw == "" {
+		return fallback
+	}
+
+	// Attempt to parse the value - invalid values are logged, and the fallback is returned.
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Environment variable [%s] is not a valid duration - using default value [%v]", name, fallback)
+		return fallback
+	}
+
+	return value
+}
+
+// Bool returns the value of the specified environment variable as a bool (in the format accepted by
+// strconv.ParseBool, such as "true" or "1"). If the variable is not set, or is not a valid bool, the fallback value
+// is returned instead.
+func Bool(name string, fallback bool) bool {
+
+	// Read the raw value, and return the fallback if it's empty.
+	raw := lookup(name)
+	if raw == "" {
+		return fallback
+	}
+
+	// Attempt to parse the value - invalid values are logged, and the fallback is returned.
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Environment variable [%s] is not a valid bool - using default value [%v]", name, fallback)
+		return fallback
+	}
+
+	return value
+}
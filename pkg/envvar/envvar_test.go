@@ -0,0 +1,38 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package envvar
+
+import (
+	"testing"
+)
+
+// testVariable is the name of the environment variable that the tests set.
+const testVariable = "envvar_test_variable"
+
+// TestString checks that a string variable is read as is, and that the fallback is used when it is unset or empty.
+func TestString(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"Set", ":8080", ":8080"},
+		{"Empty", "", "fallback"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(testVariable, test.value)
+
+			if value := String(testVariable, "fallback"); value != test.expected {
+				t.Fatalf("Read [%s], expected [%s]", value, test.expected)
+			}
+		})
+	}
+
+	if value := String(testVariable, "fallback"); value != "fallback" {
+		t.Fatalf("Read [%s] while unset, expected the fallback", value)
+	}
+}
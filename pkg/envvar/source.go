@@ -0,0 +1,126 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package envvar implements helper functions for reading optional, typed environment variables.
+package envvar
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+
+	// prefixVariable is the name of the environment variable that contains the prefix for every other variable (such
+	// as "B2_", to read "B2_db_user" rather than "db_user"). It is never prefixed itself.
+	prefixVariable = "b2_env_prefix"
+
+	// fileVariable is the name of the environment variable that contains the path of the .env file to load. It is
+	// never prefixed itself, and can only be set in the process environment.
+	fileVariable = "b2_env_file"
+
+	// defaultFile is the path of the .env file that is loaded if the file variable is not set. It is optional - a
+	// missing file is ignored.
+	defaultFile = ".env"
+)
+
+var (
+
+	// The variables loaded from the .env file, keyed by name. Only written during package initialization.
+	fileValues map[string]string
+
+	// The prefix for every variable. Only written during package initialization.
+	prefix string
+)
+
+// init loads the .env file (if there is one), and then reads the prefix - before any other package can read a
+// variable.
+func init() {
+	path := os.Getenv(fileVariable)
+	explicit := path != ""
+	if !explicit {
+		path = defaultFile
+	}
+
+	values, err := loadFile(path)
+	if err != nil {
+
+		// A missing default file is normal - only a missing file that was asked for is worth logging.
+		if explicit || !os.IsNotExist(err) {
+			log.Printf("Failed to load environment variables from [%s]: %v", path, err)
+		}
+	} else {
+		log.Printf("Loaded %d environment variables from [%s]", len(values), path)
+	}
+
+	fileValues = values
+
+	prefix = os.Getenv(prefixVariable)
+	if prefix == "" {
+		prefix = fileValues[prefixVariable]
+	}
+}
+
+// lookup returns the value of the specified variable, or an empty string if it is not set. The process environment
+// takes precedence over the .env file. If a prefix is configured, the prefixed name is read first - falling back to
+// the bare name, so that variables that are shared between instances don't need to be repeated for each prefix.
+func lookup(name string) string {
+	names := []string{name}
+	if prefix != "" {
+		names = []string{prefix + name, name}
+	}
+
+	for _, candidate := range names {
+		if value := os.Getenv(candidate); value != "" {
+			return value
+		}
+
+		if value := fileValues[candidate]; value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// loadFile reads the variables from the .env file at the specified path. Each line is in the format "name=value" -
+// optionally preceded by "export", with the value optionally wrapped in single or double quotes. Blank lines and lines
+// starting with "#" are ignored.
+func loadFile(path string) (values map[string]string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	values = make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d is not in the format [name=value]", lineNumber)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		values[name] = value
+	}
+
+	return values, scanner.Err()
+}
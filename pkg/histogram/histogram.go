@@ -0,0 +1,94 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package histogram implements a lightweight bucketed histogram, for recording the distribution of values such as
+// durations without keeping every observation.
+package histogram
+
+import (
+	"math"
+	"sort"
+)
+
+// Histogram counts observations in buckets with fixed upper bounds. Values larger than the largest bound are counted
+// in an overflow bucket. Not safe for concurrent use.
+type Histogram struct {
+
+	// The upper bound (inclusive) for each bucket, in ascending order.
+	bounds []float64
+
+	// The number of observations in each bucket. Has one more element than bounds, for the overflow bucket.
+	counts []uint64
+
+	// The total number of observations, and the sum of all observed values.
+	count uint64
+	sum   float64
+}
+
+// New creates and returns a pointer to a new histogram, with the specified bucket upper bounds. The bounds are
+// sorted, so they can be specified in any order.
+func New(bounds ...float64) *Histogram {
+
+	// Copy and sort the bounds, so that the caller's slice is not modified.
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records the specified value.
+func (histogram *Histogram) Observe(value float64) {
+
+	// Find the first bucket whose upper bound is large enough for the value - if there isn't one, this returns the
+	// index of the overflow bucket.
+	index := sort.SearchFloat64s(histogram.bounds, value)
+
+	histogram.counts[index]++
+	histogram.count++
+	histogram.sum += value
+}
+
+// Count returns the number of values that have been observed.
+func (histogram *Histogram) Count() uint64 {
+	return histogram.count
+}
+
+// Mean returns the mean of the values that have been observed, or zero if there are none.
+func (histogram *Histogram) Mean() float64 {
+	if histogram.count == 0 {
+		return 0
+	}
+
+	return histogram.sum / float64(histogram.count)
+}
+
+// Quantile returns an estimate of the specified quantile (between 0 and 1) of the values that have been observed,
+// as the upper bound of the bucket that contains it. Returns positive infinity if the quantile is in the overflow
+// bucket, and zero if no values have been observed.
+func (histogram *Histogram) Quantile(quantile float64) float64 {
+
+	// Nothing to estimate if there are no observations.
+	if histogram.count == 0 {
+		return 0
+	}
+
+	// Determine the rank of the quantile, and then find the bucket that contains it.
+	rank := uint64(math.Ceil(quantile * float64(histogram.count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for index, count := range histogram.counts {
+		cumulative += count
+		if cumulative >= rank && index < len(histogram.bounds) {
+			return histogram.bounds[index]
+		}
+	}
+
+	return math.Inf(1)
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+package histogram
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []float64
+		quantile float64
+		expected float64
+	}{
+		{"No values", nil, 0.5, 0},
+		{"Single value", []float64{3}, 0.5, 5},
+		{"Value on a bound", []float64{5}, 0.5, 5},
+		{"Median", []float64{1, 3, 8, 9}, 0.5, 5},
+		{"95th percentile", []float64{1, 3, 8, 9}, 0.95, 10},
+		{"Zero quantile", []float64{3, 8}, 0, 5},
+		{"Overflow", []float64{1, 11}, 0.95, math.Inf(1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			histogram := New(10, 1, 5)
+			for _, value := range test.values {
+				histogram.Observe(value)
+			}
+
+			if quantile := histogram.Quantile(test.quantile); quantile != test.expected {
+				t.Fatalf("Quantile %v of %v is %v, expected %v", test.quantile, test.values, quantile, test.expected)
+			}
+		})
+	}
+}
+
+func TestMean(t *testing.T) {
+	histogram := New(1, 5, 10)
+	if mean := histogram.Mean(); mean != 0 {
+		t.Fatalf("Mean with no values is %v, expected 0", mean)
+	}
+
+	for _, value := range []float64{1, 3, 8, 20} {
+		histogram.Observe(value)
+	}
+
+	if count, mean := histogram.Count(), histogram.Mean(); count != 4 || mean != 8 {
+		t.Fatalf("Histogram has %d values with a mean of %v, expected 4 with a mean of 8", count, mean)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package iplimit implements a limit on the number of concurrent connections from each IP address, that can be safely
+// shared between goroutines.
+package iplimit
+
+import "sync"
+
+// Limiter tracks the number of live connections from each IP address, against a limit. A limit of zero (or less) means
+// that the number of connections is unlimited.
+type Limiter struct {
+
+	// The number of live connections from each IP address. IP addresses without any connections are removed.
+	counts map[string]int
+
+	// The limit - set on creation, and never modified.
+	limit int
+
+	// Mutex lock to protect the critical section that can occur when reading/writing to counts.
+	lock sync.Mutex
+}
+
+// New creates and returns a pointer to a new limiter with the specified limit.
+func New(limit int) *Limiter {
+	return &Limiter{
+		counts: make(map[string]int),
+		limit:  limit,
+	}
+}
+
+// Acquire counts a new connection from the specified IP address, and returns true - unless the IP address has already
+// reached the limit, in which case the connection is not counted, and false is returned. Every successful call must be
+// matched by a call to Release once the connection is closed.
+func (limiter *Limiter) Acquire(ip string) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if limiter.limit > 0 && limiter.counts[ip] >= limiter.limit {
+		return false
+	}
+
+	limiter.counts[ip]++
+
+	return true
+}
+
+// Release stops counting a connection from the specified IP address, once it has been closed.
+func (limiter *Limiter) Release(ip string) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if limiter.counts[ip] <= 1 {
+		delete(limiter.counts, ip)
+	} else {
+		limiter.counts[ip]--
+	}
+}
+
+// Count returns the number of live connections from the specified IP address.
+func (limiter *Limiter) Count(ip string) int {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	return limiter.counts[ip]
+}
+
+// Limit returns the limit for the limiter. Zero (or less) means that there is no limit.
+func (limiter *Limiter) Limit() int {
+	return limiter.limit
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 James Einosuke Stanton. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE.md file.
+
+// Package maintenance implements a maintenance mode switch, that can be safely shared between goroutines. While
+// maintenance mode is enabled, servers stop starting new work, and report when they have drained - so that the
+// process can be shut down without interrupting anything that's in progress.
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SettingOff is the setting that disables maintenance mode (see Set).
+const SettingOff = "off"
+
+// Mode tracks whether maintenance mode is enabled, along with the planned shutdown time, and which of the servers
+// that share it have drained.
+type Mode struct {
+
+	// Whether maintenance mode is enabled, and the time at which the process is planned to shut down.
+	enabled      bool
+	shutdownTime time.Time
+
+	// The delay until the planned shutdown time, for when maintenance mode is enabled without specifying one. Set on
+	// creation, and never modified.
+	defaultDelay time.Duration
+
+	// Whether each registered server has drained, keyed by server name. Reset whenever maintenance mode is enabled.
+	drained map[string]bool
+
+	// Whether the drained channel has been notified since maintenance mode was last enabled.
+	notified bool
+
+	// Channel that is notified when every registered server has drained, while maintenance mode is enabled.
+	drainedNotify chan struct{}
+
+	// Mutex lock to protect the fields above.
+	lock sync.Mutex
+}
+
+// NewMode creates and returns a pointer to a new maintenance mode switch, which starts disabled. The specified delay
+// is used for the planned shutdown time when maintenance mode is enabled without specifying one.
+func NewMode(defaultDelay time.Duration) *Mode {
+	return &Mode{
+		defaultDelay:  defaultDelay,
+		drained:       make(map[string]bool),
+		drainedNotify: make(chan struct{}, 1),
+	}
+}
+
+// Register adds a server with the specified name to the set of servers that must drain before the drained channel is
+// notified.
+func (mode *Mode) Register(server string) {
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+
+	mode.drained[server] = false
+}
+
+// Enable enables maintenance mode, with the specified planned shutdown time. Every server must report that it has
+// drained again, even if maintenance mode was already enabled.
+func (mode *Mode) Enable(shutdownTime time.Time) {
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+
+	mode.enabled = true
+	mode.shutdownTime = shutdownTime
+	mode.notified = false
+
+	for server := range mode.drained {
+		mode.drained[server] = false
+	}
+}
+
+// Disable disables maintenance mode.
+func (mode *Mode) Disable() {
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+
+	mode.enabled = false
+	mode.shutdownTime = time.Time{}
+}
+
+// Toggle enables maintenance mode (with the default delay until the planned shutdown time) if it is disabled, or
+// disables it if it is enabled. Returns true if maintenance mode is now enabled.
+func (mode *Mode) Toggle(now time.Time) bool {
+	if enabled, _ := mode.State(); enabled {
+		mode.Disable()
+		return false
+	}
+
+	mode.Enable(now.Add(mode.defaultDelay))
+
+	return true
+}
+
+// Set applies the specified setting - either "off", to disable maintenance mode, or the delay until the planned
+// shutdown time (such as "15m"), to enable it. An empty setting enables maintenance mode with the default delay.
+func (mode *Mode) Set(setting string, now time.Time) error {
+	if setting == SettingOff {
+		mode.Disable()
+		return nil
+	}
+
+	delay := mode.defaultDelay
+	if setting != "" {
+		parsed, err := time.ParseDuration(setting)
+		if err != nil || parsed < 0 {
+			return errors.New("Setting must be [off], or the delay until the planned shutdown (such as 15m)")
+		}
+
+		delay = parsed
+	}
+
+	mode.Enable(now.Add(delay))
+
+	return nil
+}
+
+// State returns whether maintenance mode is enabled, and if so, the planned shutdown time.
+func (mode *Mode) State() (enabled bool, shutdownTime time.Time) {
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+
+	return mode.enabled, mode.shutdownTime
+}
+
+// Enabled returns true if maintenance mode is enabled.
+func (mode *Mode) Enabled() bool {
+	enabled, _ := mode.State()
+	return enabled
+}
+
+// ReportDrained records whether the specified server has drained. Once every registered server has drained while
+// maintenance mode is enabled, the drained channel is notified - once per time that maintenance mode is enabled.
+func (mode *Mode) ReportDrained(server string, drained bool) {
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+
+	mode.drained[server] = drained
+
+	if !mode.enabled || mode.notified {
+		return
+	}
+
+	for _, serverDrained := range mode.drained {
+		if !serverDrained {
+			return
+		}
+	}
+
+	mode.notified = true
+
+	select {
+	case mode.drainedNotify <- struct{}{}:
+	default:
+	}
+}
+
+// Drained returns a channel that is notified when every registered server has drained, while maintenance mode is
+// enabled. Maintenance mode may have been disabled since, so check Enabled before acting on it.
+func (mode *Mode) Drained() <-chan struct{} {
+	return mode.drainedNotify
+}
+
+// Announcement returns the message that informs clients of a change to maintenance mode, for the specified state.
+func Announcement(enabled bool, shutdownTime time.Time) string {
+	if !enabled {
+		return "Server maintenance has been cancelled"
+	}
+
+	return fmt.Sprintf("Server maintenance - no new matches will start. Planned shutdown at %s", shutdownTime.UTC().Format(time.RFC3339))
+}
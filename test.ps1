@@ -0,0 +1 @@
+go test -race ./...